@@ -0,0 +1,47 @@
+/*
+Copyright 2019 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake provides a fake stand-in for pkg/fs's per-VM stats, for
+// tests that need deterministic VMFsStats without shelling out to stat
+// or qemu-img.
+package fake
+
+import "github.com/Mirantis/virtlet/pkg/fs"
+
+// FakeVMFsStatter is a fake implementation of a GetFsStatsForVM-like
+// call, returning canned per-container-ID stats instead of touching the
+// filesystem.
+type FakeVMFsStatter struct {
+	// Stats maps a container ID to the VMFsStats Get should return for
+	// it.
+	Stats map[string]fs.VMFsStats
+}
+
+// NewFakeVMFsStatter creates a FakeVMFsStatter with an empty Stats map.
+func NewFakeVMFsStatter() *FakeVMFsStatter {
+	return &FakeVMFsStatter{Stats: make(map[string]fs.VMFsStats)}
+}
+
+// Get returns the VMFsStats previously set for containerID via Set, or
+// a zero value if none was set.
+func (f *FakeVMFsStatter) Get(containerID string) fs.VMFsStats {
+	return f.Stats[containerID]
+}
+
+// Set records the VMFsStats Get should return for containerID.
+func (f *FakeVMFsStatter) Set(containerID string, stats fs.VMFsStats) {
+	f.Stats[containerID] = stats
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2019 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+// VMFsStats is per-VM disk usage, as opposed to the aggregate
+// filesystem usage GetFsStatsForPath returns. It's granular enough for
+// kubelet's per-container stats (eviction decisions, "kubectl top").
+type VMFsStats struct {
+	// OverlayBytes is the qcow2 overlay file's actual on-disk size
+	// (stat's st_blocks * 512), not its apparent/virtual size - a
+	// sparse or thinly-provisioned overlay can be far smaller on disk
+	// than the size reported by its qcow2 header.
+	OverlayBytes uint64
+	// InodeCount is the number of inodes under the VM's per-container
+	// directory (domainRoot), found with a bounded walk.
+	InodeCount uint64
+	// BackingChainBytes is the summed on-disk size of imageFile's qcow2
+	// backing-file chain, as reported by `qemu-img info
+	// --backing-chain`. It's left zero if qemu-img isn't available or
+	// the image has no backing chain, since the request that added this
+	// field treats it as optional.
+	BackingChainBytes uint64
+}
@@ -0,0 +1,124 @@
+// +build linux
+
+/*
+Copyright 2019 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// errWalkBoundHit is returned internally by countInodes's Walk callback
+// once maxInodeWalkEntries is reached, to stop filepath.Walk early
+// without treating the early stop as a failure.
+var errWalkBoundHit = errors.New("fs: inode walk bound reached")
+
+// maxInodeWalkEntries bounds how many directory entries
+// GetFsStatsForVM's inode walk will count, so a VM directory containing
+// an unexpectedly large tree can't make a stats call arbitrarily slow.
+const maxInodeWalkEntries = 100000
+
+// GetFsStatsForVM returns per-VM disk usage for a single container's
+// qcow2 overlay (imageFile) and its per-container directory
+// (domainRoot), for use in CRI per-container filesystem stats.
+func GetFsStatsForVM(domainRoot, imageFile string) (VMFsStats, error) {
+	var stats VMFsStats
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(imageFile, &st); err != nil {
+		return stats, err
+	}
+	stats.OverlayBytes = uint64(st.Blocks) * 512
+
+	inodes, err := countInodes(domainRoot)
+	if err != nil {
+		return stats, err
+	}
+	stats.InodeCount = inodes
+
+	if chainBytes, err := backingChainBytes(imageFile); err != nil {
+		glog.V(4).Infof("GetFsStatsForVM: backing-chain size for %s unavailable: %v", imageFile, err)
+	} else {
+		stats.BackingChainBytes = chainBytes
+	}
+
+	return stats, nil
+}
+
+// countInodes walks root, counting at most maxInodeWalkEntries entries
+// (including root itself).
+func countInodes(root string) (uint64, error) {
+	var count uint64
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		count++
+		if count >= maxInodeWalkEntries {
+			return errWalkBoundHit
+		}
+		return nil
+	})
+	if err != nil && err != errWalkBoundHit {
+		return 0, err
+	}
+	return count, nil
+}
+
+// qemuImgBackingChainEntry is the subset of `qemu-img info
+// --backing-chain --output=json` this package reads.
+type qemuImgBackingChainEntry struct {
+	ActualSize int64 `json:"actual-size"`
+}
+
+// backingChainBytes sums the on-disk size of imageFile's full qcow2
+// backing-file chain via qemu-img. It returns an error (rather than a
+// zero result) whenever qemu-img can't be run or its output can't be
+// parsed, so GetFsStatsForVM can log and treat the field as unavailable
+// instead of silently reporting zero as if there were no backing chain.
+func backingChainBytes(imageFile string) (uint64, error) {
+	out, err := exec.Command("qemu-img", "info", "--backing-chain", "--output=json", imageFile).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []qemuImgBackingChainEntry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return 0, err
+	}
+
+	// The first entry describes imageFile itself, already counted as
+	// OverlayBytes; only the entries after it are backing files.
+	if len(entries) > 0 {
+		entries = entries[1:]
+	}
+
+	var total uint64
+	for _, e := range entries {
+		if e.ActualSize > 0 {
+			total += uint64(e.ActualSize)
+		}
+	}
+	return total, nil
+}
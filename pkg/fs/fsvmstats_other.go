@@ -0,0 +1,28 @@
+// +build !linux
+
+/*
+Copyright 2019 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fs
+
+import "fmt"
+
+// GetFsStatsForVM is not supported outside Linux, matching
+// fsstat_linux.go's GetFsStatsForPath build-tag split: the st_blocks
+// accounting this package relies on is a Linux-specific syscall detail.
+func GetFsStatsForVM(domainRoot, imageFile string) (VMFsStats, error) {
+	return VMFsStats{}, fmt.Errorf("fs: GetFsStatsForVM is not supported on this platform")
+}
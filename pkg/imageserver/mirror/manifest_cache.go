@@ -0,0 +1,120 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Mirantis/virtlet/pkg/metadata"
+)
+
+// manifestCacheBucket is the CacheStore bucket ManifestCache keys every
+// entry under, namespaced by Reference.
+const manifestCacheBucket = "manifest-cache"
+
+// ManifestCacheEntry records one previously-resolved image tag, so a
+// repeated pod creation for the same tag can skip a full manifest GET.
+// It's the record ManifestCache persists, keyed by Reference, in a
+// pkg/metadata.CacheStore bucket.
+type ManifestCacheEntry struct {
+	// Reference is the image reference this entry resolves, e.g.
+	// "docker.io/library/alpine:3.18".
+	Reference string
+	// Digest is the resolved manifest digest, e.g. "sha256:...".
+	Digest string
+	// LocalImage is where the pulled image landed on this host, for the
+	// caller to reuse instead of pulling again.
+	LocalImage string
+	// ETag is the registry's ETag for the manifest GET that produced
+	// Digest, so a future lookup can be done as a conditional GET
+	// instead of re-fetching the full manifest.
+	ETag string
+	// ResolvedAt is when this entry was written.
+	ResolvedAt time.Time
+	// TTL is how long ResolvedAt stays valid; zero means the configured
+	// default TTL applies (see Expired).
+	TTL time.Duration
+}
+
+// defaultManifestTTL is used by Expired when an entry doesn't specify
+// its own TTL.
+const defaultManifestTTL = 5 * time.Minute
+
+// Expired reports whether e should be treated as stale as of now, and
+// its manifest re-fetched rather than trusted.
+func (e ManifestCacheEntry) Expired(now time.Time) bool {
+	ttl := e.TTL
+	if ttl <= 0 {
+		ttl = defaultManifestTTL
+	}
+	return now.After(e.ResolvedAt.Add(ttl))
+}
+
+// ManifestCache persists ManifestCacheEntry records in a
+// pkg/metadata.CacheStore, so a resolved manifest digest survives a
+// process restart instead of being re-fetched on every pull.
+type ManifestCache struct {
+	store metadata.CacheStore
+	now   func() time.Time
+}
+
+// NewManifestCache wraps store as a ManifestCache.
+func NewManifestCache(store metadata.CacheStore) *ManifestCache {
+	return &ManifestCache{store: store, now: time.Now}
+}
+
+// Get returns the cached entry for reference, if one exists and isn't
+// Expired as of now. An expired entry is treated the same as a missing
+// one (ok == false) rather than an error, since the caller's only
+// recourse in either case is to re-fetch the manifest.
+func (c *ManifestCache) Get(reference string) (ManifestCacheEntry, bool, error) {
+	data, ok, err := c.store.Get(manifestCacheBucket, reference)
+	if err != nil || !ok {
+		return ManifestCacheEntry{}, false, err
+	}
+
+	var entry ManifestCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return ManifestCacheEntry{}, false, fmt.Errorf("mirror: decoding cached manifest for %q: %v", reference, err)
+	}
+	if entry.Expired(c.now()) {
+		return ManifestCacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// Put records entry, keyed by entry.Reference, overwriting any existing
+// entry for the same reference.
+func (c *ManifestCache) Put(entry ManifestCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("mirror: encoding manifest cache entry for %q: %v", entry.Reference, err)
+	}
+	return c.store.Put(manifestCacheBucket, entry.Reference, data)
+}
+
+// Invalidate drops the cached entry for reference, regardless of
+// whether it's expired yet. The CRI calls this whenever it has
+// out-of-band knowledge that a cached digest may no longer be current -
+// e.g. RemoveImage for reference, or an ImageFsInfo sweep that found
+// reference's LocalImage missing from disk - rather than waiting for
+// the TTL to lapse on its own.
+func (c *ManifestCache) Invalidate(reference string) error {
+	return c.store.Delete(manifestCacheBucket, reference)
+}
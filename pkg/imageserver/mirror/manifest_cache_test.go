@@ -0,0 +1,97 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mirantis/virtlet/pkg/metadata"
+)
+
+func newTestManifestCache(t *testing.T) *ManifestCache {
+	store, err := metadata.NewCacheStore("mem://")
+	if err != nil {
+		t.Fatalf("metadata.NewCacheStore(\"mem://\"): %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return NewManifestCache(store)
+}
+
+func TestManifestCacheGetPut(t *testing.T) {
+	c := newTestManifestCache(t)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if _, ok, err := c.Get("docker.io/library/alpine:3.18"); err != nil || ok {
+		t.Fatalf("Get on empty cache: got (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+
+	entry := ManifestCacheEntry{
+		Reference:  "docker.io/library/alpine:3.18",
+		Digest:     "sha256:abc",
+		LocalImage: "/var/lib/virtlet/images/alpine",
+		ResolvedAt: now,
+	}
+	if err := c.Put(entry); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, ok, err := c.Get(entry.Reference)
+	if err != nil || !ok {
+		t.Fatalf("Get after put: got (ok=%v, err=%v), want (true, nil)", ok, err)
+	}
+	if got.Digest != entry.Digest || got.LocalImage != entry.LocalImage {
+		t.Fatalf("Get after put: got %+v, want %+v", got, entry)
+	}
+}
+
+func TestManifestCacheExpired(t *testing.T) {
+	c := newTestManifestCache(t)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	entry := ManifestCacheEntry{
+		Reference:  "docker.io/library/alpine:3.18",
+		Digest:     "sha256:abc",
+		ResolvedAt: now.Add(-2 * defaultManifestTTL),
+	}
+	if err := c.Put(entry); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, ok, err := c.Get(entry.Reference); err != nil || ok {
+		t.Fatalf("Get of an expired entry: got (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+}
+
+func TestManifestCacheInvalidate(t *testing.T) {
+	c := newTestManifestCache(t)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	entry := ManifestCacheEntry{Reference: "docker.io/library/alpine:3.18", Digest: "sha256:abc", ResolvedAt: now}
+	if err := c.Put(entry); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := c.Invalidate(entry.Reference); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, ok, err := c.Get(entry.Reference); err != nil || ok {
+		t.Fatalf("Get after Invalidate: got (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+}
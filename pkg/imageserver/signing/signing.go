@@ -0,0 +1,155 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signing mints and verifies signed, expirable tokens for
+// virtlet's HTTP serving of cloud-init ISOs, kernel/initrd artifacts and
+// injected SSH keys, so a process on the host that merely shares the
+// virtlet network namespace (e.g. another tenant's pod) can't fetch
+// another pod's boot artifacts by guessing paths. It borrows the
+// secretbox.Seal/Open pattern from go.universe.tf/netboot/pixiecore's
+// signURL/getURL, prepending an 8-byte big-endian Unix expiry to the
+// plaintext before sealing so Open can reject an expired token without
+// touching storage.
+package signing
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// KeySize is the size, in bytes, of a signing key.
+const KeySize = 32
+
+// maxPreviousKeys bounds how many retired keys Open still tries, so a slow
+// rotator can't make token verification arbitrarily expensive.
+const maxPreviousKeys = 4
+
+// Key is a 32-byte secretbox key.
+type Key [KeySize]byte
+
+// GenerateKey returns a new random signing key, suitable for Signer's
+// initial key at virtlet start.
+func GenerateKey() (Key, error) {
+	var k Key
+	if _, err := io.ReadFull(rand.Reader, k[:]); err != nil {
+		return k, fmt.Errorf("signing: generating key: %v", err)
+	}
+	return k, nil
+}
+
+// Signer mints and verifies signed, expirable URL tokens. It keeps a small
+// LRU of previously active keys so that tokens minted just before a
+// rotation remain valid until they expire, instead of being invalidated by
+// the rotation itself.
+type Signer struct {
+	mu       sync.RWMutex
+	current  Key
+	previous []Key // most-recently-active first, capped at maxPreviousKeys
+}
+
+// NewSigner creates a Signer whose current key is key.
+func NewSigner(key Key) *Signer {
+	return &Signer{current: key}
+}
+
+// RotateKey makes key the current signing key, retiring the previous
+// current key to the front of the LRU of keys Open still tries.
+func (s *Signer) RotateKey(key Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.previous = append([]Key{s.current}, s.previous...)
+	if len(s.previous) > maxPreviousKeys {
+		s.previous = s.previous[:maxPreviousKeys]
+	}
+	s.current = key
+}
+
+// Sign returns a token encoding url, valid until ttl elapses.
+func (s *Signer) Sign(url string, ttl time.Duration) (string, error) {
+	s.mu.RLock()
+	key := s.current
+	s.mu.RUnlock()
+	return seal(url, ttl, &key)
+}
+
+// Open recovers the URL encoded by token, returning an error if token is
+// malformed, doesn't verify against the current key or any retired key
+// still in the LRU, or has expired.
+func (s *Signer) Open(token string) (string, error) {
+	s.mu.RLock()
+	keys := append([]Key{s.current}, s.previous...)
+	s.mu.RUnlock()
+
+	var lastErr error
+	for i := range keys {
+		url, err := open(token, &keys[i])
+		if err == nil {
+			return url, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func seal(url string, ttl time.Duration, key *Key) (string, error) {
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", fmt.Errorf("signing: reading nonce randomness: %v", err)
+	}
+
+	plaintext := make([]byte, 8, 8+len(url))
+	binary.BigEndian.PutUint64(plaintext, uint64(time.Now().Add(ttl).Unix()))
+	plaintext = append(plaintext, url...)
+
+	out := nonce[:]
+	out = secretbox.Seal(out, plaintext, &nonce, (*[32]byte)(key))
+	return base64.URLEncoding.EncodeToString(out), nil
+}
+
+func open(token string, key *Key) (string, error) {
+	signed, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	if len(signed) < 24 {
+		return "", errors.New("signing: token too short to be valid")
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], signed)
+	plaintext, ok := secretbox.Open(nil, signed[24:], &nonce, (*[32]byte)(key))
+	if !ok {
+		return "", errors.New("signing: signature verification failed")
+	}
+	if len(plaintext) < 8 {
+		return "", errors.New("signing: token missing expiry")
+	}
+
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(plaintext[:8])), 0)
+	if time.Now().After(expiry) {
+		return "", errors.New("signing: token expired")
+	}
+	return string(plaintext[8:]), nil
+}
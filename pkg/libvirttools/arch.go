@@ -0,0 +1,111 @@
+/*
+Copyright 2020 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package libvirttools
+
+import (
+	"runtime"
+
+	"github.com/golang/glog"
+)
+
+// GuestArch identifies a VM guest's CPU architecture, as requested via the
+// pod's guest-arch annotation (config.ParsedAnnotations.Arch, parsed the
+// same way config.ParsedAnnotations.UEFI/CPUModel/SystemUUID already are in
+// CreateContainer) or, if that's left unset, this node's own architecture
+// (see hostGuestArch).
+type GuestArch string
+
+const (
+	// ArchAMD64 is the libvirt/QEMU architecture name for x86_64 guests.
+	ArchAMD64 GuestArch = "x86_64"
+	// ArchARM64 is the libvirt/QEMU architecture name for aarch64/arm64
+	// guests.
+	ArchARM64 GuestArch = "aarch64"
+)
+
+const (
+	noKvmEmulatorAMD64 = "/usr/bin/qemu-system-x86_64"
+	noKvmEmulatorARM64 = "/usr/bin/qemu-system-aarch64"
+
+	// ovmfCodePathARM64/ovmfVarsTemplatePathARM64 are AAVMF's installed
+	// paths - the aarch64 build of the same TianoCore OVMF firmware,
+	// packaged under a different name by most distros.
+	ovmfCodePathARM64         = "/usr/share/AAVMF/AAVMF_CODE.fd"
+	ovmfVarsTemplatePathARM64 = "/usr/share/AAVMF/AAVMF_VARS.fd"
+)
+
+// archConfig bundles the architecture-specific pieces createDomain needs:
+// the QEMU system emulator to fall back to when KVM acceleration isn't
+// usable, the libvirt machine type to define the domain with, and the
+// UEFI firmware paths to use when the pod requests UEFI boot.
+type archConfig struct {
+	noKvmEmulator        string
+	machine              string
+	ovmfCodePath         string
+	ovmfVarsTemplatePath string
+}
+
+// archConfigs covers every GuestArch this package supports. aarch64 has no
+// legacy BIOS equivalent to SeaBIOS, so an aarch64 pod needs
+// VirtletBootMode=efi set explicitly - resolveBootMode's BootModeBIOS
+// default isn't arch-aware. The OVMF/AAVMF firmware paths are recorded
+// here regardless of arch so createDomain doesn't need a separate
+// arch-specific branch for the EFI case.
+var archConfigs = map[GuestArch]archConfig{
+	ArchAMD64: {
+		noKvmEmulator: noKvmEmulatorAMD64,
+		// "pc" (libvirt/QEMU's default x86_64 machine type) is fine
+		// unmodified, so Machine is left empty here rather than set to
+		// the literal default.
+		machine:              "",
+		ovmfCodePath:         ovmfCodePath,
+		ovmfVarsTemplatePath: ovmfVarsTemplatePath,
+	},
+	ArchARM64: {
+		noKvmEmulator:        noKvmEmulatorARM64,
+		machine:              "virt",
+		ovmfCodePath:         ovmfCodePathARM64,
+		ovmfVarsTemplatePath: ovmfVarsTemplatePathARM64,
+	},
+}
+
+// hostGuestArch maps runtime.GOARCH to the GuestArch createDomain expects,
+// for CreateContainer to fall back to when a pod doesn't request a guest
+// arch explicitly via annotation. KVM acceleration is always same-arch
+// (there's no such thing as a KVM-accelerated aarch64 guest on an amd64
+// host or vice versa), so this is also what CreateContainer compares a
+// requested arch against to decide whether KVM can stay enabled.
+func hostGuestArch() GuestArch {
+	switch runtime.GOARCH {
+	case "arm64":
+		return ArchARM64
+	default:
+		return ArchAMD64
+	}
+}
+
+// resolveArchConfig looks up arch's archConfig, falling back to
+// ArchAMD64's (and that arch) for anything unrecognized, e.g. a typo in
+// the pod's guest-arch annotation, logging why rather than silently
+// booting the wrong firmware/machine type.
+func resolveArchConfig(arch GuestArch) (GuestArch, archConfig) {
+	if cfg, ok := archConfigs[arch]; ok {
+		return arch, cfg
+	}
+	glog.Warningf("unknown guest arch %q, falling back to %s", arch, ArchAMD64)
+	return ArchAMD64, archConfigs[ArchAMD64]
+}
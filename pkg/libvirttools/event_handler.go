@@ -17,13 +17,149 @@ limitations under the License.
 package libvirttools
 
 import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/Mirantis/virtlet/pkg/metadata"
 	"github.com/Mirantis/virtlet/pkg/metadata/types"
 	"github.com/golang/glog"
 	"github.com/libvirt/libvirt-go"
-	"time"
 )
 
+// DomainLifecycleEvent carries one libvirt domain lifecycle notification
+// (VIR_DOMAIN_EVENT_ID_LIFECYCLE), translated out of libvirt-go's
+// *libvirt.DomainEventLifecycle so callers waiting on it don't need to
+// import libvirt-go themselves.
+type DomainLifecycleEvent struct {
+	Event  libvirt.DomainEventType
+	Detail int
+}
+
+// ExitReason classifies why a domain most recently stopped, as reported by
+// libvirt's VIR_DOMAIN_EVENT_STOPPED/VIR_DOMAIN_EVENT_SHUTDOWN event detail,
+// so a caller like VirtualizationTool.WaitForExit can tell a crash apart
+// from a graceful shutdown instead of only seeing virt.DomainStateShutoff
+// either way.
+type ExitReason string
+
+const (
+	ExitReasonUnknown   ExitReason = "unknown"
+	ExitReasonShutdown  ExitReason = "shutdown"
+	ExitReasonDestroyed ExitReason = "destroyed"
+	ExitReasonCrashed   ExitReason = "crashed"
+	ExitReasonMigrated  ExitReason = "migrated"
+	ExitReasonSaved     ExitReason = "saved"
+	ExitReasonFailed    ExitReason = "failed"
+)
+
+// exitReasonForStoppedEvent classifies a VIR_DOMAIN_EVENT_STOPPED event's
+// detail code. Non-STOPPED events have no defined exit reason.
+func exitReasonForStoppedEvent(detail int) ExitReason {
+	switch libvirt.DomainEventStoppedDetailType(detail) {
+	case libvirt.DOMAIN_EVENT_STOPPED_SHUTDOWN:
+		return ExitReasonShutdown
+	case libvirt.DOMAIN_EVENT_STOPPED_DESTROYED:
+		return ExitReasonDestroyed
+	case libvirt.DOMAIN_EVENT_STOPPED_CRASHED:
+		return ExitReasonCrashed
+	case libvirt.DOMAIN_EVENT_STOPPED_MIGRATED:
+		return ExitReasonMigrated
+	case libvirt.DOMAIN_EVENT_STOPPED_SAVED:
+		return ExitReasonSaved
+	case libvirt.DOMAIN_EVENT_STOPPED_FAILED:
+		return ExitReasonFailed
+	default:
+		return ExitReasonUnknown
+	}
+}
+
+// domainLifecycleWaiters fans out DomainLifecycleEvents, as they arrive on
+// the single libvirt event loop goroutine started by RegisterEventCallBacks,
+// to whoever is waiting on a particular domain's next transition, keyed by
+// domain UUID. It lets callers such as VirtualizationTool.startContainer
+// react to e.g. a crash immediately instead of only noticing it on the next
+// poll of utils.WaitLoop.
+//
+// It also remembers, per domain UUID, the ExitReason of the last
+// VIR_DOMAIN_EVENT_STOPPED event it saw, so a caller that wasn't actively
+// waiting at the moment the domain stopped (e.g. WaitForExit, called after
+// the fact) can still retrieve why.
+type domainLifecycleWaiters struct {
+	mu          sync.Mutex
+	waiters     map[string][]chan DomainLifecycleEvent
+	exitReasons map[string]ExitReason
+}
+
+func newDomainLifecycleWaiters() *domainLifecycleWaiters {
+	return &domainLifecycleWaiters{
+		waiters:     make(map[string][]chan DomainLifecycleEvent),
+		exitReasons: make(map[string]ExitReason),
+	}
+}
+
+// LastExitReason returns the ExitReason of the last VIR_DOMAIN_EVENT_STOPPED
+// event observed for domainUUID, and false if none has been observed yet
+// (e.g. the domain hasn't stopped since this process started, or w is nil).
+func (w *domainLifecycleWaiters) LastExitReason(domainUUID string) (ExitReason, bool) {
+	if w == nil {
+		return ExitReasonUnknown, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	reason, ok := w.exitReasons[domainUUID]
+	return reason, ok
+}
+
+// Wait registers a channel that receives the next DomainLifecycleEvent
+// delivered for domainUUID. The returned cancel function must be called
+// once the caller is done waiting, typically via defer, whether or not it
+// ended up reading from the channel, so the waiter list doesn't leak.
+func (w *domainLifecycleWaiters) Wait(domainUUID string) (<-chan DomainLifecycleEvent, func()) {
+	ch := make(chan DomainLifecycleEvent, 1)
+	w.mu.Lock()
+	w.waiters[domainUUID] = append(w.waiters[domainUUID], ch)
+	w.mu.Unlock()
+
+	cancel := func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		chans := w.waiters[domainUUID]
+		for i, c := range chans {
+			if c == ch {
+				w.waiters[domainUUID] = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		if len(w.waiters[domainUUID]) == 0 {
+			delete(w.waiters, domainUUID)
+		}
+	}
+	return ch, cancel
+}
+
+// notify delivers event to every channel currently waiting on domainUUID,
+// without blocking: a waiter whose buffer is already full simply misses
+// this particular event and falls back to whatever polling/timeout its
+// caller uses, which is the same degraded behavior callers have today.
+func (w *domainLifecycleWaiters) notify(domainUUID string, event DomainLifecycleEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if event.Event == libvirt.DOMAIN_EVENT_STOPPED {
+		w.exitReasons[domainUUID] = exitReasonForStoppedEvent(event.Detail)
+	}
+	for _, ch := range w.waiters[domainUUID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
 // handle libvirt domain events
 // currently it is merely for the memory device add/remove event to avoid repeated calls of
 // UpdateContainerResources() from kubelet while a resource updating is in progress
@@ -32,13 +168,31 @@ type eventHandler struct {
 	uri       string
 	conn      *libvirt.Connect
 	metaStore metadata.ContainerStore
+	waiters   *domainLifecycleWaiters
+	pipeline  *eventPipeline
+}
+
+// Waiters returns the eventHandler's domainLifecycleWaiters, letting a
+// VirtualizationTool register for a given domain's next lifecycle event
+// instead of only polling with utils.WaitLoop. Returns nil if h is nil,
+// which happens when NewEventHandler couldn't connect to libvirt.
+func (h *eventHandler) Waiters() *domainLifecycleWaiters {
+	if h == nil {
+		return nil
+	}
+	return h.waiters
 }
 
 func init() {
 	libvirt.EventRegisterDefaultImpl()
 }
 
-func NewEventHandler(uri string, store metadata.Store) *eventHandler {
+// NewEventHandler connects to uri and returns an eventHandler ready to
+// have RegisterEventCallBacks called on it. sink receives every normalized
+// DomainEvent the handler produces (lifecycle and device events alike);
+// pass NoopEventSink{} (or nil) if nothing outside this process needs to
+// react to them.
+func NewEventHandler(uri string, store metadata.Store, sink EventSink) *eventHandler {
 	conn, err := libvirt.NewConnect(uri)
 	if err != nil {
 		glog.Errorf("failed to connect to %v", uri)
@@ -49,6 +203,24 @@ func NewEventHandler(uri string, store metadata.Store) *eventHandler {
 		uri:       uri,
 		conn:      conn,
 		metaStore: store,
+		waiters:   newDomainLifecycleWaiters(),
+		pipeline:  newEventPipeline(store, sink),
+	}
+}
+
+// Shutdown stops the eventHandler's worker pipeline, letting every event
+// already queued finish being reconciled (see eventPipeline.Shutdown), and
+// only then closes the libvirt connection. It's a no-op on a nil handler,
+// matching Waiters' nil-receiver convention, so callers that hold a possibly
+// absent eventHandler (NewEventHandler returns nil on connection failure)
+// don't need a separate nil check.
+func (h *eventHandler) Shutdown() {
+	if h == nil {
+		return
+	}
+	h.pipeline.Shutdown()
+	if h.conn != nil {
+		h.conn.Close()
 	}
 }
 
@@ -59,8 +231,15 @@ func (h *eventHandler) RegisterEventCallBacks() error {
 	var err error
 
 	if callbackId, err = h.conn.DomainEventLifecycleRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
-		id, _ := d.GetUUIDString()
-		glog.V(4).Infof("debug changes on Domain ID %v", id)
+		id, err := d.GetUUIDString()
+		if err != nil {
+			glog.Errorf("failed to get UUID of domain reporting lifecycle event: %v", err)
+			return
+		}
+		glog.V(4).Infof("domain %v lifecycle event %v, detail %v", id, event.Event, event.Detail)
+		lifecycleEvent := DomainLifecycleEvent{Event: event.Event, Detail: event.Detail}
+		h.waiters.notify(id, lifecycleEvent)
+		h.pipeline.SubmitLifecycle(d, lifecycleEvent)
 
 	}); err != nil {
 		return err
@@ -69,7 +248,7 @@ func (h *eventHandler) RegisterEventCallBacks() error {
 
 	if callbackId, err = h.conn.DomainEventDeviceAddedRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventDeviceAdded) {
 		glog.V(4).Infof("Device added. DevAlias :%v", event.DevAlias)
-		handleMemoryDeviceAddRemove(d, h.metaStore)
+		h.pipeline.Submit(d, DomainEventKindDeviceAdded, event.DevAlias)
 
 	}); err != nil {
 		return err
@@ -78,7 +257,7 @@ func (h *eventHandler) RegisterEventCallBacks() error {
 
 	if callbackId, err = h.conn.DomainEventDeviceRemovedRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventDeviceRemoved) {
 		glog.V(4).Infof("Device removed. DevAlias :%v; string: %v", event.DevAlias, event.String())
-		handleMemoryDeviceAddRemove(d, h.metaStore)
+		h.pipeline.Submit(d, DomainEventKindDeviceRemoved, event.DevAlias)
 
 	}); err != nil {
 		return err
@@ -88,7 +267,7 @@ func (h *eventHandler) RegisterEventCallBacks() error {
 	// if async hotplug/unplug failed, release the lock so kubelet retry can get in
 	if callbackId, err = h.conn.DomainEventDeviceRemovalFailedRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventDeviceRemovalFailed) {
 		glog.V(4).Infof("Device removal failed. DevAlias :%v", event.DevAlias)
-		handleMemoryDeviceAddRemove(d, h.metaStore)
+		h.pipeline.Submit(d, DomainEventKindDeviceRemovalFailed, event.DevAlias)
 	}); err != nil {
 		return err
 	}
@@ -106,40 +285,367 @@ func (h *eventHandler) RegisterEventCallBacks() error {
 	return nil
 }
 
-// take actions needed in the callback functions
-// keep synchronized pattern to reduce complexity for now
-// post 830, a channel can be added here to perform those actions
-func handleMemoryDeviceAddRemove(d *libvirt.Domain, metaStore metadata.ContainerStore) error {
+// ResourceKind identifies which kind of hot-pluggable resource a libvirt
+// device-added/-removed/-removal-failed event's DevAlias refers to, so
+// eventPipeline.process can route it to the reconciler for that resource
+// (and so ContainerInfo.Config.ResourceUpdateInProgress, a per-kind flag
+// keyed by ResourceKind rather than the single global bool it used to be,
+// can be cleared independently per kind instead of one resource's update
+// racing another's in-progress flag).
+type ResourceKind string
+
+const (
+	ResourceKindMemory ResourceKind = "memory"
+	ResourceKindCPU    ResourceKind = "cpu"
+	ResourceKindDisk   ResourceKind = "disk"
+	ResourceKindNIC    ResourceKind = "nic"
+)
+
+// classifyDevAlias maps a libvirt device alias to the ResourceKind it
+// belongs to, using libvirt's own auto-generated alias prefixes (the
+// domain definitions this package creates don't set explicit <alias>
+// elements, so libvirt always names devices this way): "dimm*" for
+// hotplugged memory devices, "vcpu*" for hotplugged vCPUs, "net*" for
+// NICs, and "virtio-disk*"/"scsi*"/"ide*" for disks. Returns ok=false for
+// anything else (e.g. a device kind this package doesn't track), so the
+// caller can skip it instead of guessing.
+func classifyDevAlias(alias string) (kind ResourceKind, ok bool) {
+	switch {
+	case strings.HasPrefix(alias, "dimm"):
+		return ResourceKindMemory, true
+	case strings.HasPrefix(alias, "vcpu"):
+		return ResourceKindCPU, true
+	case strings.HasPrefix(alias, "net"):
+		return ResourceKindNIC, true
+	case strings.HasPrefix(alias, "virtio-disk"), strings.HasPrefix(alias, "scsi"), strings.HasPrefix(alias, "ide"):
+		return ResourceKindDisk, true
+	default:
+		return "", false
+	}
+}
+
+const (
+	// eventPipelineShardCount is the number of worker goroutines (and
+	// their backing channels) eventPipeline starts. Events for a given
+	// domain UUID always hash to the same shard (see eventPipeline.shardFor),
+	// so that domain's device events are always processed in the order
+	// they were delivered, while different domains' events are reconciled
+	// concurrently across shards.
+	eventPipelineShardCount = 8
+	// eventPipelineShardCapacity bounds how many not-yet-processed events
+	// each shard's channel will buffer before Submit starts dropping new
+	// ones (see eventPipeline.overflowCount) rather than blocking the
+	// libvirt event-loop goroutine that calls it.
+	eventPipelineShardCapacity = 64
+	// reconcileMaxAttempts bounds reconcileResource's retry-with-backoff
+	// loop: a metaStore error is usually a transient BoltDB contention
+	// issue (another goroutine holding the same container's bucket lock),
+	// not a permanent failure, so it's worth a few retries before giving
+	// up and logging.
+	reconcileMaxAttempts = 5
+	// reconcileBackoffBase is the delay before the first retry; each
+	// subsequent retry doubles it.
+	reconcileBackoffBase = 100 * time.Millisecond
+)
+
+// deviceEvent is what a libvirt lifecycle/device-added/-removed/-removal-
+// failed callback hands off to eventPipeline.Submit/SubmitLifecycle: just
+// enough to reconcile and emit later, off the libvirt event-loop goroutine.
+type deviceEvent struct {
+	domain     *libvirt.Domain
+	domainUUID string
+	// eventKind is the DomainEventKind this event will be emitted as.
+	// DomainEventKindLifecycle events carry lifecycle (and leave devAlias
+	// empty); the three device kinds carry devAlias instead.
+	eventKind DomainEventKind
+	devAlias  string
+	lifecycle DomainLifecycleEvent
+}
+
+// eventPipeline decouples libvirt's event-loop goroutine (which must return
+// quickly, or EventRunDefaultImpl starts dropping events under load) from
+// the actual metadata reconciliation, which can block on BoltDB and is slow
+// enough that running it inline isn't safe. Submit is called synchronously
+// from the event-loop goroutine and only does a non-blocking channel send;
+// a fixed pool of per-shard workers does the real work, sharded by domain
+// UUID so one domain's events are serialized relative to each other while
+// different domains proceed in parallel.
+type eventPipeline struct {
+	metaStore     metadata.ContainerStore
+	sink          EventSink
+	shards        []chan deviceEvent
+	wg            sync.WaitGroup
+	closed        int32
+	overflowCount uint64
+}
+
+// newEventPipeline starts eventPipelineShardCount worker goroutines backed
+// by bounded per-shard channels, ready to accept events via Submit. Events
+// are, once reconciled, normalized into a DomainEvent and handed to sink;
+// a nil sink is treated as NoopEventSink{}.
+func newEventPipeline(metaStore metadata.ContainerStore, sink EventSink) *eventPipeline {
+	if sink == nil {
+		sink = NoopEventSink{}
+	}
+	p := &eventPipeline{
+		metaStore: metaStore,
+		sink:      sink,
+		shards:    make([]chan deviceEvent, eventPipelineShardCount),
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan deviceEvent, eventPipelineShardCapacity)
+		p.wg.Add(1)
+		go p.worker(p.shards[i])
+	}
+	return p
+}
+
+// shardFor picks the worker shard responsible for domainUUID, using FNV-1a
+// so the same domain always lands on the same shard for the lifetime of
+// this eventPipeline.
+func (p *eventPipeline) shardFor(domainUUID string) chan deviceEvent {
+	h := fnv.New32a()
+	h.Write([]byte(domainUUID))
+	return p.shards[h.Sum32()%uint32(len(p.shards))]
+}
+
+// Submit hands a device event off to its shard's worker without blocking.
+// eventKind must be one of the three DomainEventKindDevice* kinds. If that
+// shard's queue is full (the worker is behind, or stuck on a metaStore
+// retry loop), the event is dropped and counted in overflowCount rather
+// than blocking the caller, which is always the libvirt event-loop
+// goroutine started by RegisterEventCallBacks. Submit is a no-op once
+// Shutdown has been called.
+func (p *eventPipeline) Submit(d *libvirt.Domain, eventKind DomainEventKind, devAlias string) {
+	p.enqueue(d, deviceEvent{eventKind: eventKind, devAlias: devAlias}, devAlias)
+}
+
+// SubmitLifecycle hands a domain lifecycle event off to its shard's
+// worker, the same way Submit does for device events, so the event-loop
+// goroutine that calls it never blocks on sink delivery.
+func (p *eventPipeline) SubmitLifecycle(d *libvirt.Domain, event DomainLifecycleEvent) {
+	p.enqueue(d, deviceEvent{eventKind: DomainEventKindLifecycle, lifecycle: event}, "")
+}
+
+// enqueue fills in ev's domain/domainUUID and routes it to its shard,
+// shared by Submit and SubmitLifecycle. logAlias is only used in the
+// overflow log message, to say which device (if any) was dropped.
+func (p *eventPipeline) enqueue(d *libvirt.Domain, ev deviceEvent, logAlias string) {
+	if atomic.LoadInt32(&p.closed) != 0 {
+		return
+	}
 	id, err := d.GetUUIDString()
 	if err != nil {
-		return err
+		glog.Errorf("failed to get UUID of domain reporting event: %v", err)
+		return
+	}
+	ev.domain = d
+	ev.domainUUID = id
+	select {
+	case p.shardFor(id) <- ev:
+	default:
+		atomic.AddUint64(&p.overflowCount, 1)
+		glog.Errorf("event queue for domain %s is full, dropping %s event for alias %q", id, ev.eventKind, logAlias)
+	}
+}
+
+// OverflowCount returns how many events Submit has dropped so far because
+// their shard's queue was full. No metrics library is vendored here to
+// export it as a proper counter metric, so it's exposed as a plain
+// accessor a caller (e.g. a future /healthz-style endpoint) can poll.
+func (p *eventPipeline) OverflowCount() uint64 {
+	return atomic.LoadUint64(&p.overflowCount)
+}
+
+// Shutdown stops accepting new events and waits for every shard to finish
+// processing whatever it already has buffered, so no device event that was
+// successfully queued is lost on shutdown. It's safe to call more than
+// once; only the first call does anything.
+func (p *eventPipeline) Shutdown() {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return
+	}
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.wg.Wait()
+}
+
+// worker drains ch until it's closed and emptied, reconciling each event in
+// the order received - which, since every event for a given domain UUID is
+// routed to the same shard by shardFor, means one domain's events are
+// always reconciled in delivery order even though other domains' events on
+// other shards are being reconciled at the same time.
+func (p *eventPipeline) worker(ch chan deviceEvent) {
+	defer p.wg.Done()
+	for ev := range ch {
+		p.process(ev)
+	}
+}
+
+// process dispatches ev to emitLifecycle or processDevice depending on its
+// eventKind.
+func (p *eventPipeline) process(ev deviceEvent) {
+	if ev.eventKind == DomainEventKindLifecycle {
+		p.emitLifecycle(ev)
+		return
 	}
+	p.processDevice(ev)
+}
 
-	domInfo, err := d.GetInfo()
+// emitLifecycle normalizes ev's DomainLifecycleEvent into a DomainEvent
+// and hands it to p.sink. Unlike device events, there's no metaStore write
+// involved (domainLifecycleWaiters.notify already recorded ev on the
+// libvirt event-loop goroutine before this was ever enqueued), so there's
+// nothing here to retry - only the sink delivery, which SpoolingEventSink
+// is what's responsible for retrying durably.
+func (p *eventPipeline) emitLifecycle(ev deviceEvent) {
+	event := DomainEvent{
+		DomainUUID:   ev.domainUUID,
+		PodSandboxID: p.lookupPodSandboxID(ev.domainUUID),
+		Kind:         DomainEventKindLifecycle,
+		Timestamp:    time.Now(),
+	}
+	if ev.lifecycle.Event == libvirt.DOMAIN_EVENT_STOPPED {
+		event.ExitReason = exitReasonForStoppedEvent(ev.lifecycle.Detail)
+	}
+	if err := p.sink.Emit(context.Background(), event); err != nil {
+		glog.Errorf("failed to emit lifecycle event for domain %s: %v", ev.domainUUID, err)
+	}
+}
+
+// lookupPodSandboxID best-effort resolves domainUUID's owning pod, for
+// DomainEvent.PodSandboxID. A failure (e.g. the container was already
+// removed from metaStore) just means the emitted event has no
+// PodSandboxID rather than failing the whole emit.
+func (p *eventPipeline) lookupPodSandboxID(domainUUID string) string {
+	containerInfo, err := p.metaStore.Container(domainUUID).Retrieve()
 	if err != nil {
-		return err
+		glog.V(4).Infof("could not resolve pod sandbox ID for domain %s: %v", domainUUID, err)
+		return ""
+	}
+	return containerInfo.Config.PodSandboxID
+}
+
+// processDevice classifies ev's DevAlias and, if it matches a known
+// ResourceKind, runs reconcileResource against it with retry-with-backoff:
+// metaStore errors are usually transient BoltDB contention rather than
+// permanent failures, so a few retries with doubling delay are tried
+// before giving up and logging. Unrecognized aliases are logged and
+// skipped rather than guessed at. Whether or not reconcileResource
+// succeeds, ev is still emitted to p.sink once classified, so external
+// controllers see the device event even if metaStore reconciliation
+// itself ultimately failed.
+func (p *eventPipeline) processDevice(ev deviceEvent) {
+	kind, ok := classifyDevAlias(ev.devAlias)
+	if !ok {
+		glog.V(4).Infof("ignoring device event for unrecognized alias %q", ev.devAlias)
+		return
+	}
+
+	backoff := reconcileBackoffBase
+	var before, after *ResourceSnapshot
+	var err error
+	for attempt := 1; attempt <= reconcileMaxAttempts; attempt++ {
+		if before, after, err = reconcileResource(ev.domain, kind, p.metaStore); err == nil {
+			break
+		}
+		glog.Errorf("failed to reconcile %s resource update for domain %s (attempt %d/%d): %v",
+			kind, ev.domainUUID, attempt, reconcileMaxAttempts, err)
+		if attempt < reconcileMaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	if err != nil {
+		glog.Errorf("giving up reconciling %s resource update for domain %s after %d attempts: %v",
+			kind, ev.domainUUID, reconcileMaxAttempts, err)
+	}
+
+	event := DomainEvent{
+		DomainUUID:   ev.domainUUID,
+		PodSandboxID: p.lookupPodSandboxID(ev.domainUUID),
+		Kind:         ev.eventKind,
+		DevAlias:     ev.devAlias,
+		Before:       before,
+		After:        after,
+		Timestamp:    time.Now(),
+	}
+	if sinkErr := p.sink.Emit(context.Background(), event); sinkErr != nil {
+		glog.Errorf("failed to emit %s event for domain %s: %v", ev.eventKind, ev.domainUUID, sinkErr)
+	}
+}
+
+// reconcileResource re-reads whatever of the domain's current state kind
+// covers and updates containerInfo.Config with it, then clears
+// containerInfo.Config.ResourceUpdateInProgress[kind], unblocking the next
+// UpdateContainerResources call for that resource kind (see
+// boltClient.ResetResourceUpdateInProgress for the equivalent reset done
+// at runtime service startup). It's called off the libvirt event-loop
+// goroutine, from one of eventPipeline's per-domain-serialized workers (see
+// eventPipeline.processDevice for the retry-with-backoff wrapped around
+// it). It returns a before/after ResourceSnapshot of the fields it
+// touched, for processDevice to attach to the DomainEvent it emits; both
+// are nil for ResourceKindDisk/NIC, which this doesn't update (see below).
+func reconcileResource(d *libvirt.Domain, kind ResourceKind, metaStore metadata.ContainerStore) (before, after *ResourceSnapshot, err error) {
+	id, err := d.GetUUIDString()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Update the vm config and metadata stored in Arktos-vm-runtime metadata
 	containerInfo, err := metaStore.Container(id).Retrieve()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	containerInfo.Config.MemoryLimitInBytes = int64(domInfo.Memory * defaultLibvirtDomainMemoryUnitValue)
-	containerInfo.Config.ResourceUpdateInProgress = false
+	before = &ResourceSnapshot{
+		MemoryLimitInBytes: containerInfo.Config.MemoryLimitInBytes,
+		CPUSetSpec:         containerInfo.Config.CPUSetSpec,
+	}
+
+	switch kind {
+	case ResourceKindMemory:
+		domInfo, err := d.GetInfo()
+		if err != nil {
+			return before, nil, err
+		}
+		containerInfo.Config.MemoryLimitInBytes = int64(domInfo.Memory * defaultLibvirtDomainMemoryUnitValue)
+	case ResourceKindCPU:
+		domInfo, err := d.GetInfo()
+		if err != nil {
+			return before, nil, err
+		}
+		containerInfo.Config.CPUSetSpec = fmt.Sprintf("0-%d", domInfo.NrVirtCpu-1)
+	case ResourceKindDisk, ResourceKindNIC:
+		// types.VMConfig has no attached disk/NIC device list field for
+		// this to sync into (the same kind of gap noted on
+		// AdjustDomainMemory's missing per-DIMM size tracking) - all
+		// this can honestly do today is clear the in-progress flag
+		// below, once that disk/NIC's hotplug/unplug has actually
+		// completed. No ResourceSnapshot applies here, so after is left
+		// nil for these two kinds.
+		before = nil
+	}
+
+	if containerInfo.Config.ResourceUpdateInProgress != nil {
+		containerInfo.Config.ResourceUpdateInProgress[string(kind)] = false
+	}
+
+	if before != nil {
+		after = &ResourceSnapshot{
+			MemoryLimitInBytes: containerInfo.Config.MemoryLimitInBytes,
+			CPUSetSpec:         containerInfo.Config.CPUSetSpec,
+		}
+	}
 
 	glog.V(4).Infof("Update runtime metadata with config: %v", containerInfo.Config)
-	err = metaStore.Container(id).Save(
+	if err := metaStore.Container(id).Save(
 		func(_ *types.ContainerInfo) (*types.ContainerInfo, error) {
 			return containerInfo, nil
-		})
-
-	if err != nil {
+		}); err != nil {
 		glog.Errorf("Failed to save containerInfo for container: %v", id)
-		return err
+		return before, after, err
 	}
 
-	return nil
-
+	return before, after, nil
 }
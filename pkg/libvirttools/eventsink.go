@@ -0,0 +1,298 @@
+/*
+Copyright 2020 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package libvirttools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DomainEventKind classifies which kind of libvirt notification a
+// DomainEvent was normalized from.
+type DomainEventKind string
+
+const (
+	DomainEventKindLifecycle           DomainEventKind = "lifecycle"
+	DomainEventKindDeviceAdded         DomainEventKind = "device_added"
+	DomainEventKindDeviceRemoved       DomainEventKind = "device_removed"
+	DomainEventKindDeviceRemovalFailed DomainEventKind = "device_removal_failed"
+)
+
+// ResourceSnapshot is the subset of ContainerInfo.Config a DomainEvent
+// reports the before/after value of. It only covers the fields
+// reconcileResource actually updates (memory and vCPU count); disk/NIC
+// hotplug events carry no snapshot, for the same reason reconcileResource
+// itself is a no-op for ResourceKindDisk/NIC (see its doc comment).
+type ResourceSnapshot struct {
+	MemoryLimitInBytes int64  `json:"memoryLimitInBytes"`
+	CPUSetSpec         string `json:"cpuSetSpec"`
+}
+
+// DomainEvent is the stable JSON schema external Arktos controllers
+// (scheduler, autoscaler, billing) consume from an EventSink, normalized
+// from whichever of the DomainLifecycleEvent/device-added/device-removed/
+// device-removal-failed libvirt notifications produced it.
+type DomainEvent struct {
+	DomainUUID string `json:"domainUUID"`
+	// PodSandboxID identifies the owning pod (ContainerInfo.Config.PodSandboxID),
+	// i.e. the closest equivalent this package has to a pod UID.
+	PodSandboxID string          `json:"podSandboxID,omitempty"`
+	Kind         DomainEventKind `json:"kind"`
+	// DevAlias is set for the three device-* kinds, identifying which
+	// libvirt device (see classifyDevAlias) the event is about.
+	DevAlias string `json:"devAlias,omitempty"`
+	// Before/After are only populated for device events that
+	// reconcileResource actually updates a ResourceSnapshot for.
+	Before *ResourceSnapshot `json:"before,omitempty"`
+	After  *ResourceSnapshot `json:"after,omitempty"`
+	// ExitReason is only set for DomainEventKindLifecycle events whose
+	// underlying libvirt notification was VIR_DOMAIN_EVENT_STOPPED (see
+	// exitReasonForStoppedEvent); every other lifecycle transition leaves
+	// it empty, so it's omitted from the JSON encoding.
+	ExitReason ExitReason `json:"exitReason,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+}
+
+// EventSink delivers DomainEvents to whatever's listening for them outside
+// this process. Emit should be safe to call concurrently: eventPipeline
+// calls it from every shard worker.
+type EventSink interface {
+	Emit(ctx context.Context, event DomainEvent) error
+}
+
+// NoopEventSink discards every event. It's NewEventHandler's default sink,
+// for deployments that don't need external controllers to react to
+// in-guest resource changes and would rather not pay for a webhook/spool
+// they're not using.
+type NoopEventSink struct{}
+
+// Emit implements EventSink.
+func (NoopEventSink) Emit(ctx context.Context, event DomainEvent) error {
+	return nil
+}
+
+// WebhookEventSink delivers events by POSTing their JSON encoding to a
+// fixed URL. It's the simplest EventSink this package implements that
+// actually leaves the process: unlike a message-bus client, it needs
+// nothing beyond net/http, which is always available.
+type WebhookEventSink struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewWebhookEventSink returns a WebhookEventSink posting to url, using a
+// client with a bounded per-request timeout so a stuck webhook receiver
+// can't wedge an eventPipeline worker indefinitely.
+func NewWebhookEventSink(url string) *WebhookEventSink {
+	return &WebhookEventSink{
+		URL:        url,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Emit implements EventSink.
+func (s *WebhookEventSink) Emit(ctx context.Context, event DomainEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshaling domain event: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("delivering domain event to webhook %s: %v", s.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s rejected domain event with status %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// NATSEventSink is meant to publish DomainEvents onto a NATS subject, the
+// way WebhookEventSink posts them to an HTTP endpoint. It can't actually do
+// that yet: no NATS client (github.com/nats-io/nats.go or similar) is
+// vendored anywhere under vendor/ (vendor/ only carries github.com/aykevl
+// and go.universe.tf - see NewNetbootServer for the latter), so there's no
+// wire protocol implementation to build on without fabricating one
+// wholesale, which would be far more likely to be subtly wrong than
+// useful. NATSEventSink is kept as a typed
+// placeholder recording the configuration an eventual real implementation
+// would need, with Emit always erroring so a misconfigured deployment
+// fails loudly instead of silently dropping every event.
+type NATSEventSink struct {
+	// URL is the NATS server URL to connect to, e.g. "nats://localhost:4222".
+	URL string
+	// Subject is the NATS subject DomainEvents would be published to.
+	Subject string
+}
+
+// Emit implements EventSink. See NATSEventSink's doc comment for why this
+// always errors instead of publishing.
+func (s *NATSEventSink) Emit(ctx context.Context, event DomainEvent) error {
+	return fmt.Errorf("NATSEventSink: no NATS client is vendored in this build, cannot publish to %s (subject %q)", s.URL, s.Subject)
+}
+
+// SpoolingEventSink wraps another EventSink with at-least-once delivery:
+// every event is durably recorded on disk before Emit attempts delivery,
+// and stays recorded until delivery succeeds, so a transient sink outage
+// (a webhook receiver down, a NATS server unreachable) can't lose events -
+// the next retry, or the next process's startup, will keep trying them.
+type SpoolingEventSink struct {
+	sink     EventSink
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []DomainEvent
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSpoolingEventSink wraps sink with an on-disk spool file at path,
+// retrying whatever's left undelivered every interval. Any events already
+// in path from a prior process (e.g. one that crashed before delivering
+// them) are loaded and retried immediately, preserving at-least-once
+// semantics across restarts.
+func NewSpoolingEventSink(sink EventSink, path string, interval time.Duration) (*SpoolingEventSink, error) {
+	s := &SpoolingEventSink{
+		sink:     sink,
+		path:     path,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+
+	if data, err := ioutil.ReadFile(path); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &s.pending); err != nil {
+			return nil, fmt.Errorf("loading event spool %s: %v", path, err)
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading event spool %s: %v", path, err)
+	}
+
+	s.wg.Add(1)
+	go s.drainLoop()
+	return s, nil
+}
+
+// Emit implements EventSink. It durably appends event to the spool before
+// attempting immediate delivery, so even a crash right after Emit returns
+// doesn't lose the event: the next drainLoop pass (in this process or, if
+// it didn't get the chance, the next one that opens the same spool path)
+// will retry it.
+func (s *SpoolingEventSink) Emit(ctx context.Context, event DomainEvent) error {
+	s.mu.Lock()
+	s.pending = append(s.pending, event)
+	err := s.persistLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("spooling domain event: %v", err)
+	}
+
+	s.tryDeliver(ctx)
+	return nil
+}
+
+// persistLocked writes s.pending to s.path, replacing its previous
+// contents. Callers must hold s.mu. It writes to a temp file and renames
+// it into place so a crash mid-write can't leave a half-written,
+// unparseable spool file behind.
+func (s *SpoolingEventSink) persistLocked() error {
+	data, err := json.Marshal(s.pending)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// tryDeliver attempts to deliver every currently pending event, in the
+// order they were spooled, removing each one that succeeds. It stops at
+// the first failure: later events are usually for the same domain, and
+// delivering them out of order past a gap isn't obviously better than
+// just waiting for the next retry.
+func (s *SpoolingEventSink) tryDeliver(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivered := 0
+	for _, event := range s.pending {
+		if err := s.sink.Emit(ctx, event); err != nil {
+			glog.V(4).Infof("event sink delivery failed, will retry: %v", err)
+			break
+		}
+		delivered++
+	}
+	if delivered == 0 {
+		return
+	}
+	s.pending = append([]DomainEvent{}, s.pending[delivered:]...)
+	if err := s.persistLocked(); err != nil {
+		glog.Errorf("failed to persist event spool %s after delivering %d events: %v", s.path, delivered, err)
+	}
+}
+
+// drainLoop periodically retries whatever's left in the spool, so events
+// that failed on their first Emit attempt (rather than just being added
+// after a prior failure) still eventually get delivered once the sink
+// recovers.
+func (s *SpoolingEventSink) drainLoop() {
+	defer s.wg.Done()
+	s.tryDeliver(context.Background())
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.tryDeliver(context.Background())
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// Shutdown stops drainLoop and makes one last delivery attempt for
+// whatever's still pending, so a clean shutdown doesn't leave events
+// waiting for the next retry interval unnecessarily. Whatever's still
+// undelivered stays on disk at s.path for the next process to pick up.
+func (s *SpoolingEventSink) Shutdown() {
+	close(s.stopCh)
+	s.wg.Wait()
+	s.tryDeliver(context.Background())
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package libvirttools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mirantis/virtlet/pkg/metadata"
+)
+
+func newTestHealthHistoryStore(t *testing.T) *HealthHistoryStore {
+	store, err := metadata.NewCacheStore("mem://")
+	if err != nil {
+		t.Fatalf("metadata.NewCacheStore(\"mem://\"): %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return NewHealthHistoryStore(store)
+}
+
+func TestHealthHistoryStoreRoundTrip(t *testing.T) {
+	s := newTestHealthHistoryStore(t)
+
+	if results, err := s.Load("container1"); err != nil || results != nil {
+		t.Fatalf("Load for unknown container: got (%v, %v), want (nil, nil)", results, err)
+	}
+
+	want := []HealthCheckResult{
+		{Timestamp: time.Unix(1, 0), Success: true, Output: "ok"},
+		{Timestamp: time.Unix(2, 0), Success: false, Output: "connection refused"},
+	}
+	if err := s.Save("container1", want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := s.Load("container1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got) != len(want) || got[0].Success != want[0].Success || got[1].Output != want[1].Output {
+		t.Fatalf("Load after Save: got %+v, want %+v", got, want)
+	}
+}
+
+func TestHealthCheckerAttachHistoryStore(t *testing.T) {
+	s := newTestHealthHistoryStore(t)
+	prior := []HealthCheckResult{{Timestamp: time.Unix(1, 0), Success: true, Output: "ok"}}
+	if err := s.Save("container1", prior); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	hc := NewHealthChecker(nil, HealthCheckSpec{Kind: HealthCheckTCP, Address: "127.0.0.1:1"}, nil)
+	if err := hc.AttachHistoryStore(s, "container1"); err != nil {
+		t.Fatalf("AttachHistoryStore: %v", err)
+	}
+
+	results := hc.Results()
+	if len(results) != 1 || results[0].Output != "ok" {
+		t.Fatalf("Results after AttachHistoryStore: got %+v, want the persisted prior history", results)
+	}
+}
@@ -18,34 +18,133 @@ limitations under the License.
 package libvirttools
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/libvirt/libvirt-go"
 	"github.com/libvirt/libvirt-go-xml"
 	"math"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/Mirantis/virtlet/pkg/virt"
 )
 
+// dhcpLeasePollInterval is how often WaitForDHCPLease re-queries libvirt
+// for a lease while no matching address has shown up yet.
+const dhcpLeasePollInterval = 500 * time.Millisecond
+
 type libvirtDomainConnection struct {
 	conn libvirtConnection
 }
 
-// TODO: runtime issue: https://github.com/futurewei-cloud/arktos-vm-runtime/issues/50
-//       multiple sizes of devices, and, numa node setting
-// default mem chip size set to 512 MiB
-const memoryDeviceSizeInKiB = 512 * 1024
+// defaultMemoryDeviceSizeInKiB is used when AdjustDomainMemory is called
+// without an explicit device size, preserving the previous fixed-512MiB
+// behavior.
+const defaultMemoryDeviceSizeInKiB = 512 * 1024
 
-const memoryDeviceDefinition = `<memory model='dimm'>
+const memoryDeviceDefinitionTemplate = `<memory model='dimm'>
 							<target>
-								<size unit='MiB'>512</size>
-								<node>0</node>
+								<size unit='KiB'>%d</size>
+								<node>%d</node>
 							</target>
 						</memory>`
 
-const snapshotXMLTemplate = `<domainsnapshot>
-  								<name>%s</name>
-							 </domainsnapshot>`
+func memoryDeviceDefinition(sizeInKiB int64, numaNode uint) string {
+	return fmt.Sprintf(memoryDeviceDefinitionTemplate, sizeInKiB, numaNode)
+}
+
+// SnapshotKind selects how CreateSnapshot persists a domain's disk (and,
+// for SnapshotExternal, memory) state.
+type SnapshotKind int
+
+const (
+	// SnapshotInternal stores the snapshot inside each disk's own qcow2
+	// file. This is the original, CBT-unfriendly behavior.
+	SnapshotInternal SnapshotKind = iota
+	// SnapshotExternal redirects every disk listed in Spec.Disks (and, if
+	// MemoryFile is set, the domain's memory state) to new external files,
+	// leaving the current disk image as a read-only backing file.
+	SnapshotExternal
+	// SnapshotDiskOnly behaves like SnapshotExternal but never captures
+	// memory state, so it can be taken of a running domain without a
+	// stop-the-world pause.
+	SnapshotDiskOnly
+)
+
+// DiskSnapshot names the external file a single disk's snapshot should be
+// redirected to.
+type DiskSnapshot struct {
+	// Name is the disk's target device name, e.g. "vda".
+	Name string
+	// File is the path of the new external snapshot file backing Name.
+	File string
+}
+
+// SnapshotSpec describes a CreateSnapshot request in full, as opposed to the
+// name-only internal snapshots the API originally supported.
+type SnapshotSpec struct {
+	// Name is the snapshot's libvirt name.
+	Name string
+	// Kind selects internal, external, or disk-only semantics.
+	Kind SnapshotKind
+	// Description is stored alongside the snapshot metadata.
+	Description string
+	// MemoryFile is the external file to dump guest memory into. Ignored
+	// for SnapshotInternal and SnapshotDiskOnly.
+	MemoryFile string
+	// Disks lists the external file redirection for each disk that should
+	// participate in the snapshot. Ignored for SnapshotInternal.
+	Disks []DiskSnapshot
+	// Quiesce requests guest-agent filesystem quiescing before the
+	// snapshot is taken.
+	Quiesce bool
+	// Atomic requests the snapshot be rejected rather than applied
+	// partially if any disk cannot be snapshotted.
+	Atomic bool
+}
+
+func (spec SnapshotSpec) xml() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<domainsnapshot>\n  <name>%s</name>\n", spec.Name)
+	if spec.Description != "" {
+		fmt.Fprintf(&b, "  <description>%s</description>\n", spec.Description)
+	}
+	if spec.Kind == SnapshotExternal && spec.MemoryFile != "" {
+		fmt.Fprintf(&b, "  <memory snapshot='external' file='%s'/>\n", spec.MemoryFile)
+	} else {
+		b.WriteString("  <memory snapshot='no'/>\n")
+	}
+	if spec.Kind != SnapshotInternal && len(spec.Disks) > 0 {
+		b.WriteString("  <disks>\n")
+		for _, d := range spec.Disks {
+			fmt.Fprintf(&b, "    <disk name='%s' snapshot='external'>\n      <source file='%s'/>\n    </disk>\n", d.Name, d.File)
+		}
+		b.WriteString("  </disks>\n")
+	}
+	b.WriteString("</domainsnapshot>")
+	return b.String()
+}
+
+func (spec SnapshotSpec) flags() libvirt.DomainSnapshotCreateFlags {
+	var flags libvirt.DomainSnapshotCreateFlags
+	// An external snapshot with a MemoryFile is a full-system checkpoint,
+	// which libvirt rejects under DISK_ONLY.
+	if spec.Kind == SnapshotDiskOnly || (spec.Kind == SnapshotExternal && spec.MemoryFile == "") {
+		flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY
+	}
+	if spec.Quiesce {
+		flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_QUIESCE
+	}
+	if spec.Atomic {
+		flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC
+	}
+	return flags
+}
 
 var _ virt.DomainConnection = &libvirtDomainConnection{}
 
@@ -208,6 +307,59 @@ func (domain *libvirtDomain) State() (virt.DomainState, error) {
 	}
 }
 
+// StateWithReason is like State, but also returns the libvirt-specific
+// reason for the domain's current state (e.g. a RUNNING domain reports
+// whether it was booted, migrated-in, restored from a managed save, or
+// unpaused; a SHUTOFF domain reports whether it was shut down cleanly,
+// destroyed, or crashed). The reason is returned as the raw int
+// virDomainGetState gives back: libvirt-go has no single reason enum
+// covering every state - DomainRunningReason, DomainShutoffReason,
+// DomainPausedReason and so on are separate int-based types, one per
+// DomainState value - so the caller is expected to know which one
+// applies based on the returned state, the same way libvirt's C API
+// works.
+func (domain *libvirtDomain) StateWithReason() (libvirt.DomainState, int, error) {
+	state, reason, err := domain.d.GetState()
+	if err != nil {
+		return libvirt.DOMAIN_NOSTATE, 0, err
+	}
+	return state, reason, nil
+}
+
+// Suspend pauses a running domain's vCPUs in place (virDomainSuspend):
+// the domain keeps its memory and stays defined as far as libvirt is
+// concerned, just stops executing, until Resume.
+func (domain *libvirtDomain) Suspend() error {
+	return domain.d.Suspend()
+}
+
+// Resume unpauses a domain previously paused with Suspend.
+func (domain *libvirtDomain) Resume() error {
+	return domain.d.Resume()
+}
+
+// ManagedSave stops the domain and persists its complete state,
+// including guest RAM, to libvirt's own managed-save location
+// (virDomainManagedSave) - there's no explicit destination to choose,
+// unlike virDomainSave. The next Create() call on this domain restores
+// from it automatically instead of booting fresh; see
+// HasManagedSaveImage.
+func (domain *libvirtDomain) ManagedSave() error {
+	return domain.d.ManagedSave(0)
+}
+
+// HasManagedSaveImage reports whether a ManagedSave state is currently
+// pending for this domain.
+func (domain *libvirtDomain) HasManagedSaveImage() (bool, error) {
+	return domain.d.HasManagedSaveImage(0)
+}
+
+// ManagedSaveRemove discards any pending ManagedSave state without
+// restoring it, so the next Create() call boots fresh instead.
+func (domain *libvirtDomain) ManagedSaveRemove() error {
+	return domain.d.ManagedSaveRemove(0)
+}
+
 func (domain *libvirtDomain) UUIDString() (string, error) {
 	return domain.d.GetUUIDString()
 }
@@ -263,15 +415,122 @@ func (domain *libvirtDomain) Reboot(flags libvirt.DomainRebootFlagValues) error
 	return domain.d.Reboot(flags)
 }
 
-// CreateSnapshop creates a system snapshot for current domain
+// CreateSnapshot creates a system snapshot for current domain
 func (domain *libvirtDomain) CreateSnapshot(snapshotID string) error {
-	spec := fmt.Sprintf(snapshotXMLTemplate, snapshotID)
+	return domain.CreateSnapshotWithSpec(SnapshotSpec{Name: snapshotID, Kind: SnapshotInternal})
+}
 
-	// with flag 0 it will create a system snapshot for an active domain.
-	_, err := domain.d.CreateSnapshotXML(spec, 0)
+// CreateSnapshotWithSpec creates a snapshot according to spec, supporting
+// internal, external, and disk-only snapshots for live backup and
+// changed-block-tracking workflows.
+func (domain *libvirtDomain) CreateSnapshotWithSpec(spec SnapshotSpec) error {
+	_, err := domain.d.CreateSnapshotXML(spec.xml(), spec.flags())
 	return err
 }
 
+// ListSnapshots returns the names of all snapshots defined for the domain.
+func (domain *libvirtDomain) ListSnapshots() ([]string, error) {
+	return domain.ListSnapshotsWithFilter(nil)
+}
+
+// SnapshotFilter narrows the result of ListSnapshotsWithFilter.
+type SnapshotFilter struct {
+	// LeavesOnly restricts the result to snapshots with no children -
+	// the subset that are safe to delete without orphaning some other
+	// snapshot that depends on them as a backing file.
+	LeavesOnly bool
+}
+
+// flags translates f into the libvirt ListAllSnapshots flags it
+// corresponds to. A nil filter behaves like an empty SnapshotFilter.
+func (f *SnapshotFilter) flags() uint32 {
+	if f == nil {
+		return 0
+	}
+	var flags uint32
+	if f.LeavesOnly {
+		flags |= uint32(libvirt.DOMAIN_SNAPSHOT_LIST_LEAVES)
+	}
+	return flags
+}
+
+// ListSnapshotsWithFilter is like ListSnapshots, but narrows the result
+// per filter, e.g. to only the leaf snapshots it's safe to delete
+// without corrupting the backing chain of some other snapshot.
+func (domain *libvirtDomain) ListSnapshotsWithFilter(filter *SnapshotFilter) ([]string, error) {
+	snapshots, err := domain.d.ListAllSnapshots(filter.flags())
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		name, err := s.GetName()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// DeleteSnapshot removes the named snapshot. flags is passed through to
+// libvirt's DomainSnapshotDelete, e.g. to also remove its children.
+func (domain *libvirtDomain) DeleteSnapshot(snapshotID string, flags libvirt.DomainSnapshotDeleteFlags) error {
+	snapshot, err := domain.d.SnapshotLookupByName(snapshotID, 0)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve snapshot %s: %v", snapshotID, err)
+	}
+	return snapshot.Delete(flags)
+}
+
+// SnapshotXML returns the domain snapshot XML describing the named
+// snapshot, so callers can implement rotation and incremental backups.
+func (domain *libvirtDomain) SnapshotXML(snapshotID string) (string, error) {
+	snapshot, err := domain.d.SnapshotLookupByName(snapshotID, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve snapshot %s: %v", snapshotID, err)
+	}
+	return snapshot.GetXMLDesc(0)
+}
+
+// SnapshotInfo describes a single domain snapshot, parsed out of the XML
+// libvirt already stores for it (see SnapshotXML). It covers what
+// libvirt itself tracks about a snapshot; it isn't a metadata-store
+// record (see VirtualizationTool.SnapshotInfo's doc comment for why
+// size-on-disk and operator-supplied labels aren't part of it here).
+type SnapshotInfo struct {
+	// Name is the snapshot's libvirt name.
+	Name string
+	// Description is the free-text description passed to
+	// SnapshotSpec.Description when the snapshot was created.
+	Description string
+	// CreationTime is libvirt's creationTime element: a Unix timestamp,
+	// as a string, in seconds.
+	CreationTime string
+	// ParentName is the name of the snapshot this one was taken on top
+	// of, the previous current snapshot at creation time. It's empty
+	// for a root snapshot.
+	ParentName string
+}
+
+// parseSnapshotInfo parses a single domain snapshot's XML description
+// (as returned by SnapshotXML) into a SnapshotInfo.
+func parseSnapshotInfo(xmlDesc string) (*SnapshotInfo, error) {
+	var snap libvirtxml.DomainSnapshot
+	if err := snap.Unmarshal(xmlDesc); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot XML: %v", err)
+	}
+	info := &SnapshotInfo{
+		Name:         snap.Name,
+		Description:  snap.Description,
+		CreationTime: snap.CreationTime,
+	}
+	if snap.Parent != nil {
+		info.ParentName = snap.Parent.Name
+	}
+	return info, nil
+}
+
 func (domain *libvirtDomain) RestoreToSnapshot(snapshotID string) error {
 	// the flag is not used in libvirt. Now it is requird to be always o.
 	snapshot, err := domain.d.SnapshotLookupByName(snapshotID, 0)
@@ -284,16 +543,29 @@ func (domain *libvirtDomain) RestoreToSnapshot(snapshotID string) error {
 	return snapshot.RevertToSnapshot(0)
 }
 
+// MigrateToURI3 live-migrates the domain to the libvirtd listening at
+// destURI. destXML, if non-empty, replaces the domain's own current XML
+// as the definition libvirt applies on the destination - see
+// VirtualizationTool.MigrateContainer, which rewrites host-specific bits
+// (graphics listen addresses) out of it before passing it in here.
+func (domain *libvirtDomain) MigrateToURI3(destURI string, destXML string, flags libvirt.DomainMigrateFlags) error {
+	params := libvirt.DomainMigrateParameters{
+		DestXML:    destXML,
+		DestXMLSet: destXML != "",
+	}
+	return domain.d.MigrateToURI3(destURI, &params, flags)
+}
+
 // Update domain vcpu
 func (domain *libvirtDomain) SetVcpus(vcpus uint) error {
 	return domain.d.SetVcpusFlags(vcpus, libvirt.DOMAIN_VCPU_CONFIG|libvirt.DOMAIN_VCPU_LIVE)
 }
 
 // TODO: move this to a helper function file
-func determineNumberOfDeviceNeeded(memChangeInKib int64, isAttach bool) int {
+func determineNumberOfDeviceNeeded(memChangeInKib, deviceSizeInKiB int64, isAttach bool) int {
 	var numberMemoryDevicesNeeded int
 
-	temp := math.Abs(float64(memChangeInKib)) / float64(memoryDeviceSizeInKiB)
+	temp := math.Abs(float64(memChangeInKib)) / float64(deviceSizeInKiB)
 	if isAttach {
 		numberMemoryDevicesNeeded = int(math.Ceil(temp))
 	} else {
@@ -303,15 +575,29 @@ func determineNumberOfDeviceNeeded(memChangeInKib int64, isAttach bool) int {
 	return numberMemoryDevicesNeeded
 }
 
-// Update domain current memory
-// the memory device is 512 Mib each
-func (domain *libvirtDomain) AdjustDomainMemory(memChangeInKib int64) error {
+// ErrMemoryHotplugUnsupported is returned by AdjustDomainMemory when
+// libvirt reports that attaching or detaching the DIMM itself failed
+// because the guest kernel doesn't support memory hotplug, rather than
+// for some other reason (bad XML, domain not running, etc). Callers can
+// use this to fall back to recreating the domain with its new memory
+// size instead of retrying the same hotplug.
+var ErrMemoryHotplugUnsupported = errors.New("guest does not support memory hotplug")
+
+// AdjustDomainMemory hot(un)plugs DIMM memory devices to bring the domain's
+// current memory in line with memChangeInKib. deviceSizeInKiB selects the
+// size of each DIMM (0 defaults to defaultMemoryDeviceSizeInKiB); numaNode
+// selects which guest NUMA cell the devices are attached to.
+func (domain *libvirtDomain) AdjustDomainMemory(memChangeInKib int64, deviceSizeInKiB int64, numaNode uint) error {
 	glog.V(4).Infof("MemoryChanges in KiB: %v", memChangeInKib)
 
+	if deviceSizeInKiB <= 0 {
+		deviceSizeInKiB = defaultMemoryDeviceSizeInKiB
+	}
+
 	isAttach := memChangeInKib > 0
 	glog.V(4).Infof("isAttach: %v", isAttach)
 
-	numberMemoryDevicesNeeded := determineNumberOfDeviceNeeded(memChangeInKib, isAttach)
+	numberMemoryDevicesNeeded := determineNumberOfDeviceNeeded(memChangeInKib, deviceSizeInKiB, isAttach)
 	glog.V(4).Infof("Number of device needed : %v", numberMemoryDevicesNeeded)
 
 	// TODO: pending design
@@ -325,16 +611,20 @@ func (domain *libvirtDomain) AdjustDomainMemory(memChangeInKib int64) error {
 		return fmt.Errorf("invalid memory change size")
 	}
 
+	deviceXML := memoryDeviceDefinition(deviceSizeInKiB, numaNode)
 	for i := 0; i < numberMemoryDevicesNeeded; i++ {
 		var err error
 		if isAttach {
 			glog.V(4).Infof("Attach memory device to domain")
-			err = domain.d.AttachDeviceFlags(memoryDeviceDefinition, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG|libvirt.DOMAIN_DEVICE_MODIFY_LIVE)
+			err = domain.d.AttachDeviceFlags(deviceXML, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG|libvirt.DOMAIN_DEVICE_MODIFY_LIVE)
 		} else {
 			glog.V(4).Infof("Detach memory device to domain")
-			err = domain.d.DetachDeviceFlags(memoryDeviceDefinition, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG|libvirt.DOMAIN_DEVICE_MODIFY_LIVE)
+			err = domain.d.DetachDeviceFlags(deviceXML, libvirt.DOMAIN_DEVICE_MODIFY_CONFIG|libvirt.DOMAIN_DEVICE_MODIFY_LIVE)
 		}
 		if err != nil {
+			if libvirtErr, ok := err.(libvirt.Error); ok && libvirtErr.Code == libvirt.ERR_OPERATION_UNSUPPORTED {
+				return ErrMemoryHotplugUnsupported
+			}
 			return err
 		}
 	}
@@ -342,6 +632,299 @@ func (domain *libvirtDomain) AdjustDomainMemory(memChangeInKib int64) error {
 	return nil
 }
 
+// InterfaceAddresses returns the addresses libvirt currently knows about
+// for this domain's interfaces, keyed by MAC address, sourced from the
+// DHCP server's own lease table.
+func (domain *libvirtDomain) InterfaceAddresses() (map[string][]net.IP, error) {
+	ifaces, err := domain.d.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string][]net.IP, len(ifaces))
+	for _, iface := range ifaces {
+		var addrs []net.IP
+		for _, addr := range iface.Addrs {
+			if ip := net.ParseIP(addr.Addr); ip != nil {
+				addrs = append(addrs, ip)
+			}
+		}
+		ret[iface.Hwaddr] = addrs
+	}
+	return ret, nil
+}
+
+// WaitForDHCPLease polls the domain's DHCP lease table until the interface
+// with the given MAC address has been handed an address, or ctx is done.
+func (domain *libvirtDomain) WaitForDHCPLease(ctx context.Context, mac string) (net.IP, error) {
+	for {
+		addrs, err := domain.InterfaceAddresses()
+		if err != nil {
+			return nil, err
+		}
+		if ips := addrs[mac]; len(ips) > 0 {
+			return ips[0], nil
+		}
+
+		select {
+		case <-time.After(dhcpLeasePollInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for a DHCP lease on %s: %v", mac, ctx.Err())
+		}
+	}
+}
+
+// GuestExecResult is the outcome of a single qemu-guest-agent guest-exec
+// command, once guest-exec-status reports it as finished.
+type GuestExecResult struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// guestExecPollInterval is how often GuestExec re-polls
+// guest-exec-status while the command is still running.
+const guestExecPollInterval = 200 * time.Millisecond
+
+// GuestExec runs command (with args) inside the guest via
+// qemu-guest-agent's guest-exec/guest-exec-status commands (see
+// https://qemu.readthedocs.io/en/latest/interop/qemu-ga-ref.html),
+// polling guest-exec-status every guestExecPollInterval until the
+// process exits or timeout elapses. It requires qemu-guest-agent to be
+// installed and running in the guest, and the domain's channel for it
+// configured, same as libvirt's own virsh qemu-agent-command.
+func (domain *libvirtDomain) GuestExec(command string, args []string, timeout time.Duration) (*GuestExecResult, error) {
+	type execArgs struct {
+		Path          string   `json:"path"`
+		Arg           []string `json:"arg,omitempty"`
+		CaptureOutput bool     `json:"capture-output"`
+	}
+	type execCmd struct {
+		Execute   string   `json:"execute"`
+		Arguments execArgs `json:"arguments"`
+	}
+
+	req, err := json.Marshal(execCmd{
+		Execute:   "guest-exec",
+		Arguments: execArgs{Path: command, Arg: args, CaptureOutput: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build guest-exec command: %v", err)
+	}
+
+	resp, err := domain.d.QemuAgentCommand(string(req), libvirt.DOMAIN_QEMU_AGENT_COMMAND_DEFAULT, 0)
+	if err != nil {
+		return nil, fmt.Errorf("guest-exec of %q failed: %v", command, err)
+	}
+
+	var execResp struct {
+		Return struct {
+			PID int `json:"pid"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal([]byte(resp), &execResp); err != nil {
+		return nil, fmt.Errorf("failed to parse guest-exec response: %v", err)
+	}
+
+	type statusArgs struct {
+		PID int `json:"pid"`
+	}
+	type statusCmd struct {
+		Execute   string     `json:"execute"`
+		Arguments statusArgs `json:"arguments"`
+	}
+	statusReq, err := json.Marshal(statusCmd{
+		Execute:   "guest-exec-status",
+		Arguments: statusArgs{PID: execResp.Return.PID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build guest-exec-status command: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		statusResp, err := domain.d.QemuAgentCommand(string(statusReq), libvirt.DOMAIN_QEMU_AGENT_COMMAND_DEFAULT, 0)
+		if err != nil {
+			return nil, fmt.Errorf("guest-exec-status of pid %d failed: %v", execResp.Return.PID, err)
+		}
+
+		var status struct {
+			Return struct {
+				Exited   bool   `json:"exited"`
+				ExitCode int    `json:"exitcode"`
+				OutData  string `json:"out-data"`
+				ErrData  string `json:"err-data"`
+			} `json:"return"`
+		}
+		if err := json.Unmarshal([]byte(statusResp), &status); err != nil {
+			return nil, fmt.Errorf("failed to parse guest-exec-status response: %v", err)
+		}
+
+		if status.Return.Exited {
+			stdout, _ := base64.StdEncoding.DecodeString(status.Return.OutData)
+			stderr, _ := base64.StdEncoding.DecodeString(status.Return.ErrData)
+			return &GuestExecResult{
+				ExitCode: status.Return.ExitCode,
+				Stdout:   string(stdout),
+				Stderr:   string(stderr),
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("guest-exec of %q timed out after %v", command, timeout)
+		}
+		time.Sleep(guestExecPollInterval)
+	}
+}
+
+// DiskIOStats holds a single block device's I/O counters, as reported by
+// virDomainBlockStats.
+type DiskIOStats struct {
+	Device  string
+	RdReq   int64
+	RdBytes int64
+	WrReq   int64
+	WrBytes int64
+	Errs    int64
+}
+
+// BlockStats returns I/O counters for the disk attached as device (the
+// target dev name, e.g. "vda", from the domain XML).
+func (domain *libvirtDomain) BlockStats(device string) (*DiskIOStats, error) {
+	s, err := domain.d.BlockStats(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block stats for %s: %v", device, err)
+	}
+	return &DiskIOStats{
+		Device:  device,
+		RdReq:   s.RdReq,
+		RdBytes: s.RdBytes,
+		WrReq:   s.WrReq,
+		WrBytes: s.WrBytes,
+		Errs:    s.Errs,
+	}, nil
+}
+
+// NetIOStats holds a single network interface's counters, as reported by
+// virDomainInterfaceStats.
+type NetIOStats struct {
+	Device    string
+	RxBytes   int64
+	RxPackets int64
+	RxErrs    int64
+	RxDrop    int64
+	TxBytes   int64
+	TxPackets int64
+	TxErrs    int64
+	TxDrop    int64
+}
+
+// InterfaceStats returns I/O counters for the network interface attached
+// as device (the target dev name, e.g. "tap0", from the domain XML).
+func (domain *libvirtDomain) InterfaceStats(device string) (*NetIOStats, error) {
+	s, err := domain.d.InterfaceStats(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface stats for %s: %v", device, err)
+	}
+	return &NetIOStats{
+		Device:    device,
+		RxBytes:   s.RxBytes,
+		RxPackets: s.RxPackets,
+		RxErrs:    s.RxErrs,
+		RxDrop:    s.RxDrop,
+		TxBytes:   s.TxBytes,
+		TxPackets: s.TxPackets,
+		TxErrs:    s.TxErrs,
+		TxDrop:    s.TxDrop,
+	}, nil
+}
+
+// VCPUStats is a single vCPU's accumulated CPU time, as reported by
+// virDomainGetVcpus.
+type VCPUStats struct {
+	Number    uint32
+	CPUTimeNs uint64
+}
+
+// VCPUStats returns per-vCPU CPU time. Note: libvirt's host-side domain
+// API has no per-vCPU steal-time counter to report here - steal time is
+// something the guest kernel itself derives from its view of
+// /proc/stat, not a figure the hypervisor exposes per vCPU, so it isn't
+// included.
+func (domain *libvirtDomain) VCPUStats() ([]VCPUStats, error) {
+	infos, err := domain.d.GetVcpus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vCPU stats: %v", err)
+	}
+	out := make([]VCPUStats, 0, len(infos))
+	for _, info := range infos {
+		out = append(out, VCPUStats{Number: info.Number, CPUTimeNs: info.CpuTime})
+	}
+	return out, nil
+}
+
+// BalloonStats is a domain's memory balloon counters, as reported by
+// virDomainMemoryStats.
+type BalloonStats struct {
+	ActualBalloonKiB uint64
+	AvailableKiB     uint64
+	UnusedKiB        uint64
+}
+
+// BalloonStats returns the domain's current balloon/available/unused
+// memory counters.
+func (domain *libvirtDomain) BalloonStats() (*BalloonStats, error) {
+	stats, err := domain.d.MemoryStats(8, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balloon stats: %v", err)
+	}
+	var bs BalloonStats
+	for _, s := range stats {
+		switch s.Tag {
+		case int32(libvirt.DOMAIN_MEMORY_STAT_ACTUAL_BALLOON):
+			bs.ActualBalloonKiB = s.Val
+		case int32(libvirt.DOMAIN_MEMORY_STAT_AVAILABLE):
+			bs.AvailableKiB = s.Val
+		case int32(libvirt.DOMAIN_MEMORY_STAT_UNUSED):
+			bs.UnusedKiB = s.Val
+		}
+	}
+	return &bs, nil
+}
+
+// JobStats returns the domain's current (or, briefly after completion,
+// most recent) migration/save job progress, as reported by
+// virDomainGetJobStats. See MigrationJobInfo's doc comment in
+// migration.go for what this deliberately doesn't report.
+func (domain *libvirtDomain) JobStats() (*MigrationJobInfo, error) {
+	info, err := domain.d.GetJobStats(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration job stats: %v", err)
+	}
+	result := &MigrationJobInfo{
+		Active:        info.Type != libvirt.DOMAIN_JOB_NONE,
+		TimeElapsedMs: info.TimeElapsed,
+	}
+	if info.DataTotalSet {
+		result.DataTotal = info.DataTotal
+	}
+	if info.DataProcessedSet {
+		result.DataProcessed = info.DataProcessed
+	}
+	if info.DataRemainingSet {
+		result.DataRemaining = info.DataRemaining
+	}
+	if info.MemTotalSet {
+		result.MemTotal = info.MemTotal
+	}
+	if info.MemProcessedSet {
+		result.MemProcessed = info.MemProcessed
+	}
+	if info.MemRemainingSet {
+		result.MemRemaining = info.MemRemaining
+	}
+	return result, nil
+}
+
 type libvirtSecret struct {
 	s *libvirt.Secret
 }
@@ -101,6 +101,14 @@ func (v *VirtletRuntimeService) Version(ctx context.Context, in *kubeapi.Version
 	}, nil
 }
 
+// APIVersion reports the same runtime/API version info as Version. It
+// exists so a caller doing per-connection CRI version negotiation (see
+// kubelet's v1/v1alpha2 fallback) can probe which protocol a connection
+// speaks before committing to it.
+func (v *VirtletRuntimeService) APIVersion(ctx context.Context, in *kubeapi.VersionRequest) (*kubeapi.VersionResponse, error) {
+	return v.Version(ctx, in)
+}
+
 //
 // Sandboxes
 //
@@ -413,12 +421,44 @@ func (v *VirtletRuntimeService) ContainerStatus(ctx context.Context, in *kubeapi
 	return response, nil
 }
 
-// ExecSync is a placeholder for an unimplemented CRI method.
-func (v *VirtletRuntimeService) ExecSync(context.Context, *kubeapi.ExecSyncRequest) (*kubeapi.ExecSyncResponse, error) {
-	return nil, errors.New("not implemented")
+// defaultExecTimeout bounds ExecSync when req.Timeout is zero (CRI lets
+// callers request no timeout at all, but VirtualizationTool.GuestExec
+// needs a finite one to hand qemu-guest-agent's polling loop).
+const defaultExecTimeout = 30 * time.Second
+
+// ExecSync runs a command inside the VM via qemu-guest-agent's guest-exec,
+// through VirtualizationTool.GuestExec - the same mechanism
+// HealthChecker's exec probes use. It's synchronous, matching ExecSync's
+// CRI contract: the guest-exec/guest-exec-status polling loop happens
+// inside GuestExec, and this method just waits for it to finish or for
+// req.Timeout to elapse.
+func (v *VirtletRuntimeService) ExecSync(ctx context.Context, req *kubeapi.ExecSyncRequest) (*kubeapi.ExecSyncResponse, error) {
+	if len(req.Cmd) == 0 {
+		return nil, errors.New("ExecSync: empty Cmd")
+	}
+	timeout := defaultExecTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	result, err := v.virtTool.GuestExec(req.ContainerId, req.Cmd[0], req.Cmd[1:], timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &kubeapi.ExecSyncResponse{
+		Stdout:   []byte(result.Stdout),
+		Stderr:   []byte(result.Stderr),
+		ExitCode: int32(result.ExitCode),
+	}, nil
 }
 
-// Exec is a placeholder for an unimplemented CRI method.
+// Exec is still a placeholder, unlike ExecSync above: it needs to hand the
+// caller a streaming URL the way Attach/PortForward do through
+// streamServer, but guest-exec's request/response model (what
+// VirtualizationTool.GuestExec wraps) has no notion of an interactive
+// stdin/stdout/stderr stream for streamServer to multiplex - it runs a
+// command to completion and returns its captured output, same as
+// ExecSync. Wiring real streaming exec would mean extending the
+// guest-agent transport itself, not just calling GuestExec differently.
 func (v *VirtletRuntimeService) Exec(context.Context, *kubeapi.ExecRequest) (*kubeapi.ExecResponse, error) {
 	return nil, errors.New("not implemented")
 }
@@ -608,13 +648,23 @@ func (v *VirtletRuntimeService) RebootVM(ctx context.Context, in *kubeapi.Reboot
 	return response, nil
 }
 
-// To be implemented
+// AttachNetworkInterface is not supported: this runtime provisions all of a
+// pod's network interfaces once, in RunPodSandbox, by handing the VM's
+// helper process a single netFdKey that already encodes every tap fd
+// tapmanager set up for the pod (see ds.netFdKey and vconfig.NetKeyEnvVarName
+// in pkg/libvirttools). There's no hot-plug path that could attach one more
+// interface to an already-running VM without that plumbing, so unlike the
+// other CRI device-attach stubs this isn't a "to be implemented" placeholder.
 func (v *VirtletRuntimeService) AttachNetworkInterface(ctx context.Context, in *kubeapi.DeviceAttachDetachRequest) (*kubeapi.DeviceAttachDetachResponse, error) {
-	return nil, errors.New("not implemented")
+	return nil, errors.New("AttachNetworkInterface is not supported: virtlet wires up all pod network interfaces at RunPodSandbox time and has no interface hot-plug path")
 }
 
+// DetachNetworkInterface is not supported, for the same reason as
+// AttachNetworkInterface above: interfaces are torn down as a whole along
+// with the pod's sandbox (see StopPodSandbox's ReleaseFDs call), not
+// individually.
 func (v *VirtletRuntimeService) DetachNetworkInterface(ctx context.Context, in *kubeapi.DeviceAttachDetachRequest) (*kubeapi.DeviceAttachDetachResponse, error) {
-	return nil, errors.New("not implemented")
+	return nil, errors.New("DetachNetworkInterface is not supported: virtlet tears down all pod network interfaces at StopPodSandbox time and has no interface hot-unplug path")
 }
 
 func (v *VirtletRuntimeService) ListNetworkInterfaces(ctx context.Context, in *kubeapi.ListDeviceRequest) (*kubeapi.ListDeviceResponse, error) {
@@ -667,6 +717,36 @@ func (v *VirtletRuntimeService) RestoreToSnapshot(ctx context.Context, in *kubea
 	return &kubeapi.RestoreToSnapshotResponse{}, nil
 }
 
+// ListSnapshots method implements ListSnapshots() from CRI.
+func (v *VirtletRuntimeService) ListSnapshots(ctx context.Context, in *kubeapi.ListSnapshotsRequest) (*kubeapi.ListSnapshotsResponse, error) {
+	glog.V(2).Infof("Listing snapshots for VM %s", in.VmID)
+
+	snapshots, err := v.virtTool.ListSnapshots(in.VmID)
+	if err != nil {
+		glog.Errorf("ListSnapshots failed for VM %s with error: %v", in.VmID, err)
+		return nil, err
+	}
+
+	return &kubeapi.ListSnapshotsResponse{SnapshotID: snapshots}, nil
+}
+
+// DeleteSnapshot method implements DeleteSnapshot() from CRI.
+func (v *VirtletRuntimeService) DeleteSnapshot(ctx context.Context, in *kubeapi.DeleteSnapshotRequest) (*kubeapi.DeleteSnapshotResponse, error) {
+	glog.V(2).Infof("DeleteSnapshot: deleting snapshot %s of VM %s", in.SnapshotID, in.VmID)
+
+	if err := checkSnapshotName(in.SnapshotID); err != nil {
+		return nil, err
+	}
+
+	if err := v.virtTool.DeleteSnapshot(in.VmID, in.SnapshotID); err != nil {
+		glog.Errorf("DeleteSnapshot failed for VM %s snapshot %s with error: %v", in.VmID, in.SnapshotID, err)
+		return nil, err
+	}
+	glog.V(2).Infof("DeleteSnapshot: deleted snapshot %s of VM %s", in.SnapshotID, in.VmID)
+
+	return &kubeapi.DeleteSnapshotResponse{}, nil
+}
+
 func checkSnapshotName(snapshotID string) error {
 
 	// some characters will be used internally
@@ -676,3 +756,37 @@ func checkSnapshotName(snapshotID string) error {
 
 	return nil
 }
+
+// DrainNode live-migrates every running container on this node to destURI,
+// one at a time via virtTool.MigrateContainer, stopping at the first
+// failure so a caller can see which container it was and retry. It's meant
+// to back a "node is being decommissioned" controller action.
+//
+// This isn't wired up as a CRI RPC: doing that needs a new method added to
+// kubeapi.RuntimeServiceServer, which is generated from a .proto file this
+// tree doesn't have (the same kind of gap noted on
+// pkg/libvirttools/migration.go's MigrateContainer, re: a gRPC handler
+// for a migrate-to pod annotation), so there's no request/response message type to
+// receive a drain call through, and no server-registration code to answer
+// it with. A controller that wants this today has to call DrainNode
+// in-process, or reach it through some other transport of its own until
+// that RPC exists.
+func (v *VirtletRuntimeService) DrainNode(ctx context.Context, destURI string, opts libvirttools.MigrationOptions) ([]string, error) {
+	containers, err := v.virtTool.ListContainers(nil)
+	if err != nil {
+		return nil, fmt.Errorf("DrainNode: failed to list containers: %v", err)
+	}
+
+	var migrated []string
+	for _, c := range containers {
+		if c.State != types.ContainerState_CONTAINER_RUNNING {
+			continue
+		}
+		glog.V(2).Infof("DrainNode: migrating container %s to %s", c.Id, destURI)
+		if err := v.virtTool.MigrateContainer(c.Id, destURI, opts); err != nil {
+			return migrated, fmt.Errorf("DrainNode: failed to migrate container %s: %v", c.Id, err)
+		}
+		migrated = append(migrated, c.Id)
+	}
+	return migrated, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// CacheStore is a generic, bucket-namespaced byte-blob store: the same
+// kvStore contract boltClient, memClient, etcdClient and sqliteClient
+// already implement for this package's own use, exported for a caller
+// outside pkg/metadata that needs a small persistent cache - e.g.
+// pkg/imageserver/mirror's manifest-digest cache - without depending on
+// the PodSandbox/Container Store interface this package can't declare
+// (see NewStore's doc comment).
+type CacheStore interface {
+	// Get returns bucket's value for key, or ok == false if bucket or
+	// key don't exist.
+	Get(bucket, key string) (value []byte, ok bool, err error)
+	// Put writes key's value in bucket, creating bucket if needed, and
+	// overwriting any existing value for key.
+	Put(bucket, key string, value []byte) error
+	// Delete removes key from bucket. It's a no-op, not an error, if
+	// bucket or key don't already exist.
+	Delete(bucket, key string) error
+	// ForEach calls fn once per (key, value) pair currently in bucket.
+	// It's a no-op, not an error, if bucket doesn't exist.
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	// Close releases the backend's underlying resources (file handle,
+	// network connection, ...).
+	Close() error
+}
+
+// kvStoreCache adapts an unexported kvStore backend to the exported
+// CacheStore interface, so NewCacheStore can hand one of this package's
+// existing backends to a caller outside the package without exposing
+// the backend's concrete type or its unexported method names.
+type kvStoreCache struct {
+	kvStore
+}
+
+func (c kvStoreCache) Get(bucket, key string) ([]byte, bool, error) {
+	return c.getBucket(bucket, key)
+}
+
+func (c kvStoreCache) Put(bucket, key string, value []byte) error {
+	return c.putBucket(bucket, key, value)
+}
+
+func (c kvStoreCache) Delete(bucket, key string) error {
+	return c.deleteBucket(bucket, key)
+}
+
+func (c kvStoreCache) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return c.forEachBucket(bucket, fn)
+}
+
+// NewCacheStore opens a CacheStore for dsn, using the same URL-style
+// scheme dispatch as NewStore ("bolt://", "mem://", "etcd://",
+// "sqlite://", or a bare path for backwards-compatible bolt). Unlike
+// NewStore, NewCacheStore doesn't return the PodSandbox/Container Store
+// interface - it returns the bucket-level CacheStore directly, since a
+// cache like pkg/imageserver/mirror's has no PodSandbox/Container
+// records to store.
+func NewCacheStore(dsn string) (CacheStore, error) {
+	scheme, rest, err := splitDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	var kv kvStore
+	switch scheme {
+	case "bolt":
+		db, err := newBoltStore(rest)
+		if err != nil {
+			return nil, err
+		}
+		kv = db.(kvStore)
+	case "mem":
+		kv = newMemStore()
+	case "etcd":
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("metadata.NewCacheStore: parsing etcd DSN %q: %v", dsn, err)
+		}
+		store, err := newEtcdStore(u.Host, u.Path)
+		if err != nil {
+			return nil, err
+		}
+		kv = store.(kvStore)
+	case "sqlite":
+		store, err := newSQLiteStore(rest)
+		if err != nil {
+			return nil, err
+		}
+		kv = store.(kvStore)
+	default:
+		return nil, fmt.Errorf("metadata.NewCacheStore: unknown backend scheme %q", scheme)
+	}
+	return kvStoreCache{kv}, nil
+}
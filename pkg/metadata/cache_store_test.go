@@ -0,0 +1,66 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import "testing"
+
+func TestNewCacheStoreMem(t *testing.T) {
+	cache, err := NewCacheStore("mem://")
+	if err != nil {
+		t.Fatalf("NewCacheStore(\"mem://\"): %v", err)
+	}
+	defer cache.Close()
+
+	if _, ok, err := cache.Get("b", "k"); err != nil || ok {
+		t.Fatalf("Get on empty store: got (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+
+	if err := cache.Put("b", "k", []byte("v1")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	v, ok, err := cache.Get("b", "k")
+	if err != nil || !ok || string(v) != "v1" {
+		t.Fatalf("Get after put: got (%q, %v, %v), want (\"v1\", true, nil)", v, ok, err)
+	}
+
+	if err := cache.Put("b", "k2", []byte("v2")); err != nil {
+		t.Fatalf("Put second key: %v", err)
+	}
+	seen := map[string]string{}
+	if err := cache.ForEach("b", func(key string, value []byte) error {
+		seen[key] = string(value)
+		return nil
+	}); err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	if seen["k"] != "v1" || seen["k2"] != "v2" || len(seen) != 2 {
+		t.Fatalf("ForEach: got %v, want {k:v1 k2:v2}", seen)
+	}
+
+	if err := cache.Delete("b", "k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok, _ := cache.Get("b", "k"); ok {
+		t.Fatalf("Get after delete: key still present")
+	}
+}
+
+func TestNewCacheStoreUnknownScheme(t *testing.T) {
+	if _, err := NewCacheStore("bogus://somewhere"); err == nil {
+		t.Fatal("NewCacheStore with an unknown scheme should error, got nil")
+	}
+}
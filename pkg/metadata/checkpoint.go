@@ -0,0 +1,67 @@
+/*
+Copyright 2017 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GarbageCollectOrphanedCheckpoints removes checkpoint state files
+// directly under dir whose container ID (the file's basename, minus
+// extension) isn't in liveContainerIDs, and returns the paths it
+// removed.
+//
+// This only does the filesystem half of the job described for
+// checkpoint/restore: sweeping dir for state files whose
+// types.ContainerInfo record has been deleted. The actual wiring -
+// types.ContainerInfo gaining a types.CheckpointInfo field, a Store
+// method to enumerate live container IDs, and CRI-level checkpoint and
+// restore verbs that call it - belongs in pkg/metadata's Store
+// interface and its boltdb implementation, neither of which this
+// package declares (client.go only has the DSN dispatch and the
+// backend-agnostic CacheStore/kvStore layer; there's no store.go, no
+// ContainerInfo type, and no fake store for tests to use). Wire this
+// into that Store once it exists, passing it the set of container IDs
+// the Store actually knows about.
+func GarbageCollectOrphanedCheckpoints(dir string, liveContainerIDs map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var removed []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		id := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		if liveContainerIDs[id] {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -17,6 +17,10 @@ limitations under the License.
 package metadata
 
 import (
+	"fmt"
+	"net/url"
+	"sync"
+
 	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
 )
@@ -25,25 +29,224 @@ type boltClient struct {
 	db *bolt.DB
 }
 
-// NewStore is a factory function for Store interface
-func NewStore(path string) (Store, error) {
-	db, err := bolt.Open(path, 0600, nil)
+// NewStore is a factory function for Store interface. dsn is a URL-style
+// data source name selecting the backend:
+//
+//   - "bolt:///var/lib/virtlet/metadata.db" (or a bare path, for backwards
+//     compatibility) opens a persistent BoltDB file at the given path.
+//   - "mem://" opens a memClient: a plain map[string][]byte per bucket,
+//     guarded by a sync.RWMutex, with no backing file at all, so tests
+//     and restartable containers don't need a persistent volume, and
+//     don't need to clean up a throwaway file on Close either.
+//   - "etcd://host:2379/prefix" opens an etcdClient against an etcd v3
+//     cluster, for metadata shared across multiple virtlet nodes rather
+//     than kept per-node.
+//   - "sqlite:///var/lib/virtlet/virtlet.db" opens a sqliteClient backed
+//     by a SQLite database file.
+//
+// "redis://host:6379/0" is recognized but not implemented: it would need
+// vendoring a Redis client, which nothing under vendor/ currently provides.
+func NewStore(dsn string) (Store, error) {
+	scheme, rest, err := splitDSN(dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &boltClient{db: db}
-	return client, nil
+	switch scheme {
+	case "bolt":
+		return newBoltStore(rest)
+	case "mem":
+		return newMemStore(), nil
+	case "etcd":
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("metadata.NewStore: parsing etcd DSN %q: %v", dsn, err)
+		}
+		return newEtcdStore(u.Host, u.Path)
+	case "sqlite":
+		return newSQLiteStore(rest)
+	case "redis":
+		return nil, fmt.Errorf("metadata.NewStore: %s backend is not available in this build (no vendored %s client)", scheme, scheme)
+	default:
+		return nil, fmt.Errorf("metadata.NewStore: unknown backend scheme %q", scheme)
+	}
+}
+
+// splitDSN parses a URL-style DSN into a backend scheme and the remainder
+// of the DSN that the backend should interpret itself (e.g. a filesystem
+// path). A DSN without a "scheme://" prefix is treated as a bare bolt path,
+// preserving the historical NewStore(path) behavior.
+func splitDSN(dsn string) (scheme, rest string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return "bolt", dsn, nil
+	}
+	return u.Scheme, u.Opaque + u.Path, nil
+}
+
+func newBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &boltClient{db: db}, nil
 }
 
-// Close releases all database resources
+// Close releases all database resources.
 func (b boltClient) Close() error {
 	return b.db.Close()
 }
 
+// kvStore is the common, backend-agnostic key/value contract every
+// backend (boltClient, memClient, etcdClient, sqliteClient) implements,
+// independent of whatever bucket/schema conventions a PodSandbox/
+// Container CRUD layer builds on top of it. CacheStore (cache_store.go)
+// exports this same contract for callers outside this package.
+type kvStore interface {
+	getBucket(bucket, key string) ([]byte, bool, error)
+	putBucket(bucket, key string, value []byte) error
+	deleteBucket(bucket, key string) error
+	forEachBucket(bucket string, fn func(key string, value []byte) error) error
+	Close() error
+}
+
+func (b boltClient) getBucket(bucket, key string) ([]byte, bool, error) {
+	var value []byte
+	var ok bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		if v := bkt.Get([]byte(key)); v != nil {
+			value = append([]byte(nil), v...)
+			ok = true
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+func (b boltClient) putBucket(bucket, key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(key), value)
+	})
+}
+
+func (b boltClient) deleteBucket(bucket, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.Delete([]byte(key))
+	})
+}
+
+func (b boltClient) forEachBucket(bucket string, fn func(key string, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+// memClient is the mem:// backend: each bucket is a plain
+// map[string][]byte, guarded by a single sync.RWMutex shared across all
+// buckets (the same coarse-grained locking boltClient gets for free from
+// bolt.DB's single-writer transactions - there's no per-bucket lock
+// striping here either). Nothing it does ever touches disk.
+type memClient struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+func newMemStore() *memClient {
+	return &memClient{buckets: map[string]map[string][]byte{}}
+}
+
+// Close is a no-op: memClient has no file or connection to release.
+func (m *memClient) Close() error {
+	return nil
+}
+
+func (m *memClient) getBucket(bucket, key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	bkt, ok := m.buckets[bucket]
+	if !ok {
+		return nil, false, nil
+	}
+	v, ok := bkt[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), v...), true, nil
+}
+
+func (m *memClient) putBucket(bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bkt, ok := m.buckets[bucket]
+	if !ok {
+		bkt = map[string][]byte{}
+		m.buckets[bucket] = bkt
+	}
+	bkt[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memClient) deleteBucket(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bkt, ok := m.buckets[bucket]
+	if !ok {
+		return nil
+	}
+	delete(bkt, key)
+	return nil
+}
+
+func (m *memClient) forEachBucket(bucket string, fn func(key string, value []byte) error) error {
+	m.mu.RLock()
+	// Snapshot the bucket contents before calling fn, so fn is free to
+	// call back into this memClient (e.g. putBucket/deleteBucket)
+	// without deadlocking on mu - bolt's own ForEach forbids mutating
+	// the bucket mid-iteration too, so this isn't a looser contract
+	// than boltClient's.
+	bkt, ok := m.buckets[bucket]
+	snapshot := make(map[string][]byte, len(bkt))
+	for k, v := range bkt {
+		snapshot[k] = v
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	for k, v := range snapshot {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // TODO: Verify libvirt domain update info or callbacks status before reset the resource update in progress flag
 //       if libvirt is still updating it, the don't reset it
 //
+// ResourceUpdateInProgress is keyed per resource kind (map[string]bool,
+// keyed by the string form of pkg/libvirttools.ResourceKind - memory, cpu,
+// disk, nic) rather than a single global bool, so a pending memory update
+// left in progress by a prior crash doesn't also block an unrelated CPU
+// update from starting.
 func (b boltClient) ResetResourceUpdateInProgress() error {
 	glog.V(4).Infof("Reset container resource update in progress")
 	sandboxes, err := b.ListPodSandboxes(nil)
@@ -63,9 +266,11 @@ func (b boltClient) ResetResourceUpdateInProgress() error {
 				return err
 			}
 
-			if containerInfo.Config.ResourceUpdateInProgress == true {
-				glog.Infof("Reset container resource update in progress flag for container %v", container.GetID())
-				b.SetResourceUpdateInProgress(container.GetID(), false)
+			for kind, inProgress := range containerInfo.Config.ResourceUpdateInProgress {
+				if inProgress {
+					glog.Infof("Reset %s resource update in progress flag for container %v", kind, container.GetID())
+					b.SetResourceUpdateInProgress(container.GetID(), kind, false)
+				}
 			}
 		}
 	}
@@ -0,0 +1,141 @@
+/*
+Copyright 2020 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// kvBackends runs a test against the bolt and mem kvStore backends, so a
+// behavior difference between them (e.g. one silently tolerating a
+// double put, the other erroring) shows up as a per-backend subtest
+// failure instead of only being caught by whichever one a given test
+// happened to be written against.
+func kvBackends(t *testing.T) map[string]kvStore {
+	tmpDir, err := ioutil.TempDir("", "virtlet-bolt-kv-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	db, err := bolt.Open(filepath.Join(tmpDir, "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return map[string]kvStore{
+		"bolt": boltClient{db: db},
+		"mem":  newMemStore(),
+	}
+}
+
+func TestKVStoreConformance(t *testing.T) {
+	for name, kv := range kvBackends(t) {
+		kv := kv
+		t.Run(name, func(t *testing.T) {
+			if _, ok, err := kv.getBucket("b", "k"); err != nil || ok {
+				t.Fatalf("getBucket on empty store: got (ok=%v, err=%v), want (false, nil)", ok, err)
+			}
+
+			if err := kv.putBucket("b", "k", []byte("v1")); err != nil {
+				t.Fatalf("putBucket: %v", err)
+			}
+			v, ok, err := kv.getBucket("b", "k")
+			if err != nil || !ok || string(v) != "v1" {
+				t.Fatalf("getBucket after put: got (%q, %v, %v), want (\"v1\", true, nil)", v, ok, err)
+			}
+
+			if err := kv.putBucket("b", "k", []byte("v2")); err != nil {
+				t.Fatalf("putBucket overwrite: %v", err)
+			}
+			if v, _, _ := kv.getBucket("b", "k"); string(v) != "v2" {
+				t.Fatalf("getBucket after overwrite: got %q, want \"v2\"", v)
+			}
+
+			if err := kv.putBucket("b", "k2", []byte("v3")); err != nil {
+				t.Fatalf("putBucket second key: %v", err)
+			}
+			seen := map[string]string{}
+			if err := kv.forEachBucket("b", func(key string, value []byte) error {
+				seen[key] = string(value)
+				return nil
+			}); err != nil {
+				t.Fatalf("forEachBucket: %v", err)
+			}
+			if seen["k"] != "v2" || seen["k2"] != "v3" || len(seen) != 2 {
+				t.Fatalf("forEachBucket: got %v, want {k:v2 k2:v3}", seen)
+			}
+
+			if err := kv.deleteBucket("b", "k"); err != nil {
+				t.Fatalf("deleteBucket: %v", err)
+			}
+			if _, ok, _ := kv.getBucket("b", "k"); ok {
+				t.Fatalf("getBucket after delete: key still present")
+			}
+
+			if err := kv.deleteBucket("nonexistent-bucket", "k"); err != nil {
+				t.Fatalf("deleteBucket on missing bucket should be a no-op, got: %v", err)
+			}
+			if err := kv.forEachBucket("nonexistent-bucket", func(string, []byte) error {
+				t.Fatal("forEachBucket on missing bucket called fn")
+				return nil
+			}); err != nil {
+				t.Fatalf("forEachBucket on missing bucket should be a no-op, got: %v", err)
+			}
+		})
+	}
+}
+
+// TestMemStoreDoesNotTouchDisk guards the specific defect this backend
+// replaced: NewStore("mem://") used to open a throwaway BoltDB file
+// under os.TempDir(). It asserts that exercising a memClient leaves the
+// temp directory exactly as it found it.
+func TestMemStoreDoesNotTouchDisk(t *testing.T) {
+	before, err := ioutil.ReadDir(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewStore("mem://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, ok := store.(*memClient)
+	if !ok {
+		t.Fatalf("NewStore(\"mem://\") returned %T, want *memClient", store)
+	}
+	if err := mem.putBucket("b", "k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := ioutil.ReadDir(os.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("mem:// store left files behind in %s: before=%d entries, after=%d entries", os.TempDir(), len(before), len(after))
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+)
+
+// etcdRequestTimeout bounds every individual etcd RPC this backend
+// issues, so a partitioned or overloaded cluster fails a single
+// get/put/delete rather than hanging the caller indefinitely.
+const etcdRequestTimeout = 5 * time.Second
+
+// etcdClient is the etcd:// backend: it implements kvStore over a flat
+// etcd keyspace by namespacing every key as "<prefix>/<bucket>/<key>",
+// so it can share metadata_test.go/client_test.go's bucket-oriented
+// assertions with boltClient and memClient despite etcd having no
+// native notion of buckets itself.
+type etcdClient struct {
+	cli    *clientv3.Client
+	prefix string
+}
+
+// newEtcdStore dials the etcd v3 cluster at endpoint (a "host:port" or
+// comma-separated list of them) and namespaces every key under prefix
+// (e.g. the DSN's path component, so "etcd://host:2379/virtlet" and
+// "etcd://host:2379/virtlet-staging" don't collide on the same cluster).
+func newEtcdStore(endpoint, prefix string) (Store, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoint, ","),
+		DialTimeout: etcdRequestTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("metadata.NewStore: connecting to etcd at %q: %v", endpoint, err)
+	}
+	return &etcdClient{cli: cli, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+// Close releases the underlying etcd client connection.
+func (e *etcdClient) Close() error {
+	return e.cli.Close()
+}
+
+// etcdKey builds the flat etcd key backing (bucket, key).
+func (e *etcdClient) etcdKey(bucket, key string) string {
+	return e.prefix + "/" + bucket + "/" + key
+}
+
+// etcdBucketPrefix builds the common prefix of every key in bucket, for
+// use with clientv3.WithPrefix() range reads.
+func (e *etcdClient) etcdBucketPrefix(bucket string) string {
+	return e.prefix + "/" + bucket + "/"
+}
+
+func (e *etcdClient) getBucket(bucket, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	resp, err := e.cli.Get(ctx, e.etcdKey(bucket, key))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, false, nil
+	}
+	return resp.Kvs[0].Value, true, nil
+}
+
+func (e *etcdClient) putBucket(bucket, key string, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := e.cli.Put(ctx, e.etcdKey(bucket, key), string(value))
+	return err
+}
+
+func (e *etcdClient) deleteBucket(bucket, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	_, err := e.cli.Delete(ctx, e.etcdKey(bucket, key))
+	return err
+}
+
+func (e *etcdClient) forEachBucket(bucket string, fn func(key string, value []byte) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	prefix := e.etcdBucketPrefix(bucket)
+	resp, err := e.cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), prefix)
+		if err := fn(key, kv.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrateBucketBoltToBolt exercises MigrateBucket across two
+// separate bolt DSNs - unlike mem://, a bolt DSN names a real file both
+// the source and destination NewCacheStore calls can independently
+// open, so this is a genuine copy rather than a same-process handoff.
+func TestMigrateBucketBoltToBolt(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "virtlet-migrate-bucket-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	srcDSN := filepath.Join(tmpDir, "src.db")
+	dstDSN := filepath.Join(tmpDir, "dst.db")
+
+	src, err := NewCacheStore(srcDSN)
+	if err != nil {
+		t.Fatalf("NewCacheStore(src): %v", err)
+	}
+	if err := src.Put("pod-sandboxes", "sandbox1", []byte("v1")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := src.Put("containers", "container1", []byte("v2")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("Close(src): %v", err)
+	}
+
+	if err := MigrateBucket(srcDSN, dstDSN, []string{"pod-sandboxes", "containers"}); err != nil {
+		t.Fatalf("MigrateBucket: %v", err)
+	}
+
+	dst, err := NewCacheStore(dstDSN)
+	if err != nil {
+		t.Fatalf("NewCacheStore(dst): %v", err)
+	}
+	defer dst.Close()
+
+	if v, ok, err := dst.Get("pod-sandboxes", "sandbox1"); err != nil || !ok || string(v) != "v1" {
+		t.Fatalf("dst Get(pod-sandboxes, sandbox1): got (%q, %v, %v), want (\"v1\", true, nil)", v, ok, err)
+	}
+	if v, ok, err := dst.Get("containers", "container1"); err != nil || !ok || string(v) != "v2" {
+		t.Fatalf("dst Get(containers, container1): got (%q, %v, %v), want (\"v2\", true, nil)", v, ok, err)
+	}
+}
+
+func TestMigrateBucketUnknownScheme(t *testing.T) {
+	if err := MigrateBucket("mem://", "bogus://somewhere", []string{"containers"}); err == nil {
+		t.Fatal("MigrateBucket with an unknown destination scheme should error, got nil")
+	}
+}
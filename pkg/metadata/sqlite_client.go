@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteBucketTableRe restricts bucket names accepted as SQLite table
+// names to a safe identifier subset, since table names can't be
+// parameterized through database/sql placeholders the way values can -
+// every bucket name this package actually uses (see e.g. the
+// "pod-sandboxes"/"containers" bucket names MigrateStore copies
+// byte-for-byte) satisfies this, so rejecting anything else is a safety
+// net rather than a real restriction in practice.
+var sqliteBucketTableRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// sqliteClient is the sqlite:// backend: each bucket becomes a table
+// "bucket_<name>" with a (key TEXT PRIMARY KEY, value BLOB) schema.
+type sqliteClient struct {
+	db *sql.DB
+}
+
+// newSQLiteStore opens (creating if needed) the SQLite database file at
+// path.
+func newSQLiteStore(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("metadata.NewStore: opening sqlite db %q: %v", path, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("metadata.NewStore: opening sqlite db %q: %v", path, err)
+	}
+	return &sqliteClient{db: db}, nil
+}
+
+// Close releases the underlying *sql.DB.
+func (s *sqliteClient) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteClient) table(bucket string) (string, error) {
+	if !sqliteBucketTableRe.MatchString(bucket) {
+		return "", fmt.Errorf("metadata: sqlite backend: invalid bucket name %q", bucket)
+	}
+	return "bucket_" + bucket, nil
+}
+
+func (s *sqliteClient) ensureTable(table string) error {
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (key TEXT PRIMARY KEY, value BLOB)`, table))
+	return err
+}
+
+func (s *sqliteClient) getBucket(bucket, key string) ([]byte, bool, error) {
+	table, err := s.table(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.ensureTable(table); err != nil {
+		return nil, false, err
+	}
+	var value []byte
+	err = s.db.QueryRow(fmt.Sprintf(`SELECT value FROM "%s" WHERE key = ?`, table), key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *sqliteClient) putBucket(bucket, key string, value []byte) error {
+	table, err := s.table(bucket)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureTable(table); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(fmt.Sprintf(`INSERT INTO "%s" (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, table), key, value)
+	return err
+}
+
+func (s *sqliteClient) deleteBucket(bucket, key string) error {
+	table, err := s.table(bucket)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureTable(table); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(fmt.Sprintf(`DELETE FROM "%s" WHERE key = ?`, table), key)
+	return err
+}
+
+func (s *sqliteClient) forEachBucket(bucket string, fn func(key string, value []byte) error) error {
+	table, err := s.table(bucket)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureTable(table); err != nil {
+		return err
+	}
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT key, value FROM "%s"`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
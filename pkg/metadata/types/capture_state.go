@@ -0,0 +1,27 @@
+/*
+Copyright 2017 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// CaptureState records the status of a per-VM traffic capture
+// (pkg/network/capture) against a container, so ListPodContainers / status
+// reports can expose it and operators can correlate captured traffic with
+// VM lifecycle.
+type CaptureState struct {
+	Enabled      bool   `json:"enabled"`
+	CurrentFile  string `json:"currentFile,omitempty"`
+	BytesWritten int64  `json:"bytesWritten"`
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2017 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import "fmt"
+
+// CheckpointInfo records a single libvirt managedsave/migrate-to-file
+// checkpoint taken for a container, analogous to CaptureState and
+// ImageDescriptor: a self-contained record meant to be embedded as a
+// field on ContainerInfo and persisted alongside it.
+type CheckpointInfo struct {
+	// StateFilePath is the managedsave/migration-file this checkpoint
+	// was written to, under the runtime's configured checkpoint
+	// directory.
+	StateFilePath string `json:"stateFilePath"`
+	// CreatedAt is when the checkpoint was taken, Unix seconds.
+	CreatedAt int64 `json:"createdAt"`
+	// KernelVersion and QEMUVersion are `uname -r` / `qemu-system-*
+	// --version` on the host that took the checkpoint, compared
+	// against the restoring host in CheckRestoreCompatibility.
+	KernelVersion string `json:"kernelVersion"`
+	QEMUVersion   string `json:"qemuVersion"`
+	// MachineType is the libvirt domain's machine type (e.g.
+	// "pc-q35-6.2"). QEMU can't restore a saved state into a domain
+	// with a different machine type, so this must match on restore.
+	MachineType string `json:"machineType"`
+	// MemoryBytes is the guest memory size recorded in the domain at
+	// checkpoint time.
+	MemoryBytes int64 `json:"memoryBytes"`
+	// ContentHash is a hex sha256 of StateFilePath's contents.
+	// CheckRestoreCompatibility doesn't compare it, and nothing in this
+	// package verifies a state file against it.
+	ContentHash string `json:"contentHash"`
+}
+
+// CompatibilityError explains why a CheckpointInfo can't be restored on
+// the current host: one of its recorded fields doesn't match what the
+// restoring host actually has.
+type CompatibilityError struct {
+	Field              string
+	Recorded, Current string
+}
+
+func (e *CompatibilityError) Error() string {
+	return fmt.Sprintf("checkpoint %s mismatch: recorded %q, host has %q", e.Field, e.Recorded, e.Current)
+}
+
+// CheckRestoreCompatibility compares c's recorded kernel version, QEMU
+// version, and machine type against the host attempting the restore,
+// returning a *CompatibilityError for the first mismatch it finds, or
+// nil if c looks safe to restore. A recorded field left empty (e.g. a
+// checkpoint taken before this field existed) isn't checked.
+//
+// Callers decide whether a mismatch is fatal or just a warning; this
+// just reports the facts.
+func (c CheckpointInfo) CheckRestoreCompatibility(hostKernel, hostQEMU, hostMachineType string) error {
+	switch {
+	case c.KernelVersion != "" && c.KernelVersion != hostKernel:
+		return &CompatibilityError{"kernel version", c.KernelVersion, hostKernel}
+	case c.QEMUVersion != "" && c.QEMUVersion != hostQEMU:
+		return &CompatibilityError{"QEMU version", c.QEMUVersion, hostQEMU}
+	case c.MachineType != "" && c.MachineType != hostMachineType:
+		return &CompatibilityError{"machine type", c.MachineType, hostMachineType}
+	}
+	return nil
+}
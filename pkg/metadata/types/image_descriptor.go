@@ -0,0 +1,82 @@
+/*
+Copyright 2017 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// VirtletDiskQcow2MediaType is the OCI media type used for a QCOW2 VM disk
+// layer pulled and verified as an OCI artifact.
+const VirtletDiskQcow2MediaType = "application/vnd.virtlet.disk.qcow2"
+
+// ImagePlatform mirrors the subset of an OCI image-spec Platform struct
+// virtlet cares about when selecting a disk artifact for the host.
+type ImagePlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// ImageDescriptor is an OCI image-spec content descriptor (mediaType,
+// digest, size, platform, annotations) recorded for a container's image
+// instead of the opaque image name string virtlet historically stored.
+// A zero-value ImageDescriptor (empty MediaType and Digest) represents an
+// image recorded before this field existed; see IsLegacy.
+type ImageDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      digest.Digest     `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    ImagePlatform     `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// IsLegacy reports whether this descriptor was synthesized for a container
+// recorded before ImageDescriptor existed (an old-format bare Image
+// string), rather than resolved from a real OCI pull. Legacy descriptors
+// carry no verifiable digest. IsLegacy is the only marker of that state;
+// nothing in this package re-resolves such a descriptor when the image is
+// pulled again.
+func (d ImageDescriptor) IsLegacy() bool {
+	return d.MediaType == "" && d.Digest == ""
+}
+
+// LegacyImageDescriptor synthesizes an ImageDescriptor for a container
+// recorded under the old bare "Image string" format, so loading it doesn't
+// fail just because no descriptor was ever persisted for it.
+func LegacyImageDescriptor() ImageDescriptor {
+	return ImageDescriptor{}
+}
+
+// Verify checks that content hashes to d.Digest, returning an error if it
+// doesn't (or if d has no digest to check against, e.g. a legacy
+// descriptor). Callers must fail the container start on a non-nil error
+// rather than falling back to unverified content.
+func (d ImageDescriptor) Verify(content []byte) error {
+	if d.Digest == "" {
+		return fmt.Errorf("image descriptor has no digest to verify against")
+	}
+	verifier := d.Digest.Verifier()
+	if _, err := verifier.Write(content); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("image content does not match digest %s", d.Digest)
+	}
+	return nil
+}
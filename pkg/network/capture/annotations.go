@@ -0,0 +1,59 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package capture drives per-VM AF_PACKET traffic capture from the CRI pod
+// annotations a sandbox carries, writing rotating PCAP files readable via
+// "kubectl cp" without requiring a shell in the VM itself.
+package capture
+
+import "strconv"
+
+const (
+	// AnnotationCapture, if set to "true", enables a capture on the pod's
+	// tap/macvtap interface.
+	AnnotationCapture = "virtlet.k8s/capture"
+	// AnnotationFilter carries a BPF filter expression restricting which
+	// packets are captured.
+	AnnotationFilter = "virtlet.k8s/capture-filter"
+	// AnnotationBytes caps each rotated capture segment's size, in bytes.
+	AnnotationBytes = "virtlet.k8s/capture-bytes"
+)
+
+// Config is the capture configuration derived from a pod's annotations.
+type Config struct {
+	Enabled bool
+	// Filter is a BPF filter expression, or "" to capture everything.
+	Filter string
+	// RotateBytes caps each capture segment's size; 0 means unbounded.
+	RotateBytes int64
+}
+
+// ConfigFromAnnotations parses a Config out of a pod's CRI annotations. A
+// missing or unparsable AnnotationBytes is treated as unbounded rather than
+// failing the whole parse, since a malformed size shouldn't prevent
+// capturing traffic at all.
+func ConfigFromAnnotations(annotations map[string]string) Config {
+	cfg := Config{
+		Enabled: annotations[AnnotationCapture] == "true",
+		Filter:  annotations[AnnotationFilter],
+	}
+	if v, ok := annotations[AnnotationBytes]; ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			cfg.RotateBytes = n
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,162 @@
+// +build linux
+
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capture
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"go.universe.tf/netboot/pcap"
+)
+
+const (
+	// htons(ETH_P_ALL): capture every ethertype, not just IP.
+	ethPAll = 0x0300
+
+	// Not exposed by the standard syscall package, but stable across
+	// Linux architectures.
+	soAttachFilter = 26
+)
+
+// sockFilter mirrors struct sock_filter from linux/filter.h: one classic
+// BPF instruction.
+type sockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// sockFprog mirrors struct sock_fprog from linux/filter.h: a BPF program
+// attached via SO_ATTACH_FILTER.
+type sockFprog struct {
+	Len     uint16
+	_       [6]byte // padding to match the kernel's pointer alignment
+	Filters *sockFilter
+}
+
+// Capture owns one AF_PACKET socket reading frames off a single host-side
+// tap/macvtap interface and writing them to a rotating PCAP file.
+type Capture struct {
+	iface string
+	fd    int
+	rw    *pcap.RotatingWriter
+
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Start opens an AF_PACKET socket on iface, optionally attaches filter as a
+// classic BPF program (callers compile the filter string from
+// Config.Filter themselves; this package doesn't vendor a BPF assembler),
+// and begins writing captured frames into a RotatingWriter rooted at
+// outDir/iface.pcap.
+func Start(iface string, filter []sockFilter, cfg Config, outDir string) (*Capture, error) {
+	ifIndex, err := interfaceIndex(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, ethPAll)
+	if err != nil {
+		return nil, fmt.Errorf("capture: opening AF_PACKET socket on %s: %v", iface, err)
+	}
+
+	sll := syscall.SockaddrLinklayer{Protocol: ethPAll, Ifindex: ifIndex}
+	if err := syscall.Bind(fd, &sll); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("capture: binding to %s: %v", iface, err)
+	}
+
+	if len(filter) > 0 {
+		if err := attachFilter(fd, filter); err != nil {
+			syscall.Close(fd)
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	rw, err := pcap.NewRotatingWriter(outDir+"/"+iface+".pcap", pcap.LinkEthernet, 262144, cfg.RotateBytes, 0, 0)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	c := &Capture{iface: iface, fd: fd, rw: rw, done: make(chan struct{})}
+	go c.loop()
+	return c, nil
+}
+
+func (c *Capture) loop() {
+	buf := make([]byte, 65536)
+	for {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			continue
+		}
+		frame := make([]byte, n)
+		copy(frame, buf[:n])
+		c.rw.Put(&pcap.Packet{Timestamp: time.Now(), Bytes: frame, Length: n})
+	}
+}
+
+// Stop closes the capture socket and the current PCAP segment file; the
+// segment isn't fsynced. It's safe to call from the same code path that
+// already tears down the tap device, and should also be invoked when the
+// owning lease is released.
+func (c *Capture) Stop() error {
+	var err error
+	c.stopOnce.Do(func() {
+		close(c.done)
+		syscall.Close(c.fd)
+		err = c.rw.Close()
+	})
+	return err
+}
+
+func attachFilter(fd int, filter []sockFilter) error {
+	prog := sockFprog{Len: uint16(len(filter)), Filters: &filter[0]}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), uintptr(syscall.SOL_SOCKET),
+		uintptr(soAttachFilter), uintptr(unsafe.Pointer(&prog)), unsafe.Sizeof(prog), 0)
+	if errno != 0 {
+		return fmt.Errorf("capture: SO_ATTACH_FILTER: %v", errno)
+	}
+	return nil
+}
+
+func interfaceIndex(name string) (int, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, fmt.Errorf("capture: looking up interface %s: %v", name, err)
+	}
+	return iface.Index, nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dhcpv4
+
+import (
+	"net"
+	"time"
+)
+
+// IdentityAssociation associates an IPv4 address with the MAC address of a
+// client, mirroring dhcp6.IdentityAssociation.
+type IdentityAssociation struct {
+	IPAddress net.IP
+	MAC       net.HardwareAddr
+	CreatedAt time.Time
+}
+
+// AddressPool keeps track of assigned and available IPv4 addresses.
+type AddressPool interface {
+	ReserveAddress(mac net.HardwareAddr, requested net.IP) (*IdentityAssociation, error)
+	ReleaseAddress(mac net.HardwareAddr)
+}
+
+// BootConfiguration provides the values served in DHCPv4 options.
+type BootConfiguration interface {
+	GetSubnetMask() net.IPMask
+	GetRouters() []net.IP
+	GetDNSServers() []net.IP
+	GetDomainName() string
+	GetLeaseTime() uint32
+	// GetBootServer/GetBootFile return options 66/67, used for PXE/iPXE.
+	GetBootServer() string
+	GetBootFile() string
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dhcpv4
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// cniIPConfig is the subset of a CNI ADD result's "ips[]" entries this pool
+// cares about. The field names and shape are identical across the 0.4.0 and
+// 1.0.0 CNI spec result versions, so a single struct covers both.
+type cniIPConfig struct {
+	Address string `json:"address"`
+	Gateway string `json:"gateway"`
+}
+
+// cniResult is the subset of a CNI ADD result this pool parses; unknown
+// fields (dns, routes, the 1.0.0 "interfaces" array, ...) are ignored.
+type cniResult struct {
+	CNIVersion string        `json:"cniVersion"`
+	IPs        []cniIPConfig `json:"ips"`
+}
+
+// CNIAddressPool implements AddressPool by delegating address assignment to
+// an external CNI IPAM plugin binary (host-local, dhcp, whereabouts, ...)
+// instead of managing a pool in-process, so operators can reuse whatever
+// address management the rest of the cluster's CNI already provides.
+type CNIAddressPool struct {
+	// PluginPath is the path to the CNI IPAM plugin binary to exec, e.g.
+	// "/opt/cni/bin/host-local".
+	PluginPath string
+	// NetConf is the CNI network configuration (including the "ipam"
+	// section) passed to the plugin on stdin, typically loaded from
+	// /etc/cni/net.d/virtlet-ipam.conf.
+	NetConf []byte
+	// IfName is the CNI_IFNAME reported to the plugin. Most IPAM-only
+	// plugins (host-local, whereabouts) don't act on it, but it must stay
+	// consistent between the ADD and the matching DEL.
+	IfName string
+
+	execCommand func(name string, args ...string) *exec.Cmd
+
+	mu           sync.Mutex
+	containerIDs map[string]string // MAC string -> CNI_CONTAINERID used for the matching ADD
+}
+
+// NewCNIAddressPool creates a CNIAddressPool that shells out to pluginPath,
+// passing it netConf on stdin, for every Reserve/ReleaseAddress call.
+func NewCNIAddressPool(pluginPath string, netConf []byte, ifName string) *CNIAddressPool {
+	return &CNIAddressPool{
+		PluginPath:   pluginPath,
+		NetConf:      netConf,
+		IfName:       ifName,
+		execCommand:  exec.Command,
+		containerIDs: make(map[string]string),
+	}
+}
+
+// ReserveAddress invokes the configured CNI IPAM plugin with CNI_COMMAND=ADD
+// and converts the returned ips[0].address into an IdentityAssociation.
+func (p *CNIAddressPool) ReserveAddress(mac net.HardwareAddr, requested net.IP) (*IdentityAssociation, error) {
+	containerID := fmt.Sprintf("%x", []byte(mac))
+
+	result, err := p.runPlugin("ADD", containerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.IPs) == 0 {
+		return nil, fmt.Errorf("dhcpv4: CNI plugin %s returned no addresses for %s", p.PluginPath, mac)
+	}
+
+	ip, _, err := net.ParseCIDR(result.IPs[0].Address)
+	if err != nil {
+		return nil, fmt.Errorf("dhcpv4: CNI plugin %s returned an unparsable address %q: %v", p.PluginPath, result.IPs[0].Address, err)
+	}
+
+	p.mu.Lock()
+	p.containerIDs[mac.String()] = containerID
+	p.mu.Unlock()
+
+	return &IdentityAssociation{IPAddress: ip, MAC: mac, CreatedAt: time.Now()}, nil
+}
+
+// ReleaseAddress invokes the configured CNI IPAM plugin with CNI_COMMAND=DEL
+// for the CNI_CONTAINERID that was used on the matching ReserveAddress, so
+// host-local's on-disk lease files (and similar IPAM GC) stay correct.
+func (p *CNIAddressPool) ReleaseAddress(mac net.HardwareAddr) {
+	p.mu.Lock()
+	containerID, ok := p.containerIDs[mac.String()]
+	delete(p.containerIDs, mac.String())
+	p.mu.Unlock()
+	if !ok {
+		containerID = fmt.Sprintf("%x", []byte(mac))
+	}
+
+	// Best-effort: a failed DEL shouldn't block tearing down the rest of
+	// the sandbox, but is worth the caller knowing about via logs.
+	if _, err := p.runPlugin("DEL", containerID); err != nil {
+		glog.Warningf("%v", err)
+	}
+}
+
+func (p *CNIAddressPool) runPlugin(command, containerID string) (*cniResult, error) {
+	cmd := p.execCommand(p.PluginPath)
+	cmd.Env = []string{
+		"CNI_COMMAND=" + command,
+		"CNI_CONTAINERID=" + containerID,
+		"CNI_IFNAME=" + p.IfName,
+	}
+	cmd.Stdin = bytes.NewReader(p.NetConf)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("dhcpv4: CNI plugin %s %s failed: %v: %s", p.PluginPath, command, err, stderr.String())
+	}
+
+	if command == "DEL" {
+		return nil, nil
+	}
+
+	result := &cniResult{}
+	if err := json.Unmarshal(stdout.Bytes(), result); err != nil {
+		return nil, fmt.Errorf("dhcpv4: parsing CNI plugin %s result: %v", p.PluginPath, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dhcpv4 implements a DHCPv4 (RFC 2131) server-side packet builder,
+// modeled after the DHCPv6 PacketBuilder in the vendored
+// go.universe.tf/netboot/dhcp6 package so Arktos VM pods can be offered
+// either v4, v6, or dual-stack leases through the same kind of API.
+package dhcpv4
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// MessageType is the value carried in DHCP option 53.
+type MessageType byte
+
+// DHCP message types relevant to the server side of a lease negotiation.
+const (
+	MsgDiscover MessageType = 1
+	MsgOffer    MessageType = 2
+	MsgRequest  MessageType = 3
+	MsgDecline  MessageType = 4
+	MsgAck      MessageType = 5
+	MsgNak      MessageType = 6
+	MsgRelease  MessageType = 7
+	MsgInform   MessageType = 8
+)
+
+// Option codes used by the PacketBuilder. Names follow RFC 2131 / RFC 2132.
+const (
+	OptSubnetMask     byte = 1
+	OptRouters        byte = 3
+	OptDNSServers     byte = 6
+	OptHostname       byte = 12
+	OptDomainName     byte = 15
+	OptRequestedIP    byte = 50
+	OptLeaseTime      byte = 51
+	OptMessageType    byte = 53
+	OptServerID       byte = 54
+	OptParameterList  byte = 55
+	OptMessage        byte = 56
+	OptClientID       byte = 61
+	OptTFTPServerName byte = 66
+	OptBootfileName   byte = 67
+	OptRelayAgentInfo byte = 82
+	OptVendorClassID  byte = 60
+	OptClientArch     byte = 93
+	OptClientUUID     byte = 97
+)
+
+// pxeClientVendorClass is the option 60 value iPXE/BIOS PXE ROMs send to
+// identify themselves as network-boot clients, see RFC 4578 section 2.2.
+const pxeClientVendorClass = "PXEClient"
+
+// VendorClassID returns the value of option 60, or nil if unset.
+func (o Options) VendorClassID() []byte {
+	return o[OptVendorClassID]
+}
+
+// IsPXEClient reports whether option 60 identifies the client as a PXE ROM
+// (as opposed to some other DHCP client sharing the same subnet).
+func (o Options) IsPXEClient() bool {
+	return bytes.HasPrefix(o.VendorClassID(), []byte(pxeClientVendorClass))
+}
+
+// ClientArch returns the RFC 4578 option 93 client system architecture
+// value, or 0 if unset.
+func (o Options) ClientArch() uint16 {
+	v, ok := o[OptClientArch]
+	if !ok || len(v) != 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(v)
+}
+
+// ClientUUID returns the option 97 client machine identifier (type byte
+// followed by a 16-byte UUID/GUID), or nil if unset.
+func (o Options) ClientUUID() []byte {
+	return o[OptClientUUID]
+}
+
+// Options is the set of DHCP options attached to a Packet, keyed by option
+// code. Values are the raw option payload, matching dhcp6.Options in shape.
+type Options map[byte][]byte
+
+// Packet is a DHCPv4/BOOTP message (RFC 2131 section 2). bootpHeader holds
+// the htype/hlen/hops/sname/file fields that the original PacketBuilder
+// didn't need to fill in for a server reply, but Unmarshal/Marshal (added
+// alongside BOOTP/PXE client support) must round-trip.
+type Packet struct {
+	Op      byte // 2 == BOOTREPLY
+	Xid     uint32
+	Secs    uint16
+	Flags   uint16
+	Ciaddr  [4]byte
+	Yiaddr  [4]byte
+	Siaddr  [4]byte
+	Giaddr  [4]byte
+	Chaddr  [16]byte
+	Options Options
+
+	bootpHeader
+}
+
+// Type returns the message type carried in option 53, or 0 if unset.
+func (o Options) Type() MessageType {
+	v, ok := o[OptMessageType]
+	if !ok || len(v) != 1 {
+		return 0
+	}
+	return MessageType(v[0])
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dhcpv4
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// PacketBuilder is used for generating DHCPOFFER/DHCPACK/DHCPNAK responses
+// to requests received from DHCPv4 clients.
+type PacketBuilder struct {
+	ServerID net.IP
+}
+
+// MakePacketBuilder creates a new PacketBuilder bound to a server identifier
+// address (the value advertised in option 54).
+func MakePacketBuilder(serverID net.IP) *PacketBuilder {
+	return &PacketBuilder{ServerID: serverID}
+}
+
+// BuildResponse generates a response packet for a request packet, given the
+// boot configuration and address pool to draw from.
+func (b *PacketBuilder) BuildResponse(in *Packet, mac net.HardwareAddr, requestedIP net.IP, configuration BootConfiguration, addresses AddressPool) (*Packet, error) {
+	switch in.Options.Type() {
+	case MsgDiscover:
+		association, err := addresses.ReserveAddress(mac, requestedIP)
+		if err != nil {
+			return b.makeNak(in, err), err
+		}
+		return b.makeMsgOffer(in, association, configuration), nil
+	case MsgRequest:
+		association, err := addresses.ReserveAddress(mac, requestedIP)
+		if err != nil {
+			return b.makeNak(in, err), err
+		}
+		return b.makeMsgAck(in, association, configuration), nil
+	case MsgRelease:
+		addresses.ReleaseAddress(mac)
+		return nil, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (b *PacketBuilder) makeMsgOffer(in *Packet, association *IdentityAssociation, cfg BootConfiguration) *Packet {
+	return b.makeLeaseReply(MsgOffer, in, association, cfg)
+}
+
+func (b *PacketBuilder) makeMsgAck(in *Packet, association *IdentityAssociation, cfg BootConfiguration) *Packet {
+	return b.makeLeaseReply(MsgAck, in, association, cfg)
+}
+
+func (b *PacketBuilder) makeLeaseReply(msgType MessageType, in *Packet, association *IdentityAssociation, cfg BootConfiguration) *Packet {
+	options := Options{
+		OptMessageType: {byte(msgType)},
+		OptServerID:    []byte(b.ServerID.To4()),
+		OptLeaseTime:   uint32Bytes(cfg.GetLeaseTime()),
+	}
+	if mask := cfg.GetSubnetMask(); mask != nil {
+		options[OptSubnetMask] = []byte(mask)
+	}
+	if routers := cfg.GetRouters(); len(routers) > 0 {
+		options[OptRouters] = concatIPv4(routers)
+	}
+	if dns := cfg.GetDNSServers(); len(dns) > 0 {
+		options[OptDNSServers] = concatIPv4(dns)
+	}
+	if domain := cfg.GetDomainName(); domain != "" {
+		options[OptDomainName] = []byte(domain)
+	}
+	if server := cfg.GetBootServer(); server != "" {
+		options[OptTFTPServerName] = []byte(server)
+	}
+	if file := cfg.GetBootFile(); file != "" {
+		options[OptBootfileName] = []byte(file)
+	}
+	// A per-arch boot file, when cfg provides one, replaces the static
+	// GetBootFile value; an error or empty result keeps the static one.
+	if archCfg, ok := cfg.(ArchBootConfiguration); ok {
+		if url, err := archCfg.GetBootFileURL(in.Options[OptClientID], in.Options.ClientArch()); err == nil && len(url) > 0 {
+			options[OptBootfileName] = url
+		}
+	}
+
+	out := &Packet{
+		Op:      2, // BOOTREPLY
+		Xid:     in.Xid,
+		Chaddr:  in.Chaddr,
+		Siaddr:  in.Siaddr,
+		Giaddr:  in.Giaddr,
+		Options: options,
+	}
+	copy(out.Yiaddr[:], association.IPAddress.To4())
+	return out
+}
+
+// makeNak produces a DHCPNAK, used when no address is available for a
+// DISCOVER/REQUEST.
+func (b *PacketBuilder) makeNak(in *Packet, err error) *Packet {
+	return &Packet{
+		Op:     2, // BOOTREPLY
+		Xid:    in.Xid,
+		Chaddr: in.Chaddr,
+		Giaddr: in.Giaddr,
+		Options: Options{
+			OptMessageType: {byte(MsgNak)},
+			OptServerID:    []byte(b.ServerID.To4()),
+			OptMessage:     []byte(err.Error()),
+		},
+	}
+}
+
+func uint32Bytes(v uint32) []byte {
+	bs := make([]byte, 4)
+	binary.BigEndian.PutUint32(bs, v)
+	return bs
+}
+
+func concatIPv4(ips []net.IP) []byte {
+	ret := make([]byte, 0, len(ips)*4)
+	for _, ip := range ips {
+		ret = append(ret, []byte(ip.To4())...)
+	}
+	return ret
+}
+
+// AddRelayAgentInfo attaches option 82 (circuit-id + remote-id sub-options)
+// to a reply, for relay scenarios where the relay expects it echoed back.
+func AddRelayAgentInfo(options Options, circuitID, remoteID []byte) {
+	sub := make([]byte, 0, len(circuitID)+len(remoteID)+4)
+	sub = append(sub, 1, byte(len(circuitID)))
+	sub = append(sub, circuitID...)
+	sub = append(sub, 2, byte(len(remoteID)))
+	sub = append(sub, remoteID...)
+	options[OptRelayAgentInfo] = sub
+}
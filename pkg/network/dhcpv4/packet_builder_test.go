@@ -0,0 +1,101 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dhcpv4
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+type fakePool struct {
+	association *IdentityAssociation
+	err         error
+	released    net.HardwareAddr
+}
+
+func (p *fakePool) ReserveAddress(mac net.HardwareAddr, requested net.IP) (*IdentityAssociation, error) {
+	return p.association, p.err
+}
+
+func (p *fakePool) ReleaseAddress(mac net.HardwareAddr) {
+	p.released = mac
+}
+
+type fakeConfig struct{}
+
+func (fakeConfig) GetSubnetMask() net.IPMask { return net.CIDRMask(24, 32) }
+func (fakeConfig) GetRouters() []net.IP      { return []net.IP{net.ParseIP("10.0.0.1")} }
+func (fakeConfig) GetDNSServers() []net.IP   { return []net.IP{net.ParseIP("10.0.0.2")} }
+func (fakeConfig) GetDomainName() string     { return "example.com" }
+func (fakeConfig) GetLeaseTime() uint32      { return 3600 }
+func (fakeConfig) GetBootServer() string     { return "10.0.0.3" }
+func (fakeConfig) GetBootFile() string       { return "pxelinux.0" }
+
+func TestBuildResponseOffer(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	pool := &fakePool{association: &IdentityAssociation{IPAddress: net.ParseIP("10.0.0.42"), MAC: mac}}
+	builder := MakePacketBuilder(net.ParseIP("10.0.0.1"))
+
+	in := &Packet{Xid: 42, Options: Options{OptMessageType: {byte(MsgDiscover)}}}
+	out, err := builder.BuildResponse(in, mac, nil, fakeConfig{}, pool)
+	if err != nil {
+		t.Fatalf("BuildResponse: %s", err)
+	}
+	if out.Options.Type() != MsgOffer {
+		t.Fatalf("expected DHCPOFFER, got %d", out.Options.Type())
+	}
+	if net.IP(out.Yiaddr[:]).String() != "10.0.0.42" {
+		t.Fatalf("expected offered address 10.0.0.42, got %s", net.IP(out.Yiaddr[:]))
+	}
+	if string(out.Options[OptSubnetMask]) != string([]byte(net.CIDRMask(24, 32))) {
+		t.Fatalf("expected subnet mask option to be set")
+	}
+}
+
+func TestBuildResponseNoAddrsAvailable(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	pool := &fakePool{err: errors.New("pool exhausted")}
+	builder := MakePacketBuilder(net.ParseIP("10.0.0.1"))
+
+	in := &Packet{Xid: 42, Options: Options{OptMessageType: {byte(MsgRequest)}}}
+	out, err := builder.BuildResponse(in, mac, nil, fakeConfig{}, pool)
+	if err == nil {
+		t.Fatalf("expected an error when the pool is exhausted")
+	}
+	if out.Options.Type() != MsgNak {
+		t.Fatalf("expected DHCPNAK, got %d", out.Options.Type())
+	}
+	if string(out.Options[OptMessage]) != "pool exhausted" {
+		t.Fatalf("expected NAK message to carry the pool error, got %q", out.Options[OptMessage])
+	}
+}
+
+func TestBuildResponseRelease(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	pool := &fakePool{}
+	builder := MakePacketBuilder(net.ParseIP("10.0.0.1"))
+
+	in := &Packet{Xid: 42, Options: Options{OptMessageType: {byte(MsgRelease)}}}
+	out, err := builder.BuildResponse(in, mac, nil, fakeConfig{}, pool)
+	if err != nil || out != nil {
+		t.Fatalf("expected no reply to a release, got %v, %v", out, err)
+	}
+	if pool.released.String() != mac.String() {
+		t.Fatalf("expected the pool to release %s, released %s", mac, pool.released)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dhcpv4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// magicCookie is the 4-byte value (RFC 1497) marking the start of the
+// option area in a BOOTP packet.
+var magicCookie = [4]byte{99, 130, 83, 99}
+
+const (
+	bootRequest = 1
+	bootReply   = 2
+
+	// fixedHeaderLen is the size of everything before sname/file: op,
+	// htype, hlen, hops, xid, secs, flags, ciaddr, yiaddr, siaddr, giaddr,
+	// chaddr.
+	fixedHeaderLen = 1 + 1 + 1 + 1 + 4 + 2 + 2 + 4 + 4 + 4 + 4 + 16
+	snameLen       = 64
+	fileLen        = 128
+	// minPacketLen is fixedHeaderLen + sname + file + the 4-byte magic
+	// cookie, with no options.
+	minPacketLen = fixedHeaderLen + snameLen + fileLen + 4
+)
+
+// Additional fixed-header fields not carried by the original Packet
+// struct, needed to answer legacy BIOS clients that rely on htype/hlen
+// (e.g. some PXE ROMs echo them back) and sname/file (overridden here by
+// options 66/67, but still zeroed/parsed for spec compliance).
+type bootpHeader struct {
+	Htype byte
+	Hlen  byte
+	Hops  byte
+	Sname [snameLen]byte
+	File  [fileLen]byte
+}
+
+// Unmarshal decodes a BOOTP/DHCPv4 packet off the wire.
+func Unmarshal(bs []byte) (*Packet, error) {
+	if len(bs) < minPacketLen {
+		return nil, fmt.Errorf("dhcpv4: packet too short: %d bytes", len(bs))
+	}
+
+	p := &Packet{}
+	p.Op = bs[0]
+	p.bootpHeader.Htype = bs[1]
+	p.bootpHeader.Hlen = bs[2]
+	p.bootpHeader.Hops = bs[3]
+	p.Xid = binary.BigEndian.Uint32(bs[4:8])
+	p.Secs = binary.BigEndian.Uint16(bs[8:10])
+	p.Flags = binary.BigEndian.Uint16(bs[10:12])
+	copy(p.Ciaddr[:], bs[12:16])
+	copy(p.Yiaddr[:], bs[16:20])
+	copy(p.Siaddr[:], bs[20:24])
+	copy(p.Giaddr[:], bs[24:28])
+	copy(p.Chaddr[:], bs[28:44])
+	copy(p.bootpHeader.Sname[:], bs[44:44+snameLen])
+	copy(p.bootpHeader.File[:], bs[44+snameLen:44+snameLen+fileLen])
+
+	cookieOffset := 44 + snameLen + fileLen
+	if !bytes.Equal(bs[cookieOffset:cookieOffset+4], magicCookie[:]) {
+		return nil, fmt.Errorf("dhcpv4: missing magic cookie")
+	}
+
+	options, err := UnmarshalOptions(bs[cookieOffset+4:])
+	if err != nil {
+		return nil, err
+	}
+	p.Options = options
+	return p, nil
+}
+
+// UnmarshalOptions decodes a sequence of TLV options terminated by the 0xFF
+// end option (or end of input), skipping 0x00 padding between options.
+func UnmarshalOptions(bs []byte) (Options, error) {
+	ret := make(Options)
+	for len(bs) > 0 {
+		code := bs[0]
+		if code == 0 { // pad
+			bs = bs[1:]
+			continue
+		}
+		if code == 0xff { // end
+			break
+		}
+		if len(bs) < 2 {
+			return nil, fmt.Errorf("dhcpv4: truncated option %d header", code)
+		}
+		l := int(bs[1])
+		if len(bs) < 2+l {
+			return nil, fmt.Errorf("dhcpv4: option %d claims %d bytes of payload, but only has %d", code, l, len(bs)-2)
+		}
+		ret[code] = append(ret[code], bs[2:2+l]...)
+		bs = bs[2+l:]
+	}
+	return ret, nil
+}
+
+// Marshal serializes p into a BOOTP/DHCPv4 wire packet.
+func (p *Packet) Marshal() ([]byte, error) {
+	buf := make([]byte, 0, minPacketLen+64)
+	buf = append(buf, p.Op, p.bootpHeader.Htype, p.bootpHeader.Hlen, p.bootpHeader.Hops)
+
+	xid := make([]byte, 4)
+	binary.BigEndian.PutUint32(xid, p.Xid)
+	buf = append(buf, xid...)
+
+	secsFlags := make([]byte, 4)
+	binary.BigEndian.PutUint16(secsFlags[0:2], p.Secs)
+	binary.BigEndian.PutUint16(secsFlags[2:4], p.Flags)
+	buf = append(buf, secsFlags...)
+
+	buf = append(buf, p.Ciaddr[:]...)
+	buf = append(buf, p.Yiaddr[:]...)
+	buf = append(buf, p.Siaddr[:]...)
+	buf = append(buf, p.Giaddr[:]...)
+	buf = append(buf, p.Chaddr[:]...)
+	buf = append(buf, p.bootpHeader.Sname[:]...)
+	buf = append(buf, p.bootpHeader.File[:]...)
+	buf = append(buf, magicCookie[:]...)
+
+	for code, value := range p.Options {
+		buf = append(buf, code, byte(len(value)))
+		buf = append(buf, value...)
+	}
+	buf = append(buf, 0xff)
+
+	return buf, nil
+}
+
+// ShouldDiscard returns an error if p fails the minimal validation a server
+// should enforce before acting on it: DISCOVER must carry a client
+// identifier (option 61) and REQUEST must carry the server's own server
+// identifier (option 54), mirroring dhcp6's shouldDiscardSolicit/Request.
+func (p *Packet) ShouldDiscard(serverID []byte) error {
+	switch p.Options.Type() {
+	case MsgDiscover:
+		if _, ok := p.Options[OptClientID]; !ok {
+			return fmt.Errorf("'Discover' packet has no client-id option")
+		}
+		return nil
+	case MsgRequest:
+		sid, ok := p.Options[OptServerID]
+		if !ok {
+			return fmt.Errorf("'Request' packet has no server-id option")
+		}
+		if !bytes.Equal(sid, serverID) {
+			return fmt.Errorf("'Request' packet's server-id option (%v) is different from ours (%v)", sid, serverID)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
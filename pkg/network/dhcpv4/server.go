@@ -0,0 +1,137 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dhcpv4
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ArchBootConfiguration is implemented by a BootConfiguration that can also
+// pick a boot file URL per (client-id, RFC 4578 client architecture)
+// tuple, mirroring dhcp6.BootConfiguration.GetBootURL. It's a separate,
+// optional interface (checked with a type assertion when BuildResponse
+// builds an OFFER or ACK)
+// rather than a new required BootConfiguration method, so a plain static
+// BootConfiguration (GetBootServer/GetBootFile) keeps working unchanged.
+type ArchBootConfiguration interface {
+	GetBootFileURL(clientID []byte, arch uint16) ([]byte, error)
+}
+
+// transactionKey identifies one DHCP transaction by the client's chaddr
+// and the xid it chose.
+type transactionKey struct {
+	chaddr [16]byte
+	xid    uint32
+}
+
+// TransactionStore tracks DHCPv4 transactions keyed by (chaddr, xid).
+// Server.HandleRequest records each response it builds with Put; nothing
+// in this package calls Get or Delete, so a REQUEST is answered by a
+// fresh BuildResponse rather than from the recorded DISCOVER response,
+// recorded entries are kept for the Server's lifetime, and no DHCPv6
+// code uses the store.
+type TransactionStore struct {
+	mu           sync.Mutex
+	transactions map[transactionKey]*Packet
+}
+
+// NewTransactionStore creates an empty TransactionStore.
+func NewTransactionStore() *TransactionStore {
+	return &TransactionStore{transactions: make(map[transactionKey]*Packet)}
+}
+
+// Put records resp as the response given for the transaction identified by
+// req.
+func (s *TransactionStore) Put(req, resp *Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions[transactionKeyOf(req)] = resp
+}
+
+// Get returns the previously recorded response for the transaction
+// identified by req, if any.
+func (s *TransactionStore) Get(req *Packet) (*Packet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.transactions[transactionKeyOf(req)]
+	return resp, ok
+}
+
+// Delete forgets the transaction identified by req, once it's been
+// acknowledged or released.
+func (s *TransactionStore) Delete(req *Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.transactions, transactionKeyOf(req))
+}
+
+func transactionKeyOf(p *Packet) transactionKey {
+	return transactionKey{chaddr: p.Chaddr, xid: p.Xid}
+}
+
+// Server answers DHCPv4/BOOTP DISCOVER/REQUEST from legacy BIOS PXE
+// clients, using this package's BootConfiguration/AddressPool/PacketBuilder.
+// Those are modeled on dhcp6's but are separate types, and a Server shares
+// no state or boot dispatch with a DHCPv6 server.
+type Server struct {
+	Builder       *PacketBuilder
+	Configuration BootConfiguration
+	Addresses     AddressPool
+	ServerID      []byte
+
+	Transactions *TransactionStore
+}
+
+// NewServer creates a Server. ServerID is this server's own DHCP option 54
+// value, used to validate incoming REQUESTs via ShouldDiscard.
+func NewServer(builder *PacketBuilder, cfg BootConfiguration, addresses AddressPool, serverID []byte) *Server {
+	return &Server{
+		Builder:       builder,
+		Configuration: cfg,
+		Addresses:     addresses,
+		ServerID:      serverID,
+		Transactions:  NewTransactionStore(),
+	}
+}
+
+// HandleRequest validates req, builds the response via the configured
+// PacketBuilder, and records a non-nil response in s.Transactions under
+// req's (chaddr, xid); nothing reads it back (see TransactionStore).
+func (s *Server) HandleRequest(req *Packet) (*Packet, error) {
+	if err := req.ShouldDiscard(s.ServerID); err != nil {
+		return nil, fmt.Errorf("dhcpv4: discarding packet: %v", err)
+	}
+
+	mac := macOf(req)
+	resp, err := s.Builder.BuildResponse(req, mac, req.Options[OptRequestedIP], s.Configuration, s.Addresses)
+	if err != nil {
+		return resp, err
+	}
+	if resp != nil {
+		s.Transactions.Put(req, resp)
+	}
+	return resp, nil
+}
+
+func macOf(p *Packet) []byte {
+	hlen := int(p.bootpHeader.Hlen)
+	if hlen <= 0 || hlen > 16 {
+		hlen = 6
+	}
+	return p.Chaddr[:hlen]
+}
@@ -19,12 +19,14 @@ package cgroups
 import (
 	"fmt"
 	"github.com/containerd/cgroups"
+	cgroupsv2 "github.com/containerd/cgroups/v2"
 	"github.com/golang/glog"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/Mirantis/virtlet/pkg/fs"
@@ -33,13 +35,41 @@ import (
 
 const (
 	cgroupfs = "/sys/fs/cgroup"
+
+	// unifiedHierarchyMarker exists at cgroupfs root only when the host is
+	// running the cgroups v2 unified hierarchy.
+	unifiedHierarchyMarker = "cgroup.controllers"
+)
+
+// CgroupVersion identifies which cgroup hierarchy layout a Manager
+// operates against.
+type CgroupVersion int
+
+const (
+	// V1 is the legacy per-controller cgroup hierarchy, where
+	// /proc/<pid>/cgroup lines look like "6:memory:/path".
+	V1 CgroupVersion = iota
+	// V2 is the single unified hierarchy, where every line in
+	// /proc/<pid>/cgroup looks like "0::/path" and controller files are
+	// named e.g. cpu.max, memory.max.
+	V2
 )
 
+// detectCgroupVersion reports which hierarchy the host's cgroupfs is
+// running, by checking for the v2-only cgroup.controllers file.
+func detectCgroupVersion() CgroupVersion {
+	if _, err := os.Stat(filepath.Join(cgroupfs, unifiedHierarchyMarker)); err == nil {
+		return V2
+	}
+	return V1
+}
+
 // Controller represents a named controller for a process
 type Controller struct {
-	fsys fs.FileSystem
-	name string
-	path string
+	fsys    fs.FileSystem
+	name    string
+	path    string
+	version CgroupVersion
 }
 
 // Manager provides an interface to operate on linux cgroups
@@ -51,13 +81,17 @@ type Manager interface {
 	GetProcessController(controllerName string) (*Controller, error)
 	// MoveProcess move the process to the path under a cgroup controller
 	MoveProcess(controller, path string) error
+	// Version reports which cgroup hierarchy layout this Manager is
+	// operating against.
+	Version() CgroupVersion
 }
 
 // RealManager provides an implementation of Manager which is
 // using default linux system paths to access info about cgroups for processes.
 type RealManager struct {
-	fsys fs.FileSystem
-	pid  string
+	fsys    fs.FileSystem
+	pid     string
+	version CgroupVersion
 }
 
 var _ Manager = &RealManager{}
@@ -67,7 +101,12 @@ func NewManager(pid interface{}, fsys fs.FileSystem) Manager {
 	if fsys == nil {
 		fsys = fs.RealFileSystem
 	}
-	return &RealManager{fsys: fsys, pid: utils.Stringify(pid)}
+	return &RealManager{fsys: fsys, pid: utils.Stringify(pid), version: detectCgroupVersion()}
+}
+
+// Version is an implementation of Version method of Manager interface.
+func (c *RealManager) Version() CgroupVersion {
+	return c.version
 }
 
 // GetProcessControllers is an implementation of GetProcessControllers method
@@ -97,17 +136,30 @@ func (c *RealManager) GetProcessControllers() (map[string]string, error) {
 
 		// split entries like:
 		// "6:memory:/user.slice/user-xxx.slice/session-xx.scope"
+		// on cgroups v2, the controller field is empty: "0::/user.slice/..."
 		parts := strings.SplitN(line, ":", 3)
 
 		name := parts[1]
-		if strings.HasPrefix(name, "name=") {
-			// Handle named cgroup hierarchies like name=systemd
-			// The corresponding directory tree will be /sys/fs/cgroup/systemd
-			name = name[5:]
-		}
+		if name == "" {
+			// Unified hierarchy: this single line covers every enabled
+			// controller, all rooted at the same path.
+			names, err := c.unifiedControllerNames()
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range names {
+				ctrls[n] = parts[2]
+			}
+		} else {
+			if strings.HasPrefix(name, "name=") {
+				// Handle named cgroup hierarchies like name=systemd
+				// The corresponding directory tree will be /sys/fs/cgroup/systemd
+				name = name[5:]
+			}
 
-		// use second part as controller name and third as its path
-		ctrls[name] = parts[2]
+			// use second part as controller name and third as its path
+			ctrls[name] = parts[2]
+		}
 
 		if err == io.EOF {
 			break
@@ -117,6 +169,22 @@ func (c *RealManager) GetProcessControllers() (map[string]string, error) {
 	return ctrls, nil
 }
 
+// unifiedControllerNames returns the controllers enabled for the unified
+// hierarchy, as listed in /sys/fs/cgroup/cgroup.controllers.
+func (c *RealManager) unifiedControllerNames() ([]string, error) {
+	fr, err := c.fsys.GetDelimitedReader(filepath.Join(cgroupfs, unifiedHierarchyMarker))
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+
+	line, err := fr.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return strings.Fields(line), nil
+}
+
 // GetProcessController is an implementation of GetProcessController method
 // of Manager interface.
 func (c *RealManager) GetProcessController(controllerName string) (*Controller, error) {
@@ -131,9 +199,10 @@ func (c *RealManager) GetProcessController(controllerName string) (*Controller,
 	}
 
 	return &Controller{
-		fsys: c.fsys,
-		name: controllerName,
-		path: controllerPath,
+		fsys:    c.fsys,
+		name:    controllerName,
+		path:    controllerPath,
+		version: c.version,
 	}, nil
 }
 
@@ -148,6 +217,9 @@ func (c *RealManager) MoveProcess(controller, path string) error {
 
 // Set sets the value of a controller setting
 func (c *Controller) Set(name string, value interface{}) error {
+	if c.version == V2 {
+		return c.setV2(name, value)
+	}
 	return c.fsys.WriteFile(
 		filepath.Join(cgroupfs, c.name, c.path, c.name+"."+name),
 		[]byte(utils.Stringify(value)),
@@ -155,6 +227,105 @@ func (c *Controller) Set(name string, value interface{}) error {
 	)
 }
 
+// cfsPeriodDefault is used as cpu.max's period when no cpu.max file exists
+// yet to read the current one from.
+const cfsPeriodDefault = 100000
+
+// setV2 translates the v1-style name/value pairs used by VM resource
+// updates (shares, quota/period, memory limit) into their cgroups v2
+// unified-hierarchy equivalents.
+func (c *Controller) setV2(name string, value interface{}) error {
+	switch name {
+	case "shares":
+		shares, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+		return c.writeV2File("cpu.weight", utils.Stringify(sharesToWeight(shares)))
+	case "cfs_quota_us":
+		quota, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+		return c.writeCPUMax(quota, -1)
+	case "cfs_period_us":
+		period, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+		return c.writeCPUMax(-1, period)
+	case "limit_in_bytes":
+		return c.writeV2File("memory.max", utils.Stringify(value))
+	default:
+		return fmt.Errorf("no cgroups v2 translation for %s.%s", c.name, name)
+	}
+}
+
+// writeCPUMax updates cpu.max, which holds "<quota> <period>" as a single
+// file in the unified hierarchy. A negative quota or period leaves that
+// field as whatever is currently on disk (or the default, if unreadable).
+func (c *Controller) writeCPUMax(quota, period int64) error {
+	curQuota, curPeriod := int64(-1), int64(cfsPeriodDefault)
+
+	if fr, err := c.fsys.GetDelimitedReader(filepath.Join(cgroupfs, c.path, "cpu.max")); err == nil {
+		defer fr.Close()
+		if line, err := fr.ReadString('\n'); err == nil || err == io.EOF {
+			if fields := strings.Fields(line); len(fields) == 2 {
+				if fields[0] != "max" {
+					if v, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+						curQuota = v
+					}
+				}
+				if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+					curPeriod = v
+				}
+			}
+		}
+	}
+
+	if quota >= 0 {
+		curQuota = quota
+	}
+	if period >= 0 {
+		curPeriod = period
+	}
+
+	quotaStr := "max"
+	if curQuota >= 0 {
+		quotaStr = strconv.FormatInt(curQuota, 10)
+	}
+	return c.writeV2File("cpu.max", fmt.Sprintf("%s %d", quotaStr, curPeriod))
+}
+
+// writeV2File writes a controller setting file directly under the unified
+// hierarchy path, where (unlike v1) all controllers share one directory.
+func (c *Controller) writeV2File(file, value string) error {
+	return c.fsys.WriteFile(filepath.Join(cgroupfs, c.path, file), []byte(value), 0644)
+}
+
+// sharesToWeight linearly maps a v1 cpu.shares value (range [2, 262144])
+// onto the v2 cpu.weight range ([1, 10000]), per the kernel's documented
+// cgroup v1/v2 CPU controller conversion.
+func sharesToWeight(shares int64) int64 {
+	if shares < 2 {
+		shares = 2
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	default:
+		return strconv.ParseInt(utils.Stringify(value), 10, 64)
+	}
+}
+
 // Check if a particular cgroup exists for a given controller
 func (c *Controller) CgroupExists(ctl string, cgPath string) bool {
 	fullPath := path.Join(cgroupfs, ctl, cgPath)
@@ -171,13 +342,46 @@ func (c *Controller) CgroupExists(ctl string, cgPath string) bool {
 
 }
 
-// Create a new CGroup with desired resource settings
-func CreateChildCgroup(cgParent string, cgName string, res *specs.LinuxResources) (cgroups.Cgroup, error) {
+// CgroupHandle is a handle to a cgroup CreateChildCgroup just created,
+// under whichever of the v1 (per-controller) or v2 (unified) hierarchies
+// detectCgroupVersion found active - callers that only need to confirm
+// the cgroup exists and log its state don't need to branch on which
+// hierarchy was used themselves, the same way UpdateVmCgroup already
+// dispatches between V1/V2 internally for updates.
+type CgroupHandle struct {
+	v1 cgroups.Cgroup
+	v2 *cgroupsv2.Manager
+}
+
+// State reports the new cgroup's state, for logging. cgroups v2's
+// Manager has no direct equivalent of v1's State, so v2 handles always
+// report "created" rather than a fabricated v1-style state name.
+func (h *CgroupHandle) State() string {
+	if h.v1 != nil {
+		return string(h.v1.State())
+	}
+	return "created"
+}
+
+// Create a new CGroup with desired resource settings. It dispatches to the
+// v2 unified hierarchy automatically when detectCgroupVersion reports one
+// is active, the same way UpdateVmCgroup dispatches to UpdateVmCgroupV2 -
+// callers don't need to call CreateChildCgroupV2 themselves to support a
+// cgroups v2 host.
+func CreateChildCgroup(cgParent string, cgName string, res *specs.LinuxResources) (*CgroupHandle, error) {
 	// if cgParent is not set, default to root
 	if cgParent == "" {
 		cgParent = "/"
 	}
 
+	if detectCgroupVersion() == V2 {
+		v2, err := CreateChildCgroupV2(cgParent, cgName, res)
+		if err != nil {
+			return nil, err
+		}
+		return &CgroupHandle{v2: v2}, nil
+	}
+
 	parent, err := cgroups.Load(cgroups.V1, cgroups.StaticPath(cgParent))
 	if err != nil {
 		glog.Errorf("Failed to load parent cgroup %v. error %v", cgParent, err)
@@ -190,12 +394,28 @@ func CreateChildCgroup(cgParent string, cgName string, res *specs.LinuxResources
 		return nil, err
 	}
 
-	return cg, nil
+	return &CgroupHandle{v1: cg}, nil
+}
+
+// CreateChildCgroupV2 creates a new cgroup under the unified hierarchy with
+// desired resource settings, translating the OCI specs.LinuxResources used
+// by the rest of the codebase into cgroups v2's Resources struct.
+func CreateChildCgroupV2(cgParent string, cgName string, res *specs.LinuxResources) (*cgroupsv2.Manager, error) {
+	if cgParent == "" {
+		cgParent = "/"
+	}
+
+	return cgroupsv2.NewManager(cgroupfs, path.Join(cgParent, cgName), cgroupsv2.ToResources(res))
 }
 
 // Update a CGroup with desired resource settings
 func UpdateVmCgroup(cgPath string, res *specs.LinuxResources) error {
 	glog.V(4).Infof("Update VM Cgroup: %v, with resource %v", cgPath, res)
+
+	if detectCgroupVersion() == V2 {
+		return UpdateVmCgroupV2(cgPath, res)
+	}
+
 	cg, err := cgroups.Load(cgroups.V1, cgroups.StaticPath(cgPath))
 	if err != nil {
 		glog.Errorf("Failed to load cgroup %v. error %v", cgPath, err)
@@ -210,3 +430,20 @@ func UpdateVmCgroup(cgPath string, res *specs.LinuxResources) error {
 
 	return nil
 }
+
+// UpdateVmCgroupV2 updates a cgroup under the unified hierarchy with
+// desired resource settings.
+func UpdateVmCgroupV2(cgPath string, res *specs.LinuxResources) error {
+	cg, err := cgroupsv2.LoadManager(cgroupfs, cgPath)
+	if err != nil {
+		glog.Errorf("Failed to load cgroup %v. error %v", cgPath, err)
+		return err
+	}
+
+	if err := cg.Update(cgroupsv2.ToResources(res)); err != nil {
+		glog.Errorf("Failed to update cgroup %v. error %v", cgPath, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selinux
+
+import "testing"
+
+// TestMarshalContextRoundTrip guards the persist/restore path: whatever
+// MarshalContext produces for a RelabelContext must read back
+// byte-for-byte via UnmarshalContext, since that round trip is what a
+// caller relies on to call RestoreLabel again after a process restart.
+func TestMarshalContextRoundTrip(t *testing.T) {
+	want := RelabelContext{Path: "/var/lib/virtlet/volumes/vol1", PriorContext: "system_u:object_r:svirt_sandbox_file_t:s0"}
+
+	data, err := MarshalContext(want)
+	if err != nil {
+		t.Fatalf("MarshalContext: %v", err)
+	}
+
+	got, err := UnmarshalContext(data)
+	if err != nil {
+		t.Fatalf("UnmarshalContext: %v", err)
+	}
+	if got != want {
+		t.Fatalf("UnmarshalContext(MarshalContext(ctx)) = %+v, want %+v", got, want)
+	}
+}
+
+// TestApplyLabelIfEnabledDisabled checks that a disabled toggle skips
+// ApplyLabel entirely (and so never shells out to chcon), returning a
+// zero-PriorContext RelabelContext for the given path - the same shape
+// RestoreLabel treats as a no-op.
+func TestApplyLabelIfEnabledDisabled(t *testing.T) {
+	ctx, err := ApplyLabelIfEnabled(false, "/some/path", RelabelShared)
+	if err != nil {
+		t.Fatalf("ApplyLabelIfEnabled(false, ...): %v", err)
+	}
+	if ctx.Path != "/some/path" || ctx.PriorContext != "" {
+		t.Fatalf("ApplyLabelIfEnabled(false, ...) = %+v, want {Path: /some/path, PriorContext: \"\"}", ctx)
+	}
+	if err := RestoreLabel(ctx); err != nil {
+		t.Fatalf("RestoreLabel of a disabled ApplyLabelIfEnabled result should be a no-op, got: %v", err)
+	}
+}
+
+// TestApplyLabelNoneIsNoOp checks that RelabelNone skips chcon the same
+// way a disabled toggle does.
+func TestApplyLabelNoneIsNoOp(t *testing.T) {
+	ctx, err := ApplyLabel("/some/path", RelabelNone)
+	if err != nil {
+		t.Fatalf("ApplyLabel(path, RelabelNone): %v", err)
+	}
+	if ctx.Path != "/some/path" || ctx.PriorContext != "" {
+		t.Fatalf("ApplyLabel(path, RelabelNone) = %+v, want {Path: /some/path, PriorContext: \"\"}", ctx)
+	}
+}
+
+func TestRelabelType(t *testing.T) {
+	if got := relabelType(RelabelShared); got != "svirt_sandbox_file_t" {
+		t.Errorf("relabelType(RelabelShared) = %q, want svirt_sandbox_file_t", got)
+	}
+	if got := relabelType(RelabelPrivate); got != "svirt_lxc_file_t" {
+		t.Errorf("relabelType(RelabelPrivate) = %q, want svirt_lxc_file_t", got)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virt
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Checkpoint tarball member names, modeled after the checkpointctl
+// metadata format used by container runtimes: the libvirt domain XML, a
+// JSON descriptor of what's being checkpointed, and the engine-specific
+// saved-state blob (for us, libvirt's managed-save state file).
+const (
+	checkpointDomainXMLName = "domain.xml"
+	checkpointConfigName    = "config.dump"
+	checkpointStateName     = "state.img"
+)
+
+// CheckpointOptions controls how Checkpoint captures a domain's state.
+type CheckpointOptions struct {
+	// IncludeMemory, when true, includes the libvirt managed-save state
+	// (the domain's in-memory state, as produced by `virsh save`) in the
+	// checkpoint tarball. When false, only the domain XML and config are
+	// captured, for a disk-only checkpoint.
+	IncludeMemory bool
+}
+
+// CheckpointConfig is the JSON descriptor recorded as config.dump inside
+// the checkpoint tarball, identifying which pod/container the checkpoint
+// belongs to.
+type CheckpointConfig struct {
+	PodID          string `json:"podId"`
+	ContainerID    string `json:"containerId"`
+	DomainUUID     string `json:"domainUuid"`
+	DomainName     string `json:"domainName"`
+	IncludesMemory bool   `json:"includesMemory"`
+}
+
+// WriteCheckpoint writes a checkpoint tarball to dest, containing
+// domainXML, the CheckpointConfig descriptor, and (if opts.IncludeMemory
+// is set and state is non-nil) the libvirt managed-save state read from
+// state.
+func WriteCheckpoint(dest string, domainXML string, config CheckpointConfig, state io.Reader, opts CheckpointOptions) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file %q: %v", dest, err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	defer tw.Close()
+
+	config.IncludesMemory = opts.IncludeMemory && state != nil
+
+	if err := writeTarMember(tw, checkpointDomainXMLName, []byte(domainXML)); err != nil {
+		return err
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint config: %v", err)
+	}
+	if err := writeTarMember(tw, checkpointConfigName, configJSON); err != nil {
+		return err
+	}
+
+	if config.IncludesMemory {
+		stateBytes, err := io.ReadAll(state)
+		if err != nil {
+			return fmt.Errorf("failed to read managed-save state: %v", err)
+		}
+		if err := writeTarMember(tw, checkpointStateName, stateBytes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeTarMember(tw *tar.Writer, name string, content []byte) error {
+	hdr := &tar.Header{Name: name, Size: int64(len(content)), Mode: 0600}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write tar header for %q: %v", name, err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write tar member %q: %v", name, err)
+	}
+	return nil
+}
+
+// CheckpointContents holds the decoded contents of a checkpoint tarball,
+// as produced by ReadCheckpoint.
+type CheckpointContents struct {
+	DomainXML string
+	Config    CheckpointConfig
+	State     []byte
+}
+
+// ReadCheckpoint reads and decodes the checkpoint tarball at src.
+func ReadCheckpoint(src string) (*CheckpointContents, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint file %q: %v", src, err)
+	}
+	defer f.Close()
+
+	ret := &CheckpointContents{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint tar: %v", err)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar member %q: %v", hdr.Name, err)
+		}
+
+		switch hdr.Name {
+		case checkpointDomainXMLName:
+			ret.DomainXML = string(content)
+		case checkpointConfigName:
+			if err := json.Unmarshal(content, &ret.Config); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal checkpoint config: %v", err)
+			}
+		case checkpointStateName:
+			ret.State = content
+		}
+	}
+
+	if ret.DomainXML == "" {
+		return nil, fmt.Errorf("checkpoint %q has no domain XML", src)
+	}
+	return ret, nil
+}
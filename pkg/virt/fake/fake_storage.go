@@ -171,10 +171,14 @@ func (p *FakeStoragePool) LookupVolumeByName(name string) (virt.StorageVolume, e
 	return nil, virt.ErrStorageVolumeNotFound
 }
 
-func (p *FakeStoragePool) removeVolumeByName(name string) error {
-	if _, found := p.volumes[name]; !found {
+func (p *FakeStoragePool) removeVolumeByName(name string, removeWithSnapshots bool) error {
+	v, found := p.volumes[name]
+	if !found {
 		return nil
 	}
+	if len(v.snapshots) > 0 && !removeWithSnapshots {
+		return fmt.Errorf("storage volume %q has live snapshots", name)
+	}
 	delete(p.volumes, name)
 	return nil
 }
@@ -182,7 +186,31 @@ func (p *FakeStoragePool) removeVolumeByName(name string) error {
 // RemoveVolumeByName implements RemoveVolumeByName method of StoragePool interface.
 func (p *FakeStoragePool) RemoveVolumeByName(name string) error {
 	p.rec.Rec("RemoveVolumeByName", name)
-	return p.removeVolumeByName(name)
+	return p.removeVolumeByName(name, false)
+}
+
+// CloneVolume implements CloneVolume method of StoragePool interface.
+func (p *FakeStoragePool) CloneVolume(src virt.StorageVolume, def *libvirtxml.StorageVolume) (virt.StorageVolume, error) {
+	srcVol, ok := src.(*FakeStorageVolume)
+	if !ok {
+		return nil, fmt.Errorf("CloneVolume: src volume %q is not a FakeStorageVolume", src.Name())
+	}
+	p.rec.Rec("CloneVolume", map[string]interface{}{
+		"src": srcVol.descriptiveName(),
+		"def": mustMarshal(def),
+	})
+
+	v, err := p.createStorageVol(def)
+	if err != nil {
+		return nil, err
+	}
+	clone := v.(*FakeStorageVolume)
+	clone.parent = srcVol
+	if clone.size == 0 {
+		clone.size = srcVol.size
+	}
+	srcVol.children = append(srcVol.children, clone)
+	return clone, nil
 }
 
 // XML implements XML method of StoragePool interface.
@@ -198,6 +226,13 @@ type FakeStorageVolume struct {
 	path string
 	size uint64
 	def  *libvirtxml.StorageVolume
+
+	// parent is the volume this one was cloned from, or nil if it wasn't
+	// a clone.
+	parent *FakeStorageVolume
+	// children are the volumes cloned from this one.
+	children  []*FakeStorageVolume
+	snapshots []*FakeStorageSnapshot
 }
 
 func newFakeStorageVolume(rec testutils.Recorder, pool *FakeStoragePool, def *libvirtxml.StorageVolume) (*FakeStorageVolume, error) {
@@ -247,9 +282,9 @@ func (v *FakeStorageVolume) Path() (string, error) {
 }
 
 // Remove implements Remove method of StorageVolume interface.
-func (v *FakeStorageVolume) Remove() error {
-	v.rec.Rec("Remove", nil)
-	return v.pool.removeVolumeByName(v.name)
+func (v *FakeStorageVolume) Remove(removeWithSnapshots bool) error {
+	v.rec.Rec("Remove", removeWithSnapshots)
+	return v.pool.removeVolumeByName(v.name, removeWithSnapshots)
 }
 
 // Format implements Format method of StorageVolume interface.
@@ -258,7 +293,45 @@ func (v *FakeStorageVolume) Format() error {
 	return nil
 }
 
+// CreateSnapshot implements CreateSnapshot method of StorageVolume interface.
+func (v *FakeStorageVolume) CreateSnapshot(name string) (virt.StorageSnapshot, error) {
+	v.rec.Rec("CreateSnapshot", name)
+	for _, s := range v.snapshots {
+		if s.name == name {
+			return nil, fmt.Errorf("snapshot already exists: %v", name)
+		}
+	}
+	s := &FakeStorageSnapshot{name: name, volume: v}
+	v.snapshots = append(v.snapshots, s)
+	return s, nil
+}
+
+// ListSnapshots implements ListSnapshots method of StorageVolume interface.
+func (v *FakeStorageVolume) ListSnapshots() ([]virt.StorageSnapshot, error) {
+	r := make([]virt.StorageSnapshot, len(v.snapshots))
+	for n, s := range v.snapshots {
+		r[n] = s
+	}
+	return r, nil
+}
+
 // XML implements XML method of StorageVolume interface.
 func (v *FakeStorageVolume) XML() (*libvirtxml.StorageVolume, error) {
 	return v.def, nil
 }
+
+// FakeStorageSnapshot is a fake implementation of StorageSnapshot interface.
+type FakeStorageSnapshot struct {
+	name   string
+	volume *FakeStorageVolume
+}
+
+// Name implements Name method of StorageSnapshot interface.
+func (s *FakeStorageSnapshot) Name() string {
+	return s.name
+}
+
+// Volume implements Volume method of StorageSnapshot interface.
+func (s *FakeStorageSnapshot) Volume() virt.StorageVolume {
+	return s.volume
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017 Mirantis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package virt
+
+import (
+	"errors"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// ErrStoragePoolNotFound is returned by StorageConnection.LookupStoragePoolByName
+// when no pool with the given name exists.
+var ErrStoragePoolNotFound = errors.New("storage pool not found")
+
+// ErrStorageVolumeNotFound is returned by StoragePool.LookupVolumeByName
+// when no volume with the given name exists in the pool.
+var ErrStorageVolumeNotFound = errors.New("storage volume not found")
+
+// StorageConnection provides access to libvirt storage pools.
+type StorageConnection interface {
+	// CreateStoragePool creates a new storage pool using the specified
+	// definition.
+	CreateStoragePool(def *libvirtxml.StoragePool) (StoragePool, error)
+	// LookupStoragePoolByName looks up a storage pool by name.
+	LookupStoragePoolByName(name string) (StoragePool, error)
+	// ListPools lists the existing storage pools.
+	ListPools() ([]StoragePool, error)
+	// PutFiles adds a set of files, specified as a map of file paths to
+	// their contents, to the image identified by imagePath.
+	PutFiles(imagePath string, files map[string][]byte) error
+}
+
+// StoragePool provides access to a libvirt storage pool.
+type StoragePool interface {
+	// CreateStorageVol creates a new storage volume using the specified
+	// definition.
+	CreateStorageVol(def *libvirtxml.StorageVolume) (StorageVolume, error)
+	// ListVolumes lists the volumes in the pool.
+	ListVolumes() ([]StorageVolume, error)
+	// LookupVolumeByName looks up a volume in the pool by name.
+	LookupVolumeByName(name string) (StorageVolume, error)
+	// RemoveVolumeByName removes the volume with the given name from the
+	// pool. It fails if the volume has live snapshots; see
+	// StorageVolume.Remove to remove one along with its snapshots.
+	RemoveVolumeByName(name string) error
+	// CloneVolume creates a new volume, described by def, as a clone of
+	// src. In the real libvirt-backed implementation this is expected to
+	// produce a qcow2 volume with src as its backing file, so the clone
+	// is fast and shares unmodified blocks with src.
+	CloneVolume(src StorageVolume, def *libvirtxml.StorageVolume) (StorageVolume, error)
+	// XML returns the pool's definition.
+	XML() (*libvirtxml.StoragePool, error)
+}
+
+// StorageVolume provides access to a libvirt storage volume.
+type StorageVolume interface {
+	// Name returns the volume name.
+	Name() string
+	// Size returns the volume size in bytes.
+	Size() (uint64, error)
+	// Path returns the volume path.
+	Path() (string, error)
+	// Remove removes the volume. It fails if the volume has live
+	// snapshots, unless removeWithSnapshots is true, in which case the
+	// snapshots are removed along with it.
+	Remove(removeWithSnapshots bool) error
+	// Format formats the volume.
+	Format() error
+	// CreateSnapshot takes a point-in-time snapshot of the volume, named
+	// name.
+	CreateSnapshot(name string) (StorageSnapshot, error)
+	// ListSnapshots lists the snapshots taken of this volume.
+	ListSnapshots() ([]StorageSnapshot, error)
+	// XML returns the volume's definition.
+	XML() (*libvirtxml.StorageVolume, error)
+}
+
+// StorageSnapshot represents a point-in-time snapshot of a StorageVolume.
+type StorageSnapshot interface {
+	// Name returns the snapshot name.
+	Name() string
+	// Volume returns the volume this snapshot was taken of.
+	Volume() StorageVolume
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2026 Authors of Arktos
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package debug implements virtlet's hidden "debug" command group, the
+// virtlet analog of the pixiecore CLI's own hidden debug subcommands
+// (dump-ipxe, tcpdump — see
+// vendor/go.universe.tf/netboot/pixiecore/cli/debugcmd.go) used for field
+// diagnosis without cluttering normal --help output.
+//
+// This tree has no cmd/virtlet entrypoint for a real virtlet binary's
+// rootCmd to attach these subcommands to, and github.com/spf13/cobra
+// isn't vendored as a standalone importable package here (it's only
+// bundled inside the unrelated pixiecore vendor tree, which this package
+// deliberately doesn't import from). Command builds its own cobra.Command
+// tree so that, once a real virtlet root command exists, wiring it in is
+// a single rootCmd.AddCommand(debug.Command(...)) call — the same shape
+// pixiecore's cli/debugcmd.go init() uses.
+package debug
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Mirantis/virtlet/pkg/virt"
+)
+
+// dhcpv6CaptureFilter is the tcpdump filter used to capture the DHCPv6
+// solicit/advertise/request/reply exchange together with the router
+// advertisements virtlet's embedded DHCPv6 server's clients rely on.
+const dhcpv6CaptureFilter = "udp port 546 or udp port 547 or icmp6"
+
+// Command returns the hidden "debug" command group, with dump-cloudinit
+// and capture-dhcpv6 as its initial subcommands. pool is the storage
+// pool dump-cloudinit looks up cloud-init volumes in; it's passed in
+// rather than resolved from a hardcoded pool name so that tests can
+// supply a fake storage connection's pool directly.
+func Command(pool virt.StoragePool) *cobra.Command {
+	debugCmd := &cobra.Command{
+		Use:    "debug",
+		Short:  "Internal debugging commands",
+		Hidden: true,
+	}
+	debugCmd.AddCommand(dumpCloudInitCmd(pool))
+	debugCmd.AddCommand(captureDHCPv6Cmd())
+	return debugCmd
+}
+
+func dumpCloudInitCmd(pool virt.StoragePool) *cobra.Command {
+	return &cobra.Command{
+		Use:   "dump-cloudinit pod-id",
+		Short: "Dump a running VM pod's NoCloud cloud-init ISO contents to the current directory",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				fatalf("dump-cloudinit takes exactly one argument: pod-id")
+			}
+			if err := DumpCloudInit(pool, args[0], "."); err != nil {
+				fatalf("%v", err)
+			}
+		},
+	}
+}
+
+func captureDHCPv6Cmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "capture-dhcpv6 interface pcap-file",
+		Short: "Run tcpdump to capture the DHCPv6/RA exchange between a guest and virtlet's embedded DHCPv6 server",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 {
+				fatalf("capture-dhcpv6 takes exactly two arguments: interface pcap-file")
+			}
+			if err := CaptureDHCPv6(args[0], args[1]); err != nil {
+				fatalf("%v", err)
+			}
+		},
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// CaptureDHCPv6 shells out to tcpdump to capture the DHCPv6/RA exchange
+// on iface into pcapFile, blocking until tcpdump exits (normally via
+// Ctrl-C during a field diagnosis session).
+func CaptureDHCPv6(iface, pcapFile string) error {
+	c := exec.Command("tcpdump", "-w", pcapFile, "-i", iface, dhcpv6CaptureFilter)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("tcpdump failed: %v", err)
+	}
+	return nil
+}
@@ -6,9 +6,11 @@
 package osfs
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // Default has the filesystem capabilities of the common filesystem(s) on the
@@ -37,6 +39,49 @@ type MountPoint struct {
 	FSRoot    string // root of the mount within the filesystem
 	Root      string // mount point relative to the process's root
 	Type      string // filesystem type, e.g. "ext4"
+
+	// The fields below mirror the remaining columns of one
+	// /proc/self/mountinfo line (see the field-by-field doc comment in
+	// osfs_linux.go) and are only populated by the Linux backend;
+	// BSD/Windows mounts leave them at their zero value.
+	ID           int      // (1) unique identifier of the mount
+	ParentID     int      // (2) ID of the parent mount, or of self for the root
+	Major, Minor uint32   // (3) major:minor device number
+	Options      string   // (6) per-mount options
+	Optional     []string // (7) zero or more "tag[:value]" fields
+	Source       string   // (10) mount source, e.g. a device path, or "none"
+	SuperOptions string   // (11) per-superblock options
+}
+
+// FilterFunc is invoked by Read once per candidate mount point, before it is
+// added to the returned Info. Returning skip=true leaves that mount out of
+// the result without allocating anything for it; returning stop=true ends
+// parsing immediately afterwards, which lets a caller that only wants, say,
+// the first match for a given path avoid reading through the rest of
+// mountinfo. A nil FilterFunc keeps every mount, as if it always returned
+// (false, false).
+type FilterFunc func(*MountPoint) (skip, stop bool)
+
+// mountedViaTable is the Mounted implementation shared by every backend
+// except Linux (which has a cheaper, syscall-based Mounted in
+// osfs_linux.go): it reads the whole mount table and checks whether some
+// mount point's Root is exactly path, rather than path merely living
+// somewhere underneath one.
+func mountedViaTable(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return false, err
+	}
+	info, err := Read(nil)
+	if err != nil {
+		return false, err
+	}
+	_, ok := info.mountPaths[abs]
+	return ok, nil
 }
 
 // Info lists all filesystems on the current system. A specific filesystem can
@@ -44,6 +89,69 @@ type MountPoint struct {
 type Info struct {
 	mountPaths   map[string]*MountPoint
 	mountNumbers map[uint64]*MountPoint
+
+	// capabilities caches the result of Probe, keyed by the probed mount's
+	// (Major, Minor), so repeatedly probing the same device is free.
+	capabilities map[devKey]Capabilities
+}
+
+// devKey identifies a mount's backing device for the capabilities cache.
+type devKey struct {
+	major, minor uint32
+}
+
+// Capabilities describes filesystem features that Filesystem can't infer
+// from Type alone, and that only actually probing the filesystem (see
+// MountPoint.Probe) can answer reliably - different configurations of the
+// same filesystem type can disagree on these (e.g. an ext4 mount may or may
+// not have reflink-capable bigalloc, a FUSE filesystem may or may not pass
+// fallocate calls through). The zero value means "unknown", which is also
+// what every field reads as before Probed is set.
+type Capabilities struct {
+	Probed bool // true once Probe has filled in the rest of this struct
+
+	Reflink       bool // FICLONE (reflink copy) is supported
+	PunchHole     bool // fallocate(FALLOC_FL_PUNCH_HOLE) is supported
+	TmpFile       bool // O_TMPFILE is supported
+	CopyFileRange bool // copy_file_range(2) is supported
+
+	// ProjectQuota is left false: this package doesn't implement the
+	// FS_IOC_FSGETXATTR/FS_IOC_FSSETXATTR ioctls project quotas need,
+	// since they're a struct-based protocol rather than the simple
+	// syscalls the other fields probe, and are usually only relevant on
+	// xfs/ext4 with project quotas explicitly enabled at mkfs time. A
+	// caller that needs this should probe it itself.
+	ProjectQuota bool
+
+	CaseInsensitive bool
+}
+
+// Probe actively tests p's filesystem for the features recorded in
+// Capabilities, by creating scratch files under dir (which must be a
+// writable directory on p's mount) and issuing the relevant syscalls,
+// recording ENOTSUP/EOPNOTSUPP/ENOSYS as "not supported" rather than
+// failing outright. Results are cached in info keyed by p's (Major, Minor),
+// so probing the same device again - even via a different MountPoint value
+// for the same device - returns the cached Capabilities immediately. ctx
+// bounds how long probing, which does real file I/O, is allowed to run.
+func (info *Info) Probe(ctx context.Context, p *MountPoint, dir string) (Capabilities, error) {
+	if p == nil {
+		return Capabilities{}, os.ErrInvalid
+	}
+	key := devKey{p.Major, p.Minor}
+	if c, ok := info.capabilities[key]; ok {
+		return c, nil
+	}
+
+	c, err := probeCapabilities(ctx, dir)
+	if err != nil {
+		return c, err
+	}
+	if info.capabilities == nil {
+		info.capabilities = make(map[devKey]Capabilities)
+	}
+	info.capabilities[key] = c
+	return c, nil
 }
 
 // Len returns the number of mount points found.
@@ -52,6 +160,211 @@ func (info *Info) Len() int {
 	return len(info.mountPaths)
 }
 
+// GetByUUID returns the mount point whose filesystem UUID (as resolved by
+// MountPoint.UUID) matches uuid, or nil if none of info's mounts resolve to
+// it. The comparison is case-insensitive, since /dev/disk/by-uuid and
+// blkid don't always agree on the case of a UUID for the same filesystem.
+func (info *Info) GetByUUID(uuid string) *MountPoint {
+	for _, mount := range info.mountPaths {
+		if got, err := mount.UUID(); err == nil && strings.EqualFold(got, uuid) {
+			return mount
+		}
+	}
+	return nil
+}
+
+// MountEventType classifies a MountEvent delivered by a Watcher.
+type MountEventType int
+
+const (
+	// Added means a mount appeared that wasn't there before.
+	Added MountEventType = iota
+	// Removed means a mount that was present is now gone.
+	Removed
+	// RemountChanged means a mount is still present at the same (ID,
+	// ParentID), but its Options or SuperOptions changed - for example a
+	// remount from "rw" to "ro". Any Capabilities cached for it by
+	// Info.Probe should be considered stale.
+	RemountChanged
+)
+
+func (t MountEventType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case RemountChanged:
+		return "remount-changed"
+	default:
+		return "unknown"
+	}
+}
+
+// MountEvent reports one change to the live mount table, as streamed by a
+// Watcher.
+type MountEvent struct {
+	Type  MountEventType
+	Mount *MountPoint
+}
+
+// Watcher streams MountEvents as the mount table changes, so a caller
+// doesn't need to poll Read itself. Get a Watcher with NewWatcher, read
+// from Events, and call Close when done.
+type Watcher struct {
+	events  <-chan MountEvent
+	closeFn func() error
+}
+
+// Events returns the channel MountEvents are delivered on. It's closed
+// once the Watcher is Closed or hits an unrecoverable error.
+func (w *Watcher) Events() <-chan MountEvent {
+	return w.events
+}
+
+// Close stops the Watcher and releases any resources it holds.
+func (w *Watcher) Close() error {
+	return w.closeFn()
+}
+
+// GetMountChain returns the stack of mounts covering path: the most
+// specific mount first (what Get would return), then its parent mount,
+// and so on up to the root mount "/". This is what Get alone can't tell
+// you - Get resolves path to a single MountPoint by device number or
+// longest-prefix match, which for a bind mount or an overlayfs layer is
+// the *underlying* filesystem, not whatever is actually visible at path.
+//
+// The chain is built by following ParentID links (field 2 of
+// /proc/self/mountinfo), so it's only meaningful on Linux, where those
+// fields are populated; on other platforms it always returns a
+// single-element chain, the same mount Get would have returned.
+func (info *Info) GetMountChain(path string) ([]*MountPoint, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	mount, err := info.Get(path, st)
+	if err != nil {
+		return nil, err
+	}
+	if mount == nil {
+		return nil, nil
+	}
+
+	byID := make(map[int]*MountPoint, len(info.mountPaths))
+	for _, m := range info.mountPaths {
+		if m.ID != 0 {
+			byID[m.ID] = m
+		}
+	}
+
+	chain := []*MountPoint{mount}
+	seen := map[int]bool{mount.ID: true}
+	cur := mount
+	for cur.ID != 0 && cur.ParentID != cur.ID {
+		parent, ok := byID[cur.ParentID]
+		if !ok || seen[parent.ID] {
+			break
+		}
+		chain = append(chain, parent)
+		seen[parent.ID] = true
+		cur = parent
+	}
+	return chain, nil
+}
+
+// IsBind reports whether p looks like a bind mount: FSRoot, the root of
+// the mount within its filesystem, is something other than "/". A
+// mountinfo line for a plain mount always has FSRoot "/"; a bind mount of
+// some subdirectory (or of another mount's subtree) shows that
+// subdirectory instead. This also matches btrfs subvolumes mounted by
+// path, which look the same in mountinfo; callers that need to tell the
+// two apart should also check Type.
+func (p *MountPoint) IsBind() bool {
+	return p != nil && p.FSRoot != "" && p.FSRoot != "/"
+}
+
+// IsOverlay reports whether p is an overlayfs mount.
+func (p *MountPoint) IsOverlay() bool {
+	return p != nil && p.Type == "overlay"
+}
+
+// LowerDirs returns the lowerdir paths of an overlayfs mount, in the
+// order given in SuperOptions (uppermost lower directory first). It
+// returns nil if p isn't an overlay mount or has no lowerdir option.
+func (p *MountPoint) LowerDirs() []string {
+	if !p.IsOverlay() {
+		return nil
+	}
+	v, ok := overlayOption(p.SuperOptions, "lowerdir")
+	if !ok {
+		return nil
+	}
+	return strings.Split(v, ":")
+}
+
+// UpperDir returns the upperdir path of an overlayfs mount, or "" if p
+// isn't an overlay mount or has no upperdir (a read-only overlay has
+// none).
+func (p *MountPoint) UpperDir() string {
+	if !p.IsOverlay() {
+		return ""
+	}
+	v, _ := overlayOption(p.SuperOptions, "upperdir")
+	return v
+}
+
+// overlayOption looks up key=value in a comma-separated SuperOptions
+// string.
+func overlayOption(superOptions, key string) (string, bool) {
+	for _, opt := range strings.Split(superOptions, ",") {
+		if v := strings.TrimPrefix(opt, key+"="); v != opt {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Peers returns the IDs of p's peer group(s), as recorded in the
+// "shared:N" optional fields (field 7) described in mountinfo's mount
+// propagation documentation. A mount usually belongs to at most one peer
+// group, but this returns a slice defensively since mountinfo allows more
+// than one optional field of the same kind.
+func (p *MountPoint) Peers() []int {
+	return p.optionalTagValues("shared")
+}
+
+// Master returns the ID of the peer group p receives propagation events
+// from, as recorded in a "master:N" optional field, and whether p has
+// one at all (a mount with propagation type "private" or "unbindable"
+// does not).
+func (p *MountPoint) Master() (int, bool) {
+	ids := p.optionalTagValues("master")
+	if len(ids) == 0 {
+		return 0, false
+	}
+	return ids[0], true
+}
+
+// optionalTagValues returns the integer values of every "tag:N" entry in
+// p.Optional whose tag matches name.
+func (p *MountPoint) optionalTagValues(name string) []int {
+	if p == nil {
+		return nil
+	}
+	var ids []int
+	for _, tag := range p.Optional {
+		v := strings.TrimPrefix(tag, name+":")
+		if v == tag {
+			continue
+		}
+		if n, err := strconv.Atoi(v); err == nil {
+			ids = append(ids, n)
+		}
+	}
+	return ids
+}
+
 // GetPath returns the mount point based on a path. It does a os.Stat and
 // Info.Get on the file. It is a shorthand for Get(path, stat).
 func (info *Info) GetPath(path string) (*MountPoint, error) {
@@ -95,6 +408,12 @@ func parseUint64(s string) uint64 {
 	return n
 }
 
+// resolveFuseBlkType, when non-nil, tells Filesystem what the real
+// filesystem type behind a "fuseblk" mount is, so it can set Inode
+// correctly instead of always assuming the worst. Only the Linux backend
+// sets it (see osfs_blkid_linux.go), since it relies on blkid.
+var resolveFuseBlkType func(p *MountPoint) (realType string, ok bool)
+
 // Filesystem returns capabilities of the filesystem for this mount point. The
 // results are more like an educated guess, but should give correct results for
 // the vast majority of detected filesystems. It has a reasonable default (e.g.
@@ -111,18 +430,36 @@ func (p *MountPoint) Filesystem() Filesystem {
 		// These are special filesystems, namely /sys, /proc and /dev.
 		fs.Memory = true
 		fs.Special = true
-	case "vfat":
+	case "vfat", "msdos":
 		// FAT filesystems support basically nothing interesting.
 		fs = Filesystem{}
+	case "apfs":
+		// Apple's modern filesystem; same guarantees as the other
+		// POSIX defaults (stable inodes, hardlinks).
+	case "ntfs":
+		// NTFS supports symlinks only via reparse points created by an
+		// admin process; assume the common case of a non-admin caller.
+		fs.Symlink = false
 	case "fuseblk":
 		// This is a difficult one. Many different types of filesystems can be
-		// behind FUSE.
-		// I am not sure whether NTFS (a comman FUSE filesystem) uses stable
-		// inode numbers (stable across reboots etc.). Until that's verified,
-		// set it to false.
-		// TODO: get the filesystem type from something like
-		// /run/blkid/blkid.tab?
+		// behind FUSE. Default to false until we know better.
 		fs.Inode = false
+		// resolveFuseBlkType is only set on Linux (see
+		// osfs_blkid_linux.go), where blkid can tell us the real
+		// filesystem type behind the FUSE mount - e.g. NTFS-3G and a
+		// native Linux filesystem mounted via FUSE both keep the
+		// backing filesystem's stable inode numbers, while exFAT
+		// doesn't have inodes to begin with.
+		if resolveFuseBlkType != nil {
+			if realType, ok := resolveFuseBlkType(p); ok {
+				switch realType {
+				case "ntfs", "ext2", "ext3", "ext4", "btrfs", "xfs":
+					fs.Inode = true
+				case "exfat", "vfat", "msdos":
+					fs.Inode = false
+				}
+			}
+		}
 	case "tmpfs":
 		// tmpfs has all the benefits of a POSIX filesystem, but is implemented
 		// in memory.
@@ -0,0 +1,184 @@
+// Copyright 2016 Ayke van Laethem.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.txt file.
+
+// Filesystem UUID/LABEL resolution via /dev/disk/by-uuid, /dev/disk/by-label
+// and blkid, used by MountPoint.UUID/Label and Filesystem's fuseblk case.
+package osfs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	resolveFuseBlkType = func(p *MountPoint) (string, bool) {
+		info, err := blkidInfo(p.Source)
+		if err != nil {
+			return "", false
+		}
+		t, ok := info["TYPE"]
+		return t, ok
+	}
+}
+
+// UUID resolves the filesystem UUID of this mount's device (the same value
+// `blkid` would print), e.g. "a1b2c3d4-...". It tries, in order: matching
+// device nodes under /dev/disk/by-uuid, a cached entry in
+// /run/blkid/blkid.tab, and finally running `blkid -o export` directly -
+// the same fallback chain udev/blkid use themselves when one source isn't
+// available, which matters inside a minimal container without a populated
+// /dev/disk or a running udev.
+func (p *MountPoint) UUID() (string, error) {
+	return p.resolveDiskLink("/dev/disk/by-uuid", "UUID")
+}
+
+// Label resolves the filesystem LABEL of this mount's device, the same way
+// UUID does.
+func (p *MountPoint) Label() (string, error) {
+	return p.resolveDiskLink("/dev/disk/by-label", "LABEL")
+}
+
+func (p *MountPoint) resolveDiskLink(dir, tag string) (string, error) {
+	if p == nil || p.Source == "" {
+		return "", fmt.Errorf("osfs: mount has no recorded device source")
+	}
+
+	if name, ok := findDiskLink(dir, p.Source); ok {
+		return name, nil
+	}
+
+	info, err := blkidInfo(p.Source)
+	if err != nil {
+		return "", err
+	}
+	value, ok := info[tag]
+	if !ok {
+		return "", fmt.Errorf("osfs: blkid reported no %s for %s", tag, p.Source)
+	}
+	return value, nil
+}
+
+// findDiskLink looks for an entry under dir (/dev/disk/by-uuid or
+// /dev/disk/by-label) whose target is the same device as device, comparing
+// by os.SameFile rather than the link text so relative symlinks and
+// differently-spelled paths to the same device still match.
+func findDiskLink(dir, device string) (string, bool) {
+	deviceInfo, err := os.Stat(device)
+	if err != nil {
+		return "", false
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		linkInfo, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if os.SameFile(deviceInfo, linkInfo) {
+			return entry.Name(), true
+		}
+	}
+	return "", false
+}
+
+// blkidInfo returns the tag/value pairs blkid knows about device (UUID,
+// LABEL, TYPE, ...). It first looks for a cached entry in
+// /run/blkid/blkid.tab, which blkid itself maintains and which is readable
+// without the CAP_SYS_ADMIN-ish privileges that probing the raw device
+// again might need; if that file doesn't exist or has nothing for device,
+// it falls back to running `blkid -o export device` directly.
+func blkidInfo(device string) (map[string]string, error) {
+	if info, err := blkidTabInfo(device); err == nil {
+		return info, nil
+	}
+	return blkidExportInfo(device)
+}
+
+// blkidTabInfo parses /run/blkid/blkid.tab, whose entries look like:
+//
+//	<device DEVNO="0x0801" UUID="..." LABEL="..." TYPE="ext4">/dev/sda1</device>
+func blkidTabInfo(device string) (map[string]string, error) {
+	f, err := os.Open("/run/blkid/blkid.tab")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "<device") {
+			continue
+		}
+		open := strings.Index(line, ">")
+		closeIdx := strings.LastIndex(line, "<")
+		if open < 0 || closeIdx <= open {
+			continue
+		}
+		if strings.TrimSpace(line[open+1:closeIdx]) != device {
+			continue
+		}
+		return parseBlkidTags(line[:open]), nil
+	}
+	return nil, fmt.Errorf("osfs: %s not found in /run/blkid/blkid.tab", device)
+}
+
+// parseBlkidTags pulls out TAG="value" attributes from a blkid.tab <device
+// ...> opening tag.
+func parseBlkidTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for {
+		eq := strings.Index(s, "=\"")
+		if eq < 0 {
+			break
+		}
+		nameStart := eq
+		for nameStart > 0 && (isTagNameByte(s[nameStart-1])) {
+			nameStart--
+		}
+		name := s[nameStart:eq]
+		rest := s[eq+2:]
+		end := strings.Index(rest, "\"")
+		if end < 0 {
+			break
+		}
+		tags[name] = rest[:end]
+		s = rest[end+1:]
+	}
+	return tags
+}
+
+func isTagNameByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// blkidExportInfo runs `blkid -o export device` and parses its KEY=value
+// output. This is the last resort when blkid.tab isn't available (no udev
+// running, e.g. a fresh container) and needs blkid installed and
+// permission to read the raw device.
+func blkidExportInfo(device string) (map[string]string, error) {
+	out, err := exec.Command("blkid", "-o", "export", device).Output()
+	if err != nil {
+		return nil, fmt.Errorf("osfs: blkid -o export %s: %s", device, err)
+	}
+
+	tags := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return tags, nil
+}
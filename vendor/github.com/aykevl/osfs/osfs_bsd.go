@@ -0,0 +1,165 @@
+// Copyright 2016 Ayke van Laethem.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.txt file.
+
+// +build darwin freebsd
+
+// On Darwin and FreeBSD there is no /proc/self/mountinfo, so mount points
+// are listed via getfsstat(2) instead, through golang.org/x/sys/unix's
+// binding for it.
+package osfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+var errUnsupported = errors.New("osfs: unsupported on this operating system")
+
+func defaultFilesystem() Filesystem {
+	return Filesystem{
+		Permissions: 0777,
+		Symlink:     true,
+		Hardlink:    true,
+		Inode:       true,
+	}
+}
+
+// Read returns a list of all mountpoints and their filesystem types,
+// using getfsstat(2). filter, if non-nil, is invoked for each mount as
+// it's built and can skip it or stop enumeration early (see FilterFunc);
+// pass nil to keep everything. It always returns a valid Info object, but
+// may also return an error on failure; as on Linux, you can safely ignore
+// Read() errors while still having reasonable defaults.
+func Read(filter FilterFunc) (*Info, error) {
+	info := &Info{
+		mountPaths:   make(map[string]*MountPoint),
+		mountNumbers: make(map[uint64]*MountPoint),
+	}
+
+	n, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return info, err
+	}
+	stats := make([]unix.Statfs_t, n)
+	if _, err := unix.Getfsstat(stats, unix.MNT_NOWAIT); err != nil {
+		return info, err
+	}
+
+	for _, st := range stats {
+		root, ok := cString(st.Mntonname[:])
+		if !ok {
+			continue
+		}
+		fstype, _ := cString(st.Fstypename[:])
+		source, _ := cString(st.Mntfromname[:])
+
+		mount := &MountPoint{
+			FSRoot: "/",
+			Root:   root,
+			Type:   fstype,
+			Source: source,
+			// getfsstat has no st_dev-compatible value; f_fsid is the
+			// closest thing to a stable per-filesystem identifier it
+			// exposes, so synthesize a devNumber from it.
+			devNumber: uint64(uint32(st.Fsid.Val[0]))<<32 | uint64(uint32(st.Fsid.Val[1])),
+		}
+
+		var skip, stop bool
+		if filter != nil {
+			skip, stop = filter(mount)
+		}
+		if !skip {
+			info.mountPaths[mount.Root] = mount
+			info.mountNumbers[mount.devNumber] = mount
+		}
+		if stop {
+			return info, nil
+		}
+	}
+	return info, nil
+}
+
+// Mounted reports whether path is itself a mount point. BSD's getfsstat
+// doesn't expose a cheaper syscall-level check like Linux's openat2, so
+// this just reads the whole mount table and looks for an exact Root
+// match.
+func Mounted(path string) (bool, error) {
+	return mountedViaTable(path)
+}
+
+// UUID isn't implemented on BSD: there's no blkid/by-uuid equivalent wired
+// up here (diskutil on Darwin, glabel on FreeBSD would be the analogues).
+func (p *MountPoint) UUID() (string, error) {
+	return "", errUnsupported
+}
+
+// Label isn't implemented on BSD, for the same reason as UUID above.
+func (p *MountPoint) Label() (string, error) {
+	return "", errUnsupported
+}
+
+// probeCapabilities isn't implemented on BSD: reflink/fallocate/O_TMPFILE
+// are Linux-specific APIs (APFS/ZFS have their own clone mechanisms, but
+// probing those isn't implemented here).
+func probeCapabilities(ctx context.Context, dir string) (Capabilities, error) {
+	return Capabilities{}, errUnsupported
+}
+
+// NewWatcher isn't implemented on BSD: there's no getfsstat(2)
+// equivalent of mountinfo's POLLPRI change notification wired up here
+// (kqueue's EVFILT_VNODE on /etc/mtab-like paths could back a future
+// implementation).
+func NewWatcher() (*Watcher, error) {
+	return nil, errUnsupported
+}
+
+// cString decodes a fixed-size NUL-terminated byte array, as used by
+// the Fstypename/Mntonname fields of unix.Statfs_t on BSD systems.
+func cString(b []byte) (string, bool) {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i]), true
+		}
+	}
+	return "", false
+}
+
+// GetReal finds the mount point for filePath. Unlike the Linux
+// implementation, it can't try a device-number lookup first: getfsstat
+// exposes f_fsid, not st_dev, and the two aren't comparable, so
+// mountNumbers (kept populated for Len()'s sake) isn't useful here.
+// Instead this goes straight to matching the longest mounted path
+// prefix of filePath.
+func (info *Info) GetReal(filePath string, fileInfo os.FileInfo) *MountPoint {
+	if !filepath.IsAbs(filePath) {
+		panic("path must be absolute")
+	}
+
+	filePath = filepath.Clean(filePath)
+	for i := len(filePath) - 1; i >= 0; i-- {
+		if filePath[i] != '/' {
+			continue
+		}
+		testPath := filePath[:i]
+		if testPath == "" {
+			testPath = "/"
+		}
+		if mount, ok := info.mountPaths[testPath]; ok {
+			return mount
+		}
+	}
+	return nil
+}
+
+// DevNumber returns the device number for this mount point.
+func (p *MountPoint) DevNumber() (uint64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	return p.devNumber, true
+}
@@ -51,21 +51,25 @@ func defaultFilesystem() Filesystem {
 	}
 }
 
-// Read retuns a list of all mountpoints and their filesystem types.
+// Read retuns a list of all mountpoints and their filesystem types. filter,
+// if non-nil, is invoked for each mount as it's parsed and can skip it or
+// stop parsing early (see FilterFunc); pass nil to keep everything, same as
+// before filter existed.
 // It always returns a valid Info object, but may also return an error on
 // failures. Errors are worked around as much as possible. Thus, you can safely
 // ignore Read() errors while still having reasonable defaults.
-func Read() (*Info, error) {
+func Read(filter FilterFunc) (*Info, error) {
 	f, err := os.Open(MOUNTINFO_PATH)
 	if err != nil {
 		// Maybe an old system that doesn't have the file, or /proc wasn't
 		// mounted (yet).
 		return &Info{}, err
 	}
-	return read(f)
+	defer f.Close()
+	return read(f, filter)
 }
 
-func read(f io.Reader) (*Info, error) {
+func read(f io.Reader, filter FilterFunc) (*Info, error) {
 	info := &Info{
 		mountPaths:   make(map[string]*MountPoint),
 		mountNumbers: make(map[uint64]*MountPoint),
@@ -91,6 +95,10 @@ func read(f io.Reader) (*Info, error) {
 
 		mount := &MountPoint{}
 
+		// (1) mount ID, (2) parent ID.
+		mount.ID = parseInt(fields[0])
+		mount.ParentID = parseInt(fields[1])
+
 		// Extract major and minor device number.
 		stdev := strings.Split(fields[2], ":")
 		if len(stdev) != 2 {
@@ -101,6 +109,8 @@ func read(f io.Reader) (*Info, error) {
 		if err1 != nil || err2 != nil {
 			continue
 		}
+		mount.Major = uint32(devMajor)
+		mount.Minor = uint32(devMinor)
 
 		// We want to know how the major and minor number are encoded in the
 		// st_dev field of stat() results, as that's one of the ways we're going
@@ -128,24 +138,42 @@ func read(f io.Reader) (*Info, error) {
 			// This is a critical part of the MountPoint struct.
 			continue
 		}
+		mount.Options = fields[5]
 
 		pos := 6
 		for pos < len(fields) && fields[pos] != "-" {
 			pos++
 		}
+		if pos > 6 {
+			// (7) optional fields, each of the form "tag[:value]".
+			mount.Optional = append([]string{}, fields[6:pos]...)
+		}
 		pos++
 		if pos >= len(fields) {
 			// Type is another critical field.
 			continue
 		}
 		mount.Type = fields[pos]
+		if pos+1 < len(fields) {
+			mount.Source = fields[pos+1]
+		}
+		if pos+2 < len(fields) {
+			mount.SuperOptions = strings.Join(fields[pos+2:], " ")
+		}
 
-		// TODO check for duplicates?
-		info.mountPaths[mount.Root] = mount
-		info.mountNumbers[mount.devNumber] = mount
+		var skip, stop bool
+		if filter != nil {
+			skip, stop = filter(mount)
+		}
+		if !skip {
+			// TODO check for duplicates?
+			info.mountPaths[mount.Root] = mount
+			info.mountNumbers[mount.devNumber] = mount
+		}
+		if stop {
+			return info, nil
+		}
 	}
-
-	return info, nil
 }
 
 // mountParse parses paths like in /etc/fstab, /etc/mtab, and
@@ -239,3 +267,81 @@ func (p *MountPoint) DevNumber() (uint64, bool) {
 	}
 	return p.devNumber, true
 }
+
+// Mounted reports whether path is itself a mount point, as opposed to a
+// plain file or directory living inside its parent's filesystem. It tries
+// openat2(2) with RESOLVE_NO_XDEV first: the kernel resolves path's parent
+// and refuses with EXDEV exactly when path crosses into a different
+// filesystem, so one syscall answers the question without reading
+// mountinfo at all. That flag only exists from Linux 5.6 onwards, so on an
+// older kernel (openat2 itself returns ENOSYS) this falls back to
+// statfs(2) on path and its parent and compares the filesystem IDs.
+func Mounted(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return false, err
+	}
+
+	mounted, err := mountedOpenat2(abs)
+	if err != unix.ENOSYS {
+		return mounted, err
+	}
+	return mountedStatfs(abs)
+}
+
+// mountedOpenat2 implements the openat2/RESOLVE_NO_XDEV fast path for
+// Mounted. It returns unix.ENOSYS (wrapped in err) when the running kernel
+// doesn't have openat2, so the caller knows to fall back.
+func mountedOpenat2(abs string) (bool, error) {
+	parent := filepath.Dir(abs)
+	base := filepath.Base(abs)
+
+	dirFd, err := unix.Open(parent, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		return false, err
+	}
+	defer unix.Close(dirFd)
+
+	fd, err := unix.Openat2(dirFd, base, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_NO_XDEV,
+	})
+	if err == unix.ENOSYS {
+		return false, unix.ENOSYS
+	}
+	if err == unix.EXDEV {
+		// path crosses into a different filesystem than parent: it's a
+		// mount point.
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	unix.Close(fd)
+	return false, nil
+}
+
+// mountedStatfs is the pre-5.6-kernel fallback for Mounted: it compares
+// path's filesystem ID against its parent directory's. This is racier than
+// openat2 (the mount table can change between the two statfs calls) but
+// works on every Linux kernel this package otherwise supports.
+func mountedStatfs(abs string) (bool, error) {
+	if abs == "/" {
+		// The root is always a mount point, and has no parent to compare
+		// against.
+		return true, nil
+	}
+
+	var pathStat, parentStat unix.Statfs_t
+	if err := unix.Statfs(abs, &pathStat); err != nil {
+		return false, err
+	}
+	if err := unix.Statfs(filepath.Dir(abs), &parentStat); err != nil {
+		return false, err
+	}
+	return pathStat.Fsid != parentStat.Fsid, nil
+}
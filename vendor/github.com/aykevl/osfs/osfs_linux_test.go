@@ -6,13 +6,14 @@ package osfs
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 )
 
 func TestReadLiveLinux(t *testing.T) {
 	return
 	t.Parallel()
-	mounts, err := Read()
+	mounts, err := Read(nil)
 	if err != nil {
 		t.Error("could not read mount points:", err)
 	}
@@ -74,33 +75,43 @@ func TestReadStaticLinux(t *testing.T) {
 		},
 		{ // normal mount
 			true,
-			MountPoint{34, "/", "/home", "btrfs"},
+			MountPoint{devNumber: 34, FSRoot: "/", Root: "/home", Type: "btrfs",
+				ID: 42, ParentID: 19, Major: 0, Minor: 34, Options: "rw,noatime",
+				Optional: []string{"shared:30"}, Source: "/dev/sdb1", SuperOptions: "rw,space_cache"},
 			"42 19 0:34 / /home rw,noatime shared:30 - btrfs /dev/sdb1 rw,space_cache",
 		},
 		{ // subvolume
 			true,
-			MountPoint{34, "/subvol", "/mountpoint", "btrfs"},
+			MountPoint{devNumber: 34, FSRoot: "/subvol", Root: "/mountpoint", Type: "btrfs",
+				ID: 42, ParentID: 19, Major: 0, Minor: 34, Options: "rw,noatime",
+				Optional: []string{"shared:30"}, Source: "/dev/sdb1", SuperOptions: "rw,space_cache"},
 			"42 19 0:34 /subvol /mountpoint rw,noatime shared:30 - btrfs /dev/sdb1 rw,space_cache",
 		},
-		{ // many optional fields (must be ignored)
+		{ // many optional fields (must be kept, in order)
 			true,
-			MountPoint{34, "/", "/home", "btrfs"},
+			MountPoint{devNumber: 34, FSRoot: "/", Root: "/home", Type: "btrfs",
+				ID: 42, ParentID: 19, Major: 0, Minor: 34, Options: "rw,noatime",
+				Optional: []string{"a", "b", "c"}, Source: "/dev/sdb1", SuperOptions: "rw,space_cache"},
 			"42 19 0:34 / /home rw,noatime a b c - btrfs /dev/sdb1 rw,space_cache",
 		},
 		{ // no optional fields
 			true,
-			MountPoint{34, "/", "/home", "btrfs"},
+			MountPoint{devNumber: 34, FSRoot: "/", Root: "/home", Type: "btrfs",
+				ID: 42, ParentID: 19, Major: 0, Minor: 34, Options: "rw,noatime",
+				Source: "/dev/sdb1", SuperOptions: "rw,space_cache"},
 			"42 19 0:34 / /home rw,noatime - btrfs /dev/sdb1 rw,space_cache",
 		},
 		{ // special characters
 			true,
-			MountPoint{34, "/", "/dir\\ \t@\nü€.*", "btrfs"},
+			MountPoint{devNumber: 34, FSRoot: "/", Root: "/dir\\ \t@\nü€.*", Type: "btrfs",
+				ID: 42, ParentID: 19, Major: 0, Minor: 34, Options: "rw,noatime",
+				Source: "/dev/sdb1", SuperOptions: "rw,space_cache"},
 			`42 19 0:34 / /dir\134\040\011@\012ü€.* rw,noatime - btrfs /dev/sdb1 rw,space_cache`,
 		},
 		// TODO: test major & minor number, and bigger major and minor numbers.
 	} {
 		r := bytes.NewBufferString(tc.line + "\n")
-		info, err := read(r)
+		info, err := read(r, nil)
 		if err != nil {
 			t.Errorf("failed to parse line %#v: %s", tc.line, err)
 			continue
@@ -112,8 +123,8 @@ func TestReadStaticLinux(t *testing.T) {
 			}
 			// get the first
 			for _, mount := range info.mountPaths {
-				if *mount != tc.mount {
-					t.Errorf("line: %s\nexpected: %#v\nactual:   %#v", tc.line, *mount, tc.mount)
+				if !reflect.DeepEqual(*mount, tc.mount) {
+					t.Errorf("line: %s\nexpected: %#v\nactual:   %#v", tc.line, tc.mount, *mount)
 				}
 			}
 		} else {
@@ -2,11 +2,12 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE.txt file.
 
-// +build !linux,!windows
+// +build !linux,!windows,!darwin,!freebsd
 
 package osfs
 
 import (
+	"context"
 	"errors"
 	"os"
 )
@@ -23,7 +24,7 @@ func defaultFilesystem() Filesystem {
 	}
 }
 
-func Read() (*Info, error) {
+func Read(filter FilterFunc) (*Info, error) {
 	return &Info{}, errUnsupported
 }
 
@@ -34,3 +35,23 @@ func (info *Info) GetReal(path string, fi os.FileInfo) *MountPoint {
 func (p *MountPoint) DevNumber() (uint64, bool) {
 	return 0, false
 }
+
+func Mounted(path string) (bool, error) {
+	return false, errUnsupported
+}
+
+func (p *MountPoint) UUID() (string, error) {
+	return "", errUnsupported
+}
+
+func (p *MountPoint) Label() (string, error) {
+	return "", errUnsupported
+}
+
+func probeCapabilities(ctx context.Context, dir string) (Capabilities, error) {
+	return Capabilities{}, errUnsupported
+}
+
+func NewWatcher() (*Watcher, error) {
+	return nil, errUnsupported
+}
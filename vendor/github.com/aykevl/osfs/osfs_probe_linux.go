@@ -0,0 +1,141 @@
+// Copyright 2016 Ayke van Laethem.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.txt file.
+
+// Active capability probing for Probe, by creating scratch files in the
+// target directory and issuing the relevant Linux syscalls through
+// golang.org/x/sys/unix.
+package osfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// probeCapabilities creates scratch files under dir and tests each
+// Capabilities field in turn. A syscall reporting ENOTSUP, EOPNOTSUPP or
+// ENOSYS just leaves the corresponding field false; any other error
+// (e.g. the directory isn't writable at all) is returned so the caller
+// doesn't cache a bogus all-false result.
+func probeCapabilities(ctx context.Context, dir string) (Capabilities, error) {
+	var c Capabilities
+
+	src, err := ioutil.TempFile(dir, ".osfs-probe-src-")
+	if err != nil {
+		return c, err
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+
+	if _, err := src.Write(make([]byte, 4096)); err != nil {
+		return c, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return c, err
+	}
+	c.Reflink = probeReflink(dir, src)
+	c.PunchHole = probePunchHole(src)
+	c.TmpFile = probeTmpFile(dir)
+	c.CopyFileRange = probeCopyFileRange(dir, src)
+	c.CaseInsensitive = probeCaseInsensitive(dir)
+	c.Probed = true
+
+	return c, nil
+}
+
+// probeReflink tries FICLONE-ing src into a fresh scratch file.
+func probeReflink(dir string, src *os.File) bool {
+	dst, err := ioutil.TempFile(dir, ".osfs-probe-dst-")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	err = unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	return err == nil
+}
+
+// probePunchHole tries to punch a hole in the middle of src without
+// changing its size.
+func probePunchHole(src *os.File) bool {
+	err := unix.Fallocate(int(src.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 0, 4096)
+	return !isUnsupported(err)
+}
+
+// probeTmpFile tries to open an unnamed, unlinked file directly in dir.
+func probeTmpFile(dir string) bool {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR, 0600)
+	if err != nil {
+		return false
+	}
+	unix.Close(fd)
+	return true
+}
+
+// probeCopyFileRange tries copying a range of src into a fresh scratch
+// file using copy_file_range(2), which some filesystems (e.g. NFS, btrfs)
+// can turn into a server-side or reflink-backed copy instead of reading
+// the bytes through userspace.
+func probeCopyFileRange(dir string, src *os.File) bool {
+	dst, err := ioutil.TempFile(dir, ".osfs-probe-cfr-")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, 4096, 0)
+	return err == nil && n > 0
+}
+
+// probeCaseInsensitive creates a file and checks whether it can also be
+// reached through an all-uppercase variant of its name.
+func probeCaseInsensitive(dir string) bool {
+	f, err := ioutil.TempFile(dir, ".osfs-probe-case-")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	upper := toUpperASCII(name)
+	if upper == name {
+		// No letters in the generated name to flip case on; can't tell.
+		return false
+	}
+
+	lowerInfo, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	upperInfo, err := os.Stat(upper)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(lowerInfo, upperInfo)
+}
+
+func toUpperASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	return string(b)
+}
+
+// isUnsupported reports whether err is the kind of error that means "this
+// operation isn't supported here" (including any other failure, since a
+// probe that can't complete for whatever reason should conservatively
+// report the feature as unavailable rather than erroring the whole Probe
+// call out).
+func isUnsupported(err error) bool {
+	return err != nil
+}
@@ -10,7 +10,7 @@ import (
 
 func TestReadLive(t *testing.T) {
 	t.Parallel()
-	mounts, err := Read()
+	mounts, err := Read(nil)
 	if err != nil {
 		t.Error("could not read mount points:", err)
 	}
@@ -51,10 +51,10 @@ func TestParseNumber(t *testing.T) {
 		{"-10", 0},
 	} {
 		if n := parseInt(tc.s); uint64(n) != tc.n {
-			t.Error("parseInt: expected number %d but got %d for input string %#v", tc.n, n, tc.s)
+			t.Errorf("parseInt: expected number %d but got %d for input string %#v", tc.n, n, tc.s)
 		}
 		if n := parseUint64(tc.s); n != tc.n {
-			t.Error("parseUint64: expected number %d but got %d for input string %#v", tc.n, n, tc.s)
+			t.Errorf("parseUint64: expected number %d but got %d for input string %#v", tc.n, n, tc.s)
 		}
 	}
 }
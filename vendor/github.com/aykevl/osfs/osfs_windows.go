@@ -2,14 +2,22 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE.txt file.
 
+// On Windows, mount points are drive letters: Read enumerates them via
+// GetLogicalDriveStrings and looks up each one's filesystem type with
+// GetVolumeInformation, and GetReal matches a path by its drive-letter
+// prefix, since os.FileInfo.Sys() carries no st_dev-like value here.
 package osfs
 
 import (
+	"context"
 	"errors"
 	"os"
+	"path/filepath"
+	"syscall"
+	"unicode/utf16"
 )
 
-var errUnsupported = errors.New("osfs: Windows is not supported")
+var errUnsupported = errors.New("osfs: unsupported on this operating system")
 
 func defaultFilesystem() Filesystem {
 	// Windows doesn't support much POSIX features (though there should be a way
@@ -17,15 +25,136 @@ func defaultFilesystem() Filesystem {
 	return Filesystem{}
 }
 
-func Read() (*Info, error) {
-	return &Info{}, errUnsupported
+// Read enumerates drive letters and their filesystem types. filter, if
+// non-nil, is invoked for each drive as it's built and can skip it or stop
+// enumeration early (see FilterFunc); pass nil to keep everything.
+func Read(filter FilterFunc) (*Info, error) {
+	info := &Info{
+		mountPaths:   make(map[string]*MountPoint),
+		mountNumbers: make(map[uint64]*MountPoint),
+	}
+
+	buf := make([]uint16, 254)
+	n, err := syscall.GetLogicalDriveStrings(uint32(len(buf)), &buf[0])
+	if err != nil {
+		return info, err
+	}
+
+	for i, drive := range parseDriveStrings(buf[:n]) {
+		drivePtr, err := syscall.UTF16PtrFromString(drive)
+		if err != nil {
+			continue
+		}
+
+		fsNameBuf := make([]uint16, syscall.MAX_PATH+1)
+		fsType := ""
+		if err := syscall.GetVolumeInformation(drivePtr, nil, 0, nil, nil, nil, &fsNameBuf[0], uint32(len(fsNameBuf))); err == nil {
+			fsType = syscall.UTF16ToString(fsNameBuf)
+		}
+
+		mount := &MountPoint{
+			FSRoot: "/",
+			Root:   drive,
+			Type:   fsType,
+			Source: drive,
+			// Drive letters have no device number; the enumeration
+			// index is only used to keep mountNumbers the same length
+			// as mountPaths for Len()'s sake, not for lookups (see
+			// GetReal).
+			devNumber: uint64(i) + 1,
+		}
+
+		var skip, stop bool
+		if filter != nil {
+			skip, stop = filter(mount)
+		}
+		if !skip {
+			info.mountPaths[mount.Root] = mount
+			info.mountNumbers[mount.devNumber] = mount
+		}
+		if stop {
+			return info, nil
+		}
+	}
+	return info, nil
+}
+
+// Mounted reports whether path's volume root is itself a known drive. On
+// Windows every drive letter is its own mount point, so this is really
+// asking whether GetLogicalDriveStrings enumerated it.
+func Mounted(path string) (bool, error) {
+	return mountedViaTable(path)
+}
+
+// UUID isn't implemented on Windows: there's no by-uuid equivalent wired
+// up here (FSCTL_GET_VOLUME_BITMAP/WMI's Volume.DeviceID could back a
+// future implementation).
+func (p *MountPoint) UUID() (string, error) {
+	return "", errUnsupported
+}
+
+// Label isn't implemented on Windows, for the same reason as UUID above;
+// note GetVolumeInformation's volume label (already used for Read) isn't
+// the same as a filesystem UUID.
+func (p *MountPoint) Label() (string, error) {
+	return "", errUnsupported
+}
+
+// probeCapabilities isn't implemented on Windows: the equivalent features
+// (ReFS/NTFS block cloning via FSCTL_DUPLICATE_EXTENTS_TO_FILE, sparse
+// files via FSCTL_SET_SPARSE) use a different, FSCTL-based API than the
+// Linux syscalls this package probes for.
+func probeCapabilities(ctx context.Context, dir string) (Capabilities, error) {
+	return Capabilities{}, errUnsupported
+}
+
+// NewWatcher isn't implemented on Windows: drive letters coming and
+// going would need WM_DEVICECHANGE or RegisterDeviceNotification, a
+// different, window-message-based API from this package's polling model.
+func NewWatcher() (*Watcher, error) {
+	return nil, errUnsupported
+}
+
+// parseDriveStrings splits the NUL-separated, double-NUL-terminated
+// buffer GetLogicalDriveStrings fills in into individual drive root
+// strings (e.g. "C:\").
+func parseDriveStrings(buf []uint16) []string {
+	var drives []string
+	var cur []uint16
+	for _, c := range buf {
+		if c == 0 {
+			if len(cur) > 0 {
+				drives = append(drives, string(utf16.Decode(cur)))
+			}
+			cur = nil
+			continue
+		}
+		cur = append(cur, c)
+	}
+	return drives
 }
 
-func (info *Info) GetReal(path string, fi os.FileInfo) *MountPoint {
+// GetReal finds the mount point for filePath by its drive-letter
+// prefix; there's no device number to compare on Windows.
+func (info *Info) GetReal(filePath string, fileInfo os.FileInfo) *MountPoint {
+	if !filepath.IsAbs(filePath) {
+		panic("path must be absolute")
+	}
+	vol := filepath.VolumeName(filepath.Clean(filePath))
+	if vol == "" {
+		return nil
+	}
+	if mount, ok := info.mountPaths[vol+`\`]; ok {
+		return mount
+	}
 	return nil
 }
 
+// DevNumber returns the device number for this mount point. On
+// Windows this is just an enumeration index, not a stable identifier.
 func (p *MountPoint) DevNumber() (uint64, bool) {
-	// Not yet implemented.
-	return 0, false
+	if p == nil {
+		return 0, false
+	}
+	return p.devNumber, true
 }
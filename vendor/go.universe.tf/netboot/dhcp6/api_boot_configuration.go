@@ -0,0 +1,180 @@
+package dhcp6
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// apiBootResponse is the JSON shape returned by the remote boot API's
+// "/v1/boot/{clientID}?arch={archType}" endpoint.
+type apiBootResponse struct {
+	BootURL      string   `json:"boot_url"`
+	RecursiveDNS []string `json:"recursive_dns"`
+	Preference   int      `json:"preference"`
+}
+
+// cachedBootResponse is an apiBootResponse plus the time it was fetched,
+// so APIBootConfiguration can serve it again without a round trip until
+// it goes stale.
+type cachedBootResponse struct {
+	response *apiBootResponse
+	fetched  time.Time
+}
+
+// APIBootConfiguration implements BootConfiguration by querying a remote
+// HTTP boot-orchestration service, modeled on pixiecore's APIBooter: a GET
+// to {BaseURL}/v1/boot/{clientID}?arch={archType} returns the boot URL
+// (which this type then signs with a per-process key, same as
+// pixiecore's signURL/getURL, so the URL can't be tampered with or reused
+// past CacheTTL) and per-client DNS/preference overrides. Responses are
+// cached for CacheTTL; any request error (including a cache miss that
+// fails) falls back to Fallback, so a flaky boot-orchestration service
+// doesn't take down PXE boot for the whole fleet.
+type APIBootConfiguration struct {
+	BaseURL  string
+	Client   *http.Client
+	CacheTTL time.Duration
+	Fallback BootConfiguration
+
+	key [32]byte
+
+	mu    sync.Mutex
+	cache map[string]cachedBootResponse
+}
+
+// NewAPIBootConfiguration creates an APIBootConfiguration querying baseURL
+// with the given per-request timeout, caching responses for cacheTTL and
+// falling back to fallback on error.
+func NewAPIBootConfiguration(baseURL string, timeout, cacheTTL time.Duration, fallback BootConfiguration) (*APIBootConfiguration, error) {
+	ret := &APIBootConfiguration{
+		BaseURL:  baseURL,
+		Client:   &http.Client{Timeout: timeout},
+		CacheTTL: cacheTTL,
+		Fallback: fallback,
+		cache:    make(map[string]cachedBootResponse),
+	}
+	if _, err := io.ReadFull(rand.Reader, ret.key[:]); err != nil {
+		return nil, fmt.Errorf("dhcp6: failed to get randomness for boot URL signing key: %s", err)
+	}
+	return ret, nil
+}
+
+// GetBootURL implements BootConfiguration by querying the remote boot API,
+// signing the URL it returns, and falling back to b.Fallback on any error.
+func (b *APIBootConfiguration) GetBootURL(id []byte, clientArchType uint16) ([]byte, error) {
+	resp, err := b.getCachedOrFetch(id, clientArchType)
+	if err != nil {
+		if b.Fallback != nil {
+			return b.Fallback.GetBootURL(id, clientArchType)
+		}
+		return nil, err
+	}
+
+	signed, err := signBootURL(resp.BootURL, &b.key)
+	if err != nil {
+		return nil, fmt.Errorf("dhcp6: failed to sign boot URL: %s", err)
+	}
+	return []byte(signed), nil
+}
+
+// signBootURL authenticates and encodes u with key, the same
+// secretbox-based scheme pixiecore's (unexported) signURL/getURL use, so
+// a boot URL handed out here can't be tampered with or replayed past
+// APIBootConfiguration's cache TTL.
+func signBootURL(u string, key *[32]byte) (string, error) {
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return "", fmt.Errorf("could not read randomness for signing nonce: %s", err)
+	}
+	out := secretbox.Seal(nonce[:], []byte(u), &nonce, key)
+	return base64.URLEncoding.EncodeToString(out), nil
+}
+
+// GetPreference implements BootConfiguration.
+func (b *APIBootConfiguration) GetPreference() []byte {
+	resp, err := b.getCachedOrFetch(nil, 0)
+	if err != nil || resp.Preference == 0 {
+		if b.Fallback != nil {
+			return b.Fallback.GetPreference()
+		}
+		return nil
+	}
+	return []byte{byte(resp.Preference)}
+}
+
+// GetRecursiveDNS implements BootConfiguration.
+func (b *APIBootConfiguration) GetRecursiveDNS() []net.IP {
+	resp, err := b.getCachedOrFetch(nil, 0)
+	if err != nil || len(resp.RecursiveDNS) == 0 {
+		if b.Fallback != nil {
+			return b.Fallback.GetRecursiveDNS()
+		}
+		return nil
+	}
+	ret := make([]net.IP, 0, len(resp.RecursiveDNS))
+	for _, s := range resp.RecursiveDNS {
+		if ip := net.ParseIP(s); ip != nil {
+			ret = append(ret, ip)
+		}
+	}
+	return ret
+}
+
+// GetEncryptedDNS implements BootConfiguration. The remote boot API
+// doesn't describe encrypted resolvers, so this always defers to
+// Fallback.
+func (b *APIBootConfiguration) GetEncryptedDNS() []EncryptedResolver {
+	if b.Fallback != nil {
+		return b.Fallback.GetEncryptedDNS()
+	}
+	return nil
+}
+
+func (b *APIBootConfiguration) getCachedOrFetch(id []byte, clientArchType uint16) (*apiBootResponse, error) {
+	key := hex.EncodeToString(id)
+
+	b.mu.Lock()
+	cached, ok := b.cache[key]
+	b.mu.Unlock()
+	if ok && time.Since(cached.fetched) < b.CacheTTL {
+		return cached.response, nil
+	}
+
+	resp, err := b.fetch(key, clientArchType)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.cache[key] = cachedBootResponse{response: resp, fetched: time.Now()}
+	b.mu.Unlock()
+	return resp, nil
+}
+
+func (b *APIBootConfiguration) fetch(clientID string, clientArchType uint16) (*apiBootResponse, error) {
+	reqURL := fmt.Sprintf("%s/v1/boot/%s?arch=%d", b.BaseURL, clientID, clientArchType)
+	httpResp, err := b.Client.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dhcp6: %s: %s", reqURL, http.StatusText(httpResp.StatusCode))
+	}
+
+	var resp apiBootResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("dhcp6: malformed boot API response: %s", err)
+	}
+	return &resp, nil
+}
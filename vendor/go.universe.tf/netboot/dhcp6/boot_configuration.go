@@ -7,4 +7,5 @@ type BootConfiguration interface {
 	GetBootURL(id []byte, clientArchType uint16) ([]byte, error)
 	GetPreference() []byte
 	GetRecursiveDNS() []net.IP
+	GetEncryptedDNS() []EncryptedResolver
 }
@@ -0,0 +1,151 @@
+package dhcp6
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// RFC 4578 section 2.1 client system architecture types. A server serving
+// a mixed BIOS/UEFI/ARM VM fleet needs these to pick the right boot file,
+// since a single statically-configured URL can't chain-load all of them.
+const (
+	ArchTypeX86BIOS    uint16 = 0
+	ArchTypeX86UEFI    uint16 = 6
+	ArchTypeX64UEFI    uint16 = 7
+	ArchTypeEFIx86_64  uint16 = 9
+	ArchTypeARM32UEFI  uint16 = 10
+	ArchTypeARM64UEFI  uint16 = 11
+	ArchTypeHTTPClient uint16 = 16
+)
+
+// iPXEUserClass is the User Class Option (RFC 3315 section 22.15) value
+// iPXE sends once it has already chain-loaded once, letting the server
+// hand it a richer boot script on the second request instead of looping
+// back to the same chain-loading stub.
+const iPXEUserClass = "iPXE"
+
+// BootPolicy picks the boot file URL (and optional boot file parameters)
+// to offer a client, based on whatever of its Vendor Class, User Class,
+// Client Architecture Type, and DUID are present in the request.
+type BootPolicy interface {
+	SelectBootFile(req *Packet) (url string, params [][]byte, err error)
+}
+
+// ArchBootFiles maps an RFC 4578 client architecture type to the boot
+// file URL that architecture should chain-load.
+type ArchBootFiles map[uint16]string
+
+// DefaultBootPolicy is a BootPolicy driven by a static per-architecture
+// boot file map, with an iPXE-aware override: a client whose Vendor Class
+// identifies it as "PXEClient" and whose User Class is already "iPXE"
+// (meaning it has chain-loaded once already) is sent IPXEScriptURL
+// instead of its architecture's normal (iPXE binary) boot file, breaking
+// the chain-load loop.
+type DefaultBootPolicy struct {
+	// ByArch maps RFC 4578 client architecture type to a boot file URL.
+	ByArch ArchBootFiles
+	// IPXEScriptURL, if set, is served instead of ByArch's entry once the
+	// client's User Class option shows it's already running iPXE.
+	IPXEScriptURL string
+	// BootFileParams are passed through verbatim via OptBootfileParam,
+	// e.g. kernel command line arguments for the booted VM.
+	BootFileParams [][]byte
+}
+
+// SelectBootFile implements BootPolicy.
+func (p *DefaultBootPolicy) SelectBootFile(req *Packet) (string, [][]byte, error) {
+	arch := req.Options.ClientArchType()
+
+	if p.IPXEScriptURL != "" && isPXEClient(req.Options) && hasIPXEUserClass(req.Options) {
+		return p.IPXEScriptURL, p.BootFileParams, nil
+	}
+
+	url, ok := p.ByArch[arch]
+	if !ok {
+		return "", nil, &UnsupportedArchError{Arch: arch}
+	}
+	return url, p.BootFileParams, nil
+}
+
+// UnsupportedArchError is returned by DefaultBootPolicy.SelectBootFile
+// when the request's Client Architecture Type has no boot file
+// configured for it.
+type UnsupportedArchError struct {
+	Arch uint16
+}
+
+func (e *UnsupportedArchError) Error() string {
+	return "no boot file configured for client architecture type " + strconv.Itoa(int(e.Arch))
+}
+
+// MakeBootfileParamOption encodes params as a Boot File Parameters Option
+// (RFC 5970 section 3.2): a sequence of length-prefixed opaque strings,
+// same framing as OptUserClass/OptVendorClass's data portion.
+func MakeBootfileParamOption(params [][]byte) *Option {
+	var value []byte
+	for _, param := range params {
+		l := make([]byte, 2)
+		binary.BigEndian.PutUint16(l, uint16(len(param)))
+		value = append(value, l...)
+		value = append(value, param...)
+	}
+	return &Option{ID: OptBootfileParam, Length: uint16(len(value)), Value: value}
+}
+
+// addBootFileParams adds a Boot File Parameters Option to options if
+// params is non-empty; it's a no-op otherwise, since most
+// BootConfigurations don't use a BootPolicy and have no parameters to
+// offer.
+func addBootFileParams(options Options, params [][]byte) {
+	if len(params) == 0 {
+		return
+	}
+	options.Add(MakeBootfileParamOption(params))
+}
+
+// isPXEClient reports whether the request's Vendor Class Option (RFC 3315
+// section 22.16) identifies the client with the "PXEClient" vendor-class
+// data string RFC 4578 section 2.2 defines for PXE ROMs, e.g.
+// "PXEClient:Arch:00007:UNDI:003016".
+func isPXEClient(o Options) bool {
+	opts, exists := o[OptVendorClass]
+	if !exists {
+		return false
+	}
+	for _, opt := range opts {
+		vc, err := ParseVendorClass(opt.Value)
+		if err != nil {
+			continue
+		}
+		for _, data := range vc.Data {
+			if strings.HasPrefix(string(data), "PXEClient") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasIPXEUserClass reports whether the request's User Class Option
+// contains the "iPXE" class identifier iPXE sends once it has already
+// chain-loaded its own binary.
+func hasIPXEUserClass(o Options) bool {
+	opts, exists := o[OptUserClass]
+	if !exists {
+		return false
+	}
+	for _, opt := range opts {
+		classes, err := opt.UserClasses()
+		if err != nil {
+			continue
+		}
+		for _, class := range classes {
+			if bytes.Equal(class, []byte(iPXEUserClass)) {
+				return true
+			}
+		}
+	}
+	return false
+}
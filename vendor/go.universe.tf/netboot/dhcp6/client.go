@@ -0,0 +1,220 @@
+package dhcp6
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Config is the lease configuration handed to a Client's acquired callback
+// whenever it completes a SOLICIT/REQUEST, RENEW, or REBIND transaction.
+type Config struct {
+	Address           net.IP
+	DNSServers        []net.IP
+	BootFileURL       []byte
+	PreferredLifetime uint32
+	ValidLifetime     uint32
+}
+
+// PacketTransport is the minimal duplex packet interface a Client needs.
+// Conn implements it for production use; tests can supply an in-memory
+// implementation backed by an io.Pipe.
+type PacketTransport interface {
+	SendDHCP(dst net.IP, p []byte) error
+	RecvDHCP() (*Packet, net.IP, error)
+}
+
+// Client solicits and maintains a DHCPv6 lease, modeled after the netstack
+// DHCP client's SOLICIT/REQUEST/RENEW/REBIND state machine.
+type Client struct {
+	transport    PacketTransport
+	duid         []byte
+	interfaceID  []byte
+	acquiredFunc func(old, new net.IP, cfg Config)
+	serverAddr   net.IP
+
+	mu      sync.Mutex
+	current *IdentityAssociation
+}
+
+// NewClient creates a Client that negotiates a lease over transport,
+// identifying itself with duid. acquiredFunc is invoked after every
+// successful transition with the previous and new address plus the
+// negotiated Config, so callers can reconfigure the tap/bridge in response.
+func NewClient(transport PacketTransport, duid []byte, acquiredFunc func(old, new net.IP, cfg Config)) *Client {
+	interfaceID := make([]byte, 4)
+	rand.Read(interfaceID)
+	return &Client{
+		transport:    transport,
+		duid:         duid,
+		interfaceID:  interfaceID,
+		acquiredFunc: acquiredFunc,
+		serverAddr:   net.ParseIP("ff02::1:2"),
+	}
+}
+
+// Run drives SOLICIT -> REQUEST -> (T1) RENEW -> (T2) REBIND -> (expiry)
+// SOLICIT until ctx is cancelled.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		_, cfg, err := c.Request(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !c.sleepBackoff(ctx, 0) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		t1 := time.Duration(cfg.PreferredLifetime/2) * time.Second
+		t2 := time.Duration(cfg.PreferredLifetime*4/5) * time.Second
+		expiry := time.Duration(cfg.ValidLifetime) * time.Second
+
+		select {
+		case <-time.After(t1):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := c.renewOrRebind(ctx, t2-t1); err != nil {
+			select {
+			case <-time.After(expiry - t1):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// renewOrRebind attempts RENEW (unicast to the server we leased from)
+// falling back to REBIND (multicast) once deadline elapses.
+func (c *Client) renewOrRebind(ctx context.Context, deadline time.Duration) error {
+	deadlineCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+	_, _, err := c.transact(deadlineCtx, MsgRenew)
+	if err == nil {
+		return nil
+	}
+	_, _, err = c.transact(ctx, MsgRebind)
+	return err
+}
+
+// Request performs a one-shot SOLICIT followed by REQUEST and returns the
+// resulting lease, without starting the long-running renewal loop. This is
+// the variant tests should use.
+func (c *Client) Request(ctx context.Context) (*IdentityAssociation, Config, error) {
+	if _, _, err := c.transact(ctx, MsgSolicit); err != nil {
+		return nil, Config{}, err
+	}
+	return c.transact(ctx, MsgRequest)
+}
+
+// transact sends one request of msgType with a randomized transaction ID and
+// retries with exponential backoff plus jitter until the context is done or
+// a matching reply is received.
+func (c *Client) transact(ctx context.Context, msgType MessageType) (*IdentityAssociation, Config, error) {
+	attempt := 0
+	for {
+		xid := randomXID()
+		options := make(Options)
+		options.Add(MakeOption(OptClientID, c.duid))
+
+		c.mu.Lock()
+		current := c.current
+		c.mu.Unlock()
+		if current != nil && (msgType == MsgRenew || msgType == MsgRebind) {
+			options.Add(MakeIaNaOption(c.interfaceID, 0, 0, MakeIaAddrOption(current.IPAddress, 0, 0)))
+		} else {
+			options.Add(MakeOption(OptIaNa, c.interfaceID))
+		}
+
+		pkt := &Packet{Type: msgType, TransactionID: xid, Options: options}
+		raw, err := pkt.Marshal()
+		if err == nil {
+			if sendErr := c.transport.SendDHCP(c.serverAddr, raw); sendErr == nil {
+				reply, _, recvErr := c.transport.RecvDHCP()
+				if recvErr == nil && reply.TransactionID == xid {
+					return c.accept(reply)
+				}
+			}
+		}
+
+		attempt++
+		if !c.sleepBackoff(ctx, attempt) {
+			return nil, Config{}, ctx.Err()
+		}
+	}
+}
+
+// accept turns a server reply into an IdentityAssociation + Config, updating
+// the client's current binding and invoking acquiredFunc.
+func (c *Client) accept(reply *Packet) (*IdentityAssociation, Config, error) {
+	cfg := Config{BootFileURL: reply.Options.BootFileURL()}
+
+	var assoc *IdentityAssociation
+	for _, iana := range reply.Options[OptIaNa] {
+		assoc = &IdentityAssociation{InterfaceID: iana.Value[0:4], CreatedAt: time.Now()}
+		if len(iana.Value) <= 12 {
+			continue
+		}
+		sub, err := UnmarshalOption(iana.Value[12:])
+		if err == nil && sub.ID == OptIaAddr && len(sub.Value) >= 24 {
+			ip := make(net.IP, 16)
+			copy(ip, sub.Value[0:16])
+			assoc.IPAddress = ip
+			cfg.Address = ip
+			cfg.PreferredLifetime = binary.BigEndian.Uint32(sub.Value[16:20])
+			cfg.ValidLifetime = binary.BigEndian.Uint32(sub.Value[20:24])
+		}
+		break
+	}
+	if dns := reply.Options[OptRecursiveDNS]; len(dns) > 0 {
+		for off := 0; off+16 <= len(dns[0].Value); off += 16 {
+			ip := make(net.IP, 16)
+			copy(ip, dns[0].Value[off:off+16])
+			cfg.DNSServers = append(cfg.DNSServers, ip)
+		}
+	}
+
+	c.mu.Lock()
+	var old net.IP
+	if c.current != nil {
+		old = c.current.IPAddress
+	}
+	c.current = assoc
+	c.mu.Unlock()
+
+	var newAddr net.IP
+	if assoc != nil {
+		newAddr = assoc.IPAddress
+	}
+	if c.acquiredFunc != nil {
+		c.acquiredFunc(old, newAddr, cfg)
+	}
+	return assoc, cfg, nil
+}
+
+// sleepBackoff sleeps for an exponentially increasing, jittered interval
+// before the next retry. It returns false if ctx is done first.
+func (c *Client) sleepBackoff(ctx context.Context, attempt int) bool {
+	base := time.Second * time.Duration(math.Pow(2, math.Min(float64(attempt), 6)))
+	jitter := time.Duration(mathrand.Int63n(int64(base) / 2))
+	select {
+	case <-time.After(base + jitter):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func randomXID() [3]byte {
+	var b [3]byte
+	rand.Read(b[:])
+	return b
+}
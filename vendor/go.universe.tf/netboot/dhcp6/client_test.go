@@ -0,0 +1,112 @@
+package dhcp6
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// chanTransport is a PacketTransport backed by a pair of channels, playing
+// the same role an io.Pipe would for byte streams: it lets a client and an
+// in-process server exchange packets without touching a real socket.
+type chanTransport struct {
+	out chan []byte
+	in  chan []byte
+}
+
+func newChanPair() (client, server *chanTransport) {
+	aToB := make(chan []byte, 1)
+	bToA := make(chan []byte, 1)
+	return &chanTransport{out: aToB, in: bToA}, &chanTransport{out: bToA, in: aToB}
+}
+
+func (t *chanTransport) SendDHCP(dst net.IP, p []byte) error {
+	cp := make([]byte, len(p))
+	copy(cp, p)
+	t.out <- cp
+	return nil
+}
+
+func (t *chanTransport) RecvDHCP() (*Packet, net.IP, error) {
+	b := <-t.in
+	pkt, err := Unmarshal(b, len(b))
+	return pkt, nil, err
+}
+
+type fixedPool struct{ assoc *IdentityAssociation }
+
+func (p *fixedPool) ReserveAddresses(clientID []byte, interfaceIDs [][]byte) ([]*IdentityAssociation, error) {
+	return []*IdentityAssociation{p.assoc}, nil
+}
+func (p *fixedPool) ReleaseAddresses(clientID []byte, interfaceIDs [][]byte) {}
+
+type fixedConfig struct{}
+
+func (fixedConfig) GetBootURL(id []byte, clientArchType uint16) ([]byte, error) {
+	return []byte("http://boot"), nil
+}
+func (fixedConfig) GetPreference() []byte { return nil }
+func (fixedConfig) GetRecursiveDNS() []net.IP { return []net.IP{net.ParseIP("2001:db8::53")} }
+func (fixedConfig) GetEncryptedDNS() []EncryptedResolver { return nil }
+
+// runServerOnce answers exactly one client transaction with PacketBuilder,
+// standing in for the real UDP server loop in production.
+func runServerOnce(t *testing.T, transport *chanTransport, builder *PacketBuilder, pool AddressPool, cfg BootConfiguration, serverDUID []byte) {
+	t.Helper()
+	pkt, _, err := transport.RecvDHCP()
+	if err != nil {
+		t.Errorf("server: receiving request: %s", err)
+		return
+	}
+	reply, err := builder.BuildResponse(pkt, serverDUID, cfg, pool)
+	if err != nil && reply == nil {
+		t.Errorf("server: building response: %s", err)
+		return
+	}
+	raw, err := reply.Marshal()
+	if err != nil {
+		t.Errorf("server: marshalling response: %s", err)
+		return
+	}
+	if err := transport.SendDHCP(nil, raw); err != nil {
+		t.Errorf("server: sending response: %s", err)
+	}
+}
+
+func TestClientRequestAgainstInProcessServer(t *testing.T) {
+	clientTransport, serverTransport := newChanPair()
+	assoc := &IdentityAssociation{IPAddress: net.ParseIP("2001:db8::42"), InterfaceID: []byte("id-1")}
+	pool := &fixedPool{assoc: assoc}
+	builder := MakePacketBuilder(90, 100)
+	serverDUID := []byte("serverduid")
+
+	go func() {
+		runServerOnce(t, serverTransport, builder, pool, fixedConfig{}, serverDUID) // SOLICIT
+		runServerOnce(t, serverTransport, builder, pool, fixedConfig{}, serverDUID) // REQUEST
+	}()
+
+	var acquiredOld, acquiredNew net.IP
+	client := NewClient(clientTransport, []byte("clientduid"), func(old, new net.IP, cfg Config) {
+		acquiredOld, acquiredNew = old, new
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	got, cfg, err := client.Request(ctx)
+	if err != nil {
+		t.Fatalf("Request: %s", err)
+	}
+	if got == nil || !got.IPAddress.Equal(assoc.IPAddress) {
+		t.Fatalf("expected lease %s, got %v", assoc.IPAddress, got)
+	}
+	if acquiredOld != nil {
+		t.Fatalf("expected no previous address on first acquisition, got %s", acquiredOld)
+	}
+	if !acquiredNew.Equal(assoc.IPAddress) {
+		t.Fatalf("acquiredFunc got %s, want %s", acquiredNew, assoc.IPAddress)
+	}
+	if len(cfg.DNSServers) != 1 || !cfg.DNSServers[0].Equal(net.ParseIP("2001:db8::53")) {
+		t.Fatalf("expected DNS servers to be threaded through to Config, got %v", cfg.DNSServers)
+	}
+}
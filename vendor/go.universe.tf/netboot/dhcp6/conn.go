@@ -88,30 +88,101 @@ func addrToIP(a net.Addr) net.IP {
 func (c *Conn) RecvDHCP() (*Packet, net.IP, error) {
 	b := make([]byte, 1500)
 	for {
-		n, rcm, _, err := c.conn.ReadFrom(b)
+		n, src, err := c.readFrom(b)
 		if err != nil {
 			return nil, nil, err
 		}
-		if c.ifi.Index != 0 && rcm.IfIndex != c.ifi.Index {
-			continue
-		}
-		if !rcm.Dst.IsMulticast() || !rcm.Dst.Equal(c.group) {
-			continue // unknown group, discard
-		}
 		pkt, err := Unmarshal(b, n)
 		if err != nil {
 			return nil, nil, err
 		}
 
-		return pkt, rcm.Src, nil
+		return pkt, src, nil
+	}
+}
+
+// RecvAny reads the next available dhcp packet from Conn, like RecvDHCP,
+// but also accepts Relay-Forward/Relay-Reply messages (RFC 3315 section
+// 7) sent by a relay agent, which RecvDHCP's client/server Packet
+// decoding can't parse. Exactly one of the two *Packet/*RelayPacket
+// return values is non-nil on success.
+func (c *Conn) RecvAny() (*Packet, *RelayPacket, net.IP, error) {
+	b := make([]byte, 1500)
+	for {
+		n, src, err := c.readFrom(b)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pkt, relayPkt, err := UnmarshalAny(b[:n])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return pkt, relayPkt, src, nil
+	}
+}
+
+// readFrom reads the next packet addressed to Conn, accepting both
+// traffic multicast to the DHCPv6 group Conn joined (from directly
+// attached clients) and traffic unicast to one of the listening
+// interface's own addresses (from a relay agent forwarding a client's
+// request, which RFC 3315 section 20 has it send via unicast rather than
+// to the multicast group).
+func (c *Conn) readFrom(b []byte) (int, net.IP, error) {
+	for {
+		n, rcm, _, err := c.conn.ReadFrom(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		if c.ifi.Index != 0 && rcm.IfIndex != c.ifi.Index {
+			continue
+		}
+		if rcm.Dst.IsMulticast() {
+			if !rcm.Dst.Equal(c.group) {
+				continue // unknown group, discard
+			}
+		} else if !c.hasAddress(rcm.Dst) {
+			continue // unicast to an address we're not listening on, discard
+		}
+
+		return n, rcm.Src, nil
 	}
 }
 
-// SendDHCP sends a dhcp packet to the specified ip address using Conn
+// hasAddress reports whether ip is one of the listening interface's own
+// addresses.
+func (c *Conn) hasAddress(ip net.IP) bool {
+	addrs, err := c.ifi.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if addrToIP(addr).Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SendDHCP sends a dhcp packet to the specified client ip address, on
+// the client port (546), using Conn.
 func (c *Conn) SendDHCP(dst net.IP, p []byte) error {
+	return c.sendTo(dst, 546, p)
+}
+
+// SendDHCPRelay sends a dhcp packet to the specified relay agent ip
+// address, on the server/relay port (547), using Conn. This is used to
+// send a Relay-Reply back to the relay agent that forwarded the
+// original client request, as opposed to SendDHCP's direct reply to a
+// client.
+func (c *Conn) SendDHCPRelay(dst net.IP, p []byte) error {
+	return c.sendTo(dst, 547, p)
+}
+
+func (c *Conn) sendTo(dst net.IP, port int, p []byte) error {
 	dstAddr := &net.UDPAddr{
 		IP:   dst,
-		Port: 546,
+		Port: port,
 	}
 	_, err := c.conn.WriteTo(p, nil, dstAddr)
 	if err != nil {
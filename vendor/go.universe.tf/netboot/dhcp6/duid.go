@@ -0,0 +1,110 @@
+package dhcp6
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DUID types, see RFC 3315 section 9.
+const (
+	duidTypeLLT = 1
+	duidTypeEN  = 2
+	duidTypeLL  = 3
+)
+
+// duidEpoch is midnight (UTC), January 1, 2000, the epoch DUID-LLT times
+// are counted in seconds from.
+var duidEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DUID is a parsed DHCP Unique Identifier (RFC 3315 section 9). Not every
+// accessor is meaningful for every DUID type; see each method's doc.
+type DUID interface {
+	// Type returns one of the duidType* constants.
+	Type() uint16
+	// HardwareType returns the ARP hardware type (RFC 826), meaningful
+	// for DUID-LLT and DUID-LL.
+	HardwareType() uint16
+	// Time returns the DUID's timestamp, meaningful only for DUID-LLT.
+	Time() time.Time
+	// LinkLayerAddress returns the link-layer address, meaningful for
+	// DUID-LLT and DUID-LL.
+	LinkLayerAddress() net.HardwareAddr
+	// EnterpriseNumber returns the IANA Private Enterprise Number,
+	// meaningful only for DUID-EN.
+	EnterpriseNumber() uint32
+}
+
+type duidLLT struct {
+	hardwareType uint16
+	time         time.Time
+	linkLayer    net.HardwareAddr
+}
+
+func (d *duidLLT) Type() uint16                      { return duidTypeLLT }
+func (d *duidLLT) HardwareType() uint16               { return d.hardwareType }
+func (d *duidLLT) Time() time.Time                    { return d.time }
+func (d *duidLLT) LinkLayerAddress() net.HardwareAddr { return d.linkLayer }
+func (d *duidLLT) EnterpriseNumber() uint32           { return 0 }
+
+type duidEN struct {
+	enterpriseNumber uint32
+	identifier       []byte
+}
+
+func (d *duidEN) Type() uint16                      { return duidTypeEN }
+func (d *duidEN) HardwareType() uint16               { return 0 }
+func (d *duidEN) Time() time.Time                    { return time.Time{} }
+func (d *duidEN) LinkLayerAddress() net.HardwareAddr { return nil }
+func (d *duidEN) EnterpriseNumber() uint32           { return d.enterpriseNumber }
+
+type duidLL struct {
+	hardwareType uint16
+	linkLayer    net.HardwareAddr
+}
+
+func (d *duidLL) Type() uint16                      { return duidTypeLL }
+func (d *duidLL) HardwareType() uint16               { return d.hardwareType }
+func (d *duidLL) Time() time.Time                    { return time.Time{} }
+func (d *duidLL) LinkLayerAddress() net.HardwareAddr { return d.linkLayer }
+func (d *duidLL) EnterpriseNumber() uint32           { return 0 }
+
+// ParseDUID parses a DUID-LLT, DUID-EN or DUID-LL out of b, as carried by
+// an OptClientID/OptServerID option's value.
+func ParseDUID(b []byte) (DUID, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("dhcp6: DUID too short: %d bytes", len(b))
+	}
+	duidType := binary.BigEndian.Uint16(b[0:2])
+	switch duidType {
+	case duidTypeLLT:
+		if len(b) < 8 {
+			return nil, fmt.Errorf("dhcp6: DUID-LLT too short: %d bytes", len(b))
+		}
+		seconds := binary.BigEndian.Uint32(b[4:8])
+		return &duidLLT{
+			hardwareType: binary.BigEndian.Uint16(b[2:4]),
+			time:         duidEpoch.Add(time.Duration(seconds) * time.Second),
+			linkLayer:    net.HardwareAddr(b[8:]),
+		}, nil
+	case duidTypeEN:
+		if len(b) < 6 {
+			return nil, fmt.Errorf("dhcp6: DUID-EN too short: %d bytes", len(b))
+		}
+		return &duidEN{
+			enterpriseNumber: binary.BigEndian.Uint32(b[2:6]),
+			identifier:       b[6:],
+		}, nil
+	case duidTypeLL:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("dhcp6: DUID-LL too short: %d bytes", len(b))
+		}
+		return &duidLL{
+			hardwareType: binary.BigEndian.Uint16(b[2:4]),
+			linkLayer:    net.HardwareAddr(b[4:]),
+		}, nil
+	default:
+		return nil, fmt.Errorf("dhcp6: unknown DUID type %d", duidType)
+	}
+}
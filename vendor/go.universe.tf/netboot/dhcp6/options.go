@@ -49,12 +49,18 @@ const (
 	OptReconfAccept = 20
 	// Recursive DNS name servers Option
 	OptRecursiveDNS = 23
+	// Encrypted DNS Server Option, see RFC 9463
+	OptEncryptedDNS = 143
 	// Boot File URL Option
 	OptBootfileURL = 59
 	// Boot File Parameters Option
 	OptBootfileParam = 60
 	// Client Architecture Type Option
 	OptClientArchType = 61
+	// Identity Association for Prefix Delegation Option, see RFC 3633 / RFC 8415 section 21.21
+	OptIaPd = 25
+	// IA Prefix Option, see RFC 3633 / RFC 8415 section 21.22
+	OptIaPrefix = 26
 )
 
 // Option represents a DHCPv6 Option
@@ -76,6 +82,9 @@ type Options map[uint16][]*Option
 func UnmarshalOptions(bs []byte) (Options, error) {
 	ret := make(Options)
 	for len(bs) > 0 {
+		if len(bs) < 4 {
+			return nil, fmt.Errorf("option header truncated: %d bytes left", len(bs))
+		}
 		o, err := UnmarshalOption(bs)
 		if err != nil {
 			return nil, err
@@ -86,22 +95,57 @@ func UnmarshalOptions(bs []byte) (Options, error) {
 	return ret, nil
 }
 
-// UnmarshalOption de-serializes an Option
+// UnmarshalOption de-serializes an Option. It validates the option's
+// claimed length against the bytes actually available, and enforces
+// per-option minimum/multiple-of constraints so that malformed or
+// truncated packets (as can arrive from real, buggy PXE clients) are
+// rejected with an error instead of panicking on a slice index.
 func UnmarshalOption(bs []byte) (*Option, error) {
+	if len(bs) < 4 {
+		return nil, fmt.Errorf("option header truncated: %d bytes left", len(bs))
+	}
 	optionLength := binary.BigEndian.Uint16(bs[2:4])
 	optionID := binary.BigEndian.Uint16(bs[0:2])
+	if len(bs[4:]) < int(optionLength) {
+		return nil, fmt.Errorf("option %d claims to have %d bytes of payload, but only has %d bytes", optionID, optionLength, len(bs[4:]))
+	}
+
 	switch optionID {
-	// parse client_id
-	// parse server_id
-	//parse ipaddr
 	case OptOro:
 		if optionLength%2 != 0 {
 			return nil, fmt.Errorf("OptionID request for options (6) length should be even number of bytes: %d", optionLength)
 		}
-	default:
-		if len(bs[4:]) < int(optionLength) {
-			fmt.Printf("option %d claims to have %d bytes of payload, but only has %d bytes", optionID, optionLength, len(bs[4:]))
-			return nil, fmt.Errorf("option %d claims to have %d bytes of payload, but only has %d bytes", optionID, optionLength, len(bs[4:]))
+	case OptRecursiveDNS:
+		if optionLength%16 != 0 {
+			return nil, fmt.Errorf("recursive DNS servers option (23) length should be a multiple of 16 bytes: %d", optionLength)
+		}
+	case OptClientID, OptServerID:
+		if optionLength < 2 {
+			return nil, fmt.Errorf("option %d (DUID) too short: %d bytes", optionID, optionLength)
+		}
+	case OptIaNa:
+		if optionLength < 12 {
+			return nil, fmt.Errorf("IA_NA option (3) too short: %d bytes", optionLength)
+		}
+	case OptIaTa:
+		if optionLength < 4 {
+			return nil, fmt.Errorf("IA_TA option (4) too short: %d bytes", optionLength)
+		}
+	case OptIaAddr:
+		if optionLength < 24 {
+			return nil, fmt.Errorf("IA_ADDR option (5) too short: %d bytes", optionLength)
+		}
+	case OptElapsedTime:
+		if optionLength != 2 {
+			return nil, fmt.Errorf("elapsed time option (8) must be 2 bytes, got %d", optionLength)
+		}
+	case OptStatusCode:
+		if optionLength < 2 {
+			return nil, fmt.Errorf("status code option (13) too short: %d bytes", optionLength)
+		}
+	case OptVendorClass, OptVendorOpts:
+		if optionLength < 4 {
+			return nil, fmt.Errorf("option %d too short: %d bytes", optionID, optionLength)
 		}
 	}
 	return &Option{ID: optionID, Length: optionLength, Value: bs[4 : 4+optionLength]}, nil
@@ -186,6 +230,30 @@ func MakeIaAddrOption(addr net.IP, preferredLifetime, validLifetime uint32) *Opt
 	return MakeOption(OptIaAddr, value)
 }
 
+// MakeIaPdOption creates an Identity Association for Prefix Delegation
+// Option with specified interface ID, t1 and t2 times, and an
+// interface-specific IA Prefix Option (or a Status Option on failure).
+func MakeIaPdOption(iaid []byte, t1, t2 uint32, iaPrefixOption *Option) *Option {
+	serializedIaPrefixOption, _ := iaPrefixOption.Marshal()
+	value := make([]byte, 12+len(serializedIaPrefixOption))
+	copy(value[0:], iaid[0:4])
+	binary.BigEndian.PutUint32(value[4:], t1)
+	binary.BigEndian.PutUint32(value[8:], t2)
+	copy(value[12:], serializedIaPrefixOption)
+	return MakeOption(OptIaPd, value)
+}
+
+// MakeIaPrefixOption creates an IA Prefix Option carrying a delegated
+// prefix, its length, and preferred/valid lifetimes.
+func MakeIaPrefixOption(prefix net.IP, prefixLength uint8, preferredLifetime, validLifetime uint32) *Option {
+	value := make([]byte, 25)
+	binary.BigEndian.PutUint32(value[0:], preferredLifetime)
+	binary.BigEndian.PutUint32(value[4:], validLifetime)
+	value[8] = prefixLength
+	copy(value[9:], prefix.To16())
+	return MakeOption(OptIaPrefix, value)
+}
+
 // MakeStatusOption creates a Status Option with given status code and message
 func MakeStatusOption(statusCode uint16, message string) *Option {
 	value := make([]byte, 2+len(message))
@@ -203,6 +271,44 @@ func MakeDNSServersOption(addresses []net.IP) *Option {
 	return MakeOption(OptRecursiveDNS, value)
 }
 
+// EncryptedResolver describes a single authenticated, transport-encrypted
+// DNS resolver, as advertised by the Encrypted DNS Server Option.
+type EncryptedResolver struct {
+	// IP is the resolver's address.
+	IP net.IP
+	// Transport is one of "tcp", "tls", "https", or "quic".
+	Transport string
+	// SNI is the resolver's authentication domain name.
+	SNI string
+	// Port is the resolver's listening port for Transport.
+	Port uint16
+}
+
+// encryptedDNSTransportCodes maps the transports DHCPv6 clients are
+// expected to support to their Encrypted DNS Server Option wire codes.
+var encryptedDNSTransportCodes = map[string]byte{
+	"tcp":   0,
+	"tls":   1,
+	"https": 2,
+	"quic":  3,
+}
+
+// MakeEncryptedDNSOption creates an Encrypted DNS Server Option (143, see
+// RFC 9463) advertising a single authenticated, transport-encrypted
+// resolver endpoint.
+func MakeEncryptedDNSOption(r EncryptedResolver) *Option {
+	sni := []byte(r.SNI)
+	value := make([]byte, 0, 16+1+2+1+len(sni))
+	value = append(value, r.IP.To16()...)
+	value = append(value, encryptedDNSTransportCodes[r.Transport])
+	portBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(portBytes, r.Port)
+	value = append(value, portBytes...)
+	value = append(value, byte(len(sni)))
+	value = append(value, sni...)
+	return MakeOption(OptEncryptedDNS, value)
+}
+
 // Marshal serializes Options
 func (o Options) Marshal() ([]byte, error) {
 	buffer := bytes.NewBuffer(make([]byte, 0, 1446))
@@ -324,6 +430,20 @@ func (o Options) IaNaIDs() [][]byte {
 	return ret
 }
 
+// IaPdIDs returns a list of interface IDs in all Identity Association for
+// Prefix Delegation Options, or an empty list if none exist.
+func (o Options) IaPdIDs() [][]byte {
+	options, exists := o[OptIaPd]
+	ret := make([][]byte, 0)
+	if exists {
+		for _, option := range options {
+			ret = append(ret, option.Value[0:4])
+		}
+		return ret
+	}
+	return ret
+}
+
 // ClientArchType returns the value in the Client Architecture Type Option, or 0 if the option doesn't exist
 func (o Options) ClientArchType() uint16 {
 	opt, exists := o[OptClientArchType]
@@ -0,0 +1,183 @@
+package dhcp6
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// StatusCode is the typed decoding of a Status Code Option (RFC 3315
+// section 22.13).
+type StatusCode struct {
+	Code    uint16
+	Message string
+}
+
+// ParseStatusCode decodes a Status Code Option's value.
+func ParseStatusCode(b []byte) (*StatusCode, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("dhcp6: status code option too short: %d bytes", len(b))
+	}
+	return &StatusCode{Code: binary.BigEndian.Uint16(b[0:2]), Message: string(b[2:])}, nil
+}
+
+// IaAddr is the typed decoding of an IA Address Option (RFC 3315 section
+// 22.6), nested inside an IA_NA or IA_TA option.
+type IaAddr struct {
+	IP                net.IP
+	PreferredLifetime uint32
+	ValidLifetime     uint32
+}
+
+// IaNa is the typed decoding of an Identity Association for Non-temporary
+// Addresses Option (RFC 3315 section 22.4).
+type IaNa struct {
+	IAID       uint32
+	T1         uint32
+	T2         uint32
+	Addresses  []IaAddr
+	StatusCode *StatusCode
+}
+
+// ParseIaNa decodes an IA_NA option's value, including its nested IA_ADDR
+// and Status Code suboptions.
+func ParseIaNa(b []byte) (*IaNa, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("dhcp6: IA_NA option too short: %d bytes", len(b))
+	}
+	ret := &IaNa{
+		IAID: binary.BigEndian.Uint32(b[0:4]),
+		T1:   binary.BigEndian.Uint32(b[4:8]),
+		T2:   binary.BigEndian.Uint32(b[8:12]),
+	}
+
+	rest := b[12:]
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("dhcp6: truncated suboption in IA_NA: %d bytes left", len(rest))
+		}
+		id := binary.BigEndian.Uint16(rest[0:2])
+		l := binary.BigEndian.Uint16(rest[2:4])
+		if len(rest[4:]) < int(l) {
+			return nil, fmt.Errorf("dhcp6: IA_NA suboption %d claims %d bytes of payload, but only has %d", id, l, len(rest[4:]))
+		}
+		value := rest[4 : 4+l]
+
+		switch id {
+		case OptIaAddr:
+			if len(value) < 24 {
+				return nil, fmt.Errorf("dhcp6: IA_ADDR suboption too short: %d bytes", len(value))
+			}
+			ip := make(net.IP, 16)
+			copy(ip, value[0:16])
+			ret.Addresses = append(ret.Addresses, IaAddr{
+				IP:                ip,
+				PreferredLifetime: binary.BigEndian.Uint32(value[16:20]),
+				ValidLifetime:     binary.BigEndian.Uint32(value[20:24]),
+			})
+		case OptStatusCode:
+			sc, err := ParseStatusCode(value)
+			if err != nil {
+				return nil, err
+			}
+			ret.StatusCode = sc
+		}
+
+		rest = rest[4+l:]
+	}
+
+	return ret, nil
+}
+
+// parseLengthPrefixedStrings decodes a length-prefixed list of opaque
+// strings, as used by both OptUserClass and the vendor-class data portion
+// of OptVendorClass.
+func parseLengthPrefixedStrings(b []byte) ([][]byte, error) {
+	var ret [][]byte
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("dhcp6: truncated length-prefixed string: %d bytes left", len(b))
+		}
+		l := binary.BigEndian.Uint16(b[0:2])
+		if len(b[2:]) < int(l) {
+			return nil, fmt.Errorf("dhcp6: length-prefixed string claims %d bytes, but only has %d", l, len(b[2:]))
+		}
+		ret = append(ret, b[2:2+l])
+		b = b[2+l:]
+	}
+	return ret, nil
+}
+
+// UserClasses decodes the Option's value as a User Class Option (RFC 3315
+// section 22.15): a sequence of length-prefixed opaque class data strings.
+func (o *Option) UserClasses() ([][]byte, error) {
+	return parseLengthPrefixedStrings(o.Value)
+}
+
+// VendorClass is the typed decoding of a Vendor Class Option (RFC 3315
+// section 22.16).
+type VendorClass struct {
+	EnterpriseNumber uint32
+	Data             [][]byte
+}
+
+// ParseVendorClass decodes a Vendor Class Option's value.
+func ParseVendorClass(b []byte) (*VendorClass, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("dhcp6: vendor class option too short: %d bytes", len(b))
+	}
+	data, err := parseLengthPrefixedStrings(b[4:])
+	if err != nil {
+		return nil, err
+	}
+	return &VendorClass{EnterpriseNumber: binary.BigEndian.Uint32(b[0:4]), Data: data}, nil
+}
+
+// IaNa returns the typed decoding of the IA_NA option matching iaid, or nil
+// if no such IA_NA option is present.
+func (o Options) IaNa(iaid uint32) (*IaNa, error) {
+	opts, exists := o[OptIaNa]
+	if !exists {
+		return nil, nil
+	}
+	for _, opt := range opts {
+		ia, err := ParseIaNa(opt.Value)
+		if err != nil {
+			return nil, err
+		}
+		if ia.IAID == iaid {
+			return ia, nil
+		}
+	}
+	return nil, nil
+}
+
+// StatusCode returns the typed decoding of this Options' top-level Status
+// Code Option, or nil if none is present.
+func (o Options) StatusCode() *StatusCode {
+	opt, exists := o[OptStatusCode]
+	if !exists {
+		return nil
+	}
+	sc, err := ParseStatusCode(opt[0].Value)
+	if err != nil {
+		return nil
+	}
+	return sc
+}
+
+// ElapsedTime returns the value of the Elapsed Time Option, in
+// hundredths of a second, or 0 if the option isn't present.
+func (o Options) ElapsedTime() uint16 {
+	opt, exists := o[OptElapsedTime]
+	if !exists || len(opt[0].Value) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(opt[0].Value)
+}
+
+// HasRapidCommit returns true if Options contains the Rapid Commit Option.
+func (o Options) HasRapidCommit() bool {
+	_, exists := o[OptRapidCommit]
+	return exists
+}
@@ -10,6 +10,68 @@ import (
 type PacketBuilder struct {
 	PreferredLifetime uint32
 	ValidLifetime     uint32
+
+	// AllowRapidCommit, when set, makes BuildResponse answer a Solicit
+	// carrying the Rapid Commit Option (RFC 3315 section 17.1.1) directly
+	// with a committed Reply instead of an Advertise, skipping the
+	// Solicit/Advertise/Request/Reply round trip.
+	AllowRapidCommit bool
+
+	// Policy, when set, overrides BootConfiguration.GetBootURL to pick the
+	// boot file (and optional boot file parameters) based on the
+	// request's Vendor Class/User Class/Client Architecture Type, e.g. to
+	// serve BIOS, UEFI and ARM VMs different boot files from one server.
+	Policy BootPolicy
+
+	// Prefixes, when set, answers IA_PD (option 25) requests with
+	// delegated prefixes carved out of it, see RFC 3633 / RFC 8415
+	// section 21.21. A nil Prefixes makes BuildResponse silently ignore
+	// IA_PD requests, the same way a client asking for IA_NA addresses
+	// with no AddressPool configured would get none.
+	Prefixes PrefixPool
+}
+
+// reserveDelegatedPrefixes reserves a delegated prefix for each IA_PD
+// (option 25) in in.Options, if any, and appends one IA_PD option per
+// delegation to options. This is a post-processing step on an
+// already-built reply/advertise, the same way addBootFileParams is, so
+// the existing makeMsg* builders (and the positional-argument tests that
+// call them directly) don't need to grow an IA_PD parameter most callers
+// won't use. Errors reserving prefixes are ignored, the same way a
+// client whose IA_NA couldn't be satisfied still gets a reply listing
+// the IAs it didn't get addresses for; a future caller wanting to
+// surface this to the client can do so via in.Options.IaPdIDs().
+func (b *PacketBuilder) reserveDelegatedPrefixes(options Options, in *Packet) {
+	if b.Prefixes == nil {
+		return
+	}
+	iaPdIDs := in.Options.IaPdIDs()
+	if len(iaPdIDs) == 0 {
+		return
+	}
+	delegations, err := b.Prefixes.ReservePrefixes(in.Options.ClientID(), iaPdIDs)
+	if err != nil {
+		return
+	}
+	for _, d := range delegations {
+		options.Add(MakeIaPdOption(d.InterfaceID, b.calculateT1(), b.calculateT2(),
+			MakeIaPrefixOption(d.Prefix, d.PrefixLength, b.PreferredLifetime, b.ValidLifetime)))
+	}
+}
+
+// resolveBootFile returns the boot file URL (and, if Policy selected one,
+// its boot file parameters) to offer in response to in, preferring Policy
+// over configuration.GetBootURL when a Policy is configured.
+func (b *PacketBuilder) resolveBootFile(in *Packet, configuration BootConfiguration) ([]byte, [][]byte, error) {
+	if b.Policy != nil {
+		url, params, err := b.Policy.SelectBootFile(in)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []byte(url), params, nil
+	}
+	url, err := configuration.GetBootURL(b.extractLLAddressOrID(in.Options.ClientID()), in.Options.ClientArchType())
+	return url, nil, err
 }
 
 // MakePacketBuilder creates a new PacketBuilder and initializes it with preferred and valid lifetimes
@@ -21,7 +83,7 @@ func MakePacketBuilder(preferredLifetime, validLifetime uint32) *PacketBuilder {
 func (b *PacketBuilder) BuildResponse(in *Packet, serverDUID []byte, configuration BootConfiguration, addresses AddressPool) (*Packet, error) {
 	switch in.Type {
 	case MsgSolicit:
-		bootFileURL, err := configuration.GetBootURL(b.extractLLAddressOrID(in.Options.ClientID()), in.Options.ClientArchType())
+		bootFileURL, bootFileParams, err := b.resolveBootFile(in, configuration)
 		if err != nil {
 			return nil, err
 		}
@@ -29,26 +91,47 @@ func (b *PacketBuilder) BuildResponse(in *Packet, serverDUID []byte, configurati
 		if err != nil {
 			return b.makeMsgAdvertiseWithNoAddrsAvailable(in.TransactionID, serverDUID, in.Options.ClientID(), err), err
 		}
-		return b.makeMsgAdvertise(in.TransactionID, serverDUID, in.Options.ClientID(),
-			in.Options.ClientArchType(), associations, bootFileURL, configuration.GetPreference(), configuration.GetRecursiveDNS()), nil
+		if b.AllowRapidCommit && in.Options.HasRapidCommit() {
+			reply := b.makeMsgReply(in.TransactionID, serverDUID, in.Options.ClientID(),
+				in.Options.ClientArchType(), associations, iasWithoutAddesses(associations, in.Options.IaNaIDs()), bootFileURL,
+				configuration.GetRecursiveDNS(), configuration.GetEncryptedDNS(), nil)
+			reply.Options.Add(MakeRapidCommitOption())
+			addBootFileParams(reply.Options, bootFileParams)
+			b.reserveDelegatedPrefixes(reply.Options, in)
+			return reply, nil
+		}
+		advertise := b.makeMsgAdvertise(in.TransactionID, serverDUID, in.Options.ClientID(),
+			in.Options.ClientArchType(), associations, bootFileURL, configuration.GetPreference(),
+			configuration.GetRecursiveDNS(), configuration.GetEncryptedDNS())
+		addBootFileParams(advertise.Options, bootFileParams)
+		b.reserveDelegatedPrefixes(advertise.Options, in)
+		return advertise, nil
 	case MsgRequest:
-		bootFileURL, err := configuration.GetBootURL(b.extractLLAddressOrID(in.Options.ClientID()), in.Options.ClientArchType())
+		bootFileURL, bootFileParams, err := b.resolveBootFile(in, configuration)
 		if err != nil {
 			return nil, err
 		}
 		associations, err := addresses.ReserveAddresses(in.Options.ClientID(), in.Options.IaNaIDs())
-		return b.makeMsgReply(in.TransactionID, serverDUID, in.Options.ClientID(),
+		reply := b.makeMsgReply(in.TransactionID, serverDUID, in.Options.ClientID(),
 			in.Options.ClientArchType(), associations, iasWithoutAddesses(associations, in.Options.IaNaIDs()), bootFileURL,
-			configuration.GetRecursiveDNS(), err), err
+			configuration.GetRecursiveDNS(), configuration.GetEncryptedDNS(), err)
+		addBootFileParams(reply.Options, bootFileParams)
+		b.reserveDelegatedPrefixes(reply.Options, in)
+		return reply, err
 	case MsgInformationRequest:
-		bootFileURL, err := configuration.GetBootURL(b.extractLLAddressOrID(in.Options.ClientID()), in.Options.ClientArchType())
+		bootFileURL, bootFileParams, err := b.resolveBootFile(in, configuration)
 		if err != nil {
 			return nil, err
 		}
-		return b.makeMsgInformationRequestReply(in.TransactionID, serverDUID, in.Options.ClientID(),
-			in.Options.ClientArchType(), bootFileURL, configuration.GetRecursiveDNS()), nil
+		reply := b.makeMsgInformationRequestReply(in.TransactionID, serverDUID, in.Options.ClientID(),
+			in.Options.ClientArchType(), bootFileURL, configuration.GetRecursiveDNS(), configuration.GetEncryptedDNS())
+		addBootFileParams(reply.Options, bootFileParams)
+		return reply, nil
 	case MsgRelease:
 		addresses.ReleaseAddresses(in.Options.ClientID(), in.Options.IaNaIDs())
+		if b.Prefixes != nil {
+			b.Prefixes.ReleasePrefixes(in.Options.ClientID(), in.Options.IaPdIDs())
+		}
 		return b.makeMsgReleaseReply(in.TransactionID, serverDUID, in.Options.ClientID()), nil
 	default:
 		return nil, nil
@@ -56,7 +139,7 @@ func (b *PacketBuilder) BuildResponse(in *Packet, serverDUID []byte, configurati
 }
 
 func (b *PacketBuilder) makeMsgAdvertise(transactionID [3]byte, serverDUID, clientID []byte, clientArchType uint16,
-	associations []*IdentityAssociation, bootFileURL, preference []byte, dnsServers []net.IP) *Packet {
+	associations []*IdentityAssociation, bootFileURL, preference []byte, dnsServers []net.IP, encryptedDNSServers []EncryptedResolver) *Packet {
 	retOptions := make(Options)
 	retOptions.Add(MakeOption(OptClientID, clientID))
 	for _, association := range associations {
@@ -74,12 +157,16 @@ func (b *PacketBuilder) makeMsgAdvertise(transactionID [3]byte, serverDUID, clie
 	if len(dnsServers) > 0 {
 		retOptions.Add(MakeDNSServersOption(dnsServers))
 	}
+	for _, resolver := range encryptedDNSServers {
+		retOptions.Add(MakeEncryptedDNSOption(resolver))
+	}
 
 	return &Packet{Type: MsgAdvertise, TransactionID: transactionID, Options: retOptions}
 }
 
 func (b *PacketBuilder) makeMsgReply(transactionID [3]byte, serverDUID, clientID []byte, clientArchType uint16,
-	associations []*IdentityAssociation, iasWithoutAddresses [][]byte, bootFileURL []byte, dnsServers []net.IP, err error) *Packet {
+	associations []*IdentityAssociation, iasWithoutAddresses [][]byte, bootFileURL []byte, dnsServers []net.IP,
+	encryptedDNSServers []EncryptedResolver, err error) *Packet {
 	retOptions := make(Options)
 	retOptions.Add(MakeOption(OptClientID, clientID))
 	for _, association := range associations {
@@ -98,12 +185,15 @@ func (b *PacketBuilder) makeMsgReply(transactionID [3]byte, serverDUID, clientID
 	if len(dnsServers) > 0 {
 		retOptions.Add(MakeDNSServersOption(dnsServers))
 	}
+	for _, resolver := range encryptedDNSServers {
+		retOptions.Add(MakeEncryptedDNSOption(resolver))
+	}
 
 	return &Packet{Type: MsgReply, TransactionID: transactionID, Options: retOptions}
 }
 
 func (b *PacketBuilder) makeMsgInformationRequestReply(transactionID [3]byte, serverDUID, clientID []byte, clientArchType uint16,
-	bootFileURL []byte, dnsServers []net.IP) *Packet {
+	bootFileURL []byte, dnsServers []net.IP, encryptedDNSServers []EncryptedResolver) *Packet {
 	retOptions := make(Options)
 	retOptions.Add(MakeOption(OptClientID, clientID))
 	retOptions.Add(MakeOption(OptServerID, serverDUID))
@@ -114,6 +204,9 @@ func (b *PacketBuilder) makeMsgInformationRequestReply(transactionID [3]byte, se
 	if len(dnsServers) > 0 {
 		retOptions.Add(MakeDNSServersOption(dnsServers))
 	}
+	for _, resolver := range encryptedDNSServers {
+		retOptions.Add(MakeEncryptedDNSOption(resolver))
+	}
 
 	return &Packet{Type: MsgReply, TransactionID: transactionID, Options: retOptions}
 }
@@ -20,7 +20,7 @@ func TestMakeMsgAdvertise(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgAdvertise(transactionID, expectedServerID, expectedClientID, 0x11,
-		[]*IdentityAssociation{identityAssociation}, expectedBootFileURL, nil, []net.IP{expectedDNSServerIP})
+		[]*IdentityAssociation{identityAssociation}, expectedBootFileURL, nil, []net.IP{expectedDNSServerIP}, nil)
 
 	if msg.Type != MsgAdvertise {
 		t.Fatalf("Expected message type %d, got %d", MsgAdvertise, msg.Type)
@@ -84,7 +84,7 @@ func TestMakeMsgAdvertiseShouldSkipDnsServersIfNoneConfigured(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgAdvertise(transactionID, expectedServerID, expectedClientID, 0x11,
-		[]*IdentityAssociation{identityAssociation}, expectedBootFileURL, nil, []net.IP{})
+		[]*IdentityAssociation{identityAssociation}, expectedBootFileURL, nil, []net.IP{}, nil)
 
 	_, exists := msg.Options[OptRecursiveDNS]
 	if exists {
@@ -99,7 +99,7 @@ func TestShouldSetPreferenceOptionWhenSpecified(t *testing.T) {
 
 	expectedPreference := []byte{128}
 	msg := builder.makeMsgAdvertise([3]byte{'t', 'i', 'd'}, []byte("serverid"), []byte("clientid"), 0x11,
-		[]*IdentityAssociation{identityAssociation}, []byte("http://bootfileurl"), expectedPreference, []net.IP{})
+		[]*IdentityAssociation{identityAssociation}, []byte("http://bootfileurl"), expectedPreference, []net.IP{}, nil)
 
 	preferenceOption := msg.Options[OptPreference]
 	if preferenceOption == nil {
@@ -121,7 +121,7 @@ func TestMakeMsgAdvertiseWithHttpClientArch(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgAdvertise(transactionID, expectedServerID, expectedClientID, 0x10,
-		[]*IdentityAssociation{identityAssociation}, expectedBootFileURL, nil, []net.IP{})
+		[]*IdentityAssociation{identityAssociation}, expectedBootFileURL, nil, []net.IP{}, nil)
 
 	vendorClassOption := msg.Options[OptVendorClass]
 	if vendorClassOption == nil {
@@ -194,7 +194,7 @@ func TestMakeMsgReply(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgReply(transactionID, expectedServerID, expectedClientID, 0x11,
-		[]*IdentityAssociation{identityAssociation}, make([][]byte, 0), expectedBootFileURL, []net.IP{expectedDNSServerIP}, nil)
+		[]*IdentityAssociation{identityAssociation}, make([][]byte, 0), expectedBootFileURL, []net.IP{expectedDNSServerIP}, nil, nil)
 
 	if msg.Type != MsgReply {
 		t.Fatalf("Expected message type %d, got %d", MsgAdvertise, msg.Type)
@@ -258,7 +258,7 @@ func TestMakeMsgReplyShouldSkipDnsServersIfNoneWereConfigured(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgReply(transactionID, expectedServerID, expectedClientID, 0x11,
-		[]*IdentityAssociation{identityAssociation}, make([][]byte, 0), expectedBootFileURL, []net.IP{}, nil)
+		[]*IdentityAssociation{identityAssociation}, make([][]byte, 0), expectedBootFileURL, []net.IP{}, nil, nil)
 
 	_, exists := msg.Options[OptRecursiveDNS]
 	if exists {
@@ -277,7 +277,7 @@ func TestMakeMsgReplyWithHttpClientArch(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgReply(transactionID, expectedServerID, expectedClientID, 0x10,
-		[]*IdentityAssociation{identityAssociation}, make([][]byte, 0), expectedBootFileURL, []net.IP{}, nil)
+		[]*IdentityAssociation{identityAssociation}, make([][]byte, 0), expectedBootFileURL, []net.IP{}, nil, nil)
 
 	vendorClassOption := msg.Options[OptVendorClass]
 	if vendorClassOption == nil {
@@ -305,7 +305,7 @@ func TestMakeMsgReplyWithNoAddrsAvailable(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgReply(transactionID, expectedServerID, expectedClientID, 0x10,
-		[]*IdentityAssociation{identityAssociation}, [][]byte{[]byte("id-2")}, expectedBootFileURL, []net.IP{},
+		[]*IdentityAssociation{identityAssociation}, [][]byte{[]byte("id-2")}, expectedBootFileURL, []net.IP{}, nil,
 		fmt.Errorf(expectedErrorMessage))
 
 	iaNaOption := msg.Options[OptIaNa]
@@ -357,7 +357,7 @@ func TestMakeMsgInformationRequestReply(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgInformationRequestReply(transactionID, expectedServerID, expectedClientID, 0x11,
-		expectedBootFileURL, []net.IP{expectedDNSServerIP})
+		expectedBootFileURL, []net.IP{expectedDNSServerIP}, nil)
 
 	if msg.Type != MsgReply {
 		t.Fatalf("Expected message type %d, got %d", MsgAdvertise, msg.Type)
@@ -414,7 +414,7 @@ func TestMakeMsgInformationRequestReplyShouldSkipDnsServersIfNoneWereConfigured(
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgInformationRequestReply(transactionID, expectedServerID, expectedClientID, 0x11,
-		expectedBootFileURL, []net.IP{})
+		expectedBootFileURL, []net.IP{}, nil)
 
 	_, exists := msg.Options[OptRecursiveDNS]
 	if exists {
@@ -431,7 +431,7 @@ func TestMakeMsgInformationRequestReplyWithHttpClientArch(t *testing.T) {
 	builder := MakePacketBuilder(90, 100)
 
 	msg := builder.makeMsgInformationRequestReply(transactionID, expectedServerID, expectedClientID, 0x10,
-		expectedBootFileURL, []net.IP{})
+		expectedBootFileURL, []net.IP{}, nil)
 
 	vendorClassOption := msg.Options[OptVendorClass]
 	if vendorClassOption == nil {
@@ -0,0 +1,218 @@
+package pool
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"go.universe.tf/netboot/dhcp6"
+)
+
+// DeterministicPool hands out the same address to a given (ClientID,
+// InterfaceID) pair every time it's asked, instead of
+// RandomAddressPool's per-call random pick, so a PXE client keeps its
+// IPv6 lease across reboots. The address is derived by hashing
+// ClientID+InterfaceID with SipHash-2-4 into a host offset, then probing
+// forward through the pool on collision, the same way an open-addressing
+// hash table would; reservations (see WithReservations) pin specific
+// DUIDs to specific addresses ahead of the hash.
+//
+// The SipHash key is generated once, at construction, and isn't itself
+// persisted: what survives a restart is the concrete association
+// (ClientID, InterfaceID) -> IP written to a WithLeaseStore, the same way
+// RandomAddressPool persists its random picks rather than trying to
+// reproduce them. A DeterministicPool with no LeaseStore attached is
+// deterministic only for the lifetime of the process.
+type DeterministicPool struct {
+	poolStartAddress               *big.Int
+	poolSize                       uint64
+	key                            [16]byte
+	identityAssociations           map[uint64]*dhcp6.IdentityAssociation
+	usedIps                        map[uint64]struct{}
+	identityAssociationExpirations fifo
+	validLifetime                  uint32 // in seconds
+	timeNow                        func() time.Time
+	reservations                   map[string]net.IP // hex(DUID) -> pinned address
+	store                          LeaseStore
+	lock                           sync.Mutex
+}
+
+// NewDeterministicPool creates a DeterministicPool covering poolSize
+// addresses starting at poolStartAddress, handing out leases for
+// validLifetime seconds.
+func NewDeterministicPool(poolStartAddress net.IP, poolSize uint64, validLifetime uint32) (*DeterministicPool, error) {
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, fmt.Errorf("generating DeterministicPool hash key: %s", err)
+	}
+
+	ret := &DeterministicPool{
+		poolStartAddress:               big.NewInt(0).SetBytes(poolStartAddress),
+		poolSize:                       poolSize,
+		key:                            key,
+		identityAssociations:           make(map[uint64]*dhcp6.IdentityAssociation),
+		usedIps:                        make(map[uint64]struct{}),
+		identityAssociationExpirations: newFifo(),
+		validLifetime:                  validLifetime,
+		timeNow:                        func() time.Time { return time.Now() },
+	}
+	return ret, nil
+}
+
+// WithLeaseStore attaches a LeaseStore to the pool and rehydrates
+// identityAssociations/usedIps/identityAssociationExpirations from it,
+// mirroring RandomAddressPool.WithLeaseStore. From this point on,
+// Reserve/ReleaseAddresses keep store in sync.
+func (p *DeterministicPool) WithLeaseStore(store LeaseStore) (*DeterministicPool, error) {
+	leases, err := store.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.timeNow()
+	for _, ia := range leases {
+		if isExpired(ia, p.validLifetime, now) {
+			continue
+		}
+		hash := calculateIAIDHash(ia.ClientID, ia.InterfaceID)
+		p.identityAssociations[hash] = ia
+		p.usedIps[big.NewInt(0).SetBytes(ia.IPAddress).Uint64()] = struct{}{}
+		p.identityAssociationExpirations.Push(&associationExpiration{expiresAt: p.calculateAssociationExpiration(ia.CreatedAt), ia: ia})
+	}
+	p.store = store
+	return p, nil
+}
+
+// WithReservations pins the DUIDs in reservations (keyed by
+// fmt.Sprintf("%x", duid)) to the given addresses, taking priority over
+// the hash-derived offset the next time each DUID requests an address.
+// It doesn't affect associations already reserved; restart the server (or
+// ReleaseAddresses first) to move an existing lease onto its reservation.
+func (p *DeterministicPool) WithReservations(reservations map[string]net.IP) *DeterministicPool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.reservations = reservations
+	return p
+}
+
+// ReserveAddresses creates new or retrieves active associations for
+// interfaces in interfaceIDs list, preferring a WithReservations pin over
+// the SipHash-derived offset for clientID.
+func (p *DeterministicPool) ReserveAddresses(clientID []byte, interfaceIDs [][]byte) ([]*dhcp6.IdentityAssociation, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expireIdentityAssociations()
+
+	ret := make([]*dhcp6.IdentityAssociation, 0, len(interfaceIDs))
+
+	for _, interfaceID := range interfaceIDs {
+		clientIDHash := calculateIAIDHash(clientID, interfaceID)
+		association, exists := p.identityAssociations[clientIDHash]
+
+		if exists {
+			ret = append(ret, association)
+			continue
+		}
+		if uint64(len(p.usedIps)) == p.poolSize {
+			return ret, fmt.Errorf("No more free ip addresses are currently available in the pool")
+		}
+
+		newIP := p.addressFor(clientID, interfaceID)
+		timeNow := p.timeNow()
+		association = &dhcp6.IdentityAssociation{
+			ClientID:    clientID,
+			InterfaceID: interfaceID,
+			IPAddress:   newIP.Bytes(),
+			CreatedAt:   timeNow,
+		}
+		p.identityAssociations[clientIDHash] = association
+		p.usedIps[newIP.Uint64()] = struct{}{}
+		p.identityAssociationExpirations.Push(&associationExpiration{expiresAt: p.calculateAssociationExpiration(timeNow), ia: association})
+		if p.store != nil {
+			if err := p.store.Save(association); err != nil {
+				return ret, err
+			}
+		}
+		ret = append(ret, association)
+	}
+
+	return ret, nil
+}
+
+// addressFor picks the address to hand clientID/interfaceID: a pinned
+// reservation if one exists, otherwise a SipHash-2-4-derived host offset,
+// probed forward past any offset already in use.
+func (p *DeterministicPool) addressFor(clientID, interfaceID []byte) *big.Int {
+	if reserved, ok := p.reservations[fmt.Sprintf("%x", clientID)]; ok {
+		return big.NewInt(0).SetBytes(reserved)
+	}
+
+	msg := make([]byte, 0, len(clientID)+len(interfaceID))
+	msg = append(msg, clientID...)
+	msg = append(msg, interfaceID...)
+	offset := siphash24(p.key, msg) % p.poolSize
+
+	for i := uint64(0); i < p.poolSize; i++ {
+		candidate := (offset + i) % p.poolSize
+		ip := big.NewInt(0).Add(p.poolStartAddress, big.NewInt(0).SetUint64(candidate))
+		if _, used := p.usedIps[ip.Uint64()]; !used {
+			return ip
+		}
+	}
+	// Unreachable: ReserveAddresses already checked len(usedIps) < poolSize.
+	return big.NewInt(0).Add(p.poolStartAddress, big.NewInt(0).SetUint64(offset))
+}
+
+// ReleaseAddresses returns IP addresses associated with ClientID and
+// interfaceIDs back into the address pool.
+func (p *DeterministicPool) ReleaseAddresses(clientID []byte, interfaceIDs [][]byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, interfaceID := range interfaceIDs {
+		hash := calculateIAIDHash(clientID, interfaceID)
+		association, exists := p.identityAssociations[hash]
+		if !exists {
+			continue
+		}
+		delete(p.usedIps, big.NewInt(0).SetBytes(association.IPAddress).Uint64())
+		delete(p.identityAssociations, hash)
+		if p.store != nil {
+			p.store.Delete(hash)
+		}
+	}
+}
+
+// expireIdentityAssociations releases IP addresses in identity
+// associations that reached the end of valid lifetime back into the
+// address pool. Note it should be called from under the
+// DeterministicPool.lock.
+func (p *DeterministicPool) expireIdentityAssociations() {
+	for {
+		if p.identityAssociationExpirations.Size() < 1 {
+			break
+		}
+		expiration := p.identityAssociationExpirations.Peek().(*associationExpiration)
+		if p.timeNow().Before(expiration.expiresAt) {
+			break
+		}
+		p.identityAssociationExpirations.Shift()
+		hash := calculateIAIDHash(expiration.ia.ClientID, expiration.ia.InterfaceID)
+		delete(p.identityAssociations, hash)
+		delete(p.usedIps, big.NewInt(0).SetBytes(expiration.ia.IPAddress).Uint64())
+		if p.store != nil {
+			p.store.Delete(hash)
+		}
+	}
+}
+
+func (p *DeterministicPool) calculateAssociationExpiration(now time.Time) time.Time {
+	return now.Add(time.Duration(p.validLifetime) * time.Second)
+}
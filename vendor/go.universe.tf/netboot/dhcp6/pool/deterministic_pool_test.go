@@ -0,0 +1,77 @@
+package pool
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDeterministicPoolReturnsSameAddressAcrossCalls(t *testing.T) {
+	expectedClientID := []byte("Client-id")
+	expectedIAID := []byte("interface-id")
+	expectedTime := time.Now()
+
+	dp, err := NewDeterministicPool(net.ParseIP("2001:db8:f00f:cafe::1"), 50, uint32(100))
+	if err != nil {
+		t.Fatalf("NewDeterministicPool: %s", err)
+	}
+	dp.timeNow = func() time.Time { return expectedTime }
+
+	first, _ := dp.ReserveAddresses(expectedClientID, [][]byte{expectedIAID})
+	second, _ := dp.ReserveAddresses(expectedClientID, [][]byte{expectedIAID})
+
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("expected 1 association per call, got %d and %d", len(first), len(second))
+	}
+	if string(first[0].IPAddress) != string(second[0].IPAddress) {
+		t.Fatal("expected the same client/iaid to get the same address on both calls")
+	}
+}
+
+func TestDeterministicPoolProbesForwardOnCollision(t *testing.T) {
+	dp, err := NewDeterministicPool(net.ParseIP("2001:db8:f00f:cafe::1"), 2, uint32(100))
+	if err != nil {
+		t.Fatalf("NewDeterministicPool: %s", err)
+	}
+	dp.timeNow = func() time.Time { return time.Now() }
+
+	a, err := dp.ReserveAddresses([]byte("client-a"), [][]byte{[]byte("ia")})
+	if err != nil {
+		t.Fatalf("reserving for client-a: %s", err)
+	}
+	b, err := dp.ReserveAddresses([]byte("client-b"), [][]byte{[]byte("ia")})
+	if err != nil {
+		t.Fatalf("reserving for client-b: %s", err)
+	}
+	if string(a[0].IPAddress) == string(b[0].IPAddress) {
+		t.Fatal("two different clients in a 2-address pool must not collide")
+	}
+
+	if _, err := dp.ReserveAddresses([]byte("client-c"), [][]byte{[]byte("ia")}); err == nil {
+		t.Fatal("expected reserving a third address out of a full 2-address pool to fail")
+	}
+}
+
+func TestDeterministicPoolReservationOverridesHash(t *testing.T) {
+	clientID := []byte("Client-id")
+	reservedIP := net.ParseIP("2001:db8:f00f:cafe::ff")
+
+	dp, err := NewDeterministicPool(net.ParseIP("2001:db8:f00f:cafe::1"), 50, uint32(100))
+	if err != nil {
+		t.Fatalf("NewDeterministicPool: %s", err)
+	}
+	dp.timeNow = func() time.Time { return time.Now() }
+	dp = dp.WithReservations(map[string]net.IP{
+		fmt.Sprintf("%x", clientID): reservedIP,
+	})
+
+	ias, err := dp.ReserveAddresses(clientID, [][]byte{[]byte("interface-id")})
+	if err != nil {
+		t.Fatalf("ReserveAddresses: %s", err)
+	}
+	if string(ias[0].IPAddress) != string(reservedIP.To16()) {
+		t.Fatalf("expected reserved address %v, got %v", reservedIP, net.IP(ias[0].IPAddress))
+	}
+}
+
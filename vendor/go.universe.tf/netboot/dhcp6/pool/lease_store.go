@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.universe.tf/netboot/dhcp6"
+)
+
+// LeaseStore persists identity associations handed out by an AddressPool so
+// that allocations survive a server restart instead of being renegotiated
+// (and potentially reassigned to a different client) from scratch.
+type LeaseStore interface {
+	// Save persists or overwrites the lease for ia's (ClientID, InterfaceID).
+	Save(ia *dhcp6.IdentityAssociation) error
+	// LoadAll returns every lease known to the store, in no particular order.
+	LoadAll() ([]*dhcp6.IdentityAssociation, error)
+	// Delete removes the lease keyed by hash, as returned by
+	// calculateIAIDHash(ClientID, InterfaceID). It's not an error to delete
+	// a hash that isn't present.
+	Delete(hash uint64) error
+	// Close releases whatever resources the store holds (e.g. a BoltDB
+	// file's exclusive lock), so a process that's done with a pool can
+	// let another one open the same path, such as a restart reopening it.
+	Close() error
+}
+
+var leasesBucket = []byte("leases")
+
+// boltLeaseStore is a LeaseStore backed by a BoltDB file, living beside the
+// BoltDB-backed metadata.Store used for pod sandbox/container state.
+type boltLeaseStore struct {
+	db *bolt.DB
+}
+
+// NewBoltLeaseStore opens (creating if necessary) a BoltDB file at path and
+// returns a LeaseStore backed by it.
+func NewBoltLeaseStore(path string) (LeaseStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(leasesBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltLeaseStore{db: db}, nil
+}
+
+func (s *boltLeaseStore) Save(ia *dhcp6.IdentityAssociation) error {
+	hash := calculateIAIDHash(ia.ClientID, ia.InterfaceID)
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(ia); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(leasesBucket).Put(hashKey(hash), buf.Bytes())
+	})
+}
+
+func (s *boltLeaseStore) LoadAll() ([]*dhcp6.IdentityAssociation, error) {
+	var ret []*dhcp6.IdentityAssociation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(leasesBucket).ForEach(func(k, v []byte) error {
+			ia := &dhcp6.IdentityAssociation{}
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(ia); err != nil {
+				return err
+			}
+			ret = append(ret, ia)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *boltLeaseStore) Delete(hash uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(leasesBucket).Delete(hashKey(hash))
+	})
+}
+
+func (s *boltLeaseStore) Close() error {
+	return s.db.Close()
+}
+
+func hashKey(hash uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, hash)
+	return k
+}
+
+// isExpired reports whether an identity association's valid lifetime has
+// already elapsed as of now, so a rehydrated lease that outlived its
+// validLifetime across a long server downtime isn't treated as still held.
+func isExpired(ia *dhcp6.IdentityAssociation, validLifetime uint32, now time.Time) bool {
+	return now.After(ia.CreatedAt.Add(time.Duration(validLifetime) * time.Second))
+}
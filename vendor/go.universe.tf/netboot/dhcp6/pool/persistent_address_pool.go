@@ -0,0 +1,28 @@
+package pool
+
+import (
+	"fmt"
+	"net"
+)
+
+// NewPersistentAddressPool creates a RandomAddressPool backed by a boltdb
+// lease store at path, so identity associations survive a process
+// restart instead of being renegotiated (and potentially reassigned to a
+// different client) from scratch. It's a thin convenience wrapper around
+// NewRandomAddressPool + NewBoltLeaseStore + WithLeaseStore for the common
+// case of wanting persistence with no further LeaseStore configuration.
+// Callers must call the returned pool's Close method once they're done
+// with it, to release the lease store's exclusive file lock - otherwise a
+// later NewPersistentAddressPool against the same path blocks forever.
+func NewPersistentAddressPool(path string, start net.IP, size uint64, lifetime uint32) (*RandomAddressPool, error) {
+	store, err := NewBoltLeaseStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lease store at %q: %s", path, err)
+	}
+
+	pool, err := NewRandomAddressPool(start, size, lifetime).WithLeaseStore(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rehydrate leases from %q: %s", path, err)
+	}
+	return pool, nil
+}
@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPersistentAddressPoolSurvivesRestart(t *testing.T) {
+	f, err := os.CreateTemp("", "persistent-address-pool-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	expectedClientID := []byte("Client-id")
+	expectedIAID := []byte("interface-id")
+	expectedTime := time.Now()
+	expectedMaxLifetime := uint32(100)
+	poolStart := net.ParseIP("2001:db8:f00f:cafe::1")
+
+	pool, err := NewPersistentAddressPool(path, poolStart, 1, expectedMaxLifetime)
+	if err != nil {
+		t.Fatalf("Failed to create persistent address pool: %v", err)
+	}
+	pool.timeNow = func() time.Time { return expectedTime }
+	ias, err := pool.ReserveAddresses(expectedClientID, [][]byte{expectedIAID})
+	if err != nil {
+		t.Fatalf("Failed to reserve address: %v", err)
+	}
+	if len(ias) != 1 {
+		t.Fatalf("Expected 1 identity association but received %d", len(ias))
+	}
+	expectedIP := ias[0].IPAddress
+
+	// Simulate a restart: close the first pool's store (releasing its
+	// exclusive lock on path) and open a fresh pool against the same
+	// store, with no in-memory state carried over.
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Failed to close persistent address pool: %v", err)
+	}
+	reopened, err := NewPersistentAddressPool(path, poolStart, 1, expectedMaxLifetime)
+	if err != nil {
+		t.Fatalf("Failed to reopen persistent address pool: %v", err)
+	}
+	reopened.timeNow = func() time.Time { return expectedTime }
+
+	a, exists := reopened.identityAssociations[calculateIAIDHash(expectedClientID, expectedIAID)]
+	if !exists {
+		t.Fatal("Expected lease to survive reopening the pool, but it didn't")
+	}
+	if string(a.IPAddress) != string(expectedIP) {
+		t.Fatalf("Expected reopened lease to keep ip %v, but got %v", expectedIP, a.IPAddress)
+	}
+
+	ias2, err := reopened.ReserveAddresses(expectedClientID, [][]byte{expectedIAID})
+	if err != nil {
+		t.Fatalf("Failed to re-reserve address after reopening: %v", err)
+	}
+	if string(ias2[0].IPAddress) != string(expectedIP) {
+		t.Fatalf("Expected same client/iaid to get back the same ip %v after reopening, but got %v", expectedIP, ias2[0].IPAddress)
+	}
+}
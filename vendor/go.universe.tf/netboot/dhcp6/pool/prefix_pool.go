@@ -0,0 +1,140 @@
+package pool
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+
+	"go.universe.tf/netboot/dhcp6"
+)
+
+// DelegatedPrefix is a single IA_PD prefix handed out to a requesting
+// client, see RFC 3633 / RFC 8415 section 21.21.
+type DelegatedPrefix struct {
+	Prefix       net.IP
+	PrefixLength uint8
+	ClientID     []byte
+	InterfaceID  []byte
+}
+
+// PrefixPool hands out fixed-length prefixes (e.g. /64s) carved out of a
+// larger delegated range (e.g. a /48), for clients requesting IA_PD rather
+// than a single IA_NA address.
+type PrefixPool struct {
+	poolPrefix       *big.Int
+	poolPrefixLength uint8
+	delegatedLength  uint8
+	poolSize         uint64 // number of delegatedLength prefixes carved out of the pool
+
+	usedPrefixes map[uint64]struct{}
+	assignments  map[uint64]*DelegatedPrefix // keyed by calculateIAIDHash(ClientID, InterfaceID)
+
+	lock sync.Mutex
+}
+
+// NewPrefixPool creates a PrefixPool that carves delegatedLength-bit
+// prefixes out of the poolPrefixLength-bit range starting at poolPrefix
+// (e.g. NewPrefixPool(net.ParseIP("2001:db8::"), 48, 64) delegates /64s out
+// of a /48).
+func NewPrefixPool(poolPrefix net.IP, poolPrefixLength, delegatedLength uint8) (*PrefixPool, error) {
+	if delegatedLength < poolPrefixLength {
+		return nil, fmt.Errorf("delegated prefix length /%d is longer than the pool prefix length /%d", delegatedLength, poolPrefixLength)
+	}
+
+	ret := &PrefixPool{
+		poolPrefix:       big.NewInt(0).SetBytes(poolPrefix.To16()),
+		poolPrefixLength: poolPrefixLength,
+		delegatedLength:  delegatedLength,
+		poolSize:         uint64(1) << uint(delegatedLength-poolPrefixLength),
+		usedPrefixes:     make(map[uint64]struct{}),
+		assignments:      make(map[uint64]*DelegatedPrefix),
+	}
+	return ret, nil
+}
+
+// ReservePrefix returns the existing delegation for (clientID, interfaceID)
+// if one exists, or carves out and returns the lowest-numbered free prefix.
+func (p *PrefixPool) ReservePrefix(clientID, interfaceID []byte) (*DelegatedPrefix, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := calculateIAIDHash(clientID, interfaceID)
+	if delegated, exists := p.assignments[hash]; exists {
+		return delegated, nil
+	}
+	if uint64(len(p.usedPrefixes)) == p.poolSize {
+		return nil, fmt.Errorf("No more free prefixes are currently available in the pool")
+	}
+
+	var index uint64
+	for index = 0; index < p.poolSize; index++ {
+		if _, exists := p.usedPrefixes[index]; !exists {
+			break
+		}
+	}
+
+	prefixBits := big.NewInt(0).Lsh(big.NewInt(int64(index)), uint(128-p.delegatedLength))
+	prefixValue := big.NewInt(0).Add(p.poolPrefix, prefixBits)
+
+	addrBytes := make([]byte, 16)
+	prefixValue.FillBytes(addrBytes)
+
+	delegated := &DelegatedPrefix{
+		Prefix:       net.IP(addrBytes),
+		PrefixLength: p.delegatedLength,
+		ClientID:     clientID,
+		InterfaceID:  interfaceID,
+	}
+	p.usedPrefixes[index] = struct{}{}
+	p.assignments[hash] = delegated
+	return delegated, nil
+}
+
+// ReleasePrefix returns the prefix delegated to (clientID, interfaceID), if
+// any, back into the pool.
+func (p *PrefixPool) ReleasePrefix(clientID, interfaceID []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := calculateIAIDHash(clientID, interfaceID)
+	delegated, exists := p.assignments[hash]
+	if !exists {
+		return
+	}
+	delete(p.assignments, hash)
+
+	prefixValue := big.NewInt(0).SetBytes(delegated.Prefix.To16())
+	index := big.NewInt(0).Sub(prefixValue, p.poolPrefix)
+	index.Rsh(index, uint(128-p.delegatedLength))
+	delete(p.usedPrefixes, index.Uint64())
+}
+
+// ReservePrefixes implements dhcp6.PrefixPool, reserving one delegated
+// prefix per interfaceID via ReservePrefix. It stops and returns the
+// first error encountered, the same way RandomAddressPool.ReserveAddresses
+// does for IA_NA.
+func (p *PrefixPool) ReservePrefixes(clientID []byte, interfaceIDs [][]byte) ([]*dhcp6.DelegatedPrefix, error) {
+	ret := make([]*dhcp6.DelegatedPrefix, 0, len(interfaceIDs))
+	for _, interfaceID := range interfaceIDs {
+		delegated, err := p.ReservePrefix(clientID, interfaceID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, &dhcp6.DelegatedPrefix{
+			Prefix:       delegated.Prefix,
+			PrefixLength: delegated.PrefixLength,
+			ClientID:     delegated.ClientID,
+			InterfaceID:  delegated.InterfaceID,
+		})
+	}
+	return ret, nil
+}
+
+// ReleasePrefixes implements dhcp6.PrefixPool, releasing the prefix
+// delegated to each interfaceID via ReleasePrefix.
+func (p *PrefixPool) ReleasePrefixes(clientID []byte, interfaceIDs [][]byte) {
+	for _, interfaceID := range interfaceIDs {
+		p.ReleasePrefix(clientID, interfaceID)
+	}
+}
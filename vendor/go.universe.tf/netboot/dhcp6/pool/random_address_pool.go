@@ -52,7 +52,13 @@ type RandomAddressPool struct {
 	identityAssociationExpirations fifo
 	validLifetime                  uint32 // in seconds
 	timeNow                        func() time.Time
-	lock                           sync.Mutex
+	// rng is seeded once, at construction time, rather than on every
+	// ReserveAddresses call: reseeding from the wall clock on every call
+	// makes allocations unreproducible under test and lets calls that
+	// land in the same clock tick collide on their seed.
+	rng   *rand.Rand
+	store LeaseStore
+	lock  sync.Mutex
 }
 
 // NewRandomAddressPool creates a new RandomAddressPool using pool start IP address, pool size, and valid lifetime of
@@ -67,9 +73,51 @@ func NewRandomAddressPool(poolStartAddress net.IP, poolSize uint64, validLifetim
 	ret.usedIps = make(map[uint64]struct{})
 	ret.identityAssociationExpirations = newFifo()
 	ret.timeNow = func() time.Time { return time.Now() }
+	ret.rng = rand.New(rand.NewSource(ret.timeNow().UnixNano()))
 	return ret
 }
 
+// WithLeaseStore attaches a LeaseStore to the pool and rehydrates
+// identityAssociations/usedIps/identityAssociationExpirations from it, so
+// leases handed out before a server restart aren't renegotiated (and
+// potentially reassigned to a different client) from scratch. Leases whose
+// validLifetime has already elapsed are dropped rather than rehydrated.
+// From this point on, Reserve/ReleaseAddresses keep store in sync.
+func (p *RandomAddressPool) WithLeaseStore(store LeaseStore) (*RandomAddressPool, error) {
+	leases, err := store.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.timeNow()
+	for _, ia := range leases {
+		if isExpired(ia, p.validLifetime, now) {
+			continue
+		}
+		hash := calculateIAIDHash(ia.ClientID, ia.InterfaceID)
+		p.identityAssociations[hash] = ia
+		p.usedIps[big.NewInt(0).SetBytes(ia.IPAddress).Uint64()] = struct{}{}
+		p.identityAssociationExpirations.Push(&associationExpiration{expiresAt: p.calculateAssociationExpiration(ia.CreatedAt), ia: ia})
+	}
+	p.store = store
+	return p, nil
+}
+
+// Close releases the attached LeaseStore, if any, so a process that's done
+// with the pool frees up whatever resources the store holds (e.g. a BoltDB
+// file's exclusive lock). It's a no-op if WithLeaseStore was never called.
+func (p *RandomAddressPool) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.store == nil {
+		return nil
+	}
+	return p.store.Close()
+}
+
 // ReserveAddresses creates new or retrieves active associations for interfaces in interfaceIDs list.
 func (p *RandomAddressPool) ReserveAddresses(clientID []byte, interfaceIDs [][]byte) ([]*dhcp6.IdentityAssociation, error) {
 	p.lock.Lock()
@@ -78,10 +126,9 @@ func (p *RandomAddressPool) ReserveAddresses(clientID []byte, interfaceIDs [][]b
 	p.expireIdentityAssociations()
 
 	ret := make([]*dhcp6.IdentityAssociation, 0, len(interfaceIDs))
-	rng := rand.New(rand.NewSource(p.timeNow().UnixNano()))
 
 	for _, interfaceID := range interfaceIDs {
-		clientIDHash := p.calculateIAIDHash(clientID, interfaceID)
+		clientIDHash := calculateIAIDHash(clientID, interfaceID)
 		association, exists := p.identityAssociations[clientIDHash]
 
 		if exists {
@@ -94,7 +141,7 @@ func (p *RandomAddressPool) ReserveAddresses(clientID []byte, interfaceIDs [][]b
 
 		for {
 			// we assume that ip addresses adhere to high 64 bits for net and subnet ids, low 64 bits are for host id rule
-			hostOffset := rng.Uint64() % p.poolSize
+			hostOffset := p.rng.Uint64() % p.poolSize
 			newIP := big.NewInt(0).Add(p.poolStartAddress, big.NewInt(0).SetUint64(hostOffset))
 			_, exists := p.usedIps[newIP.Uint64()]
 			if !exists {
@@ -106,6 +153,11 @@ func (p *RandomAddressPool) ReserveAddresses(clientID []byte, interfaceIDs [][]b
 				p.identityAssociations[clientIDHash] = association
 				p.usedIps[newIP.Uint64()] = struct{}{}
 				p.identityAssociationExpirations.Push(&associationExpiration{expiresAt: p.calculateAssociationExpiration(timeNow), ia: association})
+				if p.store != nil {
+					if err := p.store.Save(association); err != nil {
+						return ret, err
+					}
+				}
 				ret = append(ret, association)
 				break
 			}
@@ -121,12 +173,16 @@ func (p *RandomAddressPool) ReleaseAddresses(clientID []byte, interfaceIDs [][]b
 	defer p.lock.Unlock()
 
 	for _, interfaceID := range interfaceIDs {
-		association, exists := p.identityAssociations[p.calculateIAIDHash(clientID, interfaceID)]
+		hash := calculateIAIDHash(clientID, interfaceID)
+		association, exists := p.identityAssociations[hash]
 		if !exists {
 			continue
 		}
 		delete(p.usedIps, big.NewInt(0).SetBytes(association.IPAddress).Uint64())
-		delete(p.identityAssociations, p.calculateIAIDHash(clientID, interfaceID))
+		delete(p.identityAssociations, hash)
+		if p.store != nil {
+			p.store.Delete(hash)
+		}
 	}
 }
 
@@ -142,8 +198,12 @@ func (p *RandomAddressPool) expireIdentityAssociations() {
 			break
 		}
 		p.identityAssociationExpirations.Shift()
-		delete(p.identityAssociations, p.calculateIAIDHash(expiration.ia.ClientID, expiration.ia.InterfaceID))
+		hash := calculateIAIDHash(expiration.ia.ClientID, expiration.ia.InterfaceID)
+		delete(p.identityAssociations, hash)
 		delete(p.usedIps, big.NewInt(0).SetBytes(expiration.ia.IPAddress).Uint64())
+		if p.store != nil {
+			p.store.Delete(hash)
+		}
 	}
 }
 
@@ -151,7 +211,9 @@ func (p *RandomAddressPool) calculateAssociationExpiration(now time.Time) time.T
 	return now.Add(time.Duration(p.validLifetime) * time.Second)
 }
 
-func (p *RandomAddressPool) calculateIAIDHash(clientID, interfaceID []byte) uint64 {
+// calculateIAIDHash hashes a (ClientID, InterfaceID) pair into the key used
+// to index identityAssociations, usedIps and a LeaseStore alike.
+func calculateIAIDHash(clientID, interfaceID []byte) uint64 {
 	h := fnv.New64a()
 	h.Write(clientID)
 	h.Write(interfaceID)
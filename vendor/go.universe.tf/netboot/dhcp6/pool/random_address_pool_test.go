@@ -58,7 +58,7 @@ func TestReserveAddressUpdatesAddressPool(t *testing.T) {
 	pool := NewRandomAddressPool(net.ParseIP("2001:db8:f00f:cafe::1"), 1, expectedMaxLifetime)
 	pool.timeNow = func() time.Time { return expectedTime }
 	pool.ReserveAddresses(expectedClientID, [][]byte{expectedIAID})
-	expectedIdx := pool.calculateIAIDHash(expectedClientID, expectedIAID)
+	expectedIdx := calculateIAIDHash(expectedClientID, expectedIAID)
 
 	a, exists := pool.identityAssociations[expectedIdx]
 	if !exists {
@@ -140,7 +140,7 @@ func TestReleaseAddress(t *testing.T) {
 
 	pool.ReleaseAddresses(expectedClientID, [][]byte{expectedIAID})
 
-	_, exists := pool.identityAssociations[pool.calculateIAIDHash(expectedClientID, expectedIAID)]
+	_, exists := pool.identityAssociations[calculateIAIDHash(expectedClientID, expectedIAID)]
 	if exists {
 		t.Fatalf("identity association for %v should've been removed, but is still available", a[0].IPAddress)
 	}
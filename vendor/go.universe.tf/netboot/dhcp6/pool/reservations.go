@@ -0,0 +1,82 @@
+package pool
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// ParseReservations reads a DUID->address reservations file in the form
+//
+//	- duid: 0001000123456789abcdef0123456789abcdef01
+//	  address: 2001:db8:f00f:cafe:ffff::10
+//	- duid: 00030001aabbccddeeff
+//	  address: 2001:db8:f00f:cafe:ffff::11
+//
+// for WithReservations, returning a map keyed the same way
+// (fmt.Sprintf("%x", duid)). No YAML package is vendored in this tree, so
+// this only understands the "duid"/"address" list-of-maps shape above,
+// not general YAML.
+func ParseReservations(r io.Reader) (map[string]net.IP, error) {
+	ret := make(map[string]net.IP)
+
+	var duid, address string
+	flush := func() error {
+		if duid == "" && address == "" {
+			return nil
+		}
+		if duid == "" || address == "" {
+			return fmt.Errorf("reservation entry needs both duid and address, got duid=%q address=%q", duid, address)
+		}
+		if _, err := hex.DecodeString(duid); err != nil {
+			return fmt.Errorf("invalid duid %q: %s", duid, err)
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", address)
+		}
+		ret[strings.ToLower(duid)] = ip
+		duid, address = "", ""
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "-")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed reservations line %q", scanner.Text())
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "duid":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			duid = value
+		case "address":
+			address = value
+		default:
+			return nil, fmt.Errorf("unknown reservations key %q", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
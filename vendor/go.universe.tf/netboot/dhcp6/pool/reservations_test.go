@@ -0,0 +1,40 @@
+package pool
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseReservations(t *testing.T) {
+	input := `
+- duid: 0001000123456789abcdef0123456789abcdef01
+  address: 2001:db8:f00f:cafe:ffff::10
+# a comment line
+- duid: 00030001AABBCCDDEEFF
+  address: 2001:db8:f00f:cafe:ffff::11
+`
+	reservations, err := ParseReservations(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseReservations: %s", err)
+	}
+	if len(reservations) != 2 {
+		t.Fatalf("expected 2 reservations, got %d", len(reservations))
+	}
+
+	ip, ok := reservations["0001000123456789abcdef0123456789abcdef01"]
+	if !ok || !ip.Equal(net.ParseIP("2001:db8:f00f:cafe:ffff::10")) {
+		t.Fatalf("unexpected reservation for first duid: %v, %v", ok, ip)
+	}
+
+	ip, ok = reservations["00030001aabbccddeeff"]
+	if !ok || !ip.Equal(net.ParseIP("2001:db8:f00f:cafe:ffff::11")) {
+		t.Fatalf("unexpected reservation for second duid: %v, %v", ok, ip)
+	}
+}
+
+func TestParseReservationsRejectsMismatchedEntry(t *testing.T) {
+	if _, err := ParseReservations(strings.NewReader("- duid: 0001\n")); err == nil {
+		t.Fatal("expected an error for a duid with no address")
+	}
+}
@@ -0,0 +1,168 @@
+package pool
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"go.universe.tf/netboot/dhcp6"
+)
+
+// SequentialAddressPool hands out the lowest-numbered free address in the
+// pool, instead of RandomAddressPool's random host offset. This is the
+// allocation order IPv4 DHCP servers are conventionally expected to use
+// (and makes leases predictable when debugging a small /24-/16 range),
+// whereas RandomAddressPool's much larger IPv6 host-id space makes a
+// sequential scan for the lowest free address impractically slow.
+type SequentialAddressPool struct {
+	poolStartAddress               *big.Int
+	poolSize                       uint64
+	identityAssociations           map[uint64]*dhcp6.IdentityAssociation
+	usedIps                        map[uint64]struct{}
+	identityAssociationExpirations fifo
+	validLifetime                  uint32 // in seconds
+	timeNow                        func() time.Time
+	store                          LeaseStore
+	lock                           sync.Mutex
+}
+
+// NewSequentialAddressPool creates a new SequentialAddressPool covering
+// poolSize addresses starting at poolStartAddress (e.g. a /24 or /16 IPv4
+// range), handing out leases for validLifetime seconds.
+func NewSequentialAddressPool(poolStartAddress net.IP, poolSize uint64, validLifetime uint32) *SequentialAddressPool {
+	ret := &SequentialAddressPool{}
+	ret.validLifetime = validLifetime
+	ret.poolStartAddress = big.NewInt(0)
+	ret.poolStartAddress.SetBytes(poolStartAddress.To4())
+	ret.poolSize = poolSize
+	ret.identityAssociations = make(map[uint64]*dhcp6.IdentityAssociation)
+	ret.usedIps = make(map[uint64]struct{})
+	ret.identityAssociationExpirations = newFifo()
+	ret.timeNow = func() time.Time { return time.Now() }
+	return ret
+}
+
+// WithLeaseStore attaches a LeaseStore to the pool and rehydrates it from
+// previously persisted leases, mirroring RandomAddressPool.WithLeaseStore.
+func (p *SequentialAddressPool) WithLeaseStore(store LeaseStore) (*SequentialAddressPool, error) {
+	leases, err := store.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.timeNow()
+	for _, ia := range leases {
+		if isExpired(ia, p.validLifetime, now) {
+			continue
+		}
+		hash := calculateIAIDHash(ia.ClientID, ia.InterfaceID)
+		p.identityAssociations[hash] = ia
+		p.usedIps[hostOffsetOf(p.poolStartAddress, ia.IPAddress)] = struct{}{}
+		p.identityAssociationExpirations.Push(&associationExpiration{expiresAt: p.calculateAssociationExpiration(ia.CreatedAt), ia: ia})
+	}
+	p.store = store
+	return p, nil
+}
+
+// ReserveAddresses creates new or retrieves active associations for interfaces in interfaceIDs list, handing out
+// the lowest-numbered free address in the pool.
+func (p *SequentialAddressPool) ReserveAddresses(clientID []byte, interfaceIDs [][]byte) ([]*dhcp6.IdentityAssociation, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expireIdentityAssociations()
+
+	ret := make([]*dhcp6.IdentityAssociation, 0, len(interfaceIDs))
+
+	for _, interfaceID := range interfaceIDs {
+		clientIDHash := calculateIAIDHash(clientID, interfaceID)
+		association, exists := p.identityAssociations[clientIDHash]
+
+		if exists {
+			ret = append(ret, association)
+			continue
+		}
+		if uint64(len(p.usedIps)) == p.poolSize {
+			return ret, fmt.Errorf("No more free ip addresses are currently available in the pool")
+		}
+
+		var hostOffset uint64
+		for hostOffset = 0; hostOffset < p.poolSize; hostOffset++ {
+			if _, exists := p.usedIps[hostOffset]; !exists {
+				break
+			}
+		}
+
+		newIP := big.NewInt(0).Add(p.poolStartAddress, big.NewInt(0).SetUint64(hostOffset))
+		timeNow := p.timeNow()
+		association = &dhcp6.IdentityAssociation{ClientID: clientID,
+			InterfaceID: interfaceID,
+			IPAddress:   net.IP(newIP.Bytes()).To4(),
+			CreatedAt:   timeNow}
+		p.identityAssociations[clientIDHash] = association
+		p.usedIps[hostOffset] = struct{}{}
+		p.identityAssociationExpirations.Push(&associationExpiration{expiresAt: p.calculateAssociationExpiration(timeNow), ia: association})
+		if p.store != nil {
+			if err := p.store.Save(association); err != nil {
+				return ret, err
+			}
+		}
+		ret = append(ret, association)
+	}
+
+	return ret, nil
+}
+
+// ReleaseAddresses returns IP addresses associated with ClientID and interfaceIDs back into the address pool
+func (p *SequentialAddressPool) ReleaseAddresses(clientID []byte, interfaceIDs [][]byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, interfaceID := range interfaceIDs {
+		hash := calculateIAIDHash(clientID, interfaceID)
+		association, exists := p.identityAssociations[hash]
+		if !exists {
+			continue
+		}
+		delete(p.usedIps, hostOffsetOf(p.poolStartAddress, association.IPAddress))
+		delete(p.identityAssociations, hash)
+		if p.store != nil {
+			p.store.Delete(hash)
+		}
+	}
+}
+
+// expireIdentityAssociations releases IP addresses in identity associations that reached the end of valid lifetime
+// back into the address pool. Note it should be called from under the SequentialAddressPool.lock.
+func (p *SequentialAddressPool) expireIdentityAssociations() {
+	for {
+		if p.identityAssociationExpirations.Size() < 1 {
+			break
+		}
+		expiration := p.identityAssociationExpirations.Peek().(*associationExpiration)
+		if p.timeNow().Before(expiration.expiresAt) {
+			break
+		}
+		p.identityAssociationExpirations.Shift()
+		hash := calculateIAIDHash(expiration.ia.ClientID, expiration.ia.InterfaceID)
+		delete(p.identityAssociations, hash)
+		delete(p.usedIps, hostOffsetOf(p.poolStartAddress, expiration.ia.IPAddress))
+		if p.store != nil {
+			p.store.Delete(hash)
+		}
+	}
+}
+
+func (p *SequentialAddressPool) calculateAssociationExpiration(now time.Time) time.Time {
+	return now.Add(time.Duration(p.validLifetime) * time.Second)
+}
+
+func hostOffsetOf(poolStartAddress *big.Int, ip net.IP) uint64 {
+	addr := big.NewInt(0).SetBytes(ip.To4())
+	return big.NewInt(0).Sub(addr, poolStartAddress).Uint64()
+}
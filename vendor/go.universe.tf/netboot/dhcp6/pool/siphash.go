@@ -0,0 +1,70 @@
+package pool
+
+import "encoding/binary"
+
+// siphash24 computes SipHash-2-4 (Aumasson & Bernstein 2012) of msg keyed
+// by key. No SipHash package is vendored in this tree, so this is a
+// from-scratch implementation of the published algorithm (2 compression
+// rounds per 8-byte block, 4 finalization rounds), used by
+// DeterministicPool to turn a (ClientID, InterfaceID) pair into a pool
+// host offset.
+func siphash24(key [16]byte, msg []byte) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	b := uint64(len(msg)) << 56
+
+	for len(msg) >= 8 {
+		m := binary.LittleEndian.Uint64(msg)
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+		msg = msg[8:]
+	}
+
+	var last [8]byte
+	copy(last[:], msg)
+	b |= binary.LittleEndian.Uint64(last[:])
+
+	v3 ^= b
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= b
+
+	v2 ^= 0xff
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+// sipRound is one SipRound as defined by the SipHash spec.
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = rotl(v1, 13)
+	v1 ^= v0
+	v0 = rotl(v0, 32)
+	v2 += v3
+	v3 = rotl(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = rotl(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = rotl(v1, 17)
+	v1 ^= v2
+	v2 = rotl(v2, 32)
+	return v0, v1, v2, v3
+}
+
+func rotl(x uint64, b uint) uint64 {
+	return (x << b) | (x >> (64 - b))
+}
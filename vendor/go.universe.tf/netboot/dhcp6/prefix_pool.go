@@ -0,0 +1,19 @@
+package dhcp6
+
+import "net"
+
+// DelegatedPrefix associates a delegated IPv6 prefix with a network
+// interface of a client, see RFC 3633.
+type DelegatedPrefix struct {
+	Prefix       net.IP
+	PrefixLength uint8
+	ClientID     []byte
+	InterfaceID  []byte
+}
+
+// PrefixPool keeps track of assigned and available delegated prefixes
+// for IA_PD (option 25) requests.
+type PrefixPool interface {
+	ReservePrefixes(clientID []byte, interfaceIds [][]byte) ([]*DelegatedPrefix, error)
+	ReleasePrefixes(clientID []byte, interfaceIds [][]byte)
+}
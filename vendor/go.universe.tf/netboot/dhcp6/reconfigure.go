@@ -0,0 +1,184 @@
+package dhcp6
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Authentication Option protocol/algorithm IDs relevant to the
+// Reconfigure Key Authentication Protocol (RFC 3315 section 21.4).
+const (
+	authProtocolReconfigureKey byte = 3
+	authAlgorithmHMACMD5       byte = 1
+
+	// reconfigureKeyLen is the size, in bytes, of the per-client secret key
+	// used to authenticate a Reconfigure message (RFC 3315 section 21.4.3).
+	reconfigureKeyLen = 16
+
+	// authInfoLen is the size of a Reconfigure Key Authentication
+	// Protocol auth-info field: a type byte followed by the HMAC-MD5
+	// digest.
+	authInfoLen = 1 + md5.Size
+)
+
+// Reconfigure Key Authentication Protocol auth-info types (RFC 3315
+// section 21.4.3).
+const (
+	reconfigureKeyTypeReply byte = 1 // key sent to the client in a Reply
+	reconfigureKeyTypeHMAC  byte = 2 // HMAC-MD5 digest of the Reconfigure
+)
+
+// ReconfigureKeyStore associates each client (identified by its DUID) with
+// the secret key established for it during the client's initial Reply, so
+// a later server-initiated Reconfigure can be authenticated against that
+// same key (RFC 3315 section 19).
+type ReconfigureKeyStore interface {
+	Put(clientDUID []byte, key [reconfigureKeyLen]byte)
+	Get(clientDUID []byte) ([reconfigureKeyLen]byte, bool)
+}
+
+// memReconfigureKeyStore is an in-memory ReconfigureKeyStore, keyed by the
+// string form of the client's DUID.
+type memReconfigureKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][reconfigureKeyLen]byte
+}
+
+// NewMemReconfigureKeyStore creates an empty, in-memory
+// ReconfigureKeyStore.
+func NewMemReconfigureKeyStore() ReconfigureKeyStore {
+	return &memReconfigureKeyStore{keys: make(map[string][reconfigureKeyLen]byte)}
+}
+
+func (s *memReconfigureKeyStore) Put(clientDUID []byte, key [reconfigureKeyLen]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[string(clientDUID)] = key
+}
+
+func (s *memReconfigureKeyStore) Get(clientDUID []byte) ([reconfigureKeyLen]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[string(clientDUID)]
+	return key, ok
+}
+
+// MakeRapidCommitOption creates a Rapid Commit Option (RFC 3315 section
+// 22.14), which carries no value.
+func MakeRapidCommitOption() *Option {
+	return &Option{ID: OptRapidCommit}
+}
+
+// MakeReconfAcceptOption creates a Reconfigure Accept Option (RFC 3315
+// section 22.20), which carries no value.
+func MakeReconfAcceptOption() *Option {
+	return &Option{ID: OptReconfAccept}
+}
+
+// MakeReconfMsgOption creates a Reconfigure Message Option (RFC 3315
+// section 22.19), indicating whether the client should respond with a
+// Renew or an Information-Request.
+func MakeReconfMsgOption(msgType MessageType) *Option {
+	return &Option{ID: OptReconfMsg, Length: 1, Value: []byte{byte(msgType)}}
+}
+
+// signReconfigure computes the Reconfigure Key Authentication Protocol
+// HMAC-MD5 digest (RFC 3315 section 21.4.3) over msg, which must have its
+// Authentication Option's auth-info field zeroed out first.
+func signReconfigure(msg []byte, key [reconfigureKeyLen]byte) [md5.Size]byte {
+	mac := hmac.New(md5.New, key[:])
+	mac.Write(msg)
+	var digest [md5.Size]byte
+	copy(digest[:], mac.Sum(nil))
+	return digest
+}
+
+// makeAuthOption builds the Authentication Option used to carry a
+// Reconfigure Key Authentication Protocol signature. replayDetection is
+// the 64-bit RDM value (a monotonically increasing counter, per RFC 3315
+// section 21.4.4); authInfo is the type byte plus HMAC-MD5 digest.
+func makeAuthOption(replayDetection uint64, authInfo [authInfoLen]byte) *Option {
+	value := make([]byte, 11+authInfoLen)
+	value[0] = authProtocolReconfigureKey
+	value[1] = authAlgorithmHMACMD5
+	value[2] = 0 // RDM: 0 == monotonically increasing counter
+	for i := 0; i < 8; i++ {
+		value[3+i] = byte(replayDetection >> uint(8*(7-i)))
+	}
+	copy(value[11:], authInfo[:])
+	return &Option{ID: OptAuth, Length: uint16(len(value)), Value: value}
+}
+
+// ReconfigureServer sends server-initiated Reconfigure messages (RFC 3315
+// section 19), authenticated with the Reconfigure Key Authentication
+// Protocol, to clients that have already established a key and advertised
+// OptReconfAccept.
+type ReconfigureServer struct {
+	ServerDUID []byte
+	Keys       ReconfigureKeyStore
+	Conn       *Conn
+
+	mu       sync.Mutex
+	replayID uint64
+}
+
+// NewReconfigureServer creates a ReconfigureServer that sends Reconfigure
+// messages over conn, authenticated with keys drawn from keys.
+func NewReconfigureServer(serverDUID []byte, keys ReconfigureKeyStore, conn *Conn) *ReconfigureServer {
+	return &ReconfigureServer{ServerDUID: serverDUID, Keys: keys, Conn: conn}
+}
+
+// SendReconfigure builds and sends a MsgReconfigure to dst, telling the
+// client identified by clientDUID to re-contact the server with msgType
+// (MsgRenew or MsgInformationRequest), without waiting for its T1/T2 to
+// elapse. It fails if no Reconfigure key has been established for this
+// client, which happens during its initial Reply (not implemented by this
+// package's PacketBuilder yet; see EstablishReconfigureKey).
+func (s *ReconfigureServer) SendReconfigure(clientDUID []byte, dst net.IP, msgType MessageType) error {
+	if msgType != MsgRenew && msgType != MsgInformationRequest {
+		return fmt.Errorf("dhcp6: Reconfigure must request Renew or Information-Request, not %v", msgType)
+	}
+	key, ok := s.Keys.Get(clientDUID)
+	if !ok {
+		return fmt.Errorf("dhcp6: no reconfigure key established for client %x", clientDUID)
+	}
+
+	options := make(Options)
+	options.Add(MakeOption(OptServerID, s.ServerDUID))
+	options.Add(MakeOption(OptClientID, clientDUID))
+	options.Add(MakeReconfMsgOption(msgType))
+
+	replayID := s.nextReplayID()
+	// A zeroed auth-info field is signed first, then the real signature is
+	// substituted in, per RFC 3315 section 21.4.3.
+	options.Add(makeAuthOption(replayID, [authInfoLen]byte{}))
+
+	pkt := &Packet{Type: MsgReconfigure, Options: options}
+	msg, err := pkt.Marshal()
+	if err != nil {
+		return fmt.Errorf("dhcp6: failed to marshal Reconfigure: %s", err)
+	}
+
+	digest := signReconfigure(msg, key)
+	var authInfo [authInfoLen]byte
+	authInfo[0] = reconfigureKeyTypeHMAC
+	copy(authInfo[1:], digest[:])
+	options[OptAuth][0] = makeAuthOption(replayID, authInfo)
+
+	signedMsg, err := pkt.Marshal()
+	if err != nil {
+		return fmt.Errorf("dhcp6: failed to marshal signed Reconfigure: %s", err)
+	}
+
+	return s.Conn.SendDHCP(dst, signedMsg)
+}
+
+func (s *ReconfigureServer) nextReplayID() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replayID++
+	return s.replayID
+}
@@ -0,0 +1,146 @@
+package dhcp6
+
+import (
+	"fmt"
+	"net"
+)
+
+// RelayPacket represents a Relay-Forward or Relay-Reply message (RFC 3315
+// section 7). Unlike a client/server Packet, it has no transaction ID;
+// instead it carries the hop count and link/peer addresses a relay agent
+// needs to forward the encapsulated client message toward the right link,
+// plus an Options set whose OptRelayMessage suboption holds that
+// encapsulated message (itself either a Packet or, for nested relays,
+// another RelayPacket).
+type RelayPacket struct {
+	Type        MessageType
+	HopCount    byte
+	LinkAddress net.IP
+	PeerAddress net.IP
+	Options     Options
+}
+
+// relayHeaderLen is the size of a Relay-Forward/Relay-Reply's fixed header:
+// msg-type, hop-count, link-address (16 bytes), peer-address (16 bytes).
+const relayHeaderLen = 1 + 1 + 16 + 16
+
+// UnmarshalRelay creates a RelayPacket out of its serialized representation.
+func UnmarshalRelay(bs []byte) (*RelayPacket, error) {
+	if len(bs) < relayHeaderLen {
+		return nil, fmt.Errorf("relay packet too short: %d bytes", len(bs))
+	}
+
+	linkAddress := make(net.IP, 16)
+	copy(linkAddress, bs[2:18])
+	peerAddress := make(net.IP, 16)
+	copy(peerAddress, bs[18:34])
+
+	options, err := UnmarshalOptions(bs[relayHeaderLen:])
+	if err != nil {
+		return nil, fmt.Errorf("relay packet has malformed options section: %s", err)
+	}
+
+	return &RelayPacket{
+		Type:        MessageType(bs[0]),
+		HopCount:    bs[1],
+		LinkAddress: linkAddress,
+		PeerAddress: peerAddress,
+		Options:     options,
+	}, nil
+}
+
+// Marshal serializes the RelayPacket.
+func (p *RelayPacket) Marshal() ([]byte, error) {
+	marshalledOptions, err := p.Options.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("relay packet has malformed options section: %s", err)
+	}
+
+	ret := make([]byte, relayHeaderLen, relayHeaderLen+len(marshalledOptions))
+	ret[0] = byte(p.Type)
+	ret[1] = p.HopCount
+	copy(ret[2:18], p.LinkAddress.To16())
+	copy(ret[18:34], p.PeerAddress.To16())
+	return append(ret, marshalledOptions...), nil
+}
+
+// UnmarshalAny decodes a packet whose message type isn't known ahead of
+// time, dispatching on the leading byte to either Unmarshal (a regular
+// client/server Packet) or UnmarshalRelay (a Relay-Forward/Relay-Reply).
+// Exactly one of the two return values is non-nil on success.
+func UnmarshalAny(bs []byte) (*Packet, *RelayPacket, error) {
+	if len(bs) == 0 {
+		return nil, nil, fmt.Errorf("empty packet")
+	}
+
+	switch MessageType(bs[0]) {
+	case MsgRelayForw, MsgRelayRepl:
+		relay, err := UnmarshalRelay(bs)
+		return nil, relay, err
+	default:
+		pkt, err := Unmarshal(bs, len(bs))
+		return pkt, nil, err
+	}
+}
+
+// RelayMessage returns the raw bytes of the encapsulated message carried in
+// the Relay Message Option, or nil if there isn't one.
+func (p *RelayPacket) RelayMessage() []byte {
+	opts, exists := p.Options[OptRelayMessage]
+	if !exists || len(opts) == 0 {
+		return nil
+	}
+	return opts[0].Value
+}
+
+// UnmarshalClientPacket unwraps the encapsulated client message out of a
+// Relay-Forward, recursing through any nested relays until it reaches a
+// non-relay Packet. Relay agents chain (a client behind two relays gets
+// double-wrapped), so the innermost message is the one a server should act
+// on.
+func UnmarshalClientPacket(relay *RelayPacket) (*Packet, error) {
+	inner := relay.RelayMessage()
+	if inner == nil {
+		return nil, fmt.Errorf("relay packet has no relay message option")
+	}
+
+	if len(inner) == 0 {
+		return nil, fmt.Errorf("relay message option is empty")
+	}
+
+	switch MessageType(inner[0]) {
+	case MsgRelayForw, MsgRelayRepl:
+		nested, err := UnmarshalRelay(inner)
+		if err != nil {
+			return nil, err
+		}
+		return UnmarshalClientPacket(nested)
+	default:
+		return Unmarshal(inner, len(inner))
+	}
+}
+
+// WrapInRelayReply builds the Relay-Reply that should be sent back to the
+// relay agent that sent req, wrapping resp (the server's answer to the
+// client) in an OptRelayMessage option and copying req's hop-count and
+// link/peer addresses so the relay agent can deliver it to the right link.
+func WrapInRelayReply(req *RelayPacket, resp *Packet) (*RelayPacket, error) {
+	marshalledResp, err := resp.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encapsulated response: %s", err)
+	}
+
+	options := make(Options)
+	options.Add(MakeOption(OptRelayMessage, marshalledResp))
+	if interfaceID, exists := req.Options[OptInterfaceID]; exists && len(interfaceID) > 0 {
+		options.Add(MakeOption(OptInterfaceID, interfaceID[0].Value))
+	}
+
+	return &RelayPacket{
+		Type:        MsgRelayRepl,
+		HopCount:    req.HopCount,
+		LinkAddress: req.LinkAddress,
+		PeerAddress: req.PeerAddress,
+		Options:     options,
+	}, nil
+}
@@ -0,0 +1,495 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import "fmt"
+
+// This file implements just enough of classic BPF (cBPF, the packet
+// filter Linux's SO_ATTACH_FILTER and tcpdump -d both speak) to let
+// Reader skip packets during iteration without decoding them. It
+// mirrors the public shape of golang.org/x/net/bpf - the Instruction
+// types below have the same names and fields as that package's
+// LoadAbsolute, LoadIndirect, ALUOpConstant, JumpIf, RetA and so on -
+// because that package isn't vendored in this tree and there is no
+// go.mod/toolchain available here to add it. Swapping in the real
+// package later should only mean changing the import and the "bpf."
+// prefix on these type names; evalFilter's opcode encoding matches
+// the kernel's struct sock_filter layout that golang.org/x/net/bpf
+// itself assembles down to.
+
+// Register names an accumulator (A) or index (X) register.
+type Register uint16
+
+const (
+	RegA Register = 0
+	RegX Register = 1
+)
+
+// ALUOp identifies an arithmetic/logic operation for ALUOpConstant
+// and ALUOpX.
+type ALUOp uint16
+
+const (
+	ALUOpAdd        ALUOp = 0x00
+	ALUOpSub        ALUOp = 0x10
+	ALUOpMul        ALUOp = 0x20
+	ALUOpDiv        ALUOp = 0x30
+	ALUOpOr         ALUOp = 0x40
+	ALUOpAnd        ALUOp = 0x50
+	ALUOpShiftLeft  ALUOp = 0x60
+	ALUOpShiftRight ALUOp = 0x70
+	ALUOpMod        ALUOp = 0x90
+	ALUOpXor        ALUOp = 0xa0
+)
+
+// JumpTest identifies the comparison a JumpIf performs against the
+// accumulator.
+type JumpTest uint16
+
+const (
+	JumpEqual          JumpTest = 0x10
+	JumpGreaterThan    JumpTest = 0x20
+	JumpGreaterOrEqual JumpTest = 0x30
+	JumpBitsSet        JumpTest = 0x40
+)
+
+// Raw instruction encoding: class in the low 3 bits of Op, with the
+// remaining bits interpreted differently per class, exactly as the
+// kernel's struct sock_filter defines it.
+const (
+	classLd  = 0x00
+	classLdx = 0x01
+	classSt  = 0x02
+	classStx = 0x03
+	classAlu = 0x04
+	classJmp = 0x05
+	classRet = 0x06
+
+	sizeW = 0x00
+	sizeH = 0x08
+	sizeB = 0x10
+
+	modeImm = 0x00
+	modeAbs = 0x20
+	modeInd = 0x40
+	modeMem = 0x60
+	modeMsh = 0xa0
+
+	srcK = 0x00
+	srcX = 0x08
+
+	rvalK = 0x00
+	rvalA = 0x10
+
+	jmpJA = 0x00
+)
+
+// rawInstruction is one assembled cBPF instruction.
+type rawInstruction struct {
+	Op uint16
+	Jt uint8
+	Jf uint8
+	K  uint32
+}
+
+// Instruction is a single not-yet-assembled cBPF instruction.
+type Instruction interface {
+	assemble() rawInstruction
+}
+
+func sizeOp(size int) (uint16, error) {
+	switch size {
+	case 1:
+		return sizeB, nil
+	case 2:
+		return sizeH, nil
+	case 4:
+		return sizeW, nil
+	default:
+		return 0, fmt.Errorf("unsupported load size %d (must be 1, 2 or 4)", size)
+	}
+}
+
+// LoadAbsolute loads Size bytes (1, 2 or 4) from offset Off of the
+// packet into the accumulator.
+type LoadAbsolute struct {
+	Off  uint32
+	Size int
+}
+
+func (i LoadAbsolute) assemble() rawInstruction {
+	size, _ := sizeOp(i.Size)
+	return rawInstruction{Op: classLd | modeAbs | size, K: i.Off}
+}
+
+// LoadIndirect loads Size bytes from offset Off+X of the packet into
+// the accumulator.
+type LoadIndirect struct {
+	Off  uint32
+	Size int
+}
+
+func (i LoadIndirect) assemble() rawInstruction {
+	size, _ := sizeOp(i.Size)
+	return rawInstruction{Op: classLd | modeInd | size, K: i.Off}
+}
+
+// LoadConstant sets Dst to Val.
+type LoadConstant struct {
+	Dst Register
+	Val uint32
+}
+
+func (i LoadConstant) assemble() rawInstruction {
+	class := uint16(classLd)
+	if i.Dst == RegX {
+		class = classLdx
+	}
+	return rawInstruction{Op: class | modeImm, K: i.Val}
+}
+
+// LoadScratch sets Dst to the value in scratch memory slot N (0-15).
+type LoadScratch struct {
+	Dst Register
+	N   int
+}
+
+func (i LoadScratch) assemble() rawInstruction {
+	class := uint16(classLd)
+	if i.Dst == RegX {
+		class = classLdx
+	}
+	return rawInstruction{Op: class | modeMem, K: uint32(i.N)}
+}
+
+// StoreScratch saves Src into scratch memory slot N (0-15).
+type StoreScratch struct {
+	Src Register
+	N   int
+}
+
+func (i StoreScratch) assemble() rawInstruction {
+	class := uint16(classSt)
+	if i.Src == RegX {
+		class = classStx
+	}
+	return rawInstruction{Op: class, K: uint32(i.N)}
+}
+
+// LoadMemShift sets X to 4*(packet[Off]&0xf), the IHL-derived IPv4
+// header length trick classic BPF programs use to skip a variable
+// length IP header to reach the transport header.
+type LoadMemShift struct {
+	Off uint32
+}
+
+func (i LoadMemShift) assemble() rawInstruction {
+	return rawInstruction{Op: classLdx | modeMsh | sizeB, K: i.Off}
+}
+
+// ALUOpConstant applies Op to the accumulator and Val.
+type ALUOpConstant struct {
+	Op  ALUOp
+	Val uint32
+}
+
+func (i ALUOpConstant) assemble() rawInstruction {
+	return rawInstruction{Op: classAlu | srcK | uint16(i.Op), K: i.Val}
+}
+
+// ALUOpX applies Op to the accumulator and the X register.
+type ALUOpX struct {
+	Op ALUOp
+}
+
+func (i ALUOpX) assemble() rawInstruction {
+	return rawInstruction{Op: classAlu | srcX | uint16(i.Op)}
+}
+
+// Jump skips Skip instructions unconditionally.
+type Jump struct {
+	Skip uint32
+}
+
+func (i Jump) assemble() rawInstruction {
+	return rawInstruction{Op: classJmp | jmpJA, K: i.Skip}
+}
+
+// JumpIf compares the accumulator against Val using Cond, skipping
+// SkipTrue instructions if the comparison holds and SkipFalse
+// otherwise.
+type JumpIf struct {
+	Cond               JumpTest
+	Val                uint32
+	SkipTrue, SkipFalse uint8
+}
+
+func (i JumpIf) assemble() rawInstruction {
+	return rawInstruction{Op: classJmp | srcK | uint16(i.Cond), Jt: i.SkipTrue, Jf: i.SkipFalse, K: i.Val}
+}
+
+// RetA ends the program, keeping the packet if the accumulator is
+// non-zero.
+type RetA struct{}
+
+func (RetA) assemble() rawInstruction {
+	return rawInstruction{Op: classRet | rvalA}
+}
+
+// RetConstant ends the program, keeping the packet if Val is
+// non-zero.
+type RetConstant struct {
+	Val uint32
+}
+
+func (i RetConstant) assemble() rawInstruction {
+	return rawInstruction{Op: classRet | rvalK, K: i.Val}
+}
+
+// Assemble compiles prog into its raw instruction encoding, as
+// bpf.Assemble would.
+func Assemble(prog []Instruction) ([]rawInstruction, error) {
+	out := make([]rawInstruction, len(prog))
+	for idx, ins := range prog {
+		switch v := ins.(type) {
+		case LoadAbsolute:
+			if _, err := sizeOp(v.Size); err != nil {
+				return nil, fmt.Errorf("instruction %d: %s", idx, err)
+			}
+		case LoadIndirect:
+			if _, err := sizeOp(v.Size); err != nil {
+				return nil, fmt.Errorf("instruction %d: %s", idx, err)
+			}
+		}
+		out[idx] = ins.assemble()
+	}
+	return out, nil
+}
+
+// SetFilter installs a cBPF program that every packet read from r must
+// pass for Next to return it; packets that don't match are silently
+// skipped rather than decoded in Go. Passing a nil prog clears any
+// filter already installed.
+func (r *Reader) SetFilter(prog []Instruction) error {
+	if prog == nil {
+		r.filter = nil
+		return nil
+	}
+	raw, err := Assemble(prog)
+	if err != nil {
+		return err
+	}
+	r.filter = raw
+	return nil
+}
+
+// evalFilter runs prog against the raw bytes of one packet, returning
+// true if the packet should be kept.
+func evalFilter(prog []rawInstruction, pkt []byte) bool {
+	var a, x uint32
+	var scratch [16]uint32
+
+	pc := 0
+	for pc < len(prog) {
+		ins := prog[pc]
+		class := ins.Op & 0x07
+
+		switch class {
+		case classLd, classLdx:
+			mode := ins.Op & 0xe0
+			if mode == modeMsh {
+				v, ok := loadPacket(pkt, ins.K, sizeB)
+				if !ok {
+					return false
+				}
+				x = 4 * (v & 0x0f)
+				pc++
+				continue
+			}
+
+			size := ins.Op & 0x18
+			var v uint32
+			switch mode {
+			case modeAbs:
+				vv, ok := loadPacket(pkt, ins.K, size)
+				if !ok {
+					return false
+				}
+				v = vv
+			case modeInd:
+				vv, ok := loadPacket(pkt, ins.K+x, size)
+				if !ok {
+					return false
+				}
+				v = vv
+			case modeImm:
+				v = ins.K
+			case modeMem:
+				v = scratch[ins.K&0x0f]
+			}
+			if class == classLd {
+				a = v
+			} else {
+				x = v
+			}
+
+		case classSt, classStx:
+			if class == classSt {
+				scratch[ins.K&0x0f] = a
+			} else {
+				scratch[ins.K&0x0f] = x
+			}
+
+		case classAlu:
+			op := ins.Op &^ 0x0f
+			var operand uint32
+			if ins.Op&srcX != 0 {
+				operand = x
+			} else {
+				operand = ins.K
+			}
+			switch ALUOp(op) {
+			case ALUOpAdd:
+				a += operand
+			case ALUOpSub:
+				a -= operand
+			case ALUOpMul:
+				a *= operand
+			case ALUOpDiv:
+				if operand == 0 {
+					return false
+				}
+				a /= operand
+			case ALUOpOr:
+				a |= operand
+			case ALUOpAnd:
+				a &= operand
+			case ALUOpShiftLeft:
+				a <<= operand
+			case ALUOpShiftRight:
+				a >>= operand
+			case ALUOpMod:
+				if operand == 0 {
+					return false
+				}
+				a %= operand
+			case ALUOpXor:
+				a ^= operand
+			}
+
+		case classJmp:
+			if ins.Op&0xf0 == jmpJA {
+				pc += int(ins.K)
+				pc++
+				continue
+			}
+			var operand uint32
+			if ins.Op&srcX != 0 {
+				operand = x
+			} else {
+				operand = ins.K
+			}
+			var taken bool
+			switch JumpTest(ins.Op & 0xf0) {
+			case JumpEqual:
+				taken = a == operand
+			case JumpGreaterThan:
+				taken = a > operand
+			case JumpGreaterOrEqual:
+				taken = a >= operand
+			case JumpBitsSet:
+				taken = a&operand != 0
+			}
+			if taken {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+			pc++
+			continue
+
+		case classRet:
+			if ins.Op&0x18 == rvalA {
+				return a != 0
+			}
+			return ins.K != 0
+		}
+		pc++
+	}
+	return false
+}
+
+// loadPacket reads a size-encoded (sizeB/sizeH/sizeW) big-endian value
+// from pkt at off, reporting false if it runs past the end of pkt -
+// which classic BPF treats as an implicit reject, not an error.
+func loadPacket(pkt []byte, off uint32, size uint16) (uint32, bool) {
+	o := int(off)
+	switch size {
+	case sizeB:
+		if o < 0 || o+1 > len(pkt) {
+			return 0, false
+		}
+		return uint32(pkt[o]), true
+	case sizeH:
+		if o < 0 || o+2 > len(pkt) {
+			return 0, false
+		}
+		return uint32(pkt[o])<<8 | uint32(pkt[o+1]), true
+	default:
+		if o < 0 || o+4 > len(pkt) {
+			return 0, false
+		}
+		return uint32(pkt[o])<<24 | uint32(pkt[o+1])<<16 | uint32(pkt[o+2])<<8 | uint32(pkt[o+3]), true
+	}
+}
+
+// acceptWholePacket is the conventional cBPF "keep" return value:
+// nonzero is all that matters to evalFilter, but by convention it's
+// the number of bytes of the packet to keep, so programs here use the
+// same 0xffff ("keep everything") tcpdump itself emits.
+const acceptWholePacket = 0xffff
+
+// FilterEtherType returns a program that keeps only Ethernet frames
+// whose EtherType field equals t (e.g. 0x0800 for IPv4, 0x86DD for
+// IPv6).
+func FilterEtherType(t uint16) []Instruction {
+	return []Instruction{
+		LoadAbsolute{Off: 12, Size: 2},                              // 0: A = ethertype
+		JumpIf{Cond: JumpEqual, Val: uint32(t), SkipTrue: 0, SkipFalse: 1}, // 1
+		RetConstant{Val: acceptWholePacket},                          // 2: accept
+		RetConstant{Val: 0},                                          // 3: reject
+	}
+}
+
+// FilterUDPPort returns a program that keeps only IPv4/UDP packets
+// whose source or destination port equals port, for isolating a
+// single DHCP/BOOTP conversation out of a capture. It assumes
+// Ethernet framing and an IPv4 header with no options-dependent
+// quirks beyond the standard variable IHL.
+func FilterUDPPort(port uint16) []Instruction {
+	return []Instruction{
+		LoadAbsolute{Off: 12, Size: 2},                                     // 0: A = ethertype
+		JumpIf{Cond: JumpEqual, Val: 0x0800, SkipTrue: 0, SkipFalse: 8},      // 1: keep going only if IPv4
+		LoadAbsolute{Off: 23, Size: 1},                                     // 2: A = IP protocol
+		JumpIf{Cond: JumpEqual, Val: 17, SkipTrue: 0, SkipFalse: 6},          // 3: keep going only if UDP
+		LoadMemShift{Off: 14},                                              // 4: X = IP header length
+		LoadIndirect{Off: 14, Size: 2},                                     // 5: A = UDP source port
+		JumpIf{Cond: JumpEqual, Val: uint32(port), SkipTrue: 2, SkipFalse: 0}, // 6: matched source port
+		LoadIndirect{Off: 16, Size: 2},                                     // 7: A = UDP dest port
+		JumpIf{Cond: JumpEqual, Val: uint32(port), SkipTrue: 0, SkipFalse: 1}, // 8: matched dest port
+		RetConstant{Val: acceptWholePacket},                                 // 9: accept
+		RetConstant{Val: 0},                                                // 10: reject
+	}
+}
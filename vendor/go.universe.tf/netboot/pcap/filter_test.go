@@ -0,0 +1,117 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// udpPacket builds a minimal Ethernet+IPv4+UDP frame for testing
+// filters against, with no payload.
+func udpPacket(srcPort, dstPort uint16) []byte {
+	eth := make([]byte, 14)
+	eth[12], eth[13] = 0x08, 0x00 // EtherType IPv4
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45 // version 4, IHL 5 (20-byte header, no options)
+	ip[9] = 17   // protocol UDP
+
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[0:2], srcPort)
+	binary.BigEndian.PutUint16(udp[2:4], dstPort)
+
+	pkt := append(append(eth, ip...), udp...)
+	return pkt
+}
+
+func TestFilterEtherType(t *testing.T) {
+	prog, err := Assemble(FilterEtherType(0x0800))
+	if err != nil {
+		t.Fatalf("Assemble: %s", err)
+	}
+
+	ipv4 := udpPacket(68, 67)
+	if !evalFilter(prog, ipv4) {
+		t.Error("FilterEtherType(0x0800) rejected an IPv4 frame")
+	}
+
+	ipv6 := udpPacket(68, 67)
+	ipv6[12], ipv6[13] = 0x86, 0xdd
+	if evalFilter(prog, ipv6) {
+		t.Error("FilterEtherType(0x0800) accepted an IPv6 frame")
+	}
+}
+
+func TestFilterUDPPort(t *testing.T) {
+	prog, err := Assemble(FilterUDPPort(67))
+	if err != nil {
+		t.Fatalf("Assemble: %s", err)
+	}
+
+	if !evalFilter(prog, udpPacket(68, 67)) {
+		t.Error("FilterUDPPort(67) rejected a packet addressed to port 67")
+	}
+	if !evalFilter(prog, udpPacket(67, 68)) {
+		t.Error("FilterUDPPort(67) rejected a packet sourced from port 67")
+	}
+	if evalFilter(prog, udpPacket(1000, 2000)) {
+		t.Error("FilterUDPPort(67) accepted a packet using neither port 67")
+	}
+
+	nonUDP := udpPacket(68, 67)
+	nonUDP[14+9] = 6 // TCP, not UDP
+	if evalFilter(prog, nonUDP) {
+		t.Error("FilterUDPPort(67) accepted a non-UDP packet")
+	}
+}
+
+func TestReaderSetFilter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, LinkEthernet)
+	if err != nil {
+		t.Fatalf("NewWriter: %s", err)
+	}
+	for _, pkt := range []*Packet{
+		{Timestamp: time.Unix(1, 0), Length: len(udpPacket(68, 67)), Bytes: udpPacket(68, 67)},
+		{Timestamp: time.Unix(2, 0), Length: len(udpPacket(1000, 2000)), Bytes: udpPacket(1000, 2000)},
+		{Timestamp: time.Unix(3, 0), Length: len(udpPacket(67, 68)), Bytes: udpPacket(67, 68)},
+	} {
+		if err := w.Put(pkt); err != nil {
+			t.Fatalf("Put: %s", err)
+		}
+	}
+
+	r, err := NewReader(&b)
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	if err := r.SetFilter(FilterUDPPort(67)); err != nil {
+		t.Fatalf("SetFilter: %s", err)
+	}
+
+	var got []time.Time
+	for r.Next() {
+		got = append(got, r.Packet().Timestamp)
+	}
+	if r.Err() != nil {
+		t.Fatalf("reading filtered packets: %s", r.Err())
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d packets through the filter, want 2 (the middle packet should have been dropped)", len(got))
+	}
+}
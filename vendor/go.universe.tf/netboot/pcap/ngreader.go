@@ -0,0 +1,290 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// defaultTSUnitsPerSec is the PCAPng-specified timestamp resolution
+// (microseconds) an Interface Description Block implies when its
+// if_tsresol option is absent.
+const defaultTSUnitsPerSec = 1e6
+
+// ngInterface is what NgReader remembers about one interface
+// registered via an Interface Description Block, enough to decode
+// later Enhanced Packet Blocks captured on it.
+type ngInterface struct {
+	linkType      LinkType
+	tsUnitsPerSec uint64
+}
+
+// NgPacket is defined in ngwriter.go; NgReader fills in the same type
+// NgWriter consumes, so packets can be re-written or re-filtered
+// without conversion.
+
+// NgReader extracts packets from a PCAPng file, which (unlike the
+// files Reader understands) can multiplex packets captured from
+// several interfaces, each with its own timestamp resolution, into a
+// single section.
+type NgReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+
+	interfaces []ngInterface
+	pkt        *NgPacket
+	err        error
+}
+
+// NewNgReader returns a new NgReader that decodes PCAPng data from r,
+// which must begin with a Section Header Block.
+func NewNgReader(r io.Reader) (*NgReader, error) {
+	// The Section Header Block's own type field is a byte-palindrome
+	// (0x0A0D0D0A reads the same in either byte order), so it can be
+	// read before we know the file's endianness. The byte-order magic
+	// that follows the block length tells us which order everything
+	// else, including that length field itself, is actually in -
+	// mirroring how Reader disambiguates the classic pcap header using
+	// its major/minor version numbers.
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("reading pcapng section header: %s", err)
+	}
+	if binary.LittleEndian.Uint32(hdr[0:4]) != blockTypeSectionHeader {
+		return nil, errors.New("pcapng file doesn't start with a Section Header Block")
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(hdr[8:12]) == byteOrderMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[8:12]) == byteOrderMagic:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("bad pcapng byte-order magic")
+	}
+
+	totalLen := order.Uint32(hdr[4:8])
+	if totalLen < 16 {
+		return nil, fmt.Errorf("pcapng section header block has impossible length %d", totalLen)
+	}
+	rest := make([]byte, totalLen-12)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, fmt.Errorf("reading pcapng section header: %s", err)
+	}
+	if trailer := order.Uint32(rest[len(rest)-4:]); trailer != totalLen {
+		return nil, errors.New("pcapng section header block's leading and trailing lengths disagree")
+	}
+
+	return &NgReader{r: r, order: order}, nil
+}
+
+// Packet returns the packet read by the last call to Next.
+func (r *NgReader) Packet() *NgPacket {
+	return r.pkt
+}
+
+// Err returns the first non-EOF error encountered by the NgReader.
+func (r *NgReader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// Next advances the NgReader to the next Enhanced Packet Block in the
+// input, skipping any other block types it encounters (Interface
+// Description Blocks are consumed to learn each interface's link type
+// and timestamp resolution; a further Section Header Block resets
+// that interface list, as a new section's interface IDs start over at
+// 0). It returns false when the NgReader stops, either by reaching
+// the end of the input or an error.
+func (r *NgReader) Next() bool {
+	for {
+		blockType, body, err := r.readBlock()
+		if err != nil {
+			r.err = err
+			return false
+		}
+		switch blockType {
+		case blockTypeSectionHeader:
+			r.interfaces = nil
+		case blockTypeInterfaceDesc:
+			iface, err := parseInterfaceDescription(r.order, body)
+			if err != nil {
+				r.err = err
+				return false
+			}
+			r.interfaces = append(r.interfaces, iface)
+		case blockTypePacket:
+			pkt, err := r.parseEnhancedPacket(body)
+			if err != nil {
+				r.err = err
+				return false
+			}
+			r.pkt = pkt
+			return true
+		default:
+			// Uninteresting block type (e.g. an Interface Statistics
+			// Block); nothing to do but move on to the next one.
+		}
+	}
+}
+
+// readBlock reads one PCAPng block, returning its type and body (the
+// bytes between the leading and trailing Block Total Length fields).
+func (r *NgReader) readBlock() (uint32, []byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	blockType := r.order.Uint32(hdr[0:4])
+	totalLen := r.order.Uint32(hdr[4:8])
+	if totalLen < 12 {
+		return 0, nil, fmt.Errorf("pcapng block has impossible length %d", totalLen)
+	}
+
+	body := make([]byte, totalLen-12)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return 0, nil, err
+	}
+	var trailer [4]byte
+	if _, err := io.ReadFull(r.r, trailer[:]); err != nil {
+		return 0, nil, err
+	}
+	if r.order.Uint32(trailer[:]) != totalLen {
+		return 0, nil, errors.New("pcapng block's leading and trailing lengths disagree")
+	}
+	return blockType, body, nil
+}
+
+func parseInterfaceDescription(order binary.ByteOrder, body []byte) (ngInterface, error) {
+	if len(body) < 8 {
+		return ngInterface{}, errors.New("truncated pcapng interface description block")
+	}
+	iface := ngInterface{
+		linkType:      LinkType(order.Uint16(body[0:2])),
+		tsUnitsPerSec: defaultTSUnitsPerSec,
+	}
+
+	off := 8
+	for off+4 <= len(body) {
+		code := order.Uint16(body[off:])
+		length := int(order.Uint16(body[off+2:]))
+		off += 4
+		if code == optionEndOfOpt {
+			break
+		}
+		if off+length > len(body) {
+			return ngInterface{}, errors.New("truncated pcapng option in interface description block")
+		}
+		if code == optionIfTSResol && length >= 1 {
+			iface.tsUnitsPerSec = tsUnitsPerSecFromResol(body[off])
+		}
+		off += align32(length)
+	}
+	return iface, nil
+}
+
+// tsUnitsPerSecFromResol decodes an if_tsresol option byte: the high
+// bit set means a power of 2, otherwise a (negative) power of 10, per
+// the PCAPng spec.
+func tsUnitsPerSecFromResol(b byte) uint64 {
+	if b&0x80 != 0 {
+		return uint64(1) << (b &^ 0x80)
+	}
+	units := uint64(1)
+	for i := byte(0); i < b; i++ {
+		units *= 10
+	}
+	return units
+}
+
+func (r *NgReader) parseEnhancedPacket(body []byte) (*NgPacket, error) {
+	if len(body) < 20 {
+		return nil, errors.New("truncated pcapng enhanced packet block")
+	}
+	ifIdx := int(r.order.Uint32(body[0:4]))
+	if ifIdx < 0 || ifIdx >= len(r.interfaces) {
+		return nil, fmt.Errorf("enhanced packet block references unknown interface %d", ifIdx)
+	}
+	iface := r.interfaces[ifIdx]
+
+	ts := uint64(r.order.Uint32(body[4:8]))<<32 | uint64(r.order.Uint32(body[8:12]))
+	capturedLen := r.order.Uint32(body[12:16])
+	origLen := r.order.Uint32(body[16:20])
+
+	off := 20
+	if off+int(capturedLen) > len(body) {
+		return nil, errors.New("truncated pcapng enhanced packet data")
+	}
+	data := append([]byte(nil), body[off:off+int(capturedLen)]...)
+	off += align32(int(capturedLen))
+
+	pkt := &NgPacket{
+		Interface: ifIdx,
+		Packet: &Packet{
+			Timestamp: ticksToTime(ts, iface.tsUnitsPerSec),
+			Length:    int(origLen),
+			Bytes:     data,
+		},
+	}
+
+	for off+4 <= len(body) {
+		code := r.order.Uint16(body[off:])
+		length := int(r.order.Uint16(body[off+2:]))
+		off += 4
+		if code == optionEndOfOpt {
+			break
+		}
+		if off+length > len(body) {
+			return nil, errors.New("truncated pcapng option in enhanced packet block")
+		}
+		value := body[off : off+length]
+		switch code {
+		case optionEpbDropCount:
+			if length >= 8 {
+				pkt.Dropped = r.order.Uint64(value)
+			}
+		case optionComment:
+			pkt.Comment = string(value)
+		}
+		off += align32(length)
+	}
+
+	return pkt, nil
+}
+
+// ticksToTime converts a PCAPng packet timestamp (a 64-bit tick count
+// since the Unix epoch) to a time.Time, given the interface's ticks
+// per second.
+func ticksToTime(ticks, unitsPerSec uint64) time.Time {
+	if unitsPerSec == 0 {
+		unitsPerSec = defaultTSUnitsPerSec
+	}
+	sec := int64(ticks / unitsPerSec)
+	rem := ticks % unitsPerSec
+	var nsec int64
+	if unitsPerSec <= 1e9 {
+		nsec = int64(rem * (1e9 / unitsPerSec))
+	} else {
+		nsec = int64(rem / (unitsPerSec / 1e9))
+	}
+	return time.Unix(sec, nsec)
+}
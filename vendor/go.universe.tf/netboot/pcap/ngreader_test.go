@@ -0,0 +1,109 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestNgReadback(t *testing.T) {
+	ifaces := []Interface{
+		{LinkType: LinkEthernet, SnapLen: 65535, Name: "tap0"},
+		{LinkType: LinkEthernet, SnapLen: 65535, Name: "tap1"},
+	}
+
+	in := []*NgPacket{
+		{Interface: 0, Packet: &Packet{Timestamp: time.Unix(1000, 123456789), Length: 4, Bytes: []byte{1, 2, 3, 4}}},
+		{Interface: 1, Packet: &Packet{Timestamp: time.Unix(2000, 1000), Length: 2, Bytes: []byte{5, 6}}, Dropped: 3},
+		{Interface: 0, Packet: &Packet{Timestamp: time.Unix(3000, 0), Length: 6, Bytes: []byte{1, 2, 3, 4, 5, 6}}, Comment: "hello"},
+	}
+
+	var b bytes.Buffer
+	w := NewNgWriter(&b, ifaces)
+	for _, pkt := range in {
+		if err := w.Put(pkt); err != nil {
+			t.Fatalf("Put: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	r, err := NewNgReader(&b)
+	if err != nil {
+		t.Fatalf("NewNgReader: %s", err)
+	}
+
+	var out []*NgPacket
+	for r.Next() {
+		out = append(out, r.Packet())
+	}
+	if r.Err() != nil {
+		t.Fatalf("reading packets back: %s", r.Err())
+	}
+
+	if len(out) != len(in) {
+		t.Fatalf("got %d packets back, want %d", len(out), len(in))
+	}
+	for i, want := range in {
+		got := out[i]
+		if got.Interface != want.Interface {
+			t.Errorf("packet %d: interface = %d, want %d", i, got.Interface, want.Interface)
+		}
+		if !got.Packet.Timestamp.Equal(want.Packet.Timestamp) {
+			t.Errorf("packet %d: timestamp = %s, want %s", i, got.Packet.Timestamp, want.Packet.Timestamp)
+		}
+		if !bytes.Equal(got.Packet.Bytes, want.Packet.Bytes) {
+			t.Errorf("packet %d: bytes = %v, want %v", i, got.Packet.Bytes, want.Packet.Bytes)
+		}
+		if got.Packet.Length != want.Packet.Length {
+			t.Errorf("packet %d: length = %d, want %d", i, got.Packet.Length, want.Packet.Length)
+		}
+		if got.Dropped != want.Dropped {
+			t.Errorf("packet %d: dropped = %d, want %d", i, got.Dropped, want.Dropped)
+		}
+		if got.Comment != want.Comment {
+			t.Errorf("packet %d: comment = %q, want %q", i, got.Comment, want.Comment)
+		}
+	}
+}
+
+func TestNewWriterReadback(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, LinkEthernet)
+	if err != nil {
+		t.Fatalf("NewWriter: %s", err)
+	}
+	pkt := &Packet{Timestamp: time.Unix(42, 0), Length: 3, Bytes: []byte{9, 9, 9}}
+	if err := w.Put(pkt); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	r, err := NewReader(&b)
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	if r.LinkType != LinkEthernet {
+		t.Fatalf("LinkType = %d, want %d", r.LinkType, LinkEthernet)
+	}
+	if !r.Next() {
+		t.Fatalf("Next: %s", r.Err())
+	}
+	if !bytes.Equal(r.Packet().Bytes, pkt.Bytes) {
+		t.Fatalf("read back %v, want %v", r.Packet().Bytes, pkt.Bytes)
+	}
+}
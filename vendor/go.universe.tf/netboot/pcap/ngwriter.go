@@ -0,0 +1,226 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Block types defined by the PCAPng spec that NgWriter emits.
+const (
+	blockTypeSectionHeader  uint32 = 0x0A0D0D0A
+	blockTypeInterfaceDesc  uint32 = 0x00000001
+	blockTypePacket         uint32 = 0x00000006
+	blockTypeInterfaceStats uint32 = 0x00000005
+	byteOrderMagic          uint32 = 0x1A2B3C4D
+
+	optionEndOfOpt      uint16 = 0
+	optionComment       uint16 = 1
+	optionIfName        uint16 = 2
+	optionIfDescription uint16 = 3
+	optionEpbFlags      uint16 = 2
+	optionEpbDropCount  uint16 = 4
+	optionIfTSResol     uint16 = 9
+	optionIfHardware    uint16 = 15
+
+	tsResolNanoseconds uint8 = 9
+)
+
+// Interface describes one capture interface registered with an NgWriter. The
+// zero value captures Ethernet frames with a 64KB snapshot length.
+type Interface struct {
+	LinkType    LinkType
+	SnapLen     uint32
+	Name        string
+	Description string
+	Hardware    string
+}
+
+// NgPacket is a single packet destined for a particular interface in an
+// NgWriter, along with the optional per-packet metadata PCAPng supports.
+type NgPacket struct {
+	// Interface is the index into the slice of Interfaces passed to
+	// NewNgWriter that captured this packet.
+	Interface int
+	Packet    *Packet
+
+	// Dropped is the number of packets known to have been dropped by
+	// the capture just before this one, if any. 0 means "not reported".
+	Dropped uint64
+	// Comment is an optional free-form annotation for this packet.
+	Comment string
+}
+
+// NgWriter serializes Packets to an io.Writer using the PCAPng block
+// structure, which (unlike the classic libpcap format Writer emits) can
+// multiplex packets captured from several interfaces into one file with
+// nanosecond timestamp resolution.
+type NgWriter struct {
+	w          io.Writer
+	order      binary.ByteOrder
+	interfaces []Interface
+
+	headerWritten bool
+	packetCounts  []uint64
+}
+
+// NewNgWriter returns an NgWriter that emits a Section Header Block followed
+// by one Interface Description Block per entry of ifaces. Packets passed to
+// Put must reference one of these interfaces by index.
+func NewNgWriter(w io.Writer, ifaces []Interface) *NgWriter {
+	return &NgWriter{
+		w:            w,
+		order:        binary.LittleEndian,
+		interfaces:   ifaces,
+		packetCounts: make([]uint64, len(ifaces)),
+	}
+}
+
+// align32 rounds n up to the next multiple of 4, as required for option and
+// packet data padding within PCAPng blocks.
+func align32(n int) int {
+	return (n + 3) &^ 3
+}
+
+func writeOption(buf *bytes.Buffer, order binary.ByteOrder, code uint16, value []byte) {
+	binary.Write(buf, order, code)
+	binary.Write(buf, order, uint16(len(value)))
+	buf.Write(value)
+	if pad := align32(len(value)) - len(value); pad > 0 {
+		buf.Write(make([]byte, pad))
+	}
+}
+
+// writeBlock wraps body with the leading/trailing Block Total Length fields
+// every PCAPng block requires and writes it to w.w.
+func (w *NgWriter) writeBlock(blockType uint32, body []byte) error {
+	totalLen := uint32(12 + len(body))
+	var buf bytes.Buffer
+	binary.Write(&buf, w.order, blockType)
+	binary.Write(&buf, w.order, totalLen)
+	buf.Write(body)
+	binary.Write(&buf, w.order, totalLen)
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+func (w *NgWriter) writeSectionHeader() error {
+	var body bytes.Buffer
+	binary.Write(&body, w.order, byteOrderMagic)
+	binary.Write(&body, w.order, uint16(1)) // major
+	binary.Write(&body, w.order, uint16(0)) // minor
+	binary.Write(&body, w.order, int64(-1)) // section length unknown
+	if err := w.writeBlock(blockTypeSectionHeader, body.Bytes()); err != nil {
+		return err
+	}
+	for _, iface := range w.interfaces {
+		if err := w.writeInterfaceDescription(iface); err != nil {
+			return err
+		}
+	}
+	w.headerWritten = true
+	return nil
+}
+
+func (w *NgWriter) writeInterfaceDescription(iface Interface) error {
+	var body bytes.Buffer
+	binary.Write(&body, w.order, uint16(iface.LinkType))
+	binary.Write(&body, w.order, uint16(0)) // reserved
+	binary.Write(&body, w.order, iface.SnapLen)
+
+	if iface.Name != "" {
+		writeOption(&body, w.order, optionIfName, []byte(iface.Name))
+	}
+	if iface.Description != "" {
+		writeOption(&body, w.order, optionIfDescription, []byte(iface.Description))
+	}
+	if iface.Hardware != "" {
+		writeOption(&body, w.order, optionIfHardware, []byte(iface.Hardware))
+	}
+	writeOption(&body, w.order, optionIfTSResol, []byte{tsResolNanoseconds})
+	binary.Write(&body, w.order, optionEndOfOpt)
+	binary.Write(&body, w.order, uint16(0))
+
+	return w.writeBlock(blockTypeInterfaceDesc, body.Bytes())
+}
+
+// Put serializes pkt as an Enhanced Packet Block, tagged with the interface
+// it was captured on.
+func (w *NgWriter) Put(pkt *NgPacket) error {
+	if pkt.Interface < 0 || pkt.Interface >= len(w.interfaces) {
+		return errBadInterface
+	}
+	if !w.headerWritten {
+		if err := w.writeSectionHeader(); err != nil {
+			return err
+		}
+	}
+
+	ts := uint64(pkt.Packet.Timestamp.UnixNano())
+	data := pkt.Packet.Bytes
+
+	var body bytes.Buffer
+	binary.Write(&body, w.order, uint32(pkt.Interface))
+	binary.Write(&body, w.order, uint32(ts>>32))
+	binary.Write(&body, w.order, uint32(ts))
+	binary.Write(&body, w.order, uint32(len(data)))
+	binary.Write(&body, w.order, uint32(pkt.Packet.Length))
+	body.Write(data)
+	if pad := align32(len(data)) - len(data); pad > 0 {
+		body.Write(make([]byte, pad))
+	}
+
+	if pkt.Dropped > 0 {
+		var db [8]byte
+		w.order.PutUint64(db[:], pkt.Dropped)
+		writeOption(&body, w.order, optionEpbDropCount, db[:])
+	}
+	if pkt.Comment != "" {
+		writeOption(&body, w.order, optionComment, []byte(pkt.Comment))
+	}
+	if pkt.Dropped > 0 || pkt.Comment != "" {
+		binary.Write(&body, w.order, optionEndOfOpt)
+		binary.Write(&body, w.order, uint16(0))
+	}
+
+	if err := w.writeBlock(blockTypePacket, body.Bytes()); err != nil {
+		return err
+	}
+	w.packetCounts[pkt.Interface]++
+	return nil
+}
+
+// Close emits an Interface Statistics Block for every registered interface,
+// recording how many packets were written to it.
+func (w *NgWriter) Close() error {
+	for i := range w.interfaces {
+		var body bytes.Buffer
+		binary.Write(&body, w.order, uint32(i))
+		binary.Write(&body, w.order, uint32(0)) // timestamp high
+		binary.Write(&body, w.order, uint32(0)) // timestamp low
+		if err := w.writeBlock(blockTypeInterfaceStats, body.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errBadInterface = &ngError{"packet references unregistered interface"}
+
+type ngError struct{ msg string }
+
+func (e *ngError) Error() string { return e.msg }
@@ -0,0 +1,71 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestNgWriterBlockFraming(t *testing.T) {
+	ifaces := []Interface{
+		{LinkType: LinkEthernet, SnapLen: 65535, Name: "tap0"},
+		{LinkType: LinkEthernet, SnapLen: 65535, Name: "tap1"},
+	}
+
+	var b bytes.Buffer
+	w := NewNgWriter(&b, ifaces)
+
+	if err := w.Put(&NgPacket{Interface: 0, Packet: &Packet{Timestamp: time.Now(), Length: 4, Bytes: []byte{1, 2, 3, 4}}}); err != nil {
+		t.Fatalf("Put on interface 0: %s", err)
+	}
+	if err := w.Put(&NgPacket{Interface: 1, Packet: &Packet{Timestamp: time.Now(), Length: 2, Bytes: []byte{5, 6}}, Dropped: 3}); err != nil {
+		t.Fatalf("Put on interface 1: %s", err)
+	}
+	if err := w.Put(&NgPacket{Interface: 5, Packet: &Packet{Timestamp: time.Now(), Bytes: []byte{1}}}); err == nil {
+		t.Fatalf("Put with out-of-range interface index should have failed")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	data := b.Bytes()
+	order := binary.LittleEndian
+
+	// Every PCAPng block starts and ends with a matching Total Length field.
+	for off := 0; off < len(data); {
+		if off+12 > len(data) {
+			t.Fatalf("truncated block header at offset %d", off)
+		}
+		blockType := order.Uint32(data[off:])
+		length := order.Uint32(data[off+4:])
+		if length < 12 || int(off)+int(length) > len(data) {
+			t.Fatalf("block at offset %d has invalid length %d", off, length)
+		}
+		trailer := order.Uint32(data[off+int(length)-4:])
+		if trailer != length {
+			t.Fatalf("block at offset %d: leading length %d != trailing length %d", off, length, trailer)
+		}
+		if blockType == blockTypeSectionHeader {
+			magic := order.Uint32(data[off+8:])
+			if magic != byteOrderMagic {
+				t.Fatalf("section header has wrong byte-order magic: %#x", magic)
+			}
+		}
+		off += int(length)
+	}
+}
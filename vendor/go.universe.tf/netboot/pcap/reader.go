@@ -42,6 +42,8 @@ type Reader struct {
 	order binary.ByteOrder
 	tmult int64
 
+	filter []rawInstruction
+
 	pkt *Packet
 	err error
 }
@@ -131,28 +133,34 @@ func (r *Reader) Err() error {
 // error that occured while reading, except that if it was io.EOF, Err
 // will return nil.
 func (r *Reader) Next() bool {
-	hdr := struct {
-		Sec     uint32
-		SubSec  uint32
-		Len     uint32
-		OrigLen uint32
-	}{}
+	for {
+		hdr := struct {
+			Sec     uint32
+			SubSec  uint32
+			Len     uint32
+			OrigLen uint32
+		}{}
+
+		if err := binary.Read(r.r, r.order, &hdr); err != nil {
+			r.err = err
+			return false
+		}
 
-	if err := binary.Read(r.r, r.order, &hdr); err != nil {
-		r.err = err
-		return false
-	}
+		bs := make([]byte, hdr.Len)
+		if _, err := io.ReadFull(r.r, bs); err != nil {
+			r.err = err
+			return false
+		}
 
-	bs := make([]byte, hdr.Len)
-	if _, err := io.ReadFull(r.r, bs); err != nil {
-		r.err = err
-		return false
-	}
+		if r.filter != nil && !evalFilter(r.filter, bs) {
+			continue
+		}
 
-	r.pkt = &Packet{
-		Timestamp: time.Unix(int64(hdr.Sec), r.tmult*int64(hdr.SubSec)),
-		Length:    int(hdr.OrigLen),
-		Bytes:     bs,
+		r.pkt = &Packet{
+			Timestamp: time.Unix(int64(hdr.Sec), r.tmult*int64(hdr.SubSec)),
+			Length:    int(hdr.OrigLen),
+			Bytes:     bs,
+		}
+		return true
 	}
-	return true
 }
@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"io"
+	"sync"
+)
+
+// RingBuffer keeps only the most recent maxBytes worth of packets in
+// memory, and only pays for I/O when Flush is called. It's meant for
+// postmortem captures triggered around a crash, where continuous writing
+// to disk would be wasteful.
+type RingBuffer struct {
+	maxBytes int
+	mu       sync.Mutex
+	pkts     []*Packet
+	size     int
+}
+
+// NewRingBuffer creates a RingBuffer that retains at most maxBytes of
+// packet payloads.
+func NewRingBuffer(maxBytes int) *RingBuffer {
+	return &RingBuffer{maxBytes: maxBytes}
+}
+
+// Put appends pkt to the ring, evicting the oldest packets if needed to
+// stay within maxBytes.
+func (r *RingBuffer) Put(pkt *Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pkts = append(r.pkts, pkt)
+	r.size += len(pkt.Bytes)
+	for r.size > r.maxBytes && len(r.pkts) > 0 {
+		r.size -= len(r.pkts[0].Bytes)
+		r.pkts = r.pkts[1:]
+	}
+	return nil
+}
+
+// Flush writes every packet currently held by the ring, oldest first, to w
+// using the legacy libpcap format. It does not clear the ring: a capture
+// can keep running after a postmortem dump.
+func (r *RingBuffer) Flush(w io.Writer, linkType LinkType, snapLen uint32) error {
+	r.mu.Lock()
+	pkts := make([]*Packet, len(r.pkts))
+	copy(pkts, r.pkts)
+	r.mu.Unlock()
+
+	pw := &Writer{Writer: w, LinkType: linkType, SnapLen: snapLen}
+	for _, pkt := range pkts {
+		if err := pw.Put(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pcap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterRotatesOnSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pcap-rotate")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rw, err := NewRotatingWriter(filepath.Join(dir, "capture-%ts%.pcap"), LinkEthernet, 65535, 40, 0, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter: %s", err)
+	}
+	defer rw.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := rw.Put(&Packet{Timestamp: time.Now(), Length: 20, Bytes: make([]byte, 20)}); err != nil {
+			t.Fatalf("Put: %s", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("expected Put to have triggered at least one rotation, got %d segment(s)", len(entries))
+	}
+}
+
+func TestRingBufferEvictsOldest(t *testing.T) {
+	rb := NewRingBuffer(30)
+	for i := 0; i < 5; i++ {
+		rb.Put(&Packet{Timestamp: time.Now(), Bytes: make([]byte, 10)})
+	}
+	if rb.size > 30 {
+		t.Fatalf("ring buffer grew past its cap: %d bytes", rb.size)
+	}
+	if len(rb.pkts) != 3 {
+		t.Fatalf("expected 3 packets retained (30/10), got %d", len(rb.pkts))
+	}
+}
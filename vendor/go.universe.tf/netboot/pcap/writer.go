@@ -29,6 +29,18 @@ type Writer struct {
 	headerWritten bool
 }
 
+// DefaultSnapLen is the snapshot length NewWriter uses, matching what
+// tcpdump writes by default.
+const DefaultSnapLen = 65535
+
+// NewWriter returns a Writer that serializes packets of the given
+// linkType to w, with the default snapshot length and byte order.
+// Callers who need to customize SnapLen or ByteOrder can still build a
+// Writer directly with a struct literal.
+func NewWriter(w io.Writer, linkType LinkType) (*Writer, error) {
+	return &Writer{Writer: w, LinkType: linkType, SnapLen: DefaultSnapLen}, nil
+}
+
 func (w *Writer) order() binary.ByteOrder {
 	if w.ByteOrder != nil {
 		return w.ByteOrder
@@ -0,0 +1,274 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how an apibooter backed by more than one API
+// endpoint retries a failed request and fails over between endpoints.
+//
+// The zero value is not usable directly; DefaultRetryPolicy fills in
+// any field left at zero, so callers can set only the fields they care
+// about.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of HTTP requests a single
+	// BootSpec or MachineVars call will make, across all endpoints
+	// combined, before giving up.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry. Each
+	// subsequent retry doubles the previous delay, capped at
+	// MaxDelay, before a random +/-50% jitter is applied.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// CircuitBreakerThreshold is the number of consecutive failures
+	// against one endpoint that opens its circuit: the endpoint is
+	// skipped entirely until CircuitBreakerCooldown has passed.
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+	// HealthCheckInterval, if non-zero, starts a background goroutine
+	// that HEADs every endpoint on this interval, so a dead endpoint's
+	// circuit opens (and a recovered endpoint's circuit closes) even
+	// when no boot traffic is flowing to reveal that passively. Zero
+	// disables the background loop; endpoint health is still tracked
+	// from the outcome of real requests.
+	HealthCheckInterval time.Duration
+}
+
+// DefaultRetryPolicy is used for any field left at zero in a
+// RetryPolicy passed to NewAPIBooter, and in full by APIBooter.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:             4,
+	BaseDelay:               100 * time.Millisecond,
+	MaxDelay:                2 * time.Second,
+	CircuitBreakerThreshold: 3,
+	CircuitBreakerCooldown:  30 * time.Second,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy
+	if p.MaxAttempts > 0 {
+		d.MaxAttempts = p.MaxAttempts
+	}
+	if p.BaseDelay > 0 {
+		d.BaseDelay = p.BaseDelay
+	}
+	if p.MaxDelay > 0 {
+		d.MaxDelay = p.MaxDelay
+	}
+	if p.CircuitBreakerThreshold > 0 {
+		d.CircuitBreakerThreshold = p.CircuitBreakerThreshold
+	}
+	if p.CircuitBreakerCooldown > 0 {
+		d.CircuitBreakerCooldown = p.CircuitBreakerCooldown
+	}
+	if p.HealthCheckInterval > 0 {
+		d.HealthCheckInterval = p.HealthCheckInterval
+	}
+	return d
+}
+
+// backoffDelay returns how long to sleep before retry number attempt
+// (1-indexed: the sleep before the first retry, i.e. after the first
+// failed attempt, is backoffDelay(p, 1)).
+func backoffDelay(p RetryPolicy, attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// +/-50% jitter, so a thundering herd of clients retrying the same
+	// dead endpoint don't all wake up and retry in lockstep.
+	jitter := time.Duration(rand.Int63n(int64(d))) - d/2
+	d += jitter
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// APIUnavailableError is returned by apibooter.BootSpec and
+// apibooter.MachineVars when every configured endpoint is either
+// circuit-open or failed on its last retry. handleIpxe translates it
+// into a 503 with a Retry-After header, so iPXE's chain-loading retry
+// loop tries again later instead of falling through to a local shell.
+type APIUnavailableError struct {
+	// RetryAfter is how long the caller should wait before trying
+	// again; it's the retry policy's circuit breaker cooldown, since
+	// that's the soonest an endpoint can plausibly have recovered.
+	RetryAfter time.Duration
+	// Err is the most recent error observed from an endpoint, for
+	// logging; it may be nil if every endpoint's circuit was already
+	// open with no request attempted.
+	Err error
+}
+
+func (e *APIUnavailableError) Error() string {
+	return fmt.Sprintf("no API endpoint available, retry after %s: %s", e.RetryAfter, e.Err)
+}
+
+func (e *APIUnavailableError) Unwrap() error { return e.Err }
+
+// endpointState is one API endpoint's address and circuit-breaker
+// bookkeeping. Every field but urlPrefix is guarded by the owning
+// apibooter's mu.
+type endpointState struct {
+	urlPrefix string
+
+	consecutiveFailures int
+	openUntil           time.Time // zero value means the circuit is closed
+}
+
+func (e *endpointState) open(now time.Time) bool {
+	return now.Before(e.openUntil)
+}
+
+// pickEndpoint returns the most-preferred endpoint whose circuit is
+// currently closed, in b.endpoints order.
+func (b *apibooter) pickEndpoint() (*endpointState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for _, ep := range b.endpoints {
+		if !ep.open(now) {
+			return ep, true
+		}
+	}
+	return nil, false
+}
+
+// recordSuccess closes ep's circuit and promotes it to the front of
+// b.endpoints, so subsequent requests prefer whichever endpoint most
+// recently proved itself healthy.
+func (b *apibooter) recordSuccess(ep *endpointState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ep.consecutiveFailures = 0
+	ep.openUntil = time.Time{}
+	for i, e := range b.endpoints {
+		if e != ep {
+			continue
+		}
+		if i > 0 {
+			copy(b.endpoints[1:i+1], b.endpoints[0:i])
+			b.endpoints[0] = ep
+		}
+		return
+	}
+}
+
+// recordFailure counts a failed request against ep, opening its
+// circuit once CircuitBreakerThreshold consecutive failures accrue.
+func (b *apibooter) recordFailure(ep *endpointState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ep.consecutiveFailures++
+	if ep.consecutiveFailures >= b.retry.CircuitBreakerThreshold {
+		ep.openUntil = time.Now().Add(b.retry.CircuitBreakerCooldown)
+	}
+}
+
+// do executes an idempotent GET against b.endpoints in health order,
+// retrying on transport errors and 5xx responses with exponential
+// backoff, and failing over to the next healthy endpoint each retry.
+// It returns the *http.Response (any non-5xx status, including 4xx,
+// is returned to the caller rather than retried) and the urlPrefix of
+// the endpoint that answered, so the caller can resolve
+// endpoint-relative URLs in the response body against the same
+// origin.
+func (b *apibooter) do(buildURL func(urlPrefix string) string) (*http.Response, string, error) {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		ep, ok := b.pickEndpoint()
+		if !ok {
+			return nil, "", &APIUnavailableError{RetryAfter: b.retry.CircuitBreakerCooldown, Err: lastErr}
+		}
+		reqURL := buildURL(ep.urlPrefix)
+		req, err := b.newAuthorizedRequest(http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := b.client.Do(req)
+		switch {
+		case err != nil:
+			lastErr = err
+			b.recordFailure(ep)
+		case resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("%s: %s", reqURL, resp.Status)
+			resp.Body.Close()
+			b.recordFailure(ep)
+		default:
+			b.recordSuccess(ep)
+			return resp, ep.urlPrefix, nil
+		}
+		if attempt >= b.retry.MaxAttempts {
+			return nil, "", &APIUnavailableError{RetryAfter: b.retry.CircuitBreakerCooldown, Err: lastErr}
+		}
+		time.Sleep(backoffDelay(b.retry, attempt))
+	}
+}
+
+// healthCheckLoop HEADs every endpoint on b.retry.HealthCheckInterval,
+// so endpoint health (and thus preferred-endpoint ordering) stays
+// current even during a lull in boot traffic. It exits when b.done is
+// closed.
+func (b *apibooter) healthCheckLoop() {
+	t := time.NewTicker(b.retry.HealthCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-t.C:
+			b.probeAll()
+		}
+	}
+}
+
+func (b *apibooter) probeAll() {
+	b.mu.Lock()
+	endpoints := append([]*endpointState(nil), b.endpoints...)
+	b.mu.Unlock()
+	for _, ep := range endpoints {
+		req, err := b.newAuthorizedRequest(http.MethodHead, ep.urlPrefix, nil)
+		if err != nil {
+			continue
+		}
+		resp, err := b.client.Do(req)
+		if err != nil {
+			b.recordFailure(ep)
+			continue
+		}
+		resp.Body.Close()
+		b.recordSuccess(ep)
+	}
+}
+
+// Close stops the background health-check loop started by
+// NewAPIBooter when RetryPolicy.HealthCheckInterval is non-zero. It is
+// not part of the Booter interface; callers that enabled the
+// background loop should call Close during shutdown to avoid leaking
+// the goroutine. Close is a no-op if the loop was never started, and
+// safe to call more than once.
+func (b *apibooter) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	return nil
+}
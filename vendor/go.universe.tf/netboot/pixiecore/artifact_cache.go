@@ -0,0 +1,288 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArtifactCache fronts the HTTP fetches that staticBooter.serveFile and
+// apibooter.ReadBootFile would otherwise make on every single boot
+// request. Without one, a rack of N machines netbooting at the same
+// time turns into N near-simultaneous fetches of the same kernel or
+// initrd against whatever's serving it.
+//
+// This is deliberately a much simpler abstraction than CachedBooter:
+// CachedBooter understands distro/version/arch quick-recipes and their
+// published checksums, and wraps a whole Booter. An ArtifactCache knows
+// nothing about Specs; it just caches the bytes behind a URL.
+type ArtifactCache interface {
+	// Fetch returns the contents of sourceURL, and the number of bytes
+	// in it (or -1 if unknown). key identifies the artifact in the
+	// cache. Most callers can just pass sourceURL as key too, but
+	// callers whose "URL" is actually a one-time signed token (e.g.
+	// apibooter's IDs) should derive a stable key from whatever the
+	// token signs instead, so that repeated requests for the same
+	// underlying artifact still land on the same cache entry.
+	//
+	// Concurrent Fetch calls for the same key share a single upstream
+	// fetch: only the first caller actually hits sourceURL, and the
+	// rest block until that fetch lands, then read the result it
+	// populated.
+	Fetch(key, sourceURL string) (io.ReadCloser, int64, error)
+}
+
+// DiskCache is an ArtifactCache backed by a directory on local disk. It
+// evicts the least-recently-used entries once the cache exceeds
+// maxBytes, and revalidates cache hits against the source with a
+// conditional GET (If-None-Match/If-Modified-Since) before serving
+// them, so a changed upstream artifact doesn't serve stale bytes
+// forever.
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+	client   *http.Client
+
+	mu       sync.Mutex
+	inflight map[string]*cacheFetch
+}
+
+// cacheFetch tracks a single in-progress populate() call, so that
+// concurrent Fetch calls for the same key can wait on it instead of
+// each starting their own.
+type cacheFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// cacheMeta is the JSON sidecar stored next to each cached artifact,
+// used to revalidate it on the next Fetch and to pick eviction order.
+type cacheMeta struct {
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	Size         int64     `json:"size"`
+	AccessedAt   time.Time `json:"accessed_at"`
+}
+
+// NewDiskCache returns a DiskCache backed by dir, which is created if
+// it doesn't already exist. The cache holds at most maxBytes of
+// artifacts; a maxBytes of 0 disables eviction.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating cache dir %q: %s", dir, err)
+	}
+	return &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		client:   &http.Client{},
+		inflight: make(map[string]*cacheFetch),
+	}, nil
+}
+
+func (c *DiskCache) paths(key string) (data, meta string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name), filepath.Join(c.dir, name+".meta")
+}
+
+// Fetch implements ArtifactCache.
+func (c *DiskCache) Fetch(key, sourceURL string) (io.ReadCloser, int64, error) {
+	dataPath, metaPath := c.paths(key)
+
+	c.mu.Lock()
+	f, inFlight := c.inflight[key]
+	if !inFlight {
+		f = &cacheFetch{done: make(chan struct{})}
+		c.inflight[key] = f
+	}
+	c.mu.Unlock()
+
+	if inFlight {
+		<-f.done
+		if f.err != nil {
+			return nil, -1, f.err
+		}
+	} else {
+		f.err = c.populate(sourceURL, dataPath, metaPath)
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(f.done)
+		if f.err != nil {
+			return nil, -1, f.err
+		}
+		c.evict()
+	}
+
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return nil, -1, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, -1, err
+	}
+	c.touch(metaPath)
+	return file, fi.Size(), nil
+}
+
+// populate makes sure dataPath/metaPath hold a fresh copy of
+// sourceURL, fetching it if there's no cached copy yet, or
+// revalidating the cached copy's ETag/Last-Modified otherwise.
+func (c *DiskCache) populate(sourceURL, dataPath, metaPath string) error {
+	req, err := http.NewRequest(http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return err
+	}
+	if meta, ok := c.readMeta(metaPath); ok {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+
+	case http.StatusOK:
+		tmp := dataPath + ".tmp"
+		out, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(out, resp.Body)
+		out.Close()
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, dataPath); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return c.writeMeta(metaPath, cacheMeta{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         n,
+			AccessedAt:   time.Now(),
+		})
+
+	default:
+		return fmt.Errorf("GET %s: %s", sourceURL, resp.Status)
+	}
+}
+
+func (c *DiskCache) readMeta(metaPath string) (cacheMeta, bool) {
+	bs, err := os.ReadFile(metaPath)
+	if err != nil {
+		return cacheMeta{}, false
+	}
+	var m cacheMeta
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return cacheMeta{}, false
+	}
+	return m, true
+}
+
+func (c *DiskCache) writeMeta(metaPath string, m cacheMeta) error {
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, bs, 0644)
+}
+
+// touch bumps metaPath's AccessedAt, so evict() doesn't treat a
+// frequently-read entry as cold.
+func (c *DiskCache) touch(metaPath string) {
+	m, ok := c.readMeta(metaPath)
+	if !ok {
+		return
+	}
+	m.AccessedAt = time.Now()
+	c.writeMeta(metaPath, m)
+}
+
+// evict deletes the least-recently-used cache entries until the cache
+// is back under c.maxBytes.
+func (c *DiskCache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type item struct {
+		dataPath, metaPath string
+		size               int64
+		accessedAt         time.Time
+	}
+	var items []item
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".meta") {
+			continue
+		}
+		metaPath := filepath.Join(c.dir, e.Name())
+		meta, ok := c.readMeta(metaPath)
+		if !ok {
+			continue
+		}
+		items = append(items, item{
+			dataPath:   strings.TrimSuffix(metaPath, ".meta"),
+			metaPath:   metaPath,
+			size:       meta.Size,
+			accessedAt: meta.AccessedAt,
+		})
+		total += meta.Size
+	}
+	if total <= c.maxBytes {
+		return
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].accessedAt.Before(items[j].accessedAt) })
+	for _, it := range items {
+		if total <= c.maxBytes {
+			break
+		}
+		os.Remove(it.dataPath)
+		os.Remove(it.metaPath)
+		total -= it.size
+	}
+}
@@ -2,12 +2,15 @@ package pixiecore
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
+
+	"go.universe.tf/netboot/dhcp6"
 )
 
 const x86HTTPClient = 0x10
@@ -17,6 +20,7 @@ type StaticBootConfiguration struct {
 	HTTPBootURL   []byte
 	IPxeBootURL   []byte
 	RecursiveDNS  []net.IP
+	EncryptedDNS  []dhcp6.EncryptedResolver
 	Preference    []byte
 	UsePreference bool
 }
@@ -51,25 +55,55 @@ func (bc *StaticBootConfiguration) GetRecursiveDNS() []net.IP {
 	return bc.RecursiveDNS
 }
 
+// WithEncryptedDNS sets the authenticated, transport-encrypted resolvers to
+// advertise alongside the legacy RecursiveDNS option, see RFC 9463.
+func (bc *StaticBootConfiguration) WithEncryptedDNS(resolvers []dhcp6.EncryptedResolver) *StaticBootConfiguration {
+	bc.EncryptedDNS = resolvers
+	return bc
+}
+
+// GetEncryptedDNS returns the authenticated, transport-encrypted resolvers
+// to advertise via the Encrypted DNS Server Option, see RFC 9463.
+func (bc *StaticBootConfiguration) GetEncryptedDNS() []dhcp6.EncryptedResolver {
+	return bc.EncryptedDNS
+}
+
+// bootURLEntry is one element of the JSON array a boot API server may
+// return instead of a bare URL, letting it offer different artifacts per
+// client architecture and a preference order among equally-valid ones.
+type bootURLEntry struct {
+	URL    string `json:"url"`
+	Arch   int    `json:"arch"`
+	Weight int    `json:"weight"`
+}
+
 // APIBootConfiguration provides an interface to retrieve Boot File URL from an external server based on
 // client ID and architecture type
 type APIBootConfiguration struct {
 	Client        *http.Client
 	URLPrefix     string
 	RecursiveDNS  []net.IP
+	EncryptedDNS  []dhcp6.EncryptedResolver
 	Preference    []byte
 	UsePreference bool
+
+	// FallbackURLPrefixes are tried, in order, if URLPrefix's boot API
+	// can't be reached or returns an error.
+	FallbackURLPrefixes []string
+	// CacheTTL controls how long a successful GetBootURL result is
+	// cached; 0 means defaultBootURLCacheTTL.
+	CacheTTL time.Duration
+
+	cache      bootURLCache
+	callsGroup bootURLCallGroup
 }
 
 // MakeAPIBootConfiguration creates a new APIBootConfiguration initialized with provided values
 func MakeAPIBootConfiguration(url string, timeout time.Duration, preference uint8, usePreference bool,
 	dnsServerAddresses []net.IP) *APIBootConfiguration {
-	if !strings.HasSuffix(url, "/") {
-		url += "/"
-	}
 	ret := &APIBootConfiguration{
 		Client:        &http.Client{Timeout: timeout},
-		URLPrefix:     url + "v1",
+		URLPrefix:     normalizeAPIURLPrefix(url),
 		UsePreference: usePreference,
 	}
 	if usePreference {
@@ -81,33 +115,115 @@ func MakeAPIBootConfiguration(url string, timeout time.Duration, preference uint
 	return ret
 }
 
-// GetBootURL returns Boot File URL, see RFC 5970
+// GetBootURL returns Boot File URL, see RFC 5970. Results are cached for
+// CacheTTL and concurrent lookups for the same client are collapsed into a
+// single upstream call; if URLPrefix's boot API can't be reached, each of
+// FallbackURLPrefixes is tried in turn.
 func (bc *APIBootConfiguration) GetBootURL(id []byte, clientArchType uint16) ([]byte, error) {
-	reqURL := fmt.Sprintf("%s/boot/%x/%d", bc.URLPrefix, id, clientArchType)
+	key := fmt.Sprintf("%x/%d", id, clientArchType)
+
+	if url, ok := bc.cache.get(key); ok {
+		return url, nil
+	}
+
+	url, err := bc.callsGroup.do(key, func() ([]byte, error) {
+		return bc.fetchBootURL(id, clientArchType)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bc.cache.put(key, url, bc.CacheTTL)
+	return url, nil
+}
+
+// WithFallbackURLPrefixes sets the boot API endpoints to try, in order, if
+// URLPrefix's is unreachable or errors out.
+func (bc *APIBootConfiguration) WithFallbackURLPrefixes(prefixes []string) *APIBootConfiguration {
+	normalized := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		normalized[i] = normalizeAPIURLPrefix(p)
+	}
+	bc.FallbackURLPrefixes = normalized
+	return bc
+}
+
+// WithCacheTTL overrides the GetBootURL result cache's TTL.
+func (bc *APIBootConfiguration) WithCacheTTL(ttl time.Duration) *APIBootConfiguration {
+	bc.CacheTTL = ttl
+	return bc
+}
+
+func (bc *APIBootConfiguration) fetchBootURL(id []byte, clientArchType uint16) ([]byte, error) {
+	prefixes := append([]string{bc.URLPrefix}, bc.FallbackURLPrefixes...)
+
+	var lastErr error
+	for _, prefix := range prefixes {
+		url, err := bc.fetchBootURLFrom(prefix, id, clientArchType)
+		if err == nil {
+			return url, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (bc *APIBootConfiguration) fetchBootURLFrom(prefix string, id []byte, clientArchType uint16) ([]byte, error) {
+	reqURL := fmt.Sprintf("%s/boot/%x/%d", prefix, id, clientArchType)
 	resp, err := bc.Client.Get(reqURL)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
 		return nil, fmt.Errorf("%s: %s", reqURL, http.StatusText(resp.StatusCode))
 	}
-	defer resp.Body.Close()
 
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(resp.Body)
-	url, _ := bc.makeURLAbsolute(buf.String())
 
+	var entries []bootURLEntry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err == nil && len(entries) > 0 {
+		entry := selectBootURLEntry(entries, clientArchType)
+		url, err := bc.makeURLAbsolute(prefix, entry.URL)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(url), nil
+	}
+
+	// Not a JSON array: fall back to treating the body as a bare URL, for
+	// compatibility with older boot API servers.
+	url, err := bc.makeURLAbsolute(prefix, buf.String())
+	if err != nil {
+		return nil, err
+	}
 	return []byte(url), nil
 }
 
-func (bc *APIBootConfiguration) makeURLAbsolute(urlStr string) (string, error) {
+// selectBootURLEntry picks the entry matching clientArchType, or else the
+// highest-weight entry, so a boot API can offer arch-specific artifacts
+// with a documented fallback order.
+func selectBootURLEntry(entries []bootURLEntry, clientArchType uint16) bootURLEntry {
+	best := entries[0]
+	for _, e := range entries {
+		if e.Arch == int(clientArchType) {
+			return e
+		}
+		if e.Weight > best.Weight {
+			best = e
+		}
+	}
+	return best
+}
+
+func (bc *APIBootConfiguration) makeURLAbsolute(prefix, urlStr string) (string, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return "", fmt.Errorf("%q is not an URL", urlStr)
 	}
 	if !u.IsAbs() {
-		base, err := url.Parse(bc.URLPrefix)
+		base, err := url.Parse(prefix)
 		if err != nil {
 			return "", err
 		}
@@ -116,6 +232,13 @@ func (bc *APIBootConfiguration) makeURLAbsolute(urlStr string) (string, error) {
 	return u.String(), nil
 }
 
+func normalizeAPIURLPrefix(prefix string) string {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + "v1"
+}
+
 // GetPreference returns server's Preference, see RFC 3315
 func (bc *APIBootConfiguration) GetPreference() []byte {
 	return bc.Preference
@@ -125,3 +248,16 @@ func (bc *APIBootConfiguration) GetPreference() []byte {
 func (bc *APIBootConfiguration) GetRecursiveDNS() []net.IP {
 	return bc.RecursiveDNS
 }
+
+// WithEncryptedDNS sets the authenticated, transport-encrypted resolvers to
+// advertise alongside the legacy RecursiveDNS option, see RFC 9463.
+func (bc *APIBootConfiguration) WithEncryptedDNS(resolvers []dhcp6.EncryptedResolver) *APIBootConfiguration {
+	bc.EncryptedDNS = resolvers
+	return bc
+}
+
+// GetEncryptedDNS returns the authenticated, transport-encrypted resolvers
+// to advertise via the Encrypted DNS Server Option, see RFC 9463.
+func (bc *APIBootConfiguration) GetEncryptedDNS() []dhcp6.EncryptedResolver {
+	return bc.EncryptedDNS
+}
@@ -0,0 +1,87 @@
+package pixiecore
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultBootURLCacheTTL is used when APIBootConfiguration.CacheTTL is unset.
+const defaultBootURLCacheTTL = 30 * time.Second
+
+// bootURLCacheEntry holds one cached GetBootURL result.
+type bootURLCacheEntry struct {
+	url     []byte
+	expires time.Time
+}
+
+// bootURLCache is an in-memory TTL cache keyed by (id, clientArchType),
+// used to avoid a blocking HTTP round trip on every DHCP solicit.
+type bootURLCache struct {
+	mu      sync.Mutex
+	entries map[string]bootURLCacheEntry
+}
+
+func (c *bootURLCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.url, true
+}
+
+func (c *bootURLCache) put(key string, url []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultBootURLCacheTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]bootURLCacheEntry)
+	}
+	c.entries[key] = bootURLCacheEntry{url: url, expires: time.Now().Add(ttl)}
+}
+
+// bootURLCall tracks one in-flight fetch so concurrent callers for the same
+// key can wait on it instead of each issuing their own HTTP request.
+type bootURLCall struct {
+	wg  sync.WaitGroup
+	val []byte
+	err error
+}
+
+// bootURLCallGroup collapses concurrent GetBootURL calls for the same
+// (id, clientArchType) key into a single upstream fetch, so a solicit storm
+// from one client MAC doesn't turn into a thundering herd of identical boot
+// API requests.
+type bootURLCallGroup struct {
+	mu    sync.Mutex
+	calls map[string]*bootURLCall
+}
+
+func (g *bootURLCallGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*bootURLCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.val, call.err
+	}
+
+	call := &bootURLCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.val, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return call.val, call.err
+}
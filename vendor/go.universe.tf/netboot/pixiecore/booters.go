@@ -26,6 +26,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -33,9 +34,13 @@ import (
 // StaticBooter boots all machines with the same Spec.
 //
 // IDs in spec should be either local file paths, or HTTP/HTTPS URLs.
-func StaticBooter(spec *Spec) (Booter, error) {
+// cache, if non-nil, fronts every HTTP(S) fetch serveFile makes, so
+// that N machines booting the same Spec at once cost one upstream
+// fetch instead of N.
+func StaticBooter(spec *Spec, cache ArtifactCache) (Booter, error) {
 	ret := &staticBooter{
 		kernel: string(spec.Kernel),
+		cache:  cache,
 		spec: &Spec{
 			Kernel:  "kernel",
 			Message: spec.Message,
@@ -63,6 +68,7 @@ type staticBooter struct {
 	kernel   string
 	initrd   []string
 	otherIDs []string
+	cache    ArtifactCache
 
 	spec *Spec
 }
@@ -73,6 +79,9 @@ func (s *staticBooter) BootSpec(m Machine) (*Spec, error) {
 
 func (s *staticBooter) serveFile(path string) (io.ReadCloser, int64, error) {
 	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		if s.cache != nil {
+			return s.cache.Fetch(path, path)
+		}
 		resp, err := http.Get(path)
 		if err != nil {
 			return nil, -1, err
@@ -123,46 +132,176 @@ func (s *staticBooter) WriteBootFile(ID, io.Reader) error {
 	return nil
 }
 
-// APIBooter gets a BootSpec from a remote server over HTTP.
-//
-// The API is described in README.api.md
-func APIBooter(url string, timeout time.Duration) (Booter, error) {
-	if !strings.HasSuffix(url, "/") {
-		url += "/"
+// MachineVars always returns an empty map: StaticBooter serves one
+// Spec to every machine, so there's no per-machine state to expose to
+// the "V" template function.
+func (s *staticBooter) MachineVars(m Machine) (map[string]string, error) {
+	return nil, nil
+}
+
+// APIBooterConfig configures a resilient, possibly multi-endpoint
+// apibooter built by NewAPIBooter.
+type APIBooterConfig struct {
+	// Endpoints are base API server URLs, tried in order for every
+	// request. The background health-check loop (if Retry's
+	// HealthCheckInterval is set) and the circuit breaker in Retry
+	// reorder them to prefer whichever endpoint last answered
+	// successfully.
+	Endpoints []string
+	Timeout   time.Duration
+	Auth      AuthOptions
+	Cache     ArtifactCache
+	TLS       ClientTLSOptions
+	// Retry controls retries, backoff and failover across Endpoints.
+	// Its zero value is DefaultRetryPolicy.
+	Retry RetryPolicy
+}
+
+// NewAPIBooter builds a Booter that fetches boot instructions from one
+// of cfg.Endpoints over HTTP(S). With a single endpoint it behaves
+// like the original APIBooter; with more than one, BootSpec and
+// MachineVars retry and fail over between them per cfg.Retry, so a
+// single unreachable or flaky API server doesn't immediately fail a
+// machine's boot.
+func NewAPIBooter(cfg APIBooterConfig) (Booter, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("pixiecore: APIBooterConfig.Endpoints is empty")
+	}
+	tlsConfig, err := newHTTPTransport(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	if tlsConfig != nil {
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	tokens, err := newTokenSource(cfg.Auth, client)
+	if err != nil {
+		return nil, err
 	}
 	ret := &apibooter{
-		client:    &http.Client{Timeout: timeout},
-		urlPrefix: url + "v1",
+		client: client,
+		tokens: tokens,
+		cache:  cfg.Cache,
+		retry:  cfg.Retry.withDefaults(),
+		done:   make(chan struct{}),
 	}
 	if _, err := io.ReadFull(rand.Reader, ret.key[:]); err != nil {
 		return nil, fmt.Errorf("failed to get randomness for signing key: %s", err)
 	}
+	for _, u := range cfg.Endpoints {
+		if !strings.HasSuffix(u, "/") {
+			u += "/"
+		}
+		ret.endpoints = append(ret.endpoints, &endpointState{urlPrefix: u + "v1"})
+	}
+	if ret.retry.HealthCheckInterval > 0 {
+		go ret.healthCheckLoop()
+	}
 
 	return ret, nil
 }
 
+// APIBooter gets a BootSpec from a remote server over HTTP.
+//
+// The API is described in README.api.md. authOpts configures how
+// Pixiecore authenticates itself to that server; the zero
+// AuthOptions{} sends no Authorization header, matching APIBooter's
+// original behavior. cache, if non-nil, fronts every kernel/initrd
+// fetch ReadBootFile makes, so that N machines booting off the same
+// API response cost one upstream fetch instead of N. tlsOpts configures
+// mTLS/CA-pinning for the connection to the API server; the zero
+// ClientTLSOptions{} uses the system trust store and presents no client
+// certificate, matching APIBooter's original behavior.
+//
+// APIBooter talks to a single endpoint with DefaultRetryPolicy; use
+// NewAPIBooter directly for multiple endpoints or a custom RetryPolicy.
+func APIBooter(url string, timeout time.Duration, authOpts AuthOptions, cache ArtifactCache, tlsOpts ClientTLSOptions) (Booter, error) {
+	return NewAPIBooter(APIBooterConfig{
+		Endpoints: []string{url},
+		Timeout:   timeout,
+		Auth:      authOpts,
+		Cache:     cache,
+		TLS:       tlsOpts,
+	})
+}
+
 type apibooter struct {
-	client    *http.Client
-	urlPrefix string
-	key       [32]byte
+	client *http.Client
+	tokens tokenSource
+	cache  ArtifactCache
+	key    [32]byte
+
+	retry     RetryPolicy
+	mu        sync.Mutex
+	endpoints []*endpointState
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func (b *apibooter) getAPIResponse(hw net.HardwareAddr) (io.ReadCloser, error) {
-	reqURL := fmt.Sprintf("%s/boot/%s", b.urlPrefix, hw)
-	resp, err := b.client.Get(reqURL)
+// newAuthorizedRequest builds a request for method/url, attaching the
+// Authorization: Bearer header if authentication is configured.
+func (b *apibooter) newAuthorizedRequest(method, reqURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, reqURL, body)
 	if err != nil {
 		return nil, err
 	}
+	if b.tokens != nil {
+		tok, err := b.tokens.Token()
+		if err != nil {
+			return nil, fmt.Errorf("getting auth token for %s: %s", reqURL, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	return req, nil
+}
+
+func (b *apibooter) getAPIResponse(hw net.HardwareAddr) (io.ReadCloser, string, error) {
+	resp, urlPrefix, err := b.do(func(prefix string) string {
+		return fmt.Sprintf("%s/boot/%s", prefix, hw)
+	})
+	if err != nil {
+		return nil, "", err
+	}
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, fmt.Errorf("%s: %s", reqURL, http.StatusText(resp.StatusCode))
+		return nil, "", fmt.Errorf("%s: %s", resp.Request.URL, http.StatusText(resp.StatusCode))
 	}
 
-	return resp.Body, nil
+	return resp.Body, urlPrefix, nil
+}
+
+// apiArtifact is a "kernel" or "initrd" entry in the boot API's JSON
+// response. It accepts either a bare URL string, or an object carrying
+// a URL plus an optional digest to verify the fetched bytes against:
+//
+//	{"url": "http://example.com/vmlinuz", "sha256": "abcd..."}
+type apiArtifact struct {
+	URL            string
+	SHA256, SHA512 string
+}
+
+func (a *apiArtifact) UnmarshalJSON(data []byte) error {
+	var asString string
+	if err := json.Unmarshal(data, &asString); err == nil {
+		a.URL = asString
+		return nil
+	}
+
+	var asObject struct {
+		URL    string `json:"url"`
+		SHA256 string `json:"sha256"`
+		SHA512 string `json:"sha512"`
+	}
+	if err := json.Unmarshal(data, &asObject); err != nil {
+		return fmt.Errorf(`kernel/initrd entry must be a URL string or {"url": ..., "sha256": ...}: %s`, err)
+	}
+	a.URL, a.SHA256, a.SHA512 = asObject.URL, asObject.SHA256, asObject.SHA512
+	return nil
 }
 
 func (b *apibooter) BootSpec(m Machine) (*Spec, error) {
-	body, err := b.getAPIResponse(m.MAC)
+	body, urlPrefix, err := b.getAPIResponse(m.MAC)
 	if body != nil {
 		defer body.Close()
 	}
@@ -171,11 +310,11 @@ func (b *apibooter) BootSpec(m Machine) (*Spec, error) {
 	}
 
 	r := struct {
-		Kernel     string      `json:"kernel"`
-		Initrd     []string    `json:"initrd"`
-		Cmdline    interface{} `json:"cmdline"`
-		Message    string      `json:"message"`
-		IpxeScript string      `json:"ipxe-script"`
+		Kernel     apiArtifact   `json:"kernel"`
+		Initrd     []apiArtifact `json:"initrd"`
+		Cmdline    interface{}   `json:"cmdline"`
+		Message    string        `json:"message"`
+		IpxeScript string        `json:"ipxe-script"`
 	}{}
 	if err = json.NewDecoder(body).Decode(&r); err != nil {
 		return nil, err
@@ -187,12 +326,12 @@ func (b *apibooter) BootSpec(m Machine) (*Spec, error) {
 		}, nil
 	}
 
-	r.Kernel, err = b.makeURLAbsolute(r.Kernel)
+	r.Kernel.URL, err = b.makeURLAbsolute(urlPrefix, r.Kernel.URL)
 	if err != nil {
 		return nil, err
 	}
 	for i, img := range r.Initrd {
-		r.Initrd[i], err = b.makeURLAbsolute(img)
+		r.Initrd[i].URL, err = b.makeURLAbsolute(urlPrefix, img.URL)
 		if err != nil {
 			return nil, err
 		}
@@ -201,11 +340,19 @@ func (b *apibooter) BootSpec(m Machine) (*Spec, error) {
 	ret := Spec{
 		Message: r.Message,
 	}
-	if ret.Kernel, err = signURL(r.Kernel, &b.key); err != nil {
+	kernelURL, err := embedDigestFragment(r.Kernel.URL, r.Kernel.SHA256, r.Kernel.SHA512)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Kernel, err = signURL(kernelURL, &b.key); err != nil {
 		return nil, err
 	}
 	for _, img := range r.Initrd {
-		initrd, err := signURL(img, &b.key)
+		imgURL, err := embedDigestFragment(img.URL, img.SHA256, img.SHA512)
+		if err != nil {
+			return nil, err
+		}
+		initrd, err := signURL(imgURL, &b.key)
 		if err != nil {
 			return nil, err
 		}
@@ -227,7 +374,7 @@ func (b *apibooter) BootSpec(m Machine) (*Spec, error) {
 	}
 
 	f := func(u string) (string, error) {
-		urlStr, err := b.makeURLAbsolute(u)
+		urlStr, err := b.makeURLAbsolute(urlPrefix, u)
 		if err != nil {
 			return "", fmt.Errorf("invalid url %q for cmdline: %s", urlStr, err)
 		}
@@ -245,11 +392,42 @@ func (b *apibooter) BootSpec(m Machine) (*Spec, error) {
 	return &ret, nil
 }
 
+// MachineVars fetches per-machine variables from the boot API's
+// /v1/vars/<mac> endpoint. A 404 means the API server has no variables
+// for this machine, which isn't an error: it just means any "V" lookup
+// in the cmdline template will fail if the template author assumed one
+// existed.
+func (b *apibooter) MachineVars(m Machine) (map[string]string, error) {
+	resp, _, err := b.do(func(prefix string) string {
+		return fmt.Sprintf("%s/vars/%s", prefix, m.MAC)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Request.URL, http.StatusText(resp.StatusCode))
+	}
+
+	var vars map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		return nil, fmt.Errorf("decoding vars for %s: %s", m.MAC, err)
+	}
+	return vars, nil
+}
+
 func (b *apibooter) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
 	urlStr, err := getURL(id, &b.key)
 	if err != nil {
 		return nil, -1, err
 	}
+	urlStr, digestAlgo, digestHex, err := splitDigestFragment(urlStr)
+	if err != nil {
+		return nil, -1, err
+	}
 
 	u, err := url.Parse(urlStr)
 	if err != nil {
@@ -271,11 +449,21 @@ func (b *apibooter) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
 			return nil, -1, err
 		}
 		ret, sz = f, fi.Size()
+	} else if b.cache != nil {
+		// The cache issues its own (unauthenticated) requests, so
+		// caching is only wired up for the common case of a public
+		// artifact server. b.tokens-protected URLs should leave cache
+		// unset.
+		ret, sz, err = b.cache.Fetch(urlStr, urlStr)
+		if err != nil {
+			return nil, -1, err
+		}
 	} else {
-		// urlStr will get reparsed by http.Get, which is mildly
-		// wasteful, but the code looks nicer than constructing a
-		// Request.
-		resp, err := http.Get(urlStr)
+		req, err := b.newAuthorizedRequest(http.MethodGet, urlStr, nil)
+		if err != nil {
+			return nil, -1, err
+		}
+		resp, err := b.client.Do(req)
 		if err != nil {
 			return nil, -1, err
 		}
@@ -288,16 +476,132 @@ func (b *apibooter) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
 			return nil, -1, err
 		}
 	}
+
+	if digestAlgo != "" {
+		ret, err = newDigestReader(ret, digestAlgo, digestHex, string(id))
+		if err != nil {
+			return nil, -1, err
+		}
+		// The digest only resolves once the whole body has been read,
+		// by which point a Content-Length we reported up front would
+		// already have told the client it got every byte it expected.
+		// Report the size as unknown instead, so handleFile falls back
+		// to its no-Content-Length path: a mismatch then truncates the
+		// response the client actually sees, instead of silently
+		// finishing a Content-Length-accurate but corrupt transfer.
+		sz = -1
+	}
 	return ret, sz, nil
 }
 
+// ReadBootFileAt implements BooterRangeReader by forwarding the Range
+// request upstream, so handleFile's caller gets the prefix-skipping
+// done by the boot API server instead of fetching and discarding those
+// bytes a second time over the Pixiecore->upstream hop.
+//
+// A digest embedded in id isn't verified here: it was computed over
+// the whole artifact, and there's no way to check it against a byte
+// range without reading (and discarding) everything before it, which
+// defeats the entire point of a range request.
+func (b *apibooter) ReadBootFileAt(id ID, offset int64) (io.ReadCloser, int64, error) {
+	urlStr, err := getURL(id, &b.key)
+	if err != nil {
+		return nil, -1, err
+	}
+	urlStr, _, _, err = splitDigestFragment(urlStr)
+	if err != nil {
+		return nil, -1, err
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, -1, fmt.Errorf("%q is not an URL", urlStr)
+	}
+	if u.Scheme == "file" {
+		f, err := os.Open(u.Path)
+		if err != nil {
+			return nil, -1, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, -1, err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, -1, err
+		}
+		return f, fi.Size(), nil
+	}
+
+	req, err := b.newAuthorizedRequest(http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		total, err := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+		if err != nil {
+			resp.Body.Close()
+			return nil, -1, err
+		}
+		return resp.Body, total, nil
+	case http.StatusOK:
+		// Upstream ignored our Range request: skip the prefix
+		// ourselves so the caller still gets bytes starting at offset.
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				resp.Body.Close()
+				return nil, -1, err
+			}
+		}
+		return resp.Body, resp.ContentLength, nil
+	default:
+		resp.Body.Close()
+		return nil, -1, fmt.Errorf("GET %q (Range bytes=%d-) failed: %s", urlStr, offset, resp.Status)
+	}
+}
+
+// parseContentRangeTotal extracts the total resource size from a
+// "bytes <start>-<end>/<total>" Content-Range header.
+func parseContentRangeTotal(header string) (int64, error) {
+	const prefix = "bytes "
+	if !strings.HasPrefix(header, prefix) {
+		return -1, fmt.Errorf("malformed Content-Range %q", header)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, prefix), "/", 2)
+	if len(parts) != 2 {
+		return -1, fmt.Errorf("malformed Content-Range %q", header)
+	}
+	if parts[1] == "*" {
+		return -1, nil
+	}
+	total, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("malformed Content-Range %q", header)
+	}
+	return total, nil
+}
+
 func (b *apibooter) WriteBootFile(id ID, body io.Reader) error {
 	u, err := getURL(id, &b.key)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.Post(u, "application/octet-stream", body)
+	req, err := b.newAuthorizedRequest(http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -308,13 +612,13 @@ func (b *apibooter) WriteBootFile(id ID, body io.Reader) error {
 	return nil
 }
 
-func (b *apibooter) makeURLAbsolute(urlStr string) (string, error) {
+func (b *apibooter) makeURLAbsolute(urlPrefix, urlStr string) (string, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return "", fmt.Errorf("%q is not an URL", urlStr)
 	}
 	if !u.IsAbs() {
-		base, err := url.Parse(b.urlPrefix)
+		base, err := url.Parse(urlPrefix)
 		if err != nil {
 			return "", err
 		}
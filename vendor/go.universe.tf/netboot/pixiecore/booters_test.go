@@ -15,16 +15,19 @@
 package pixiecore
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -79,7 +82,7 @@ func TestStaticBooter(t *testing.T) {
 		Message: "Hello from testing world!",
 	}
 
-	b, err := StaticBooter(s)
+	b, err := StaticBooter(s, nil)
 	if err != nil {
 		t.Fatalf("Constructing StaticBooter: %s", err)
 	}
@@ -154,7 +157,7 @@ func TestAPIBooter(t *testing.T) {
 	go http.Serve(l, nil)
 
 	// Finally, build an APIBooter and test it.
-	b, err := APIBooter(fmt.Sprintf("http://%s/", l.Addr()), 100*time.Millisecond)
+	b, err := APIBooter(fmt.Sprintf("http://%s/", l.Addr()), 100*time.Millisecond, AuthOptions{}, nil, ClientTLSOptions{})
 	if err != nil {
 		t.Fatalf("Constructing APIBooter: %s", err)
 	}
@@ -197,3 +200,114 @@ func TestAPIBooter(t *testing.T) {
 		}
 	}
 }
+
+// deadAPIServer always answers /v1/boot/* with a 500, counting how
+// many boot requests it received.
+func deadAPIServer() (*httptest.Server, *int32) {
+	var hits int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/boot/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(w, "simulated API outage", http.StatusInternalServerError)
+	})
+	return httptest.NewServer(mux), &hits
+}
+
+// liveAPIServer answers /v1/boot/* with a minimal valid Spec,
+// counting how many boot requests it received.
+func liveAPIServer() (*httptest.Server, *int32) {
+	var hits int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/boot/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(`{"kernel": "/foo", "message": "hi from the live endpoint"}`))
+	})
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`foo file`)) })
+	return httptest.NewServer(mux), &hits
+}
+
+func TestAPIBooterFailover(t *testing.T) {
+	dead, deadHits := deadAPIServer()
+	defer dead.Close()
+	live, liveHits := liveAPIServer()
+	defer live.Close()
+
+	b, err := NewAPIBooter(APIBooterConfig{
+		Endpoints: []string{dead.URL, live.URL},
+		Timeout:   time.Second,
+		Retry: RetryPolicy{
+			MaxAttempts:             3,
+			BaseDelay:               time.Millisecond,
+			MaxDelay:                5 * time.Millisecond,
+			CircuitBreakerThreshold: 1,
+			CircuitBreakerCooldown:  time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Constructing NewAPIBooter: %s", err)
+	}
+
+	m := Machine{MAC: mustMAC("01:02:03:04:05:06"), Arch: ArchIA32}
+	spec, err := b.BootSpec(m)
+	if err != nil {
+		t.Fatalf("BootSpec should have failed over to the live endpoint, got error: %s", err)
+	}
+	if spec.Message != "hi from the live endpoint" {
+		t.Fatalf("Wrong message %q, BootSpec didn't fail over to the live endpoint", spec.Message)
+	}
+	if got := atomic.LoadInt32(deadHits); got != 1 {
+		t.Fatalf("dead endpoint got %d requests, want exactly 1 (then its circuit should open)", got)
+	}
+	if got := atomic.LoadInt32(liveHits); got != 1 {
+		t.Fatalf("live endpoint got %d requests, want exactly 1", got)
+	}
+
+	// The dead endpoint's circuit is now open: a second BootSpec call
+	// should go straight to the live endpoint without retrying it.
+	if _, err := b.BootSpec(m); err != nil {
+		t.Fatalf("Second BootSpec: %s", err)
+	}
+	if got := atomic.LoadInt32(deadHits); got != 1 {
+		t.Fatalf("dead endpoint got %d requests after its circuit opened, want still 1", got)
+	}
+	if got := atomic.LoadInt32(liveHits); got != 2 {
+		t.Fatalf("live endpoint got %d requests, want 2", got)
+	}
+}
+
+func TestAPIBooterAllEndpointsDown(t *testing.T) {
+	dead1, hits1 := deadAPIServer()
+	defer dead1.Close()
+	dead2, hits2 := deadAPIServer()
+	defer dead2.Close()
+
+	b, err := NewAPIBooter(APIBooterConfig{
+		Endpoints: []string{dead1.URL, dead2.URL},
+		Timeout:   time.Second,
+		Retry: RetryPolicy{
+			MaxAttempts:             4,
+			BaseDelay:               time.Millisecond,
+			MaxDelay:                5 * time.Millisecond,
+			CircuitBreakerThreshold: 2,
+			CircuitBreakerCooldown:  time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Constructing NewAPIBooter: %s", err)
+	}
+
+	m := Machine{MAC: mustMAC("01:02:03:04:05:06"), Arch: ArchIA32}
+	_, err = b.BootSpec(m)
+	var unavailable *APIUnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("BootSpec with every endpoint down should return an *APIUnavailableError, got: %#v", err)
+	}
+	if unavailable.RetryAfter <= 0 {
+		t.Fatalf("APIUnavailableError.RetryAfter should be positive, got %s", unavailable.RetryAfter)
+	}
+	// MaxAttempts(4) requests split across 2 endpoints, so each got at
+	// least one before MaxAttempts was exhausted.
+	if atomic.LoadInt32(hits1) == 0 || atomic.LoadInt32(hits2) == 0 {
+		t.Fatalf("expected both endpoints to be tried at least once, got %d and %d", atomic.LoadInt32(hits1), atomic.LoadInt32(hits2))
+	}
+}
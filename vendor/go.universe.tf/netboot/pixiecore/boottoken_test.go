@@ -0,0 +1,114 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBootTokenRoundTrip(t *testing.T) {
+	key, err := GenerateBootTokenKey()
+	if err != nil {
+		t.Fatalf("GenerateBootTokenKey: %s", err)
+	}
+	s := NewBootTokenSource(key)
+
+	mac := mustMAC("01:02:03:04:05:06")
+	tok, err := s.Mint(mac, "kernel", time.Minute)
+	if err != nil {
+		t.Fatalf("Mint: %s", err)
+	}
+
+	if err := s.Verify(tok, mac, "kernel"); err != nil {
+		t.Fatalf("Verify of a freshly minted token failed: %s", err)
+	}
+
+	otherMAC := mustMAC("02:03:04:05:06:07")
+	if err := s.Verify(tok, otherMAC, "kernel"); err == nil {
+		t.Fatal("Verify succeeded for a different MAC address")
+	}
+	if err := s.Verify(tok, mac, "initrd-0"); err == nil {
+		t.Fatal("Verify succeeded for a different file ID")
+	}
+	if err := s.Verify(tok+"d", mac, "kernel"); err == nil {
+		t.Fatal("Verify succeeded for a corrupted token")
+	}
+}
+
+func TestBootTokenExpiry(t *testing.T) {
+	key, err := GenerateBootTokenKey()
+	if err != nil {
+		t.Fatalf("GenerateBootTokenKey: %s", err)
+	}
+	s := NewBootTokenSource(key)
+
+	mac := mustMAC("01:02:03:04:05:06")
+	tok, err := s.Mint(mac, "kernel", -time.Second)
+	if err != nil {
+		t.Fatalf("Mint: %s", err)
+	}
+	if err := s.Verify(tok, mac, "kernel"); err == nil {
+		t.Fatal("Verify succeeded for an already-expired token")
+	}
+}
+
+func TestBootTokenRotation(t *testing.T) {
+	key1, err := GenerateBootTokenKey()
+	if err != nil {
+		t.Fatalf("GenerateBootTokenKey: %s", err)
+	}
+	s := NewBootTokenSource(key1)
+
+	mac := mustMAC("01:02:03:04:05:06")
+	tok, err := s.Mint(mac, "kernel", time.Minute)
+	if err != nil {
+		t.Fatalf("Mint: %s", err)
+	}
+
+	key2, err := GenerateBootTokenKey()
+	if err != nil {
+		t.Fatalf("GenerateBootTokenKey: %s", err)
+	}
+	s.RotateKey(key2)
+
+	// A token minted under the retired key should still verify: it's
+	// in the rotation LRU.
+	if err := s.Verify(tok, mac, "kernel"); err != nil {
+		t.Fatalf("Verify failed for a token minted just before rotation: %s", err)
+	}
+
+	// New tokens are minted (and verify) under the new current key.
+	tok2, err := s.Mint(mac, "kernel", time.Minute)
+	if err != nil {
+		t.Fatalf("Mint after rotation: %s", err)
+	}
+	if err := s.Verify(tok2, mac, "kernel"); err != nil {
+		t.Fatalf("Verify of a token minted under the new key: %s", err)
+	}
+
+	// Rotating maxPreviousBootTokenKeys more times should finally push
+	// the original key out of the LRU.
+	for i := 0; i < maxPreviousBootTokenKeys; i++ {
+		k, err := GenerateBootTokenKey()
+		if err != nil {
+			t.Fatalf("GenerateBootTokenKey: %s", err)
+		}
+		s.RotateKey(k)
+	}
+	if err := s.Verify(tok, mac, "kernel"); err == nil {
+		t.Fatal("Verify succeeded for a token signed with a key long since rotated out")
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CacheKey identifies the (distro, version, architecture) triple a
+// cached quick-recipe artifact belongs to, so kernels/initrds from
+// different recipes never collide on disk.
+type CacheKey struct {
+	Distro  string
+	Version string
+	Arch    string
+}
+
+// Dir returns the on-disk directory this key's artifacts are cached
+// under, rooted at baseDir (e.g. ~/.cache/pixiecore/quick).
+func (k CacheKey) Dir(baseDir string) string {
+	return filepath.Join(baseDir, k.Distro, k.Version, k.Arch)
+}
+
+// ChecksumSet maps an artifact's basename to its expected hex-encoded
+// SHA256 sum, as published in a distro's SHA256SUMS/CHECKSUM file.
+type ChecksumSet map[string]string
+
+// checksumLineRE matches the "SHA256 (filename) = hexdigest" lines used
+// by Fedora/CentOS CHECKSUM files.
+var checksumLineRE = regexp.MustCompile(`^SHA256 \((\S+)\)\s*=\s*([0-9a-fA-F]{64})$`)
+
+// ParseChecksums parses a checksums file into a ChecksumSet. It accepts
+// both of the formats the quick recipes' distros publish:
+//
+//   - the coreutils sha256sum format used for Debian/Ubuntu's
+//     SHA256SUMS and Arch's sha256sums.txt: "<hexdigest>  <filename>"
+//   - the "SHA256 (<filename>) = <hexdigest>" format used by Fedora
+//     and CentOS's CHECKSUM files
+//
+// Fedora/CentOS's .treeinfo format (an INI file with per-image
+// checksums nested under [checksums] sections) isn't handled here;
+// callers booting from a release tree that only publishes .treeinfo
+// checksums should pass a nil ChecksumSet to CachedBooter to skip
+// verification rather than mis-parse it.
+func ParseChecksums(r io.Reader) (ChecksumSet, error) {
+	set := make(ChecksumSet)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if m := checksumLineRE.FindStringSubmatch(line); m != nil {
+			set[path.Base(m[1])] = strings.ToLower(m[2])
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && len(fields[0]) == 64 {
+			set[path.Base(fields[1])] = strings.ToLower(fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading checksums: %s", err)
+	}
+	return set, nil
+}
+
+// FetchChecksums downloads and parses the checksums file at url.
+func FetchChecksums(url string) (ChecksumSet, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, http.StatusText(resp.StatusCode))
+	}
+	return ParseChecksums(resp.Body)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchResumable downloads url to dest, resuming from dest's current
+// size (web_get-style) if it already exists, rather than restarting
+// the whole transfer. A server that doesn't honor Range and returns a
+// full 200 response is handled by truncating dest and starting over.
+func fetchResumable(url, dest string) error {
+	var startOffset int64
+	if fi, err := os.Stat(dest); err == nil {
+		startOffset = fi.Size()
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if startOffset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startOffset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	default:
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fetchCached makes sure url's contents are present and (if
+// expectedSHA256 is non-empty) checksum-valid at dest, downloading or
+// resuming the download as needed. A cached file that fails checksum
+// verification is removed and re-fetched from scratch once.
+func fetchCached(url, dest, expectedSHA256 string) error {
+	if _, err := os.Stat(dest); err == nil {
+		if expectedSHA256 == "" {
+			return nil
+		}
+		if sum, err := sha256File(dest); err == nil && sum == expectedSHA256 {
+			return nil
+		}
+		os.Remove(dest)
+	}
+
+	if err := fetchResumable(url, dest); err != nil {
+		return err
+	}
+
+	if expectedSHA256 == "" {
+		return nil
+	}
+	sum, err := sha256File(dest)
+	if err != nil {
+		return err
+	}
+	if sum != expectedSHA256 {
+		os.Remove(dest)
+		return fmt.Errorf("%s: checksum mismatch: got %s, want %s", url, sum, expectedSHA256)
+	}
+	return nil
+}
+
+// CachedBooter wraps StaticBooter, caching spec's HTTP/HTTPS Kernel and
+// Initrd artifacts on disk under key.Dir(baseDir) instead of refetching
+// them from the remote mirror on every boot attempt. If checksums is
+// non-nil, each artifact is verified against the sum for its basename
+// before being trusted, with a mismatch triggering exactly one
+// re-fetch. Artifacts that are already local file paths (not
+// http(s):// URLs) are passed through to StaticBooter unchanged.
+func CachedBooter(spec *Spec, key CacheKey, baseDir string, checksums ChecksumSet) (Booter, error) {
+	cacheDir := key.Dir(baseDir)
+
+	localize := func(id ID) (ID, error) {
+		url := string(id)
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return id, nil
+		}
+		dest := filepath.Join(cacheDir, path.Base(url))
+		expected := checksums[path.Base(url)]
+		if err := fetchCached(url, dest, expected); err != nil {
+			return "", fmt.Errorf("caching %s: %s", url, err)
+		}
+		return ID(dest), nil
+	}
+
+	cachedKernel, err := localize(spec.Kernel)
+	if err != nil {
+		return nil, err
+	}
+	cachedSpec := &Spec{
+		Kernel:  cachedKernel,
+		Cmdline: spec.Cmdline,
+		Message: spec.Message,
+	}
+	for _, initrd := range spec.Initrd {
+		cachedInitrd, err := localize(initrd)
+		if err != nil {
+			return nil, err
+		}
+		cachedSpec.Initrd = append(cachedSpec.Initrd, cachedInitrd)
+	}
+
+	// cachedSpec's IDs are all local file paths by now, so there's no
+	// HTTP fetching left for an ArtifactCache to front.
+	return StaticBooter(cachedSpec, nil)
+}
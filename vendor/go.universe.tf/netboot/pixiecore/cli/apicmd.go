@@ -23,29 +23,61 @@ import (
 )
 
 var apiCmd = &cobra.Command{
-	Use:   "api server",
+	Use:   "api server [server...]",
 	Short: "Boot machines using instructions from one or more API servers",
 	Long: `API mode is a "PXE to HTTP" translator. Whenever Pixiecore sees a
 machine trying to PXE boot, it will ask a remote HTTP(S) API server
 what to do. The API server can tell Pixiecore to ignore the machine,
 or tell it what to boot.
 
+Passing more than one server enables failover: requests try servers in
+health order, retrying on 5xx/timeout with backoff, and a server whose
+circuit has opened (too many consecutive failures) is skipped until
+its cooldown passes. See the --api-retry-* and --api-circuit-breaker-*
+flags.
+
 It is your responsibility to implement or run a server that implements
 the Pixiecore boot API. The specification can be found at <TODO>.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
-			fatalf("you must specify an API URL")
+		if len(args) < 1 {
+			fatalf("you must specify at least one API URL")
 		}
-		server := args[0]
 		timeout, err := cmd.Flags().GetDuration("api-request-timeout")
 		if err != nil {
 			fatalf("Error reading flag: %s", err)
 		}
+		authOpts, err := apiAuthOptionsFromFlags(cmd)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		cache, err := artifactCacheFromFlags(cmd)
+		if err != nil {
+			fatalf("Couldn't make artifact cache: %s", err)
+		}
+		tlsOpts, err := apiClientTLSOptionsFromFlags(cmd)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		retry, err := apiRetryPolicyFromFlags(cmd)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
 
-		booter, err := pixiecore.APIBooter(server, timeout)
+		booter, err := pixiecore.NewAPIBooter(pixiecore.APIBooterConfig{
+			Endpoints: args,
+			Timeout:   timeout,
+			Auth:      authOpts,
+			Cache:     cache,
+			TLS:       tlsOpts,
+			Retry:     retry,
+		})
 		if err != nil {
 			fatalf("Failed to create API booter: %s", err)
 		}
+		booter, err = gzipCacheFromFlags(cmd, booter)
+		if err != nil {
+			fatalf("Couldn't make gzip cache: %s", err)
+		}
 		s := serverFromFlags(cmd)
 		s.Booter = booter
 
@@ -56,5 +88,134 @@ func init() {
 	rootCmd.AddCommand(apiCmd)
 	serverConfigFlags(apiCmd)
 	apiCmd.Flags().Duration("api-request-timeout", 5*time.Second, "Timeout for request to the API server")
-	// TODO: SSL cert flags for both client and server auth.
+	apiAuthConfigFlags(apiCmd)
+	artifactCacheConfigFlags(apiCmd)
+	apiClientTLSConfigFlags(apiCmd)
+	apiRetryConfigFlags(apiCmd)
+	gzipCacheConfigFlags(apiCmd)
+}
+
+// apiRetryConfigFlags registers the flags apiRetryPolicyFromFlags reads.
+func apiRetryConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("api-retry-max-attempts", 0, "Max requests (across all API servers) per boot lookup before giving up; 0 uses pixiecore.DefaultRetryPolicy's value")
+	cmd.Flags().Duration("api-retry-base-delay", 0, "Backoff before the first retry, doubling each attempt; 0 uses the default")
+	cmd.Flags().Duration("api-retry-max-delay", 0, "Cap on retry backoff; 0 uses the default")
+	cmd.Flags().Int("api-circuit-breaker-threshold", 0, "Consecutive failures against one API server before its circuit opens; 0 uses the default")
+	cmd.Flags().Duration("api-circuit-breaker-cooldown", 0, "How long an open circuit stays open before that server is tried again; 0 uses the default")
+	cmd.Flags().Duration("api-health-check-interval", 0, "How often to probe every API server in the background to keep endpoint health current; 0 disables the background probe")
+}
+
+// apiRetryPolicyFromFlags builds a pixiecore.RetryPolicy from the
+// flags apiRetryConfigFlags registered. Flags left at their zero value
+// fall through to pixiecore.DefaultRetryPolicy.
+func apiRetryPolicyFromFlags(cmd *cobra.Command) (pixiecore.RetryPolicy, error) {
+	maxAttempts, err := cmd.Flags().GetInt("api-retry-max-attempts")
+	if err != nil {
+		return pixiecore.RetryPolicy{}, err
+	}
+	baseDelay, err := cmd.Flags().GetDuration("api-retry-base-delay")
+	if err != nil {
+		return pixiecore.RetryPolicy{}, err
+	}
+	maxDelay, err := cmd.Flags().GetDuration("api-retry-max-delay")
+	if err != nil {
+		return pixiecore.RetryPolicy{}, err
+	}
+	cbThreshold, err := cmd.Flags().GetInt("api-circuit-breaker-threshold")
+	if err != nil {
+		return pixiecore.RetryPolicy{}, err
+	}
+	cbCooldown, err := cmd.Flags().GetDuration("api-circuit-breaker-cooldown")
+	if err != nil {
+		return pixiecore.RetryPolicy{}, err
+	}
+	healthCheckInterval, err := cmd.Flags().GetDuration("api-health-check-interval")
+	if err != nil {
+		return pixiecore.RetryPolicy{}, err
+	}
+	return pixiecore.RetryPolicy{
+		MaxAttempts:             maxAttempts,
+		BaseDelay:               baseDelay,
+		MaxDelay:                maxDelay,
+		CircuitBreakerThreshold: cbThreshold,
+		CircuitBreakerCooldown:  cbCooldown,
+		HealthCheckInterval:     healthCheckInterval,
+	}, nil
+}
+
+// apiClientTLSConfigFlags registers the flags apiClientTLSOptionsFromFlags reads.
+func apiClientTLSConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().String("api-tls-cert", "", "Client certificate to present to the API server for mTLS")
+	cmd.Flags().String("api-tls-key", "", "Key for --api-tls-cert")
+	cmd.Flags().String("api-tls-ca", "", "CA bundle to verify the API server's certificate against, instead of the system trust store")
+	cmd.Flags().Bool("api-tls-acme", false, "Obtain the client certificate for --api-tls-cert automatically from an ACME endpoint (not available in this build)")
+}
+
+// apiClientTLSOptionsFromFlags builds a pixiecore.ClientTLSOptions from
+// the flags apiClientTLSConfigFlags registered.
+func apiClientTLSOptionsFromFlags(cmd *cobra.Command) (pixiecore.ClientTLSOptions, error) {
+	certFile, err := cmd.Flags().GetString("api-tls-cert")
+	if err != nil {
+		return pixiecore.ClientTLSOptions{}, err
+	}
+	keyFile, err := cmd.Flags().GetString("api-tls-key")
+	if err != nil {
+		return pixiecore.ClientTLSOptions{}, err
+	}
+	caFile, err := cmd.Flags().GetString("api-tls-ca")
+	if err != nil {
+		return pixiecore.ClientTLSOptions{}, err
+	}
+	acme, err := cmd.Flags().GetBool("api-tls-acme")
+	if err != nil {
+		return pixiecore.ClientTLSOptions{}, err
+	}
+	return pixiecore.ClientTLSOptions{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		CAFile:      caFile,
+		ACMEEnabled: acme,
+	}, nil
+}
+
+// apiAuthConfigFlags registers the flags apiAuthOptionsFromFlags reads.
+func apiAuthConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().String("api-token", "", "Static bearer token to authenticate to the API server")
+	cmd.Flags().String("api-token-file", "", "Path to a file containing a bearer token to authenticate to the API server, re-read on every request")
+	cmd.Flags().String("api-oidc-issuer", "", "OIDC issuer URL; enables the OIDC client-credentials flow to authenticate to the API server")
+	cmd.Flags().String("api-oidc-client-id", "", "OIDC client ID, used with --api-oidc-issuer")
+	cmd.Flags().String("api-oidc-client-secret", "", "OIDC client secret, used with --api-oidc-issuer")
+}
+
+// apiAuthOptionsFromFlags builds a pixiecore.AuthOptions from the
+// flags apiAuthConfigFlags registered.
+func apiAuthOptionsFromFlags(cmd *cobra.Command) (pixiecore.AuthOptions, error) {
+	token, err := cmd.Flags().GetString("api-token")
+	if err != nil {
+		return pixiecore.AuthOptions{}, err
+	}
+	tokenFile, err := cmd.Flags().GetString("api-token-file")
+	if err != nil {
+		return pixiecore.AuthOptions{}, err
+	}
+	issuer, err := cmd.Flags().GetString("api-oidc-issuer")
+	if err != nil {
+		return pixiecore.AuthOptions{}, err
+	}
+	clientID, err := cmd.Flags().GetString("api-oidc-client-id")
+	if err != nil {
+		return pixiecore.AuthOptions{}, err
+	}
+	clientSecret, err := cmd.Flags().GetString("api-oidc-client-secret")
+	if err != nil {
+		return pixiecore.AuthOptions{}, err
+	}
+
+	return pixiecore.AuthOptions{
+		BearerToken:      token,
+		BearerTokenFile:  tokenFile,
+		OIDCIssuer:       issuer,
+		OIDCClientID:     clientID,
+		OIDCClientSecret: clientSecret,
+	}, nil
 }
@@ -0,0 +1,339 @@
+// Copyright © 2016 David Anderson <dave@natulte.net>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"go.universe.tf/netboot/pixiecore"
+)
+
+// Recipe is a declarative description of a quick-boot OS, letting an
+// operator add a new `quick <name>` subcommand by dropping a blueprint
+// file into --recipes-dir instead of adding a dedicated *Recipe function
+// like debianRecipe/fedoraRecipe/etc above.
+//
+// Blueprints are JSON rather than the YAML/HCL this feature was
+// originally asked for: this tree doesn't vendor a YAML or HCL parser
+// (only encoding/json is in the standard library), and this codebase's
+// convention is to not add vendored dependencies it can't actually build
+// against. A JSON blueprint plays the same role; only the file format
+// differs from the request.
+type Recipe struct {
+	// Name is both the `quick <name>` subcommand name and the blueprint
+	// file's base name (sans extension).
+	Name string `json:"name"`
+	// Versions is the whitelist of values the command's positional
+	// version/stream/channel argument accepts.
+	Versions []string `json:"versions"`
+	// ArchMap maps a --arch value to the string substituted into the
+	// URL templates below as .Arch; e.g. {"amd64": "x86_64"} lets users
+	// pass the Go-style arch name while the mirror uses its own.
+	ArchMap map[string]string `json:"arch_map"`
+	// MirrorDefault is --mirror's default value, substituted into the
+	// URL templates as .Mirror.
+	MirrorDefault string `json:"mirror_default"`
+	// KernelURLTemplate, InitrdURLTemplates and ChecksumURLTemplate are
+	// text/template strings expanded with a recipeVars value (fields
+	// .Version, .Arch, .Mirror). ChecksumURLTemplate may be empty if
+	// the distro publishes no flat checksums file.
+	KernelURLTemplate   string   `json:"kernel_url_template"`
+	InitrdURLTemplates  []string `json:"initrd_urls_template"`
+	CmdlineTemplate     string   `json:"cmdline_template"`
+	ChecksumURLTemplate string   `json:"checksum_url_template"`
+	// ExtraFlags declares additional string flags the recipe's URL/
+	// cmdline templates can reference as .Extra.<Name>.
+	ExtraFlags []RecipeFlag `json:"extra_flags"`
+}
+
+// RecipeFlag declares one of a Recipe's ExtraFlags.
+type RecipeFlag struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// recipeVars is the data text/template expands a Recipe's URL/cmdline
+// templates against.
+type recipeVars struct {
+	Version string
+	Arch    string
+	Mirror  string
+	Extra   map[string]string
+}
+
+// expandTemplate parses and executes templateText against vars, wrapping
+// parse/exec errors with enough context to find the offending blueprint.
+func expandTemplate(recipeName, templateText string, vars recipeVars) (string, error) {
+	if templateText == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(recipeName).Parse(templateText)
+	if err != nil {
+		return "", fmt.Errorf("parsing template %q: %s", templateText, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("expanding template %q: %s", templateText, err)
+	}
+	return buf.String(), nil
+}
+
+// Command builds the `quick <r.Name> <version>` cobra command for r,
+// mirroring the hand-written *Recipe functions above but driven by r's
+// templates instead of Go string formatting.
+func (r *Recipe) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   fmt.Sprintf("%s version", r.Name),
+		Short: fmt.Sprintf("Boot %s (blueprint recipe)", r.Name),
+		Long:  fmt.Sprintf("Boot %s for the given version (one of %s)", r.Name, strings.Join(r.Versions, ",")),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fatalf("you must specify a %s version", r.Name)
+			}
+			var version string
+			for _, v := range r.Versions {
+				if args[0] == v {
+					version = v
+					break
+				}
+			}
+			if version == "" {
+				fatalf("Unknown %s version %q", r.Name, args[0])
+			}
+
+			archFlag, err := cmd.Flags().GetString("arch")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+			arch := archFlag
+			if mapped, ok := r.ArchMap[archFlag]; ok {
+				arch = mapped
+			}
+			mirror, err := cmd.Flags().GetString("mirror")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+
+			extra := make(map[string]string, len(r.ExtraFlags))
+			for _, f := range r.ExtraFlags {
+				v, err := cmd.Flags().GetString(f.Name)
+				if err != nil {
+					fatalf("Error reading flag: %s", err)
+				}
+				extra[f.Name] = v
+			}
+			vars := recipeVars{Version: version, Arch: arch, Mirror: mirror, Extra: extra}
+
+			kernel, err := expandTemplate(r.Name, r.KernelURLTemplate, vars)
+			if err != nil {
+				fatalf("%s", err)
+			}
+			var initrds []string
+			for _, t := range r.InitrdURLTemplates {
+				initrd, err := expandTemplate(r.Name, t, vars)
+				if err != nil {
+					fatalf("%s", err)
+				}
+				initrds = append(initrds, initrd)
+			}
+			cmdline, err := expandTemplate(r.Name, r.CmdlineTemplate, vars)
+			if err != nil {
+				fatalf("%s", err)
+			}
+			checksums, err := expandTemplate(r.Name, r.ChecksumURLTemplate, vars)
+			if err != nil {
+				fatalf("%s", err)
+			}
+
+			quickServe(cmd, pixiecore.CacheKey{Distro: r.Name, Version: version, Arch: arch}, checksums, kernel, initrds, cmdline)
+		},
+	}
+
+	cmd.Flags().String("arch", "amd64", fmt.Sprintf("CPU architecture of the %s installer files", r.Name))
+	cmd.Flags().String("mirror", r.MirrorDefault, fmt.Sprintf("Root of the %s mirror to use", r.Name))
+	for _, f := range r.ExtraFlags {
+		cmd.Flags().String(f.Name, f.Default, f.Usage)
+	}
+	serverConfigFlags(cmd)
+	staticConfigFlags(cmd)
+	return cmd
+}
+
+// defaultRecipesDir returns ~/.config/pixiecore/recipes.d, or "" if the
+// user's config directory can't be determined.
+func defaultRecipesDir() string {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(base, "pixiecore", "recipes.d")
+}
+
+// recipesDirFromArgs looks for a --recipes-dir=value or --recipes-dir
+// value pair in args, falling back to def if absent. Blueprint recipes
+// must be registered as cobra subcommands before rootCmd.Execute()
+// parses flags (cobra has no way to add a subcommand discovered while
+// parsing its own sibling flag), so --recipes-dir can't be read the
+// normal way here; this pre-scan is the same workaround CLI tools with
+// dynamic plugin discovery (e.g. argv-scanning for a --plugins-dir
+// before the real flag parse) use for the same chicken-and-egg problem.
+func recipesDirFromArgs(args []string, def string) string {
+	for i, a := range args {
+		if a == "--recipes-dir" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(a, "--recipes-dir=") {
+			return strings.TrimPrefix(a, "--recipes-dir=")
+		}
+	}
+	return def
+}
+
+// loadRecipesDir reads every *.json blueprint in dir and returns the
+// Recipes they describe, in filename order. A missing dir is not an
+// error (it just means no blueprints); a malformed blueprint is.
+func loadRecipesDir(dir string) ([]*Recipe, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading recipes dir %s: %s", dir, err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var recipes []*Recipe
+	for _, name := range names {
+		bs, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading blueprint %s: %s", name, err)
+		}
+		var r Recipe
+		if err := json.Unmarshal(bs, &r); err != nil {
+			return nil, fmt.Errorf("parsing blueprint %s: %s", name, err)
+		}
+		if r.Name == "" {
+			r.Name = strings.TrimSuffix(name, ".json")
+		}
+		recipes = append(recipes, &r)
+	}
+	return recipes, nil
+}
+
+// builtinRecipes returns the Recipe blueprints shipped with Pixiecore
+// itself, for distros that follow the same "installer/live kernel +
+// initrd on a predictable mirror path" shape as debianRecipe/
+// fedoraRecipe/etc above closely enough that a blueprint (rather than a
+// bespoke *Recipe function) is all they need. Unlike debianRecipe and
+// friends these are data, not code, specifically to demonstrate that
+// adding one of these doesn't require a Go change - see the Recipe doc
+// comment.
+func builtinRecipes() []*Recipe {
+	return []*Recipe{
+		{
+			Name:                "almalinux",
+			Versions:            []string{"8", "9"},
+			MirrorDefault:       "https://repo.almalinux.org/almalinux",
+			KernelURLTemplate:   "{{.Mirror}}/{{.Version}}/BaseOS/{{.Arch}}/os/images/pxeboot/vmlinuz",
+			InitrdURLTemplates:  []string{"{{.Mirror}}/{{.Version}}/BaseOS/{{.Arch}}/os/images/pxeboot/initrd.img"},
+			CmdlineTemplate:     "inst.stage2={{.Mirror}}/{{.Version}}/BaseOS/{{.Arch}}/os/",
+			ChecksumURLTemplate: "", // published inside .treeinfo only, same caveat as fedoraRecipe/centosRecipe
+		},
+		{
+			Name:                "rocky",
+			Versions:            []string{"8", "9"},
+			MirrorDefault:       "https://download.rockylinux.org/pub/rocky",
+			KernelURLTemplate:   "{{.Mirror}}/{{.Version}}/BaseOS/{{.Arch}}/os/images/pxeboot/vmlinuz",
+			InitrdURLTemplates:  []string{"{{.Mirror}}/{{.Version}}/BaseOS/{{.Arch}}/os/images/pxeboot/initrd.img"},
+			CmdlineTemplate:     "inst.stage2={{.Mirror}}/{{.Version}}/BaseOS/{{.Arch}}/os/",
+			ChecksumURLTemplate: "",
+		},
+		{
+			Name:               "opensuse",
+			Versions:           []string{"15.4", "15.5", "tumbleweed"},
+			MirrorDefault:      "https://download.opensuse.org/distribution",
+			KernelURLTemplate:  "{{.Mirror}}/leap/{{.Version}}/repo/oss/boot/{{.Arch}}/loader/linux",
+			InitrdURLTemplates: []string{"{{.Mirror}}/leap/{{.Version}}/repo/oss/boot/{{.Arch}}/loader/initrd"},
+		},
+		{
+			Name:               "alpine",
+			Versions:           []string{"v3.17", "v3.18", "v3.19", "edge"},
+			ArchMap:            map[string]string{"amd64": "x86_64", "arm64": "aarch64"},
+			MirrorDefault:      "https://dl-cdn.alpinelinux.org/alpine",
+			KernelURLTemplate:  "{{.Mirror}}/{{.Version}}/releases/{{.Arch}}/netboot/vmlinuz-lts",
+			InitrdURLTemplates: []string{"{{.Mirror}}/{{.Version}}/releases/{{.Arch}}/netboot/initramfs-lts"},
+			CmdlineTemplate:    "modloop={{.Mirror}}/{{.Version}}/releases/{{.Arch}}/netboot/modloop-lts",
+		},
+		{
+			// Gentoo's autobuilds don't publish pxeboot-ready netboot
+			// kernels the way Debian/Fedora do; the "current-install-*"
+			// tree is the closest published PXE-bootable equivalent.
+			// Treat this one as a starting point for sites with their
+			// own mirror layout rather than a verified-working default.
+			Name:               "gentoo",
+			Versions:           []string{"current"},
+			ArchMap:            map[string]string{"amd64": "amd64", "arm64": "arm64"},
+			MirrorDefault:      "https://distfiles.gentoo.org/releases",
+			KernelURLTemplate:  "{{.Mirror}}/{{.Arch}}/autobuilds/current-install-{{.Arch}}-netboot/install-{{.Arch}}-netboot-kernel",
+			InitrdURLTemplates: []string{"{{.Mirror}}/{{.Arch}}/autobuilds/current-install-{{.Arch}}-netboot/install-{{.Arch}}-netboot-initramfs"},
+		},
+		{
+			// Kali is Debian-based and reuses debian-installer's netboot
+			// layout under its own mirror.
+			Name:                "kali",
+			Versions:            []string{"kali-rolling", "kali-last-snapshot"},
+			MirrorDefault:       "https://http.kali.org/kali",
+			KernelURLTemplate:   "{{.Mirror}}/dists/{{.Version}}/main/installer-{{.Arch}}/current/images/netboot/debian-installer/{{.Arch}}/linux",
+			InitrdURLTemplates:  []string{"{{.Mirror}}/dists/{{.Version}}/main/installer-{{.Arch}}/current/images/netboot/debian-installer/{{.Arch}}/initrd.gz"},
+			ChecksumURLTemplate: "{{.Mirror}}/dists/{{.Version}}/main/installer-{{.Arch}}/current/images/SHA256SUMS",
+		},
+	}
+}
+
+func init() {
+	quickCmd.PersistentFlags().String("recipes-dir", defaultRecipesDir(), "Directory of JSON blueprint files to register as additional 'quick <name>' recipes")
+
+	for _, r := range builtinRecipes() {
+		quickCmd.AddCommand(r.Command())
+	}
+
+	dir := recipesDirFromArgs(os.Args[1:], defaultRecipesDir())
+	recipes, err := loadRecipesDir(dir)
+	if err != nil {
+		fatalf("loading recipe blueprints from %s: %s", dir, err)
+	}
+	for _, r := range recipes {
+		quickCmd.AddCommand(r.Command())
+	}
+}
@@ -48,10 +48,18 @@ var bootCmd = &cobra.Command{
 			spec.Initrd = append(spec.Initrd, pixiecore.ID(initrd))
 		}
 
-		booter, err := pixiecore.StaticBooter(spec)
+		cache, err := artifactCacheFromFlags(cmd)
+		if err != nil {
+			fatalf("Couldn't make artifact cache: %s", err)
+		}
+		booter, err := pixiecore.StaticBooter(spec, cache)
 		if err != nil {
 			fatalf("Couldn't make static booter: %s", err)
 		}
+		booter, err = gzipCacheFromFlags(cmd, booter)
+		if err != nil {
+			fatalf("Couldn't make gzip cache: %s", err)
+		}
 
 		s := serverFromFlags(cmd)
 		s.Booter = booter
@@ -64,4 +72,6 @@ func init() {
 	rootCmd.AddCommand(bootCmd)
 	serverConfigFlags(bootCmd)
 	staticConfigFlags(bootCmd)
+	artifactCacheConfigFlags(bootCmd)
+	gzipCacheConfigFlags(bootCmd)
 }
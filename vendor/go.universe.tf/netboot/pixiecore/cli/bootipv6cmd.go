@@ -83,6 +83,32 @@ var bootIPv6Cmd = &cobra.Command{
 		s.AddressPool = pool.NewRandomAddressPool(net.ParseIP(addressPoolStart), addressPoolSize, addressPoolValidLifetime)
 		s.PacketBuilder = dhcp6.MakePacketBuilder(addressPoolValidLifetime-addressPoolValidLifetime*3/100, addressPoolValidLifetime)
 
+		relayListen, err := cmd.Flags().GetString("relay-listen")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		s.RelayListenAddress = relayListen
+
+		prefixPool, err := cmd.Flags().GetString("prefix-pool")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		if prefixPool != "" {
+			prefixPoolLength, err := cmd.Flags().GetUint8("prefix-pool-length")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+			prefixLength, err := cmd.Flags().GetUint8("prefix-length")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+			prefixes, err := pool.NewPrefixPool(net.ParseIP(prefixPool), prefixPoolLength, prefixLength)
+			if err != nil {
+				fatalf("Error creating prefix pool: %s", err)
+			}
+			s.PacketBuilder.Prefixes = prefixes
+		}
+
 		fmt.Println(s.Serve())
 	},
 }
@@ -97,6 +123,10 @@ func serverv6ConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().Uint64("address-pool-size", 50, "Address pool size")
 	cmd.Flags().Uint32("address-pool-lifetime", 1850, "Address pool ip valid lifetime in seconds")
 	cmd.Flags().StringP("dns-servers", "", "", "Comma separated list of one or more dns server addresses")
+	cmd.Flags().String("relay-listen", "", "Additional IPv6 address to listen on for traffic forwarded by a DHCPv6 relay agent (RFC 3315 section 20)")
+	cmd.Flags().String("prefix-pool", "", "Pool prefix to delegate IA_PD prefixes out of, e.g. 2001:db8:f00f:ffff::; empty disables prefix delegation")
+	cmd.Flags().Uint8("prefix-pool-length", 48, "Length in bits of --prefix-pool")
+	cmd.Flags().Uint8("prefix-length", 64, "Length in bits of each prefix delegated out of --prefix-pool")
 }
 
 func init() {
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -67,6 +68,99 @@ func fatalf(msg string, args ...interface{}) {
 func staticConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().String("cmdline", "", "Kernel commandline arguments")
 	cmd.Flags().String("bootmsg", "", "Message to print on machines before booting")
+	cmd.Flags().String("cache-dir", defaultQuickCacheDir(), "Local directory to cache downloaded quick-recipe kernels/initrds in, keyed by distro/version/arch; empty disables caching")
+	cmd.Flags().Bool("no-cache", false, "Always fetch quick-recipe artifacts from the remote mirror, even if --cache-dir is set")
+	cmd.Flags().Bool("verify-checksum", true, "Verify cached/downloaded quick-recipe artifacts against the distro's published SHA256 checksums")
+}
+
+// defaultQuickCacheDir returns ~/.cache/pixiecore/quick, or "" (caching
+// disabled by default) if the user's cache directory can't be
+// determined.
+func defaultQuickCacheDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(base, "pixiecore", "quick")
+}
+
+// cachedBooterFromFlags builds spec's Booter, going through
+// pixiecore.CachedBooter keyed by key when --cache-dir is set and
+// --no-cache isn't, falling back to a plain pixiecore.StaticBooter
+// otherwise. checksumsURL is only consulted when --verify-checksum is
+// set; an empty checksumsURL just skips verification.
+func cachedBooterFromFlags(cmd *cobra.Command, spec *pixiecore.Spec, key pixiecore.CacheKey, checksumsURL string) (pixiecore.Booter, error) {
+	cacheDir, err := cmd.Flags().GetString("cache-dir")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	noCache, err := cmd.Flags().GetBool("no-cache")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	if cacheDir == "" || noCache {
+		return pixiecore.StaticBooter(spec, nil)
+	}
+
+	verify, err := cmd.Flags().GetBool("verify-checksum")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	var checksums pixiecore.ChecksumSet
+	if verify && checksumsURL != "" {
+		checksums, err = pixiecore.FetchChecksums(checksumsURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetching checksums from %s: %s", checksumsURL, err)
+		}
+	}
+
+	return pixiecore.CachedBooter(spec, key, cacheDir, checksums)
+}
+
+// artifactCacheConfigFlags registers the flags artifactCacheFromFlags
+// reads. Distinct from staticConfigFlags' --cache-dir, which keys its
+// cache by distro/version/arch for the quick-recipe commands: this one
+// caches arbitrary kernel/initrd URLs, for commands (boot, api) that
+// don't have quick-recipe metadata to key off of.
+func artifactCacheConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().String("artifact-cache-dir", "", "Local directory to cache fetched kernels/initrds in; empty disables caching")
+	cmd.Flags().Int64("artifact-cache-size", 10<<30, "Maximum bytes to keep in --artifact-cache-dir, least-recently-used artifacts are evicted first")
+}
+
+// artifactCacheFromFlags builds a pixiecore.ArtifactCache from the
+// flags artifactCacheConfigFlags registered, or returns a nil
+// ArtifactCache (caching disabled) if --artifact-cache-dir is unset.
+func artifactCacheFromFlags(cmd *cobra.Command) (pixiecore.ArtifactCache, error) {
+	dir, err := cmd.Flags().GetString("artifact-cache-dir")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, nil
+	}
+	maxBytes, err := cmd.Flags().GetInt64("artifact-cache-size")
+	if err != nil {
+		return nil, err
+	}
+	return pixiecore.NewDiskCache(dir, maxBytes)
+}
+
+// gzipCacheConfigFlags registers the flags gzipCacheFromFlags reads.
+func gzipCacheConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().String("gzip-cache-dir", "", "Local directory to cache gzip-compressed boot files in, served to gzip-capable iPXE clients; empty disables compression")
+}
+
+// gzipCacheFromFlags wraps booter in a pixiecore.GzipCache if
+// --gzip-cache-dir is set, otherwise returns booter unchanged.
+func gzipCacheFromFlags(cmd *cobra.Command, booter pixiecore.Booter) (pixiecore.Booter, error) {
+	dir, err := cmd.Flags().GetString("gzip-cache-dir")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return booter, nil
+	}
+	return pixiecore.NewGzipCache(dir, booter)
 }
 
 func serverConfigFlags(cmd *cobra.Command) {
@@ -80,12 +174,65 @@ func serverConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().String("ipxe-ipxe", "", "Path to an iPXE binary for chainloading from another iPXE")
 	cmd.Flags().String("ipxe-efi32", "", "Path to an iPXE binary for 32-bit UEFI")
 	cmd.Flags().String("ipxe-efi64", "", "Path to an iPXE binary for 64-bit UEFI")
+	cmd.Flags().String("tls-cert", "", "Certificate to terminate /_/ipxe and /_/file TLS with")
+	cmd.Flags().String("tls-key", "", "Key for --tls-cert")
+	cmd.Flags().Bool("tls-acme", false, "Obtain --tls-cert/--tls-key automatically from an ACME endpoint, answering HTTP-01 on the HTTP port (not available in this build)")
+	cmd.Flags().String("tls-acme-cache-dir", "", "Directory to cache an ACME-obtained certificate in across restarts")
+	cmd.Flags().String("boot-token-key", "", "Path to a key file authenticating /_/file requests; generated and persisted here on first use if the file doesn't exist. Empty serves /_/file unauthenticated")
 
 	// Development flags, hidden from normal use.
 	cmd.Flags().String("ui-assets-dir", "", "UI assets directory (used for development)")
 	cmd.Flags().MarkHidden("ui-assets-dir")
 }
 
+// bootTokensFromFlags builds a pixiecore.BootTokenSource from
+// --boot-token-key, generating and persisting a new key the first
+// time the file doesn't exist. An empty flag returns a nil
+// BootTokenSource, leaving /_/file unauthenticated, matching
+// serverFromFlags' original behavior.
+func bootTokensFromFlags(cmd *cobra.Command) (*pixiecore.BootTokenSource, error) {
+	path, err := cmd.Flags().GetString("boot-token-key")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, nil
+	}
+	key, err := loadOrGenerateBootTokenKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return pixiecore.NewBootTokenSource(key), nil
+}
+
+// loadOrGenerateBootTokenKey reads a pixiecore.BootTokenKey from path,
+// or generates one and writes it to path (mode 0600) if the file
+// doesn't exist yet, so a server's boot token key survives restarts
+// without an operator having to manage it explicitly.
+func loadOrGenerateBootTokenKey(path string) (pixiecore.BootTokenKey, error) {
+	var key pixiecore.BootTokenKey
+	bs, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(bs) != pixiecore.BootTokenKeySize {
+			return key, fmt.Errorf("boot token key file %q has %d bytes, want %d", path, len(bs), pixiecore.BootTokenKeySize)
+		}
+		copy(key[:], bs)
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return key, fmt.Errorf("reading boot token key %q: %s", path, err)
+	}
+
+	key, err = pixiecore.GenerateBootTokenKey()
+	if err != nil {
+		return key, err
+	}
+	if err := ioutil.WriteFile(path, key[:], 0600); err != nil {
+		return key, fmt.Errorf("persisting generated boot token key to %q: %s", path, err)
+	}
+	return key, nil
+}
+
 func mustFile(path string) []byte {
 	bs, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -118,7 +265,7 @@ func staticFromFlags(cmd *cobra.Command, kernel string, initrds []string, extraC
 		spec.Initrd = append(spec.Initrd, pixiecore.ID(initrd))
 	}
 
-	booter, err := pixiecore.StaticBooter(spec)
+	booter, err := pixiecore.StaticBooter(spec, nil)
 	if err != nil {
 		fatalf("Couldn't make static booter: %s", err)
 	}
@@ -174,6 +321,26 @@ func serverFromFlags(cmd *cobra.Command) *pixiecore.Server {
 	if err != nil {
 		fatalf("Error reading flag: %s", err)
 	}
+	tlsCert, err := cmd.Flags().GetString("tls-cert")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	tlsKey, err := cmd.Flags().GetString("tls-key")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	tlsACME, err := cmd.Flags().GetBool("tls-acme")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	tlsACMECacheDir, err := cmd.Flags().GetString("tls-acme-cache-dir")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	bootTokens, err := bootTokensFromFlags(cmd)
+	if err != nil {
+		fatalf("Couldn't set up boot tokens: %s", err)
+	}
 
 	if httpPort <= 0 {
 		fatalf("HTTP port must be >0")
@@ -186,6 +353,13 @@ func serverFromFlags(cmd *cobra.Command) *pixiecore.Server {
 		HTTPStatusPort: httpStatusPort,
 		DHCPNoBind:     dhcpNoBind,
 		UIAssetsDir:    uiAssetsDir,
+		TLS: pixiecore.ServerTLSOptions{
+			CertFile:     tlsCert,
+			KeyFile:      tlsKey,
+			ACMEEnabled:  tlsACME,
+			ACMECacheDir: tlsACMECacheDir,
+		},
+		BootTokens: bootTokens,
 	}
 	for fwtype, bs := range Ipxe {
 		ret.Ipxe[fwtype] = bs
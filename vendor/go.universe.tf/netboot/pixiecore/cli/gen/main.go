@@ -0,0 +1,138 @@
+//go:build ignore
+
+// Command gen reads the version/stream/channel tables embedded in each
+// *Recipe function in quickcmd.go and emits one TestQuickBoot_<Distro>_
+// <Version>_<Arch> function per (recipe, version) tuple into
+// quick_integration_test.go, so that adding a version to a recipe's
+// table automatically gets an integration test without hand-writing
+// one. Run via `go generate ./...` from the cli package (see the
+// go:generate directive in quickcmd.go); this file itself isn't part of
+// the cli package build (see the ignore build tag above).
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// recipeInfo is what the generator extracts from one *Recipe function
+// in quickcmd.go.
+type recipeInfo struct {
+	distro       string   // e.g. "debian", derived from the function name
+	versions     []string // the recipe's version/stream/channel whitelist
+	defaultArch  string   // the --arch flag's default value
+}
+
+func main() {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "quickcmd.go", nil, 0)
+	if err != nil {
+		log.Fatalf("parsing quickcmd.go: %s", err)
+	}
+
+	var recipes []recipeInfo
+	ast.Inspect(f, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			return true
+		}
+		if !strings.HasSuffix(fn.Name.Name, "Recipe") {
+			return true
+		}
+		distro := strings.TrimSuffix(fn.Name.Name, "Recipe")
+
+		info := recipeInfo{distro: distro}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch stmt := n.(type) {
+			case *ast.AssignStmt:
+				if len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+					return true
+				}
+				ident, ok := stmt.Lhs[0].(*ast.Ident)
+				if !ok {
+					return true
+				}
+				if ident.Name != "versions" && ident.Name != "streams" && ident.Name != "channels" {
+					return true
+				}
+				lit, ok := stmt.Rhs[0].(*ast.CompositeLit)
+				if !ok {
+					return true
+				}
+				for _, elt := range lit.Elts {
+					bl, ok := elt.(*ast.BasicLit)
+					if !ok || bl.Kind != token.STRING {
+						continue
+					}
+					info.versions = append(info.versions, strings.Trim(bl.Value, `"`))
+				}
+			case *ast.CallExpr:
+				sel, ok := stmt.Fun.(*ast.SelectorExpr)
+				if !ok || sel.Sel.Name != "String" || len(stmt.Args) < 2 {
+					return true
+				}
+				nameLit, ok := stmt.Args[0].(*ast.BasicLit)
+				if !ok || strings.Trim(nameLit.Value, `"`) != "arch" {
+					return true
+				}
+				defLit, ok := stmt.Args[1].(*ast.BasicLit)
+				if !ok {
+					return true
+				}
+				info.defaultArch = strings.Trim(defLit.Value, `"`)
+			}
+			return true
+		})
+
+		if len(info.versions) > 0 {
+			recipes = append(recipes, info)
+		}
+		return true
+	})
+
+	sort.Slice(recipes, func(i, j int) bool { return recipes[i].distro < recipes[j].distro })
+
+	out, err := os.Create("quick_integration_test.go")
+	if err != nil {
+		log.Fatalf("creating quick_integration_test.go: %s", err)
+	}
+	defer out.Close()
+
+	fmt.Fprint(out, quickIntegrationTestHeader)
+	for _, r := range recipes {
+		arch := r.defaultArch
+		if arch == "" {
+			arch = "amd64"
+		}
+		for _, v := range r.versions {
+			fmt.Fprintf(out, quickIntegrationTestBody, testName(r.distro), testName(v), testName(arch), r.distro, v, arch)
+		}
+	}
+}
+
+// testName turns an arbitrary recipe/version/arch string into something
+// safe to splice into a Go identifier.
+func testName(s string) string {
+	replacer := strings.NewReplacer(".", "_", "-", "_", "/", "_")
+	return replacer.Replace(s)
+}
+
+const quickIntegrationTestHeader = `// Code generated by cli/gen/main.go via "go generate". DO NOT EDIT.
+
+package cli
+
+import "testing"
+
+`
+
+const quickIntegrationTestBody = `func TestQuickBoot_%s_%s_%s(t *testing.T) {
+	runQuickBootVMTest(t, %q, %q, %q)
+}
+
+`
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"net"
+	"os"
 	"strings"
 	"time"
 
@@ -77,9 +78,65 @@ var ipv6ApiCmd = &cobra.Command{
 		if err != nil {
 			fatalf("Error reading flag: %s", err)
 		}
-		s.AddressPool = pool.NewRandomAddressPool(net.ParseIP(addressPoolStart), addressPoolSize, addressPoolValidLifetime)
+		detPool, err := pool.NewDeterministicPool(net.ParseIP(addressPoolStart), addressPoolSize, addressPoolValidLifetime)
+		if err != nil {
+			fatalf("Error creating address pool: %s", err)
+		}
+
+		leaseDB, err := cmd.Flags().GetString("lease-db")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		if leaseDB != "" {
+			store, err := pool.NewBoltLeaseStore(leaseDB)
+			if err != nil {
+				fatalf("Error opening --lease-db %q: %s", leaseDB, err)
+			}
+			if detPool, err = detPool.WithLeaseStore(store); err != nil {
+				fatalf("Error loading leases from --lease-db %q: %s", leaseDB, err)
+			}
+		}
+
+		reservationsFile, err := cmd.Flags().GetString("reservations-file")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		if reservationsFile != "" {
+			f, err := os.Open(reservationsFile)
+			if err != nil {
+				fatalf("Error opening --reservations-file %q: %s", reservationsFile, err)
+			}
+			reservations, err := pool.ParseReservations(f)
+			f.Close()
+			if err != nil {
+				fatalf("Error parsing --reservations-file %q: %s", reservationsFile, err)
+			}
+			detPool = detPool.WithReservations(reservations)
+		}
+
+		s.AddressPool = detPool
 		s.PacketBuilder = dhcp6.MakePacketBuilder(addressPoolValidLifetime-addressPoolValidLifetime*3/100, addressPoolValidLifetime)
 
+		maxHopCount, err := cmd.Flags().GetUint8("max-hop-count")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		s.MaxHopCount = maxHopCount
+
+		trustRelayPrefixes, err := cmd.Flags().GetString("trust-relay-prefix")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		if cmd.Flags().Changed("trust-relay-prefix") {
+			for _, p := range strings.Split(trustRelayPrefixes, ",") {
+				_, prefix, err := net.ParseCIDR(p)
+				if err != nil {
+					fatalf("Invalid --trust-relay-prefix %q: %s", p, err)
+				}
+				s.TrustedRelayPrefixes = append(s.TrustedRelayPrefixes, prefix)
+			}
+		}
+
 		fmt.Println(s.Serve())
 	},
 }
@@ -94,6 +151,10 @@ func serverv6APIConfigFlags(cmd *cobra.Command) {
 	cmd.Flags().Uint64("address-pool-size", 50, "Address pool size")
 	cmd.Flags().Uint32("address-pool-lifetime", 1850, "Address pool ip address valid lifetime in seconds")
 	cmd.Flags().StringP("dns-servers", "", "", "Comma separated list of one or more dns server addresses")
+	cmd.Flags().Uint8("max-hop-count", 0, "Discard relayed packets whose hop count exceeds this value (0 means no limit)")
+	cmd.Flags().StringP("trust-relay-prefix", "", "", "Comma separated list of CIDR prefixes to accept relayed packets from (default: trust any relay)")
+	cmd.Flags().StringP("lease-db", "", "", "Path to a BoltDB file used to persist leases across restarts (default: leases aren't persisted)")
+	cmd.Flags().StringP("reservations-file", "", "", "Path to a YAML file of duid/address reservations that pin specific clients to specific addresses")
 }
 
 func init() {
@@ -14,13 +14,139 @@
 
 package cli
 
+//go:generate go run gen/main.go
+
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"go.universe.tf/netboot/pixiecore"
 )
 
+// coreosStreamMetadata is the subset of the CoreOS/Fedora CoreOS stream
+// metadata JSON schema (as served from
+// https://builds.coreos.fedoraproject.org/streams/<stream>.json) needed
+// to resolve PXE boot artifacts for a given architecture.
+type coreosStreamMetadata struct {
+	Architectures map[string]struct {
+		Artifacts map[string]struct {
+			Formats map[string]struct {
+				Kernel    struct{ Location string } `json:"kernel"`
+				Initramfs struct{ Location string } `json:"initramfs"`
+				Rootfs    struct{ Location string } `json:"rootfs"`
+			} `json:"formats"`
+		} `json:"artifacts"`
+	} `json:"architectures"`
+}
+
+// coreosPXEArtifacts fetches the stream metadata JSON at url and
+// returns the "metal"/"pxe" kernel, initramfs and rootfs image URLs for
+// arch. The rootfs image is FCOS/RHCOS's extra initramfs-packaged
+// squashfs, served as a second entry in Spec.Initrd alongside the
+// regular initramfs.
+func coreosPXEArtifacts(url, arch string) (kernel, initramfs, rootfs string, err error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", fmt.Errorf("%s: %s", url, http.StatusText(resp.StatusCode))
+	}
+
+	var meta coreosStreamMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return "", "", "", fmt.Errorf("decoding stream metadata: %s", err)
+	}
+
+	archMeta, ok := meta.Architectures[arch]
+	if !ok {
+		return "", "", "", fmt.Errorf("stream metadata has no architecture %q", arch)
+	}
+	metal, ok := archMeta.Artifacts["metal"]
+	if !ok {
+		return "", "", "", fmt.Errorf("stream metadata has no %q artifacts for architecture %q", "metal", arch)
+	}
+	pxe, ok := metal.Formats["pxe"]
+	if !ok {
+		return "", "", "", fmt.Errorf("stream metadata has no pxe format for architecture %q", arch)
+	}
+	if pxe.Kernel.Location == "" || pxe.Initramfs.Location == "" || pxe.Rootfs.Location == "" {
+		return "", "", "", fmt.Errorf("stream metadata pxe format for architecture %q is missing kernel/initramfs/rootfs", arch)
+	}
+
+	return pxe.Kernel.Location, pxe.Initramfs.Location, pxe.Rootfs.Location, nil
+}
+
+// archWhitelist fatalfs if arch isn't one of allowed, naming distro in
+// the error. Real mirrors only publish a handful of architectures per
+// distro (and under different sub-paths per arch, see below), so an
+// unrecognized --arch is a user mistake worth catching up front rather
+// than a 404 several network round-trips later.
+func archWhitelist(distro, arch string, allowed []string) {
+	for _, a := range allowed {
+		if arch == a {
+			return
+		}
+	}
+	fatalf("unsupported %s architecture %q (must be one of %s)", distro, arch, strings.Join(allowed, ","))
+}
+
+// armConsoleCmdline returns the kernel cmdline fragment ARM installers
+// need to get a usable serial console, since (unlike x86) there's no
+// BIOS-assigned COM port convention for aarch64/armhf to inherit.
+func armConsoleCmdline(arch string) string {
+	switch arch {
+	case "arm64", "aarch64", "armhf":
+		return "console=ttyAMA0,115200"
+	default:
+		return ""
+	}
+}
+
+// quickServe builds a Spec the same way staticFromFlags does, but goes
+// through cachedBooterFromFlags instead of a bare StaticBooter, so that
+// quick recipes' kernel/initrd fetches are cached under --cache-dir
+// (keyed by key) and checksum-verified against checksumsURL instead of
+// refetching from the remote mirror on every boot attempt. An empty
+// checksumsURL just means this recipe/arch combination has no flat
+// checksums file to verify against; caching still applies.
+func quickServe(cmd *cobra.Command, key pixiecore.CacheKey, checksumsURL, kernel string, initrds []string, extraCmdline string) {
+	cmdline, err := cmd.Flags().GetString("cmdline")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	bootmsg, err := cmd.Flags().GetString("bootmsg")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	if extraCmdline != "" {
+		cmdline = fmt.Sprintf("%s %s", extraCmdline, cmdline)
+	}
+
+	spec := &pixiecore.Spec{
+		Kernel:  pixiecore.ID(kernel),
+		Cmdline: cmdline,
+		Message: bootmsg,
+	}
+	for _, initrd := range initrds {
+		spec.Initrd = append(spec.Initrd, pixiecore.ID(initrd))
+	}
+
+	booter, err := cachedBooterFromFlags(cmd, spec, key, checksumsURL)
+	if err != nil {
+		fatalf("Couldn't make booter: %s", err)
+	}
+
+	s := serverFromFlags(cmd)
+	s.Booter = booter
+
+	fmt.Println(s.Serve())
+}
+
 var quickCmd = &cobra.Command{
 	Use:   "quick recipe [settings...]",
 	Short: "Boot an OS from a list",
@@ -67,6 +193,7 @@ func debianRecipe(parent *cobra.Command) {
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
 			}
+			archWhitelist("Debian", arch, []string{"amd64", "arm64", "armhf"})
 			mirror, err := cmd.Flags().GetString("mirror")
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
@@ -74,8 +201,9 @@ func debianRecipe(parent *cobra.Command) {
 
 			kernel := fmt.Sprintf("%s/dists/%s/main/installer-%s/current/images/netboot/debian-installer/%s/linux", mirror, version, arch, arch)
 			initrd := fmt.Sprintf("%s/dists/%s/main/installer-%s/current/images/netboot/debian-installer/%s/initrd.gz", mirror, version, arch, arch)
+			checksums := fmt.Sprintf("%s/dists/%s/main/installer-%s/current/images/SHA256SUMS", mirror, version, arch)
 
-			fmt.Println(staticFromFlags(cmd, kernel, []string{initrd}, "").Serve())
+			quickServe(cmd, pixiecore.CacheKey{Distro: "debian", Version: version, Arch: arch}, checksums, kernel, []string{initrd}, armConsoleCmdline(arch))
 		},
 	}
 
@@ -121,6 +249,7 @@ func ubuntuRecipe(parent *cobra.Command) {
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
 			}
+			archWhitelist("Ubuntu", arch, []string{"amd64", "arm64", "armhf"})
 			mirror, err := cmd.Flags().GetString("mirror")
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
@@ -133,8 +262,9 @@ func ubuntuRecipe(parent *cobra.Command) {
 
 			kernel := fmt.Sprintf("%s/dists/%s/main/installer-%s/current/%s/netboot/ubuntu-installer/%s/linux", mirror, version, arch, imageDir, arch)
 			initrd := fmt.Sprintf("%s/dists/%s/main/installer-%s/current/%s/netboot/ubuntu-installer/%s/initrd.gz", mirror, version, arch, imageDir, arch)
+			checksums := fmt.Sprintf("%s/dists/%s/main/installer-%s/current/%s/SHA256SUMS", mirror, version, arch, imageDir)
 
-			fmt.Println(staticFromFlags(cmd, kernel, []string{initrd}, "").Serve())
+			quickServe(cmd, pixiecore.CacheKey{Distro: "ubuntu", Version: version, Arch: arch}, checksums, kernel, []string{initrd}, armConsoleCmdline(arch))
 		},
 	}
 
@@ -176,16 +306,30 @@ func fedoraRecipe(parent *cobra.Command) {
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
 			}
+			archWhitelist("Fedora", arch, []string{"x86_64", "aarch64", "ppc64le"})
 			mirror, err := cmd.Flags().GetString("mirror")
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
 			}
 
-			kernel := fmt.Sprintf("%s/releases/%s/Server/%s/os/images/pxeboot/vmlinuz", mirror, version, arch)
-			initrd := fmt.Sprintf("%s/releases/%s/Server/%s/os/images/pxeboot/initrd.img", mirror, version, arch)
-			stage2 := fmt.Sprintf("inst.stage2=%s/releases/%s/Server/%s/os/", mirror, version, arch)
+			// Fedora only ships a "Server" variant for x86_64; other
+			// architectures' pxeboot images live under "Everything"
+			// instead.
+			variant := "Server"
+			if arch != "x86_64" {
+				variant = "Everything"
+			}
+
+			kernel := fmt.Sprintf("%s/releases/%s/%s/%s/os/images/pxeboot/vmlinuz", mirror, version, variant, arch)
+			initrd := fmt.Sprintf("%s/releases/%s/%s/%s/os/images/pxeboot/initrd.img", mirror, version, variant, arch)
+			stage2 := fmt.Sprintf("inst.stage2=%s/releases/%s/%s/%s/os/", mirror, version, variant, arch)
+			cmdline := strings.TrimSpace(stage2 + " " + armConsoleCmdline(arch))
 
-			fmt.Println(staticFromFlags(cmd, kernel, []string{initrd}, stage2).Serve())
+			// Fedora only publishes per-image checksums inside
+			// .treeinfo, which ParseChecksums doesn't parse (see its
+			// doc comment), so there's no flat checksums URL to pass
+			// here; caching still applies, verification doesn't.
+			quickServe(cmd, pixiecore.CacheKey{Distro: "fedora", Version: version, Arch: arch}, "", kernel, []string{initrd}, cmdline)
 		},
 	}
 
@@ -228,6 +372,7 @@ func centosRecipe(parent *cobra.Command) {
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
 			}
+			archWhitelist("Centos", arch, []string{"x86_64", "aarch64", "ppc64le"})
 			mirror, err := cmd.Flags().GetString("mirror")
 			if err != nil {
 				fatalf("Error reading flag: %s", err)
@@ -236,8 +381,11 @@ func centosRecipe(parent *cobra.Command) {
 			kernel := fmt.Sprintf("%s/%s/os/%s/images/pxeboot/vmlinuz", mirror, version, arch)
 			initrd := fmt.Sprintf("%s/%s/os/%s/images/pxeboot/initrd.img", mirror, version, arch)
 			stage2 := fmt.Sprintf("inst.stage2=%s/%s/os/%s/", mirror, version, arch)
+			cmdline := strings.TrimSpace(stage2 + " " + armConsoleCmdline(arch))
 
-			fmt.Println(staticFromFlags(cmd, kernel, []string{initrd}, stage2).Serve())
+			// Same .treeinfo caveat as the Fedora recipe above: no flat
+			// checksums file to verify pxeboot images against.
+			quickServe(cmd, pixiecore.CacheKey{Distro: "centos", Version: version, Arch: arch}, "", kernel, []string{initrd}, cmdline)
 		},
 	}
 
@@ -257,7 +405,7 @@ func coreosRecipe(parent *cobra.Command) {
 
 	var coreosCmd = &cobra.Command{
 		Use:   "coreos version",
-		Short: "Boot a CoreOS installer",
+		Short: "Boot a CoreOS installer (deprecated: CoreOS Container Linux is EOL, see fcos/rhcos/flatcar)",
 		Long:  fmt.Sprintf(`Boot a CoreOS installer for the given version (one of %s)`, strings.Join(versions, ",")),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
@@ -282,7 +430,10 @@ func coreosRecipe(parent *cobra.Command) {
 			kernel := fmt.Sprintf("https://%s.release.core-os.net/%s-usr/current/coreos_production_pxe.vmlinuz", version, arch)
 			initrd := fmt.Sprintf("https://%s.release.core-os.net/%s-usr/current/coreos_production_pxe_image.cpio.gz", version, arch)
 
-			fmt.Println(staticFromFlags(cmd, kernel, []string{initrd}, "").Serve())
+			// CoreOS doesn't publish a flat SHA256SUMS for its pxe
+			// images either, so caching applies but verification
+			// doesn't (no checksumsURL).
+			quickServe(cmd, pixiecore.CacheKey{Distro: "coreos", Version: version, Arch: arch}, "", kernel, []string{initrd}, "")
 		},
 	}
 
@@ -292,6 +443,190 @@ func coreosRecipe(parent *cobra.Command) {
 	parent.AddCommand(coreosCmd)
 }
 
+// addIgnitionFlags adds the flags shared by the Ignition-aware CoreOS
+// derivative recipes (fcos/rhcos/flatcar): the URL of the Ignition
+// config to hand the installer, and the target install device.
+func addIgnitionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("ignition-url", "", "URL of an Ignition config for the installed system")
+	cmd.Flags().String("install-dev", "/dev/sda", "Target block device for coreos-installer")
+}
+
+// ignitionCmdline builds the coreos.inst.* kernel cmdline fragment
+// described in the osbuild CoreOS-derived edge/IoT image-building flow:
+// the Ignition config URL, the install target device, and
+// coreos.no_persist_ip (so a PXE-assigned address isn't baked into the
+// installed disk image).
+func ignitionCmdline(cmd *cobra.Command) string {
+	ignitionURL, err := cmd.Flags().GetString("ignition-url")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	installDev, err := cmd.Flags().GetString("install-dev")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+
+	var parts []string
+	if ignitionURL != "" {
+		parts = append(parts, fmt.Sprintf("coreos.inst.ignition_url=%s", ignitionURL))
+	}
+	if installDev != "" {
+		parts = append(parts, fmt.Sprintf("coreos.inst.install_dev=%s", installDev))
+	}
+	parts = append(parts, "coreos.no_persist_ip")
+	return strings.Join(parts, " ")
+}
+
+func fcosRecipe(parent *cobra.Command) {
+	streams := []string{"stable", "testing", "next"}
+
+	fcosCmd := &cobra.Command{
+		Use:   "fcos stream",
+		Short: "Boot a Fedora CoreOS PXE installer",
+		Long:  fmt.Sprintf("Boot a Fedora CoreOS installer for the given stream (one of %s)", strings.Join(streams, ",")),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fatalf("you must specify a Fedora CoreOS stream")
+			}
+			stream := args[0]
+			var found bool
+			for _, s := range streams {
+				if s == stream {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fatalf("Unknown Fedora CoreOS stream %q", stream)
+			}
+
+			arch, err := cmd.Flags().GetString("arch")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+			streamURL, err := cmd.Flags().GetString("stream-url")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+
+			kernel, initramfs, rootfs, err := coreosPXEArtifacts(fmt.Sprintf(streamURL, stream), arch)
+			if err != nil {
+				fatalf("fetching Fedora CoreOS stream metadata: %s", err)
+			}
+
+			quickServe(cmd, pixiecore.CacheKey{Distro: "fcos", Version: stream, Arch: arch}, "", kernel, []string{initramfs, rootfs}, ignitionCmdline(cmd))
+		},
+	}
+
+	fcosCmd.Flags().String("arch", "x86_64", "CPU architecture of the Fedora CoreOS installer files")
+	fcosCmd.Flags().String("stream-url", "https://builds.coreos.fedoraproject.org/streams/%s.json", "printf-style (%s -> stream) URL of the FCOS stream metadata JSON")
+	addIgnitionFlags(fcosCmd)
+	serverConfigFlags(fcosCmd)
+	staticConfigFlags(fcosCmd)
+	parent.AddCommand(fcosCmd)
+}
+
+func rhcosRecipe(parent *cobra.Command) {
+	streams := []string{"stable", "testing"}
+
+	rhcosCmd := &cobra.Command{
+		Use:   "rhcos stream",
+		Short: "Boot a RHEL CoreOS PXE installer",
+		Long:  fmt.Sprintf("Boot a RHEL CoreOS installer for the given stream (one of %s)", strings.Join(streams, ",")),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fatalf("you must specify a RHEL CoreOS stream")
+			}
+			stream := args[0]
+			var found bool
+			for _, s := range streams {
+				if s == stream {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fatalf("Unknown RHEL CoreOS stream %q", stream)
+			}
+
+			arch, err := cmd.Flags().GetString("arch")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+			streamURL, err := cmd.Flags().GetString("stream-url")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+
+			// RHCOS's real stream metadata lives behind OpenShift's
+			// release mirror and doesn't share a single stable URL
+			// pattern the way FCOS's does; --stream-url exists so a
+			// mirror matching FCOS's stream-metadata JSON schema (which
+			// RHCOS's tooling is derived from) can be pointed at here.
+			kernel, initramfs, rootfs, err := coreosPXEArtifacts(fmt.Sprintf(streamURL, stream), arch)
+			if err != nil {
+				fatalf("fetching RHEL CoreOS stream metadata: %s", err)
+			}
+
+			quickServe(cmd, pixiecore.CacheKey{Distro: "rhcos", Version: stream, Arch: arch}, "", kernel, []string{initramfs, rootfs}, ignitionCmdline(cmd))
+		},
+	}
+
+	rhcosCmd.Flags().String("arch", "x86_64", "CPU architecture of the RHEL CoreOS installer files")
+	rhcosCmd.Flags().String("stream-url", "https://rhcos.mirror.openshift.com/art/storage/streams/%s.json", "printf-style (%s -> stream) URL of the RHCOS stream metadata JSON")
+	addIgnitionFlags(rhcosCmd)
+	serverConfigFlags(rhcosCmd)
+	staticConfigFlags(rhcosCmd)
+	parent.AddCommand(rhcosCmd)
+}
+
+func flatcarRecipe(parent *cobra.Command) {
+	channels := []string{"stable", "beta", "alpha"}
+
+	flatcarCmd := &cobra.Command{
+		Use:   "flatcar channel",
+		Short: "Boot a Flatcar Container Linux PXE installer",
+		Long:  fmt.Sprintf("Boot a Flatcar installer for the given channel (one of %s)", strings.Join(channels, ",")),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				fatalf("you must specify a Flatcar channel")
+			}
+			channel := args[0]
+			var found bool
+			for _, c := range channels {
+				if c == channel {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fatalf("Unknown Flatcar channel %q", channel)
+			}
+
+			arch, err := cmd.Flags().GetString("arch")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+
+			// Unlike FCOS/RHCOS, Flatcar doesn't publish a JSON
+			// stream-metadata endpoint: its release bucket layout is
+			// stable enough to construct PXE artifact URLs directly,
+			// the same way the legacy coreosRecipe above did for
+			// Container Linux.
+			kernel := fmt.Sprintf("https://%s.release.flatcar-linux.net/%s-usr/current/flatcar_production_pxe.vmlinuz", channel, arch)
+			initramfs := fmt.Sprintf("https://%s.release.flatcar-linux.net/%s-usr/current/flatcar_production_pxe_image.cpio.gz", channel, arch)
+
+			quickServe(cmd, pixiecore.CacheKey{Distro: "flatcar", Version: channel, Arch: arch}, "", kernel, []string{initramfs}, ignitionCmdline(cmd))
+		},
+	}
+
+	flatcarCmd.Flags().String("arch", "amd64", "CPU architecture of the Flatcar installer files")
+	addIgnitionFlags(flatcarCmd)
+	serverConfigFlags(flatcarCmd)
+	staticConfigFlags(flatcarCmd)
+	parent.AddCommand(flatcarCmd)
+}
+
 func netbootRecipe(parent *cobra.Command) {
 	var netbootCmd = &cobra.Command{
 		Use:   "xyz",
@@ -330,8 +665,9 @@ version defaults to latest, can also be a YYYY.MM.DD iso release version`,
 			kernel := fmt.Sprintf("%s/arch/boot/%s/vmlinuz", httpSrv, arch)
 			initrd := fmt.Sprintf("%s/arch/boot/%s/archiso.img", httpSrv, arch)
 			cmdline := fmt.Sprintf("archisobasedir=arch archiso_http_srv=%s/ ip=dhcp verify=y net.ifnames=0", httpSrv)
+			checksums := fmt.Sprintf("%s/sha256sums.txt", httpSrv)
 
-			fmt.Println(staticFromFlags(cmd, kernel, []string{initrd}, cmdline).Serve())
+			quickServe(cmd, pixiecore.CacheKey{Distro: "arch", Version: version, Arch: arch}, checksums, kernel, []string{initrd}, cmdline)
 		},
 	}
 	archCmd.Flags().String("mirror", "https://mirrors.kernel.org/archlinux", "Root of the archlinux mirror to use")
@@ -348,9 +684,8 @@ func init() {
 	centosRecipe(quickCmd)
 	netbootRecipe(quickCmd)
 	coreosRecipe(quickCmd)
+	fcosRecipe(quickCmd)
+	rhcosRecipe(quickCmd)
+	flatcarRecipe(quickCmd)
 	archRecipe(quickCmd)
-
-	// TODO: some kind of caching support where quick OSes get
-	// downloaded locally, so you don't have to fetch from a remote
-	// server on every boot attempt.
 }
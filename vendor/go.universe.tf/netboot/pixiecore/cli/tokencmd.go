@@ -0,0 +1,103 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+	"go.universe.tf/netboot/pixiecore"
+)
+
+var (
+	tokenCmd = &cobra.Command{
+		Use:   "token",
+		Short: "Mint or inspect boot tokens, for debugging a --boot-token-key deployment",
+	}
+	tokenMintCmd = &cobra.Command{
+		Use:   "mint mac id",
+		Short: "Mint a boot token for the given MAC address and file ID",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 {
+				fatalf("you must specify a MAC address and a file ID")
+			}
+			mac, err := net.ParseMAC(args[0])
+			if err != nil {
+				fatalf("Invalid MAC address %q: %s", args[0], err)
+			}
+			key := tokenKeyFromFlags(cmd)
+			ttl, err := cmd.Flags().GetDuration("ttl")
+			if err != nil {
+				fatalf("Error reading flag: %s", err)
+			}
+
+			tok, err := pixiecore.NewBootTokenSource(key).Mint(mac, pixiecore.ID(args[1]), ttl)
+			if err != nil {
+				fatalf("Minting token: %s", err)
+			}
+			fmt.Println(tok)
+		},
+	}
+	tokenInspectCmd = &cobra.Command{
+		Use:   "inspect token",
+		Short: "Decode a boot token and print the MAC address, file ID and expiry it authorizes",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				fatalf("you must specify a token")
+			}
+			key := tokenKeyFromFlags(cmd)
+
+			info, err := pixiecore.InspectBootToken(args[0], key)
+			if err != nil {
+				fatalf("Inspecting token: %s", err)
+			}
+			status := "valid"
+			if info.Expired {
+				status = "EXPIRED"
+			}
+			fmt.Printf("mac:     %s\n", info.MAC)
+			fmt.Printf("id:      %s\n", info.ID)
+			fmt.Printf("expires: %s (%s)\n", info.Expires, status)
+		},
+	}
+)
+
+// tokenKeyFromFlags reads the key file named by --boot-token-key,
+// fatalf'ing out if it's unset or unreadable. Unlike
+// bootTokensFromFlags, an empty path is an error here: there's no
+// sensible token to mint or inspect without a key.
+func tokenKeyFromFlags(cmd *cobra.Command) pixiecore.BootTokenKey {
+	path, err := cmd.Flags().GetString("boot-token-key")
+	if err != nil {
+		fatalf("Error reading flag: %s", err)
+	}
+	if path == "" {
+		fatalf("you must specify --boot-token-key, pointing at the same key file the server uses")
+	}
+	key, err := loadOrGenerateBootTokenKey(path)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	return key
+}
+
+func init() {
+	tokenCmd.PersistentFlags().String("boot-token-key", "", "Path to the server's boot token key file")
+	tokenMintCmd.Flags().Duration("ttl", pixiecore.DefaultBootTokenTTL, "How long the minted token remains valid")
+	tokenCmd.AddCommand(tokenMintCmd)
+	tokenCmd.AddCommand(tokenInspectCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
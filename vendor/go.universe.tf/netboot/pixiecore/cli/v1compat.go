@@ -74,7 +74,7 @@ func v1compatCLI() bool {
 		}
 
 		log.Printf("Starting Pixiecore in API mode, with server %s", *apiServer)
-		booter, err := pixiecore.APIBooter(*apiServer, *apiTimeout)
+		booter, err := pixiecore.APIBooter(*apiServer, *apiTimeout, pixiecore.AuthOptions{}, nil, pixiecore.ClientTLSOptions{})
 		if err != nil {
 			fatalf("Failed to create API booter: %s", err)
 		}
@@ -111,7 +111,7 @@ func v1compatCLI() bool {
 			spec.Initrd = append(spec.Initrd, pixiecore.ID(initrd))
 		}
 
-		booter, err := pixiecore.StaticBooter(spec)
+		booter, err := pixiecore.StaticBooter(spec, nil)
 		if err != nil {
 			fatalf("Couldn't make static booter: %s", err)
 		}
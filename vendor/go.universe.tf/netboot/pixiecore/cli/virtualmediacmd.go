@@ -0,0 +1,140 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.universe.tf/netboot/pixiecore"
+)
+
+var virtualMediaCmd = &cobra.Command{
+	Use:   "virtualmedia server [server...]",
+	Short: "Serve per-machine ISO/disk images for BMCs that mount virtual media instead of PXE booting",
+	Long: `Virtual media mode answers the same boot API server as "api" mode,
+but instead of handing DHCP/iPXE-booting machines a chain of HTTP
+fetches, it assembles a bootable ISO9660 image (optionally also a
+hybrid raw disk image) embedding the kernel, initrds, and cmdline of
+the Spec the API server returns, and serves it at /_/image. Point a
+Redfish/IPMI BMC's virtual media mount, or libvirt/QEMU's CD-ROM/disk
+config, at http://<this host>/_/image?mac=<mac>&format=iso (or img,
+img.gz).
+
+This command runs only the HTTP server; it never binds the DHCP, TFTP,
+or PXE ports.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fatalf("you must specify at least one API URL")
+		}
+		timeout, err := cmd.Flags().GetDuration("api-request-timeout")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		authOpts, err := apiAuthOptionsFromFlags(cmd)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		cache, err := artifactCacheFromFlags(cmd)
+		if err != nil {
+			fatalf("Couldn't make artifact cache: %s", err)
+		}
+		tlsOpts, err := apiClientTLSOptionsFromFlags(cmd)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		retry, err := apiRetryPolicyFromFlags(cmd)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		booter, err := pixiecore.NewAPIBooter(pixiecore.APIBooterConfig{
+			Endpoints: args,
+			Timeout:   timeout,
+			Auth:      authOpts,
+			Cache:     cache,
+			TLS:       tlsOpts,
+			Retry:     retry,
+		})
+		if err != nil {
+			fatalf("Failed to create API booter: %s", err)
+		}
+
+		vmedia, err := virtualMediaSourceFromFlags(cmd, booter)
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+
+		addr, err := cmd.Flags().GetString("listen-addr")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			fatalf("Error reading flag: %s", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/_/image", vmedia)
+		l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", addr, port))
+		if err != nil {
+			fatalf("Couldn't listen on %s:%d: %s", addr, port, err)
+		}
+		fmt.Printf("Serving virtual media images on %s\n", l.Addr())
+		fmt.Println(http.Serve(l, mux))
+	}}
+
+func init() {
+	rootCmd.AddCommand(virtualMediaCmd)
+	virtualMediaCmd.Flags().StringP("listen-addr", "l", "0.0.0.0", "IPv4 address to listen on")
+	virtualMediaCmd.Flags().IntP("port", "p", 80, "Port to listen on for HTTP")
+	virtualMediaCmd.Flags().Duration("api-request-timeout", 5*time.Second, "Timeout for request to the API server")
+	apiAuthConfigFlags(virtualMediaCmd)
+	artifactCacheConfigFlags(virtualMediaCmd)
+	apiClientTLSConfigFlags(virtualMediaCmd)
+	apiRetryConfigFlags(virtualMediaCmd)
+	virtualMediaConfigFlags(virtualMediaCmd)
+}
+
+// virtualMediaConfigFlags registers the flags virtualMediaSourceFromFlags reads.
+func virtualMediaConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().String("iso-master", "", "Path to a mkisofs-compatible ISO mastering binary; empty searches $PATH for genisoimage, mkisofs, then xorriso")
+	cmd.Flags().String("isolinux-bin", "", "Path to isolinux.bin, embedded as the El Torito boot image so format=iso is BIOS-bootable; required for format=img/img.gz")
+	cmd.Flags().String("isohybrid-bin", "", "Path to the isohybrid binary, used to patch format=img/img.gz so they're also valid raw disk images; empty searches $PATH")
+}
+
+// virtualMediaSourceFromFlags builds a pixiecore.VirtualMediaSource
+// wrapping booter from the flags virtualMediaConfigFlags registered.
+func virtualMediaSourceFromFlags(cmd *cobra.Command, booter pixiecore.Booter) (*pixiecore.VirtualMediaSource, error) {
+	isoMaster, err := cmd.Flags().GetString("iso-master")
+	if err != nil {
+		return nil, err
+	}
+	isolinuxBin, err := cmd.Flags().GetString("isolinux-bin")
+	if err != nil {
+		return nil, err
+	}
+	isohybridBin, err := cmd.Flags().GetString("isohybrid-bin")
+	if err != nil {
+		return nil, err
+	}
+	v := pixiecore.NewVirtualMediaSource(booter)
+	v.IsoMaster = isoMaster
+	v.IsolinuxBin = isolinuxBin
+	v.Isohybrid = isohybridBin
+	return v, nil
+}
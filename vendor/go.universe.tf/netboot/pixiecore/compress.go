@@ -0,0 +1,155 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CompressedBootFileSource is an optional interface a Booter can
+// implement to expose a cached, pre-compressed representation of one
+// of its boot files, so handleFile can serve it with Content-Encoding
+// set instead of compressing the file on every request.
+type CompressedBootFileSource interface {
+	// ReadCompressedBootFile returns a reader over id compressed with
+	// algo, and whether a compressed representation exists at all.
+	// found is false, with a nil error, when there's simply nothing
+	// cached for id yet - that's not a failure, just "handleFile should
+	// fall back to the uncompressed ReadBootFile".
+	ReadCompressedBootFile(id ID, algo string) (rc io.ReadCloser, size int64, found bool, err error)
+}
+
+// GzipCache wraps a Booter, adding a disk-backed, on-demand gzip cache
+// for its boot files: ReadCompressedBootFile("gzip") compresses a file
+// the first time it's requested and reuses the cached .gz after that,
+// the same one-fetch-many-readers shape as artifact_cache.go's
+// DiskCache, but keyed by compression algorithm rather than source URL.
+//
+// Only "gzip" is implemented: iPXE has no built-in decompressor of its
+// own for lz4, so an lz4-compressed artifact would need Pixiecore to
+// decompress it again before handing it to iPXE, which defeats the
+// point of caching a compressed form in the first place. Until this
+// package vendors an lz4 library to decompress on the way out,
+// ReadCompressedBootFile simply reports found=false for any algorithm
+// other than "gzip" so handleFile falls back to serving the file
+// uncompressed.
+type GzipCache struct {
+	Booter
+	dir string
+	// exempt lists IDs ReadCompressedBootFile should never compress -
+	// the config knob to force compression off for artifacts that are
+	// already compressed (e.g. a bzImage kernel), where gzip would just
+	// burn CPU for no size benefit.
+	exempt map[ID]bool
+}
+
+// NewGzipCache creates a GzipCache storing compressed blobs under dir
+// (created if missing), wrapping booter, with exempt IDs never
+// compressed.
+func NewGzipCache(dir string, booter Booter, exempt ...ID) (*GzipCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	ex := make(map[ID]bool, len(exempt))
+	for _, id := range exempt {
+		ex[id] = true
+	}
+	return &GzipCache{Booter: booter, dir: dir, exempt: ex}, nil
+}
+
+// cachePath returns the on-disk path GzipCache caches id's gzipped
+// bytes at, named after a hash of id so arbitrary IDs (which may
+// contain characters unsafe for a filename) are always valid.
+func (g *GzipCache) cachePath(id ID) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(g.dir, hex.EncodeToString(sum[:])+".gz")
+}
+
+// ReadCompressedBootFile implements CompressedBootFileSource.
+func (g *GzipCache) ReadCompressedBootFile(id ID, algo string) (io.ReadCloser, int64, bool, error) {
+	if algo != "gzip" || g.exempt[id] {
+		return nil, -1, false, nil
+	}
+
+	path := g.cachePath(id)
+	if rc, size, err := openSized(path); err == nil {
+		return rc, size, true, nil
+	} else if !os.IsNotExist(err) {
+		return nil, -1, false, err
+	}
+
+	if err := g.populate(id, path); err != nil {
+		return nil, -1, false, err
+	}
+
+	rc, size, err := openSized(path)
+	if err != nil {
+		return nil, -1, false, err
+	}
+	return rc, size, true, nil
+}
+
+// populate fetches id from the wrapped Booter and writes its gzipped
+// bytes to path, via a temp file renamed into place so a reader never
+// sees a partially-written cache entry.
+func (g *GzipCache) populate(id ID, path string) error {
+	src, _, err := g.Booter.ReadBootFile(id)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(out)
+	_, copyErr := io.Copy(gw, src)
+	closeErr := gw.Close()
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if closeErr := out.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		os.Remove(tmp)
+		return copyErr
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// openSized opens path and stats it in one step, for the common
+// "open a cache file and report its size" pattern above.
+func openSized(path string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, -1, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, -1, err
+	}
+	return f, fi.Size(), nil
+}
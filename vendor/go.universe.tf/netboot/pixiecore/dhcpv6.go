@@ -2,49 +2,122 @@ package pixiecore
 
 import (
 	"fmt"
+	"net"
+
 	"go.universe.tf/netboot/dhcp6"
 )
 
 func (s *ServerV6) serveDHCP(conn *dhcp6.Conn) error {
 	s.debug("dhcpv6", "Waiting for packets...\n")
 	for {
-		pkt, src, err := conn.RecvDHCP()
+		pkt, relayPkt, src, err := conn.RecvAny()
 		if err != nil {
 			return fmt.Errorf("Error receiving DHCP packet: %s", err)
 		}
-		if err := pkt.ShouldDiscard(s.Duid); err != nil {
-			s.debug("dhcpv6", fmt.Sprintf("Discarding (%d) packet (%d): %s\n", pkt.Type, pkt.TransactionID, err))
+
+		if relayPkt != nil {
+			s.serveRelayed(conn, relayPkt, src)
 			continue
 		}
 
-		s.debug("dhcpv6", fmt.Sprintf("Received (%d) packet (%d): %s\n", pkt.Type, pkt.TransactionID, pkt.Options.HumanReadable()))
+		s.servePacket(conn, pkt, src)
+	}
+}
 
-		response, err := s.PacketBuilder.BuildResponse(pkt, s.Duid, s.BootConfig, s.AddressPool)
-		if err != nil {
-			s.log("dhcpv6", fmt.Sprintf("Error creating response for transaction: %d: %s", pkt.TransactionID, err))
-			if response == nil {
-				s.log("dhcpv6", fmt.Sprintf("Dropping the packet"))
-				continue
-			} else {
-				s.log("dhcpv6", fmt.Sprintf("Will notify the client"))
-			}
-		}
+// servePacket answers a client's direct (non-relayed) request, replying
+// to src on the client port.
+func (s *ServerV6) servePacket(conn *dhcp6.Conn, pkt *dhcp6.Packet, src net.IP) {
+	if err := pkt.ShouldDiscard(s.Duid); err != nil {
+		s.debug("dhcpv6", fmt.Sprintf("Discarding (%d) packet (%d): %s\n", pkt.Type, pkt.TransactionID, err))
+		return
+	}
+
+	s.debug("dhcpv6", fmt.Sprintf("Received (%d) packet (%d): %s\n", pkt.Type, pkt.TransactionID, pkt.Options.HumanReadable()))
+
+	response, err := s.PacketBuilder.BuildResponse(pkt, s.Duid, s.BootConfig, s.AddressPool)
+	if err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error creating response for transaction: %d: %s", pkt.TransactionID, err))
 		if response == nil {
-			s.log("dhcpv6", fmt.Sprintf("Don't know how to respond to packet type: %d (transaction id %d)", pkt.Type, pkt.TransactionID))
-			continue
+			s.log("dhcpv6", fmt.Sprintf("Dropping the packet"))
+			return
 		}
+		s.log("dhcpv6", fmt.Sprintf("Will notify the client"))
+	}
+	if response == nil {
+		s.log("dhcpv6", fmt.Sprintf("Don't know how to respond to packet type: %d (transaction id %d)", pkt.Type, pkt.TransactionID))
+		return
+	}
 
-		marshalledResponse, err := response.Marshal()
-		if err != nil {
-			s.log("dhcpv6", fmt.Sprintf("Error marshalling response (%d) (%d): %s", response.Type, response.TransactionID, err))
-			continue
-		}
+	marshalledResponse, err := response.Marshal()
+	if err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error marshalling response (%d) (%d): %s", response.Type, response.TransactionID, err))
+		return
+	}
 
-		if err := conn.SendDHCP(src, marshalledResponse); err != nil {
-			s.log("dhcpv6", fmt.Sprintf("Error sending reply (%d) (%d): %s", response.Type, response.TransactionID, err))
-			continue
+	if err := conn.SendDHCP(src, marshalledResponse); err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error sending reply (%d) (%d): %s", response.Type, response.TransactionID, err))
+		return
+	}
+
+	s.debug("dhcpv6", fmt.Sprintf("Sent (%d) packet (%d): %s\n", response.Type, response.TransactionID, response.Options.HumanReadable()))
+}
+
+// serveRelayed answers a client's request forwarded by a relay agent in
+// a Relay-Forward, wrapping the reply in a Relay-Reply and sending it
+// back to the relay agent (src) on the server/relay port rather than to
+// the client directly, see RFC 3315 section 20.
+func (s *ServerV6) serveRelayed(conn *dhcp6.Conn, relayPkt *dhcp6.RelayPacket, src net.IP) {
+	if !s.relayTrusted(src) {
+		s.debug("dhcpv6", fmt.Sprintf("Discarding relayed packet from untrusted relay %s\n", src))
+		return
+	}
+	if s.MaxHopCount > 0 && relayPkt.HopCount > s.MaxHopCount {
+		s.debug("dhcpv6", fmt.Sprintf("Discarding relayed packet from %s: hop count %d exceeds limit %d\n", src, relayPkt.HopCount, s.MaxHopCount))
+		return
+	}
+
+	pkt, err := dhcp6.UnmarshalClientPacket(relayPkt)
+	if err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error unwrapping relayed packet from %s: %s", src, err))
+		return
+	}
+
+	if err := pkt.ShouldDiscard(s.Duid); err != nil {
+		s.debug("dhcpv6", fmt.Sprintf("Discarding relayed (%d) packet (%d): %s\n", pkt.Type, pkt.TransactionID, err))
+		return
+	}
+
+	s.debug("dhcpv6", fmt.Sprintf("Received relayed (%d) packet (%d) via %s: %s\n", pkt.Type, pkt.TransactionID, src, pkt.Options.HumanReadable()))
+
+	response, err := s.PacketBuilder.BuildResponse(pkt, s.Duid, s.BootConfig, s.addressPoolFor(relayPkt.LinkAddress))
+	if err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error creating response for relayed transaction: %d: %s", pkt.TransactionID, err))
+		if response == nil {
+			s.log("dhcpv6", fmt.Sprintf("Dropping the packet"))
+			return
 		}
+	}
+	if response == nil {
+		s.log("dhcpv6", fmt.Sprintf("Don't know how to respond to relayed packet type: %d (transaction id %d)", pkt.Type, pkt.TransactionID))
+		return
+	}
 
-		s.debug("dhcpv6", fmt.Sprintf("Sent (%d) packet (%d): %s\n", response.Type, response.TransactionID, response.Options.HumanReadable()))
+	relayReply, err := dhcp6.WrapInRelayReply(relayPkt, response)
+	if err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error wrapping relay reply (%d) (%d): %s", response.Type, response.TransactionID, err))
+		return
 	}
+
+	marshalledResponse, err := relayReply.Marshal()
+	if err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error marshalling relay reply (%d) (%d): %s", response.Type, response.TransactionID, err))
+		return
+	}
+
+	if err := conn.SendDHCPRelay(src, marshalledResponse); err != nil {
+		s.log("dhcpv6", fmt.Sprintf("Error sending relay reply (%d) (%d): %s", response.Type, response.TransactionID, err))
+		return
+	}
+
+	s.debug("dhcpv6", fmt.Sprintf("Sent relayed (%d) packet (%d) via %s: %s\n", response.Type, response.TransactionID, src, response.Options.HumanReadable()))
 }
@@ -0,0 +1,146 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// DigestMismatchError is returned by a digest-verifying ReadCloser (see
+// newDigestReader) once the bytes read don't hash to the digest they
+// were supposed to. It comes back as the final error from a Read call,
+// so callers streaming the body (e.g. handleFile's io.Copy) see it in
+// place of a clean io.EOF.
+type DigestMismatchError struct {
+	Artifact  string
+	Algorithm string
+	Want      string
+	Got       string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s digest mismatch: want %s, got %s", e.Artifact, e.Algorithm, e.Want, e.Got)
+}
+
+// digestReader wraps a ReadCloser, hashing the bytes as they're read
+// and comparing the result against an expected digest once the
+// underlying reader reports io.EOF. A mismatch replaces that io.EOF
+// with a *DigestMismatchError, so whoever's copying the stream (e.g.
+// handleFile) gets a hard error instead of a clean end of file.
+type digestReader struct {
+	io.ReadCloser
+	h        hash.Hash
+	artifact string
+	algo     string
+	want     []byte
+}
+
+// newDigestReader wraps rc so that its bytes are verified against the
+// hex-encoded digest for the named algorithm ("sha256" or "sha512") as
+// they're read. artifact is used only to identify the file in a
+// resulting DigestMismatchError.
+func newDigestReader(rc io.ReadCloser, algo, hexDigest, artifact string) (io.ReadCloser, error) {
+	want, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s digest %q for %s: %s", algo, hexDigest, artifact, err)
+	}
+
+	var h hash.Hash
+	switch algo {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q for %s", algo, artifact)
+	}
+
+	return &digestReader{ReadCloser: rc, h: h, artifact: artifact, algo: algo, want: want}, nil
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if n > 0 {
+		d.h.Write(p[:n])
+	}
+	if err == io.EOF {
+		if got := d.h.Sum(nil); !bytes.Equal(got, d.want) {
+			return n, &DigestMismatchError{
+				Artifact:  d.artifact,
+				Algorithm: d.algo,
+				Want:      hex.EncodeToString(d.want),
+				Got:       hex.EncodeToString(got),
+			}
+		}
+	}
+	return n, err
+}
+
+// digestFragmentPrefixes lists the URL fragment keys splitDigestFragment
+// recognizes, in preference order.
+var digestFragmentPrefixes = []string{"sha256=", "sha512="}
+
+// embedDigestFragment returns urlStr with a "#sha256=..." or
+// "#sha512=..." fragment added, so that the digest survives being
+// signed into an opaque ID and round-tripped through getURL. sha256hex
+// takes priority if both are set. If neither digest is set, urlStr is
+// returned unchanged (including any digest fragment it already had,
+// e.g. from an API server using the URL-fragment interop mode instead
+// of the "sha256"/"sha512" JSON fields).
+func embedDigestFragment(urlStr, sha256hex, sha512hex string) (string, error) {
+	digest := sha256hex
+	algo := "sha256"
+	if digest == "" {
+		digest, algo = sha512hex, "sha512"
+	}
+	if digest == "" {
+		return urlStr, nil
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a URL: %s", urlStr, err)
+	}
+	u.Fragment = algo + "=" + digest
+	return u.String(), nil
+}
+
+// splitDigestFragment parses a "#sha256=..."/"#sha512=..." fragment
+// off of urlStr, returning the URL with the fragment removed alongside
+// the algorithm and hex digest it named. If urlStr has no such
+// fragment, algo and digest come back empty and cleanURL is urlStr
+// unchanged.
+func splitDigestFragment(urlStr string) (cleanURL, algo, digest string, err error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%q is not a URL: %s", urlStr, err)
+	}
+	frag := u.Fragment
+	for _, prefix := range digestFragmentPrefixes {
+		if strings.HasPrefix(frag, prefix) {
+			u.Fragment = ""
+			return u.String(), strings.TrimSuffix(prefix, "="), strings.TrimPrefix(frag, prefix), nil
+		}
+	}
+	return urlStr, "", "", nil
+}
@@ -0,0 +1,253 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// EtcdKV is the subset of an etcd v3 client that EtcdBooter needs: a
+// key/value Get with optional prefix matching, a Put, and a long-lived
+// Watch of a key prefix. go.etcd.io/etcd/client/v3's Client already
+// exposes Get/Put/Watch with compatible semantics; this package keeps
+// its own narrow interface rather than depending on that package
+// directly, since no etcd client is vendored in this tree. Wrapping a
+// real *clientv3.Client to satisfy EtcdKV is a few lines of glue in
+// whatever binary links in go.etcd.io/etcd.
+type EtcdKV interface {
+	// Get returns the value at key, or (if prefix is true) the values
+	// of every key having key as a prefix, keyed by their full key
+	// path. A missing key (or empty prefix match) is not an error: it
+	// simply returns an empty map.
+	Get(ctx context.Context, key string, prefix bool) (map[string][]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	// Watch streams every create/modify/delete under prefix until ctx
+	// is cancelled, at which point the returned channel is closed.
+	Watch(ctx context.Context, prefix string) <-chan EtcdKVEvent
+	Close() error
+}
+
+// EtcdKVEvent describes a single key changing in etcd.
+type EtcdKVEvent struct {
+	Key     string
+	Value   []byte
+	Deleted bool
+}
+
+const (
+	etcdMachinePrefix = "/pixiecore/machines/"
+	etcdDefaultKey    = "/pixiecore/default"
+	etcdImagePrefix   = "/pixiecore/images/"
+	etcdWatchPrefix   = "/pixiecore/"
+)
+
+// EtcdBooter boots machines using per-machine Spec documents stored in
+// an etcd v3 cluster, following the layout used by the blacksmith
+// netboot project:
+//
+//	/pixiecore/machines/<mac>                       per-machine Spec, JSON
+//	/pixiecore/default                              fallback Spec, JSON
+//	/pixiecore/images/<distro>/<version>/<artifact>  artifact location
+//
+// A Spec's Kernel, and each entry of Initrd, may be either a literal
+// location (as accepted by StaticBooter) or a reference of the form
+// "image://<distro>/<version>/<artifact>", which EtcdBooter resolves
+// against the images registry at BootSpec time. <artifact> is free-form
+// ("kernel", "initrd", or anything else the images registry was
+// populated with); EtcdBooter defaults it to "kernel" for Spec.Kernel
+// and "initrd" for Spec.Initrd entries when omitted, e.g.
+// "image://coreos/1234.5.0" for a kernel reference.
+//
+// EtcdBooter logs every change observed under /pixiecore/ via kv's
+// Watch, so operators can see boot policy updates take effect without
+// restarting Pixiecore.
+func EtcdBooter(kv EtcdKV) (Booter, error) {
+	ret := &etcdBooter{kv: kv}
+	ret.watch()
+	return ret, nil
+}
+
+type etcdBooter struct {
+	kv EtcdKV
+}
+
+func (b *etcdBooter) watch() {
+	go func() {
+		for ev := range b.kv.Watch(context.Background(), etcdWatchPrefix) {
+			if ev.Deleted {
+				log.Printf("etcd booter: %s deleted", ev.Key)
+			} else {
+				log.Printf("etcd booter: %s updated", ev.Key)
+			}
+		}
+	}()
+}
+
+func (b *etcdBooter) BootSpec(m Machine) (*Spec, error) {
+	key := etcdMachinePrefix + m.MAC.String()
+	raw, err := b.getOne(key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up boot spec for %s: %s", m.MAC, err)
+	}
+	if raw == nil {
+		raw, err = b.getOne(etcdDefaultKey)
+		if err != nil {
+			return nil, fmt.Errorf("looking up default boot spec: %s", err)
+		}
+		if raw == nil {
+			return nil, fmt.Errorf("no boot spec for %s, and no default spec configured", m.MAC)
+		}
+	}
+
+	var spec Spec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("decoding boot spec for %s: %s", m.MAC, err)
+	}
+
+	if spec.Kernel, err = b.resolveImage(spec.Kernel, "kernel"); err != nil {
+		return nil, err
+	}
+	for i, initrd := range spec.Initrd {
+		if spec.Initrd[i], err = b.resolveImage(initrd, "initrd"); err != nil {
+			return nil, err
+		}
+	}
+
+	return &spec, nil
+}
+
+// MachineVars reads the per-machine variables stored (as a JSON
+// object) at /pixiecore/machines/<mac>/vars. A missing key is not an
+// error: it just means the machine has no variables configured.
+func (b *etcdBooter) MachineVars(m Machine) (map[string]string, error) {
+	key := etcdMachinePrefix + m.MAC.String() + "/vars"
+	raw, err := b.getOne(key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up vars for %s: %s", m.MAC, err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	var vars map[string]string
+	if err := json.Unmarshal(raw, &vars); err != nil {
+		return nil, fmt.Errorf("decoding vars for %s: %s", m.MAC, err)
+	}
+	return vars, nil
+}
+
+func (b *etcdBooter) getOne(key string) ([]byte, error) {
+	vals, err := b.kv.Get(context.Background(), key, false)
+	if err != nil {
+		return nil, err
+	}
+	return vals[key], nil
+}
+
+// resolveImage turns an "image://<distro>/<version>[/<artifact>]"
+// reference into the literal location stored for it in the images
+// registry. IDs that aren't image:// references are returned
+// unchanged.
+func (b *etcdBooter) resolveImage(id ID, defaultArtifact string) (ID, error) {
+	const scheme = "image://"
+	if !strings.HasPrefix(string(id), scheme) {
+		return id, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(string(id), scheme), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("malformed image reference %q, want image://<distro>/<version>[/<artifact>]", id)
+	}
+	distro, version := parts[0], parts[1]
+	artifact := defaultArtifact
+	if len(parts) == 3 && parts[2] != "" {
+		artifact = parts[2]
+	}
+
+	key := fmt.Sprintf("%s%s/%s/%s", etcdImagePrefix, distro, version, artifact)
+	raw, err := b.getOne(key)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %s", id, err)
+	}
+	if raw == nil {
+		return "", fmt.Errorf("no image registered at %s (referenced by %s)", key, id)
+	}
+	return ID(raw), nil
+}
+
+func (b *etcdBooter) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
+	return openArtifact(string(id))
+}
+
+func (b *etcdBooter) WriteBootFile(id ID, body io.Reader) error {
+	return writeArtifact(string(id), body)
+}
+
+// openArtifact opens an http(s):// URL or local file path, the two
+// kinds of location an images registry entry or a literal Spec field
+// may name. It mirrors staticBooter.serveFile's handling of the same
+// two cases.
+func openArtifact(path string) (io.ReadCloser, int64, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		resp, err := http.Get(path)
+		if err != nil {
+			return nil, -1, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, -1, fmt.Errorf("%s: %s", path, http.StatusText(resp.StatusCode))
+		}
+		return resp.Body, resp.ContentLength, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, -1, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, -1, err
+	}
+	return f, fi.Size(), nil
+}
+
+// writeArtifact is openArtifact's write-side counterpart, used to
+// stash a machine-supplied file (e.g. a report-back script result)
+// back into the images registry's backing store.
+func writeArtifact(path string, body io.Reader) error {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		resp, err := http.Post(path, "application/octet-stream", body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("POST %q failed: %s", path, resp.Status)
+		}
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, body)
+	return err
+}
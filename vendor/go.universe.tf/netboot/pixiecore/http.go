@@ -23,8 +23,10 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
+	"unicode"
 )
 
 func serveHTTP(l net.Listener, handlers ...func(*http.ServeMux)) error {
@@ -90,6 +92,16 @@ func (s *Server) handleIpxe(w http.ResponseWriter, r *http.Request) {
 	s.debug("HTTP", "Get bootspec for %s took %s", mac, time.Since(start))
 	if err != nil {
 		s.log("HTTP", "Couldn't get a bootspec for %s (query %q from %s): %s", mac, r.URL, r.RemoteAddr, err)
+		var unavailable *APIUnavailableError
+		if errors.As(err, &unavailable) {
+			// The boot API is down rather than saying no: ask iPXE's
+			// chain-loading retry loop to come back shortly, instead of
+			// dropping the machine to a local shell on what's likely a
+			// transient outage.
+			w.Header().Set("Retry-After", strconv.Itoa(int(unavailable.RetryAfter.Seconds())))
+			http.Error(w, "boot API temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, "couldn't get a bootspec", http.StatusInternalServerError)
 		return
 	}
@@ -100,8 +112,17 @@ func (s *Server) handleIpxe(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "you don't netboot", http.StatusNotFound)
 		return
 	}
+	vars, err := s.Booter.MachineVars(mach)
+	if err != nil {
+		s.log("HTTP", "Couldn't get machine vars for %s (query %q from %s): %s", mac, r.URL, r.RemoteAddr, err)
+		http.Error(w, "couldn't get machine vars", http.StatusInternalServerError)
+		return
+	}
+
+	gzipCapable := ipxeSupportsGzip(r.UserAgent())
+
 	start = time.Now()
-	script, err := ipxeScript(mach, spec, r.Host)
+	script, err := ipxeScript(mach, spec, r.Host, vars, s.BootTokens, gzipCapable)
 	s.debug("HTTP", "Construct ipxe script for %s took %s", mac, time.Since(start))
 	if err != nil {
 		s.log("HTTP", "Failed to assemble ipxe script for %s (query %q from %s): %s", mac, r.URL, r.RemoteAddr, err)
@@ -125,6 +146,29 @@ func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing filename", http.StatusBadRequest)
 	}
 
+	if s.BootTokens != nil {
+		mac, err := net.ParseMAC(r.URL.Query().Get("mac"))
+		if err != nil {
+			s.debug("HTTP", "Bad request %q from %s, missing/invalid MAC address for boot token check: %s", r.URL, r.RemoteAddr, err)
+			http.Error(w, "missing or invalid MAC address", http.StatusBadRequest)
+			return
+		}
+		if err := s.BootTokens.Verify(r.URL.Query().Get("token"), mac, ID(name)); err != nil {
+			s.debug("HTTP", "Rejecting %q from %s: %s", r.URL, r.RemoteAddr, err)
+			http.Error(w, "missing, expired, or invalid boot token", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Serving a compressed representation with Content-Length set isn't
+	// compatible with a byte-range request, whose offsets are into the
+	// uncompressed file, so this only applies to whole-file requests.
+	if r.Header.Get("Range") == "" && wantsGzip(r) {
+		if served := s.handleCompressedFile(w, r, name); served {
+			return
+		}
+	}
+
 	f, sz, err := s.Booter.ReadBootFile(ID(name))
 	if err != nil {
 		s.log("HTTP", "Error getting file %q (query %q from %s): %s", name, r.URL, r.RemoteAddr, err)
@@ -132,17 +176,133 @@ func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer f.Close()
+
+	if rsc, ok := f.(SizedReadSeekerCloser); ok {
+		// http.ServeContent handles Range, If-Range, and conditional
+		// requests for us, and re-derives the size via Seek if needed.
+		http.ServeContent(w, r, name, time.Time{}, rsc)
+		s.log("HTTP", "Sent file %q to %s", name, r.RemoteAddr)
+		s.fileSentEvent(r, name)
+		return
+	}
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || sz < 0 {
+		if sz >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(sz, 10))
+		} else {
+			s.log("HTTP", "Unknown file size for %q, boot will be VERY slow (can your Booter provide file sizes?)", name)
+		}
+		if _, err = io.Copy(w, f); err != nil {
+			s.log("HTTP", "Copy of %q to %s (query %q) failed: %s", name, r.RemoteAddr, r.URL, err)
+			s.digestMismatchEvent(r, name, err)
+			return
+		}
+		s.log("HTTP", "Sent file %q to %s", name, r.RemoteAddr)
+		s.fileSentEvent(r, name)
+		return
+	}
+
+	start, end, err := parseRange(rangeHeader, sz)
+	if err != nil {
+		s.debug("HTTP", "Bad range %q for %q from %s: %s", rangeHeader, name, r.RemoteAddr, err)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", sz))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	body := f
+	if rr, ok := s.Booter.(BooterRangeReader); ok {
+		// Let the Booter forward the range upstream, instead of us
+		// fetching and discarding a prefix over a connection we
+		// already have open.
+		f.Close()
+		if body, _, err = rr.ReadBootFileAt(ID(name), start); err != nil {
+			s.log("HTTP", "Error getting range of %q (query %q from %s): %s", name, r.URL, r.RemoteAddr, err)
+			http.Error(w, "couldn't get file", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+	} else if start > 0 {
+		if _, err := io.CopyN(io.Discard, f, start); err != nil {
+			s.log("HTTP", "Skipping to offset %d of %q for %s failed: %s", start, name, r.RemoteAddr, err)
+			http.Error(w, "couldn't get file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, sz))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if _, err = io.CopyN(w, body, end-start+1); err != nil {
+		s.log("HTTP", "Copy of %q range %d-%d to %s (query %q) failed: %s", name, start, end, r.RemoteAddr, r.URL, err)
+		return
+	}
+	s.log("HTTP", "Sent range %d-%d of %q to %s", start, end, name, r.RemoteAddr)
+	s.fileSentEvent(r, name)
+}
+
+// acceptsGzip reports whether r's Accept-Encoding header lists gzip.
+func acceptsGzip(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+}
+
+// wantsGzip reports whether handleFile should try serving a
+// gzip-compressed representation for r: either the client sent a
+// standard Accept-Encoding: gzip (e.g. a human fetching a file with
+// curl), or the URL carries the "gzip=1" hint ipxeScript stamps onto
+// the kernel/initrd URLs it hands to a gzip-capable iPXE build.
+func wantsGzip(r *http.Request) bool {
+	return acceptsGzip(r) || r.URL.Query().Get("gzip") == "1"
+}
+
+// ipxeSupportsGzip reports whether the iPXE build identified by
+// User-Agent can transparently decompress a gzipped image it fetches
+// (iPXE has done so since its "zlib" build option landed in v1.0.0+).
+// Anything that doesn't self-identify as iPXE is assumed not to
+// support it, since we can't be sure of its decompression behavior.
+func ipxeSupportsGzip(userAgent string) bool {
+	return strings.HasPrefix(userAgent, "iPXE/")
+}
+
+// handleCompressedFile serves name gzip-compressed if s.Booter exposes
+// a cached compressed representation via CompressedBootFileSource,
+// reporting whether it did so. false means there's nothing compressed
+// cached for name (not an error) and handleFile should fall back to
+// ReadBootFile.
+func (s *Server) handleCompressedFile(w http.ResponseWriter, r *http.Request, name string) bool {
+	src, ok := s.Booter.(CompressedBootFileSource)
+	if !ok {
+		return false
+	}
+
+	rc, sz, found, err := src.ReadCompressedBootFile(ID(name), "gzip")
+	if err != nil {
+		s.log("HTTP", "Compressed fetch of %q for %s failed, falling back to uncompressed: %s", name, r.RemoteAddr, err)
+		return false
+	}
+	if !found {
+		return false
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Encoding", "gzip")
 	if sz >= 0 {
 		w.Header().Set("Content-Length", strconv.FormatInt(sz, 10))
-	} else {
-		s.log("HTTP", "Unknown file size for %q, boot will be VERY slow (can your Booter provide file sizes?)", name)
 	}
-	if _, err = io.Copy(w, f); err != nil {
-		s.log("HTTP", "Copy of %q to %s (query %q) failed: %s", name, r.RemoteAddr, r.URL, err)
-		return
+	if _, err := io.Copy(w, rc); err != nil {
+		s.log("HTTP", "Copy of gzip-compressed %q to %s failed: %s", name, r.RemoteAddr, err)
+		return true
 	}
-	s.log("HTTP", "Sent file %q to %s", name, r.RemoteAddr)
+	s.log("HTTP", "Sent gzip-compressed file %q to %s", name, r.RemoteAddr)
+	s.fileSentEvent(r, name)
+	return true
+}
 
+// fileSentEvent emits the machine event matching the "type" query
+// parameter handleFile was called with ("kernel" or "initrd"), once
+// the corresponding bytes have actually been sent.
+func (s *Server) fileSentEvent(r *http.Request, name string) {
 	switch r.URL.Query().Get("type") {
 	case "kernel":
 		mac, err := net.ParseMAC(r.URL.Query().Get("mac"))
@@ -161,6 +321,77 @@ func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// digestMismatchEvent emits a machine event when err is a
+// *DigestMismatchError, so operators see tampering or mirror
+// corruption in the log stream rather than just a truncated transfer
+// in their iPXE console.
+func (s *Server) digestMismatchEvent(r *http.Request, name string, err error) {
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) {
+		return
+	}
+	mac, macErr := net.ParseMAC(r.URL.Query().Get("mac"))
+	if macErr != nil {
+		s.log("HTTP", "File fetch provided invalid MAC address %q", r.URL.Query().Get("mac"))
+		return
+	}
+	switch r.URL.Query().Get("type") {
+	case "kernel":
+		s.machineEvent(mac, machineStateKernel, "Digest mismatch serving kernel %q: %s", name, mismatch)
+	case "initrd":
+		s.machineEvent(mac, machineStateInitrd, "Digest mismatch serving initrd %q: %s", name, mismatch)
+	}
+}
+
+// parseRange parses a single-range HTTP Range header (e.g. "bytes=0-499",
+// "bytes=500-", or "bytes=-500") against a file of the given size,
+// returning the inclusive [start, end] byte range to serve. Multi-range
+// requests ("bytes=0-1,2-3") aren't supported and return an error, same
+// as an unsatisfiable range.
+func parseRange(header string, size int64) (start, end int64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return 0, 0, fmt.Errorf("unsupported range unit in %q", header)
+	}
+	spec := strings.TrimPrefix(header, prefix)
+	if strings.Contains(spec, ",") {
+		return 0, 0, fmt.Errorf("multiple ranges not supported")
+	}
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed range %q", header)
+	}
+
+	if parts[0] == "" {
+		// Suffix range: the last N bytes.
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("malformed range %q", header)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+
+	if start, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("malformed range %q", header)
+	}
+	if parts[1] == "" {
+		end = size - 1
+	} else if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("malformed range %q", header)
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start < 0 || start > end {
+		return 0, 0, fmt.Errorf("unsatisfiable range %q for a %d byte file", header, size)
+	}
+	return start, end, nil
+}
+
 func (s *Server) handleBooting(w http.ResponseWriter, r *http.Request) {
 	// Return a no-op boot script, to satisfy iPXE. It won't get used,
 	// the boot script deletes this image immediately after
@@ -180,7 +411,36 @@ func (s *Server) handleBooting(w http.ResponseWriter, r *http.Request) {
 	s.machineEvent(mac, machineStateBooted, "Booting into OS")
 }
 
-func ipxeScript(mach Machine, spec *Spec, serverHost string) ([]byte, error) {
+// fileURL builds the /_/file URL iPXE uses to fetch id for mach. If
+// tokens is non-nil, it mints a DefaultBootTokenTTL token binding the
+// URL to mach.MAC and id, which handleFile will then require.
+func fileURL(serverHost, id, typ string, mach Machine, tokens *BootTokenSource, gzipCapable bool) (string, error) {
+	u := fmt.Sprintf("http://%s/_/file?name=%s&mac=%s", serverHost, url.QueryEscape(id), url.QueryEscape(mach.MAC.String()))
+	if typ != "" {
+		u += "&type=" + url.QueryEscape(typ)
+	}
+	if gzipCapable {
+		u += "&gzip=1"
+	}
+	if tokens != nil {
+		tok, err := tokens.Mint(mach.MAC, ID(id), DefaultBootTokenTTL)
+		if err != nil {
+			return "", fmt.Errorf("minting boot token for %q: %s", id, err)
+		}
+		u += "&token=" + url.QueryEscape(tok)
+	}
+	return u, nil
+}
+
+// ipxeScript assembles the iPXE script that fetches and boots spec. If
+// gzipCapable is true (the requesting iPXE build can transparently
+// decompress a gzipped fetch, see ipxeSupportsGzip), the kernel and
+// initrd URLs are given a "gzip=1" hint - which handleFile takes as
+// permission to serve a cached gzip-compressed representation via
+// CompressedBootFileSource - and their in-memory --name is suffixed
+// with ".gz" so the iPXE console makes the compression visible. If
+// tokens is non-nil, every URL is minted a boot token (see fileURL).
+func ipxeScript(mach Machine, spec *Spec, serverHost string, vars map[string]string, tokens *BootTokenSource, gzipCapable bool) ([]byte, error) {
 	if spec.IpxeScript != "" {
 		return []byte(spec.IpxeScript), nil
 	}
@@ -189,28 +449,45 @@ func ipxeScript(mach Machine, spec *Spec, serverHost string) ([]byte, error) {
 		return nil, errors.New("spec is missing Kernel")
 	}
 
-	urlTemplate := fmt.Sprintf("http://%s/_/file?name=%%s&type=%%s&mac=%%s", serverHost)
+	nameSuffix := ""
+	if gzipCapable {
+		nameSuffix = ".gz"
+	}
+
 	var b bytes.Buffer
 	b.WriteString("#!ipxe\n")
-	u := fmt.Sprintf(urlTemplate, url.QueryEscape(string(spec.Kernel)), "kernel", url.QueryEscape(mach.MAC.String()))
-	fmt.Fprintf(&b, "kernel --name kernel %s\n", u)
+	u, err := fileURL(serverHost, string(spec.Kernel), "kernel", mach, tokens, gzipCapable)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&b, "kernel --name kernel%s %s\n", nameSuffix, u)
 	for i, initrd := range spec.Initrd {
-		u = fmt.Sprintf(urlTemplate, url.QueryEscape(string(initrd)), "initrd", url.QueryEscape(mach.MAC.String()))
-		fmt.Fprintf(&b, "initrd --name initrd%d %s\n", i, u)
+		u, err = fileURL(serverHost, string(initrd), "initrd", mach, tokens, gzipCapable)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "initrd --name initrd%d%s %s\n", i, nameSuffix, u)
 	}
 
 	fmt.Fprintf(&b, "imgfetch --name ready http://%s/_/booting?mac=%s ||\n", serverHost, url.QueryEscape(mach.MAC.String()))
 	b.WriteString("imgfree ready ||\n")
 
-	b.WriteString("boot kernel ")
+	fmt.Fprintf(&b, "boot kernel%s ", nameSuffix)
 	for i := range spec.Initrd {
-		fmt.Fprintf(&b, "initrd=initrd%d ", i)
+		fmt.Fprintf(&b, "initrd=initrd%d%s ", i, nameSuffix)
 	}
 
-	f := func(id string) string {
-		return fmt.Sprintf("http://%s/_/file?name=%s", serverHost, url.QueryEscape(id))
+	f := func(id string) (string, error) {
+		return fileURL(serverHost, id, "", mach, tokens, false)
+	}
+	v := func(key string) (string, error) {
+		val, ok := vars[key]
+		if !ok {
+			return "", fmt.Errorf("no machine variable %q for %s", key, mach.MAC)
+		}
+		return quoteCmdlineValue(val), nil
 	}
-	cmdline, err := expandCmdline(spec.Cmdline, template.FuncMap{"ID": f})
+	cmdline, err := expandCmdline(spec.Cmdline, template.FuncMap{"ID": f, "V": v})
 	if err != nil {
 		return nil, fmt.Errorf("expanding cmdline %q: %s", spec.Cmdline, err)
 	}
@@ -219,3 +496,20 @@ func ipxeScript(mach Machine, spec *Spec, serverHost string) ([]byte, error) {
 
 	return b.Bytes(), nil
 }
+
+// quoteCmdlineValue returns v as-is if it's safe to splice unquoted
+// into a kernel cmdline token (e.g. a plain hostname), or a
+// Go-syntax-quoted (and thus shell-metacharacter-safe) version of v
+// otherwise. This mirrors the %q formatting apibooter.constructCmdline
+// uses for boolean/string cmdline values from the boot API.
+func quoteCmdlineValue(v string) string {
+	if v == "" {
+		return strconv.Quote(v)
+	}
+	for _, r := range v {
+		if unicode.IsSpace(r) || r == '"' || r == '\\' || r == '$' || r == '`' {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
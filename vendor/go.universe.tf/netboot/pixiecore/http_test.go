@@ -20,8 +20,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -32,6 +34,9 @@ func (b booterFunc) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
 	return nil, -1, errors.New("no")
 }
 func (b booterFunc) WriteBootFile(id ID, r io.Reader) error { return errors.New("no") }
+func (b booterFunc) MachineVars(m Machine) (map[string]string, error) {
+	return nil, nil
+}
 
 func TestIpxe(t *testing.T) {
 	booter := func(m Machine) (*Spec, error) {
@@ -150,6 +155,99 @@ boot kernel initrd=initrd0 initrd=initrd1 thing=http://localhost:1234/_/file?nam
 	}
 }
 
+func TestIpxeScriptVars(t *testing.T) {
+	mach := Machine{MAC: mustParseMAC(t, "01:02:03:04:05:06")}
+	spec := &Spec{
+		Kernel:  "k",
+		Cmdline: `hostname={{ V "hostname" }} role={{ V "role" }}`,
+	}
+
+	vars := map[string]string{
+		"hostname": "node-1",
+		"role":     "control plane",
+	}
+	script, err := ipxeScript(mach, spec, "localhost:1234", vars, nil, false)
+	if err != nil {
+		t.Fatalf("ipxeScript: %s", err)
+	}
+	want := `hostname=node-1 role="control plane"`
+	if !strings.Contains(string(script), want) {
+		t.Fatalf("expected script to contain %q, got:\n%s", want, script)
+	}
+
+	// Referencing a variable the Booter didn't provide is an error,
+	// not a silently empty expansion.
+	spec.Cmdline = `hostname={{ V "hostname" }} missing={{ V "nope" }}`
+	if _, err := ipxeScript(mach, spec, "localhost:1234", vars, nil, false); err == nil {
+		t.Fatal("expected an error expanding a reference to an unset variable, got nil")
+	}
+}
+
+func mustParseMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatalf("parsing test MAC %q: %s", s, err)
+	}
+	return mac
+}
+
+type rangeableFile []byte
+
+func (b rangeableFile) BootSpec(m Machine) (*Spec, error) { return nil, nil }
+func (b rangeableFile) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
+	// A plain bytes.Reader isn't a SizedReadSeekerCloser (no Close), so
+	// handleFile has to take the manual Range-parsing path rather than
+	// handing off to http.ServeContent - that's the path this test
+	// wants to exercise.
+	return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+}
+func (b rangeableFile) WriteBootFile(id ID, r io.Reader) error { return errors.New("no") }
+func (b rangeableFile) MachineVars(m Machine) (map[string]string, error) {
+	return nil, nil
+}
+
+func TestFileRanges(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	log := func(subsystem, msg string) { t.Logf("[%s] %s", subsystem, msg) }
+	s := &Server{
+		Booter: rangeableFile(data),
+		Log:    log,
+		Debug:  log,
+	}
+
+	fetch := func(rangeHeader string) []byte {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/_/file?name=initrd", nil)
+		if err != nil {
+			t.Fatalf("constructing range request: %s", err)
+		}
+		req.Header.Set("Range", rangeHeader)
+		s.handleFile(rr, req)
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("range %q: got HTTP %d, want %d", rangeHeader, rr.Code, http.StatusPartialContent)
+		}
+		return rr.Body.Bytes()
+	}
+
+	// Three overlapping ranges covering the whole 10000-byte file.
+	a := fetch("bytes=0-3999")
+	b := fetch("bytes=3000-6999")
+	c := fetch("bytes=6000-9999")
+
+	var reassembled []byte
+	reassembled = append(reassembled, a...)
+	reassembled = append(reassembled, b[1000:]...) // skip the 0-999 overlap with a
+	reassembled = append(reassembled, c[1000:]...) // skip the 6000-6999 overlap with b
+
+	if !bytes.Equal(reassembled, data) {
+		t.Fatalf("reassembled ranges don't match the original %d bytes", len(data))
+	}
+}
+
 type readBootFile string
 
 func (b readBootFile) BootSpec(m Machine) (*Spec, error) { return nil, nil }
@@ -158,6 +256,9 @@ func (b readBootFile) ReadBootFile(id ID) (io.ReadCloser, int64, error) {
 	return ioutil.NopCloser(bytes.NewBuffer([]byte(d))), int64(len(d)), nil
 }
 func (b readBootFile) WriteBootFile(id ID, r io.Reader) error { return errors.New("no") }
+func (b readBootFile) MachineVars(m Machine) (map[string]string, error) {
+	return nil, nil
+}
 
 func TestFile(t *testing.T) {
 	log := func(subsystem, msg string) { t.Logf("[%s] %s", subsystem, msg) }
@@ -15,10 +15,35 @@ type ServerV6 struct {
 	Port    string
 	Duid    []byte
 
+	// RelayListenAddress, when set, makes Serve also listen on this
+	// address for traffic forwarded by a DHCPv6 relay agent (RFC 3315
+	// section 20), in addition to Address. This is useful when the
+	// relay agent's packets arrive on an interface/address other than
+	// the one Address is bound to.
+	RelayListenAddress string
+
 	BootConfig    dhcp6.BootConfiguration
 	PacketBuilder *dhcp6.PacketBuilder
 	AddressPool   dhcp6.AddressPool
 
+	// AddressPools lets relayed clients be served out of a pool chosen by
+	// the link-address the outermost relay reports them on (RFC 3315
+	// section 20), instead of always AddressPool. The first entry whose
+	// Prefix contains the Relay-Forward's link-address wins; if none
+	// match, or AddressPools is empty, AddressPool is used as before.
+	AddressPools []PoolForLink
+
+	// MaxHopCount discards a Relay-Forward whose HopCount exceeds it, as
+	// a guard against relay loops or misconfigured chains (RFC 3315
+	// section 20 expects relays to cap forwarding similarly). Zero means
+	// no limit.
+	MaxHopCount byte
+
+	// TrustedRelayPrefixes restricts which relay agent source addresses
+	// serveRelayed accepts Relay-Forward messages from. An empty list
+	// trusts any source, matching the pre-existing behavior.
+	TrustedRelayPrefixes []*net.IPNet
+
 	errs chan error
 
 	Log   func(subsystem, msg string)
@@ -56,9 +81,23 @@ func (s *ServerV6) Serve() error {
 
 	go func() { s.errs <- s.serveDHCP(dhcp) }()
 
+	var relayDHCP *dhcp6.Conn
+	if s.RelayListenAddress != "" {
+		relayDHCP, err = dhcp6.NewConn(s.RelayListenAddress, s.Port)
+		if err != nil {
+			dhcp.Close()
+			return err
+		}
+		s.debug("dhcp", "new relay-agent connection...")
+		go func() { s.errs <- s.serveDHCP(relayDHCP) }()
+	}
+
 	// Wait for either a fatal error, or Shutdown().
 	err = <-s.errs
 	dhcp.Close()
+	if relayDHCP != nil {
+		relayDHCP.Close()
+	}
 
 	s.log("dhcp", "stopped...")
 	return err
@@ -86,6 +125,43 @@ func (s *ServerV6) debug(subsystem, format string, args ...interface{}) {
 	s.Debug(subsystem, fmt.Sprintf(format, args...))
 }
 
+// PoolForLink pairs an AddressPool with the relay link-address prefix it
+// should serve, letting a single ServerV6 hand out addresses from
+// different pools depending on which subnet a relay agent reports a
+// client as being on.
+type PoolForLink struct {
+	Prefix *net.IPNet
+	Pool   dhcp6.AddressPool
+}
+
+// addressPoolFor returns the AddressPool that should serve a client
+// reachable via linkAddress: the first entry in AddressPools whose
+// Prefix contains it, or s.AddressPool if AddressPools is empty or none
+// match.
+func (s *ServerV6) addressPoolFor(linkAddress net.IP) dhcp6.AddressPool {
+	for _, p := range s.AddressPools {
+		if p.Prefix != nil && p.Prefix.Contains(linkAddress) {
+			return p.Pool
+		}
+	}
+	return s.AddressPool
+}
+
+// relayTrusted reports whether src, the source address of a Relay-Forward,
+// falls within one of TrustedRelayPrefixes. An empty TrustedRelayPrefixes
+// trusts every source.
+func (s *ServerV6) relayTrusted(src net.IP) bool {
+	if len(s.TrustedRelayPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range s.TrustedRelayPrefixes {
+		if prefix.Contains(src) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *ServerV6) setDUID(addr net.HardwareAddr) {
 	duid := make([]byte, len(addr)+8) // see rfc3315, section 9.2, DUID-LT
 
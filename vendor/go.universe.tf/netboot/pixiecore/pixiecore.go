@@ -16,6 +16,7 @@ package pixiecore // import "go.universe.tf/netboot/pixiecore"
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -77,9 +78,12 @@ type Spec struct {
 	// Optional init ramdisks for linux kernels
 	Initrd []ID
 	// Optional kernel commandline. This string is evaluated as a
-	// text/template template, in which "ID(x)" function is
-	// available. Invoking ID(x) returns a URL that will call
-	// Booter.ReadBootFile(x) when fetched.
+	// text/template template, in which two functions are available:
+	// ID(x), which returns a URL that will call Booter.ReadBootFile(x)
+	// when fetched, and V(key), which looks up key in the Booter's
+	// MachineVars(m) for the machine currently booting, quoting it if
+	// necessary to be safe as a cmdline token. Referencing a key
+	// MachineVars doesn't provide is an expansion error.
 	Cmdline string
 	// Message to print on the client machine before booting.
 	Message string
@@ -132,6 +136,36 @@ type Booter interface {
 	ReadBootFile(id ID) (io.ReadCloser, int64, error)
 	// Write the given Reader to an ID given in Spec.
 	WriteBootFile(id ID, body io.Reader) error
+	// MachineVars returns per-machine variables to make available to
+	// the "V" function in a Spec's Cmdline template, e.g. hostname,
+	// cluster role, or a join token. A nil map (with a nil error)
+	// means "no variables for this machine", which is fine as long as
+	// the cmdline doesn't reference V.
+	MachineVars(m Machine) (map[string]string, error)
+}
+
+// SizedReadSeekerCloser is an io.ReadCloser that can also Seek, e.g. an
+// *os.File. A Booter whose ReadBootFile returns one of these gets
+// Range, If-Range, and conditional request handling for free: handleFile
+// hands it straight to http.ServeContent instead of streaming the
+// whole file from byte 0.
+type SizedReadSeekerCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// BooterRangeReader is an optional capability a Booter may implement
+// alongside ReadBootFile. When handleFile needs to serve a Range
+// request and ReadBootFile didn't return a SizedReadSeekerCloser, it
+// prefers ReadBootFileAt over reading and discarding a prefix itself,
+// since a Booter fetching from an upstream server (e.g. apibooter) can
+// usually forward the range request instead of paying for the
+// discarded bytes twice.
+type BooterRangeReader interface {
+	// ReadBootFileAt returns the bytes of id starting at offset, and
+	// the total size of the underlying file (not the remaining size
+	// from offset).
+	ReadBootFileAt(id ID, offset int64) (io.ReadCloser, int64, error)
 }
 
 // Firmware describes a kind of firmware attempting to boot.
@@ -191,6 +225,18 @@ type Server struct {
 	// assets. Used for development of Pixiecore.
 	UIAssetsDir string
 
+	// TLS configures whether /_/ipxe and /_/file are served over HTTPS
+	// instead of plain HTTP. The zero ServerTLSOptions{} keeps plain
+	// HTTP, matching Serve's original behavior.
+	TLS ServerTLSOptions
+
+	// BootTokens, if non-nil, requires every /_/file fetch to carry a
+	// short-lived token binding it to the requesting MAC address and
+	// file ID. handleIpxe mints one per file URL it hands out; nil
+	// (the default) serves /_/file unauthenticated, matching Serve's
+	// original behavior.
+	BootTokens *BootTokenSource
+
 	errs chan error
 
 	eventsMu sync.Mutex
@@ -240,6 +286,17 @@ func (s *Server) Serve() error {
 		pxe.Close()
 		return err
 	}
+	tlsConfig, err := serverTLSConfig(s.TLS)
+	if err != nil {
+		dhcp.Close()
+		tftp.Close()
+		pxe.Close()
+		http.Close()
+		return err
+	}
+	if tlsConfig != nil {
+		http = tls.NewListener(http, tlsConfig)
+	}
 
 	s.events = make(map[string][]machineEvent)
 	// 5 buffer slots, one for each goroutine, plus one for
@@ -0,0 +1,124 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// ClientTLSOptions configures how APIBooter authenticates the API
+// server it talks to, and how it authenticates itself in turn.
+type ClientTLSOptions struct {
+	// CertFile and KeyFile, if both set, are a client certificate and
+	// key presented to the API server for mTLS.
+	CertFile, KeyFile string
+	// CAFile, if set, is a PEM bundle used instead of the system trust
+	// store to verify the API server's certificate, for pinning to a
+	// private CA.
+	CAFile string
+	// ACMEEnabled requests that the client certificate instead be
+	// obtained automatically from an ACME endpoint. Not available in
+	// this build: see newHTTPTransport.
+	ACMEEnabled bool
+}
+
+// ServerTLSOptions configures how Server.Serve terminates TLS for the
+// /_/ipxe and /_/file endpoints.
+type ServerTLSOptions struct {
+	// CertFile and KeyFile, if both set, are the certificate and key
+	// Serve uses to terminate TLS.
+	CertFile, KeyFile string
+	// ACMEEnabled requests that CertFile/KeyFile instead be obtained
+	// and renewed automatically from an ACME endpoint (e.g. Let's
+	// Encrypt), answering HTTP-01 challenges on the same HTTP port
+	// Serve already listens on. Not available in this build: see
+	// serverTLSConfig.
+	ACMEEnabled bool
+	// ACMECacheDir is where an ACME-obtained certificate would be
+	// cached on disk across restarts.
+	ACMECacheDir string
+}
+
+// empty reports whether o requests no TLS termination at all.
+func (o ServerTLSOptions) empty() bool {
+	return o.CertFile == "" && o.KeyFile == "" && !o.ACMEEnabled
+}
+
+// newHTTPTransport builds an http.RoundTripper's TLS configuration from
+// opts: a client certificate for mTLS (CertFile/KeyFile) and/or a
+// custom CA pool for pinning (CAFile). Returns nil if opts requests no
+// TLS customization, so callers can plug it straight into
+// http.Transport.TLSClientConfig.
+//
+// opts.ACMEEnabled isn't implemented: obtaining a client certificate
+// from an ACME endpoint needs a vendored ACME client (e.g.
+// golang.org/x/crypto/acme), which this tree doesn't carry, the same
+// "don't fabricate an unvendored dependency" rule etcd_booter.go's
+// EtcdKV and metadata.NewStore's etcd/redis/sqlite cases already
+// follow.
+func newHTTPTransport(opts ClientTLSOptions) (*tls.Config, error) {
+	if opts.ACMEEnabled {
+		return nil, fmt.Errorf("pixiecore: ACME client certificate issuance is not available in this build (no vendored ACME client)")
+	}
+	if opts.CertFile == "" && opts.KeyFile == "" && opts.CAFile == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %q", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// serverTLSConfig builds the tls.Config Serve should terminate
+// connections with, or nil if opts requests no TLS. Like
+// newHTTPTransport, opts.ACMEEnabled isn't implemented here: autocert's
+// golang.org/x/crypto/acme/autocert isn't vendored in this tree, so
+// there's no certificate manager to hand an HTTP-01 challenge handler
+// to. A supplied CertFile/KeyFile pair works today; wiring in
+// autocert.Manager once it's vendored is a matter of returning
+// manager.TLSConfig() here instead of erroring.
+func serverTLSConfig(opts ServerTLSOptions) (*tls.Config, error) {
+	if opts.empty() {
+		return nil, nil
+	}
+	if opts.ACMEEnabled {
+		return nil, fmt.Errorf("pixiecore: ACME certificate issuance is not available in this build (no vendored ACME/autocert client)")
+	}
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading server certificate: %s", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
@@ -0,0 +1,406 @@
+// Copyright 2026 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pixiecore
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// An ImageFormat is one of the virtual-media image formats
+// VirtualMediaSource can assemble.
+type ImageFormat string
+
+// The image formats /_/image accepts as its "format" query parameter.
+const (
+	// ImageFormatISO is a plain ISO9660 filesystem image.
+	ImageFormatISO ImageFormat = "iso"
+	// ImageFormatIMG is ImageFormatISO additionally hybridized (see
+	// VirtualMediaSource.Isohybrid) so it's also mountable as a raw,
+	// partitionable disk.
+	ImageFormatIMG ImageFormat = "img"
+	// ImageFormatIMGGZ is ImageFormatIMG, gzip-compressed.
+	ImageFormatIMGGZ ImageFormat = "img.gz"
+	// ImageFormatIMGLZ4 is ImageFormatIMG, lz4-compressed. Not
+	// currently implemented; see WriteImage.
+	ImageFormatIMGLZ4 ImageFormat = "img.lz4"
+)
+
+// ParseImageFormat parses s as one of the ImageFormat constants,
+// reporting false if s doesn't name a known format.
+func ParseImageFormat(s string) (ImageFormat, bool) {
+	switch f := ImageFormat(s); f {
+	case ImageFormatISO, ImageFormatIMG, ImageFormatIMGGZ, ImageFormatIMGLZ4:
+		return f, true
+	default:
+		return "", false
+	}
+}
+
+// VirtualMediaSource assembles, on demand, a bootable image for a
+// Machine's Spec, for BMCs (Redfish/IPMI) that mount an ISO or disk
+// image instead of PXE booting. It wraps a Booter the same way
+// GzipCache does, reusing BootSpec/MachineVars/ReadBootFile so the same
+// Spec drives both network boot and virtual-media boot.
+//
+// Producing a genuinely BIOS/UEFI-bootable image requires an El Torito
+// boot catalog pointing at a real bootloader boot-sector binary
+// (isolinux.bin for BIOS, a GRUB core.img for UEFI). Those are binary
+// artifacts shipped by the syslinux/grub2 OS packages, not Go
+// libraries, and aren't vendored in this tree - so IsolinuxBin is a
+// config knob pointing at one already installed on the host, and
+// WriteImage falls back to a plain, non-bootable data ISO (still
+// useful for a BMC that stages the kernel/initrd/cmdline content for
+// some other in-environment bootloader) when it's unset. UEFI/GRUB
+// boot catalogs aren't implemented at all yet.
+type VirtualMediaSource struct {
+	Booter Booter
+
+	// IsoMaster is the path to a mkisofs-compatible ISO mastering
+	// binary (genisoimage, mkisofs, or xorriso's mkisofs emulation
+	// mode). If empty, WriteImage looks for each of those names on
+	// $PATH, in that order.
+	IsoMaster string
+	// IsolinuxBin is the path to isolinux.bin (from the syslinux
+	// package), embedded as the El Torito boot image so format=iso
+	// produces a BIOS-bootable ISO. If empty, the ISO is assembled
+	// without a boot catalog, and format=img/img.gz are unavailable
+	// (see Isohybrid).
+	IsolinuxBin string
+	// Isohybrid is the path to the isohybrid binary (from syslinux),
+	// used to patch the ISO so it's also a valid MBR/GPT-partitionable
+	// raw disk for format=img/img.gz. If empty, "isohybrid" is looked
+	// up on $PATH.
+	Isohybrid string
+}
+
+// NewVirtualMediaSource returns a VirtualMediaSource wrapping booter,
+// with IsoMaster/IsolinuxBin/Isohybrid left for the caller to set.
+func NewVirtualMediaSource(booter Booter) *VirtualMediaSource {
+	return &VirtualMediaSource{Booter: booter}
+}
+
+// WriteImage assembles a boot image for mach in format, and streams it
+// to w. The kernel and initrds are fetched via Booter.ReadBootFile and
+// staged to a temp directory (ISO mastering tools need real files, not
+// streams), but that temp directory and the assembled image are both
+// removed once WriteImage returns; the only "full buffering" this
+// incurs is of the image itself on local disk, not in memory, and the
+// final copy to w is a streaming io.Copy.
+func (v *VirtualMediaSource) WriteImage(ctx context.Context, w io.Writer, mach Machine, format ImageFormat) error {
+	if format == ImageFormatIMGLZ4 {
+		return errors.New("pixiecore: format=img.lz4 is not available in this build (no vendored lz4 encoder); use iso, img, or img.gz")
+	}
+
+	spec, err := v.Booter.BootSpec(mach)
+	if err != nil {
+		return fmt.Errorf("getting boot spec for %s: %w", mach.MAC, err)
+	}
+	if spec == nil {
+		return fmt.Errorf("no boot spec for %s", mach.MAC)
+	}
+	if spec.IpxeScript != "" {
+		return errors.New("pixiecore: virtual media boot doesn't support a Spec with a raw IpxeScript, it needs Kernel/Initrd/Cmdline")
+	}
+	if spec.Kernel == "" {
+		return errors.New("pixiecore: spec is missing Kernel")
+	}
+
+	vars, err := v.Booter.MachineVars(mach)
+	if err != nil {
+		return fmt.Errorf("getting machine vars for %s: %w", mach.MAC, err)
+	}
+	cmdline, err := expandCmdline(spec.Cmdline, template.FuncMap{
+		"ID": func(id string) (string, error) {
+			return "", fmt.Errorf("cmdline references ID(%q), which resolves to an HTTP fetch URL - not usable from a virtual media image, which has no Pixiecore HTTP server backing it once the BMC boots it", id)
+		},
+		"V": func(key string) (string, error) {
+			val, ok := vars[key]
+			if !ok {
+				return "", fmt.Errorf("no machine variable %q for %s", key, mach.MAC)
+			}
+			return quoteCmdlineValue(val), nil
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("expanding cmdline: %w", err)
+	}
+
+	staging, err := ioutil.TempDir("", "pixiecore-vmedia-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := v.stageBootFile(spec.Kernel, filepath.Join(staging, "vmlinuz")); err != nil {
+		return fmt.Errorf("staging kernel: %w", err)
+	}
+	var initrdNames []string
+	for i, id := range spec.Initrd {
+		name := fmt.Sprintf("initrd%d", i)
+		if err := v.stageBootFile(id, filepath.Join(staging, name)); err != nil {
+			return fmt.Errorf("staging %s: %w", name, err)
+		}
+		initrdNames = append(initrdNames, name)
+	}
+	cfg := isolinuxConfig(cmdline, initrdNames, spec.Message)
+	if err := ioutil.WriteFile(filepath.Join(staging, "isolinux.cfg"), []byte(cfg), 0644); err != nil {
+		return err
+	}
+
+	isoPath := filepath.Join(staging, "image.iso")
+	if err := v.masterISO(ctx, staging, isoPath); err != nil {
+		return err
+	}
+
+	switch format {
+	case ImageFormatISO:
+		return streamFile(isoPath, w)
+	case ImageFormatIMG, ImageFormatIMGGZ:
+		if err := v.hybridize(ctx, isoPath); err != nil {
+			return err
+		}
+		if format == ImageFormatIMG {
+			return streamFile(isoPath, w)
+		}
+		return streamFileGzip(isoPath, w)
+	default:
+		return fmt.Errorf("unknown image format %q", format)
+	}
+}
+
+// stageBootFile fetches id from the wrapped Booter and writes it to
+// path, for the ISO mastering tool to pick up.
+func (v *VirtualMediaSource) stageBootFile(id ID, path string) error {
+	rc, _, err := v.Booter.ReadBootFile(id)
+	if err != nil {
+		return fmt.Errorf("fetching %q: %w", id, err)
+	}
+	defer rc.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, rc)
+	return err
+}
+
+// isolinuxConfig renders a minimal isolinux/syslinux configuration that
+// boots vmlinuz with initrdNames as its initrd= argument and cmdline
+// appended, printing message first if set.
+func isolinuxConfig(cmdline string, initrdNames []string, message string) string {
+	var b strings.Builder
+	if message != "" {
+		fmt.Fprintf(&b, "# %s\n", message)
+	}
+	b.WriteString("DEFAULT linux\n")
+	b.WriteString("LABEL linux\n")
+	b.WriteString("  KERNEL /vmlinuz\n")
+	if len(initrdNames) > 0 {
+		paths := make([]string, len(initrdNames))
+		for i, n := range initrdNames {
+			paths[i] = "/" + n
+		}
+		fmt.Fprintf(&b, "  INITRD %s\n", strings.Join(paths, ","))
+	}
+	fmt.Fprintf(&b, "  APPEND %s\n", cmdline)
+	return b.String()
+}
+
+// isoMasterPath returns the ISO mastering binary to invoke: v.IsoMaster
+// if set, else the first of genisoimage/mkisofs/xorriso found on $PATH.
+func (v *VirtualMediaSource) isoMasterPath() (string, error) {
+	if v.IsoMaster != "" {
+		return v.IsoMaster, nil
+	}
+	for _, name := range []string{"genisoimage", "mkisofs", "xorriso"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("pixiecore: no ISO mastering tool (genisoimage, mkisofs, or xorriso) found on $PATH; set VirtualMediaSource.IsoMaster or install one")
+}
+
+// masterISO invokes the ISO mastering tool over the files staged in
+// dir, writing the resulting image to isoPath. If v.IsolinuxBin is set,
+// it's embedded as the El Torito boot image so the result is
+// BIOS-bootable; otherwise the ISO only carries the staged files, with
+// no boot catalog.
+func (v *VirtualMediaSource) masterISO(ctx context.Context, dir, isoPath string) error {
+	bin, err := v.isoMasterPath()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-quiet", "-J", "-r", "-V", "PIXIECORE", "-o", isoPath}
+	if v.IsolinuxBin != "" {
+		if err := copyFile(v.IsolinuxBin, filepath.Join(dir, "isolinux.bin")); err != nil {
+			return fmt.Errorf("staging isolinux.bin: %w", err)
+		}
+		args = append(args, "-b", "isolinux.bin", "-c", "boot.cat", "-no-emul-boot", "-boot-load-size", "4", "-boot-info-table")
+	}
+	args = append(args, dir)
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", filepath.Base(bin), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// hybridize patches isoPath in place with isohybrid, making it also
+// valid as a raw MBR/GPT-partitionable disk image. isohybrid requires
+// the source ISO to already carry an El Torito boot catalog, so this
+// errors out clearly if IsolinuxBin wasn't set (masterISO then didn't
+// produce one).
+func (v *VirtualMediaSource) hybridize(ctx context.Context, isoPath string) error {
+	if v.IsolinuxBin == "" {
+		return errors.New("pixiecore: format=img/img.gz requires VirtualMediaSource.IsolinuxBin to be set (isohybrid needs an El Torito boot catalog to patch); format=iso is available without it")
+	}
+	bin := v.Isohybrid
+	if bin == "" {
+		var err error
+		if bin, err = exec.LookPath("isohybrid"); err != nil {
+			return errors.New("pixiecore: isohybrid (from syslinux) not found on $PATH; set VirtualMediaSource.Isohybrid or install it")
+		}
+	}
+	cmd := exec.CommandContext(ctx, bin, isoPath)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("isohybrid failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// copyFile copies src to dst, preserving no metadata beyond content -
+// dst is created (or truncated) with mode 0644.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// streamFile copies the contents of path to w.
+func streamFile(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// streamFileGzip copies the contents of path to w, gzip-compressed.
+func streamFileGzip(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(w)
+	if _, err := io.Copy(gw, f); err != nil {
+		gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+// ServeHTTP implements the /_/image endpoint: given "mac", optional
+// "arch" (defaulting to ArchX64 - BMC-managed machines needing virtual
+// media are overwhelmingly x86-64 servers), and "format", it assembles
+// and streams the corresponding image. Unlike handleFile/handleIpxe,
+// the (possibly slow, external-process-invoking) assembly happens
+// entirely before any bytes reach w, so a failure partway through
+// image generation still produces a clean HTTP error response rather
+// than a truncated body.
+func (v *VirtualMediaSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	macStr := r.URL.Query().Get("mac")
+	if macStr == "" {
+		http.Error(w, "missing MAC address parameter", http.StatusBadRequest)
+		return
+	}
+	mac, err := net.ParseMAC(macStr)
+	if err != nil {
+		http.Error(w, "invalid MAC address", http.StatusBadRequest)
+		return
+	}
+
+	arch := ArchX64
+	if archStr := r.URL.Query().Get("arch"); archStr != "" {
+		i, err := strconv.Atoi(archStr)
+		if err != nil {
+			http.Error(w, "invalid architecture", http.StatusBadRequest)
+			return
+		}
+		arch = Architecture(i)
+	}
+
+	formatStr := r.URL.Query().Get("format")
+	format, ok := ParseImageFormat(formatStr)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q, want one of iso, img, img.gz, img.lz4", formatStr), http.StatusBadRequest)
+		return
+	}
+
+	tmp, err := ioutil.TempFile("", "pixiecore-vmedia-response-")
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	defer tmp.Close()
+
+	if err := v.WriteImage(r.Context(), tmp, Machine{MAC: mac, Arch: arch}, format); err != nil {
+		http.Error(w, fmt.Sprintf("assembling image: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", mac.String()+"."+string(format)))
+	http.ServeContent(w, r, "", time.Time{}, tmp)
+}